@@ -34,6 +34,14 @@ const (
 	// PatchBaseWeightCluster is the base weight for cluster patches.
 	// tsgen:PatchBaseWeightCluster
 	PatchBaseWeightCluster = 200
+	// PatchWeightManifests is the weight of the control plane inline manifests config patch generated by cluster templates.
+	PatchWeightManifests = 380
+	// PatchWeightClusterMachineNetwork is the weight of the cluster machine static network addressing config patch generated by cluster templates.
+	PatchWeightClusterMachineNetwork = 385
+	// PatchWeightMachineSetNodeSettings is the weight of the machine set node labels and taints config patch generated by cluster templates.
+	PatchWeightMachineSetNodeSettings = 390
+	// PatchWeightClusterMachineNodeSettings is the weight of the cluster machine hostname, node labels and taints config patch generated by cluster templates.
+	PatchWeightClusterMachineNodeSettings = 395
 	// PatchBaseWeightMachineSet is the base weight for machine set patches.
 	// tsgen:PatchBaseWeightMachineSet
 	PatchBaseWeightMachineSet = 400
@@ -0,0 +1,458 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package diff implements structural diff of resources.
+//
+// Resources are compared as parsed YAML trees, so formatting and key order are ignored,
+// and the changes are reported by path, e.g. `spec.data.machine.network.interfaces[0].mtu: 1500 -> 9000`.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/fatih/color"
+	"github.com/siderolabs/gen/maps"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// ChangeType is the type of the change.
+type ChangeType int
+
+// Change types.
+const (
+	Added ChangeType = iota
+	Removed
+	Modified
+)
+
+// Change describes a single change at the path.
+type Change struct {
+	Old  any
+	New  any
+	Path string
+	Type ChangeType
+}
+
+// String implements fmt.Stringer.
+func (c Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("%s: %s", c.Path, formatValue(c.New))
+	case Removed:
+		return fmt.Sprintf("%s: %s", c.Path, formatValue(c.Old))
+	case Modified:
+		return fmt.Sprintf("%s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+	default:
+		return c.Path
+	}
+}
+
+// Compute the structural diff between two resources.
+//
+// One of the resources might be nil.
+// Only labels and annotations are compared in the metadata, as other fields are managed by the state.
+// ConfigPatch data is parsed, so that the patch contents are compared structurally as well.
+// Works both with the typed resources and with the resources decoded from YAML.
+func Compute(oldR, newR resource.Resource) ([]Change, error) {
+	oldTree, err := resourceTree(oldR)
+	if err != nil {
+		return nil, err
+	}
+
+	newTree, err := resourceTree(newR)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+
+	compare("", oldTree, newTree, &changes)
+
+	return changes, nil
+}
+
+// Render outputs colorized structural diff between two resources.
+//
+// One of the resources might be nil.
+func Render(w io.Writer, oldR, newR resource.Resource) error {
+	changes, err := Compute(oldR, newR)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	oldPath, newPath := "/dev/null", "/dev/null"
+
+	if oldR != nil {
+		oldPath = resource.String(oldR)
+	}
+
+	if newR != nil {
+		newPath = resource.String(newR)
+	}
+
+	bold := color.New(color.Bold)
+	bold.Fprintf(w, "--- %s\n", oldPath) //nolint:errcheck
+	bold.Fprintf(w, "+++ %s\n", newPath) //nolint:errcheck
+
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+	yellow := color.New(color.FgYellow)
+
+	for _, change := range changes {
+		switch change.Type {
+		case Added:
+			green.Fprintf(w, "+ %s\n", change) //nolint:errcheck
+		case Removed:
+			red.Fprintf(w, "- %s\n", change) //nolint:errcheck
+		case Modified:
+			yellow.Fprintf(w, "~ %s\n", change) //nolint:errcheck
+		}
+	}
+
+	return nil
+}
+
+func resourceTree(r resource.Resource) (any, error) {
+	if r == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	spec, err := yaml.Marshal(r.Spec())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling resource %s: %w", resource.String(r), err)
+	}
+
+	var specTree any
+
+	if err = yaml.Unmarshal(spec, &specTree); err != nil {
+		return nil, fmt.Errorf("error unmarshaling resource %s: %w", resource.String(r), err)
+	}
+
+	// config patch data is a YAML document stored as a string, parse it to compare the patch contents
+	if spec, ok := specTree.(map[string]any); ok && r.Metadata().Type() == omni.ConfigPatchType {
+		if data, ok := spec["data"].(string); ok {
+			if spec["data"], err = parseDocuments(data); err != nil {
+				return nil, fmt.Errorf("error parsing config patch %s: %w", resource.String(r), err)
+			}
+
+			if err = expandInlineManifests(spec["data"]); err != nil {
+				return nil, fmt.Errorf("error parsing inline manifests of config patch %s: %w", resource.String(r), err)
+			}
+		}
+	}
+
+	annotations := maps.Filter(r.Metadata().Annotations().Raw(), func(k, _ string) bool {
+		return k != omni.LastAppliedTemplateHash
+	})
+
+	return map[string]any{
+		"metadata": map[string]any{
+			"labels":      toAnyMap(r.Metadata().Labels().Raw()),
+			"annotations": toAnyMap(annotations),
+		},
+		"spec": specTree,
+	}, nil
+}
+
+// parseDocuments parses multi-document YAML, single document is returned as is.
+func parseDocuments(data string) (any, error) {
+	dec := yaml.NewDecoder(strings.NewReader(data))
+
+	var docs []any
+
+	for {
+		var doc any
+
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF { //nolint:errorlint
+				break
+			}
+
+			return nil, err
+		}
+
+		docs = append(docs, doc)
+	}
+
+	if len(docs) == 1 {
+		return docs[0], nil
+	}
+
+	return docs, nil
+}
+
+// expandInlineManifests replaces the contents of the inline manifests in the parsed config patch with the objects keyed by ObjectKey,
+// so that the manifests are compared per Kubernetes object.
+func expandInlineManifests(data any) error {
+	docs, ok := data.([]any)
+	if !ok {
+		docs = []any{data}
+	}
+
+	for _, doc := range docs {
+		docMap, _ := doc.(map[string]any)
+		cluster, _ := docMap["cluster"].(map[string]any)
+		inlineManifests, _ := cluster["inlineManifests"].([]any)
+
+		for _, inlineManifest := range inlineManifests {
+			inlineManifestMap, _ := inlineManifest.(map[string]any)
+
+			contents, ok := inlineManifestMap["contents"].(string)
+			if !ok {
+				continue
+			}
+
+			objects, err := ManifestObjects(contents)
+			if err != nil {
+				return err
+			}
+
+			inlineManifestMap["contents"] = objects
+		}
+	}
+
+	return nil
+}
+
+// ManifestObjects parses multi-document Kubernetes manifests into the objects keyed by ObjectKey.
+func ManifestObjects(contents string) (map[string]any, error) {
+	dec := yaml.NewDecoder(strings.NewReader(contents))
+
+	objects := map[string]any{}
+
+	for {
+		var object map[string]any
+
+		if err := dec.Decode(&object); err != nil {
+			if err == io.EOF { //nolint:errorlint
+				break
+			}
+
+			return nil, err
+		}
+
+		if object == nil {
+			continue
+		}
+
+		objects[ObjectKey(object)] = object
+	}
+
+	return objects, nil
+}
+
+// ObjectKey identifies the Kubernetes object as kind/namespace/name, the namespace is omitted for the cluster-scoped objects.
+func ObjectKey(object map[string]any) string {
+	kind, _ := object["kind"].(string)
+	metadata, _ := object["metadata"].(map[string]any)
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+
+	if namespace == "" {
+		return kind + "/" + name
+	}
+
+	return kind + "/" + namespace + "/" + name
+}
+
+func toAnyMap(m map[string]string) any {
+	if len(m) == 0 {
+		return nil
+	}
+
+	result := make(map[string]any, len(m))
+
+	for k, v := range m {
+		result[k] = v
+	}
+
+	return result
+}
+
+func compare(path string, oldValue, newValue any, changes *[]Change) {
+	// added or removed maps are compared with an empty map, so that the changes are listed by path
+	if _, ok := newValue.(map[string]any); ok && oldValue == nil {
+		oldValue = map[string]any{}
+	}
+
+	if _, ok := oldValue.(map[string]any); ok && newValue == nil {
+		newValue = map[string]any{}
+	}
+
+	switch {
+	case oldValue == nil && newValue == nil:
+		return
+	case oldValue == nil:
+		*changes = append(*changes, Change{Path: path, New: newValue, Type: Added})
+
+		return
+	case newValue == nil:
+		*changes = append(*changes, Change{Path: path, Old: oldValue, Type: Removed})
+
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+
+	if oldIsMap && newIsMap {
+		keys := maps.Keys(oldMap)
+
+		for k := range newMap {
+			if _, ok := oldMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			compare(joinPath(path, k), oldMap[k], newMap[k], changes)
+		}
+
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]any)
+	newList, newIsList := newValue.([]any)
+
+	if oldIsList && newIsList {
+		compareLists(path, oldList, newList, changes)
+
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, Change{Path: path, Old: oldValue, New: newValue, Type: Modified})
+	}
+}
+
+// listKeyFields are the fields which identify the items of the lists in the config, e.g. the network interfaces and the inline manifests.
+var listKeyFields = []string{"name", "interface", "deviceSelector"}
+
+// compareLists matches the list items by key, so that inserting or removing an item doesn't report the following items as changed.
+//
+// The items are reported by the index in the new list, and the removed items by the index in the old list.
+// Lists with the items without a key, or with duplicate keys, are compared by index.
+func compareLists(path string, oldList, newList []any, changes *[]Change) {
+	oldKeys, oldIndex, oldKeyed := listKeys(oldList)
+	newKeys, newIndex, newKeyed := listKeys(newList)
+
+	if !oldKeyed || !newKeyed {
+		for i := range max(len(oldList), len(newList)) {
+			var o, n any
+
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+
+			if i < len(newList) {
+				n = newList[i]
+			}
+
+			compare(fmt.Sprintf("%s[%d]", path, i), o, n, changes)
+		}
+
+		return
+	}
+
+	for i, n := range newList {
+		var o any
+
+		if j, ok := oldIndex[newKeys[i]]; ok {
+			o = oldList[j]
+		}
+
+		compare(fmt.Sprintf("%s[%d]", path, i), o, n, changes)
+	}
+
+	for j, o := range oldList {
+		if _, ok := newIndex[oldKeys[j]]; !ok {
+			compare(fmt.Sprintf("%s[%d]", path, j), o, nil, changes)
+		}
+	}
+}
+
+// listKeys returns the keys of the list items and the index of each key, the scalar items are keyed by the value.
+//
+// The last return value is false if some items can't be matched by key.
+func listKeys(list []any) ([]string, map[string]int, bool) {
+	keys := make([]string, 0, len(list))
+	index := make(map[string]int, len(list))
+
+	for i, item := range list {
+		key, ok := listItemKey(item)
+		if !ok {
+			return nil, nil, false
+		}
+
+		if _, duplicate := index[key]; duplicate {
+			return nil, nil, false
+		}
+
+		keys = append(keys, key)
+		index[key] = i
+	}
+
+	return keys, index, true
+}
+
+func listItemKey(item any) (string, bool) {
+	switch item := item.(type) {
+	case map[string]any:
+		for _, field := range listKeyFields {
+			if value, ok := item[field]; ok {
+				return field + "=" + formatValue(value), true
+			}
+		}
+
+		return "", false
+	case []any, nil:
+		return "", false
+	default:
+		return formatValue(item), true
+	}
+}
+
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, "./[]") {
+		key = fmt.Sprintf("[%q]", key)
+
+		return path + key
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func formatValue(v any) string {
+	switch v.(type) {
+	case map[string]any, []any:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+
+		return string(raw)
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,249 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package diff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cosi-project/runtime/pkg/resource/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/diff"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+func TestCompute(t *testing.T) {
+	oldPatch := omni.NewConfigPatch(resources.DefaultNamespace, "400-patch")
+	oldPatch.Metadata().Labels().Set(omni.LabelCluster, "my-cluster")
+	oldPatch.Metadata().Annotations().Set(omni.LastAppliedTemplateHash, "abc")
+	oldPatch.TypedSpec().Value.Data = `machine:
+  network:
+    hostname: foo
+    interfaces:
+      - interface: eth0
+        mtu: 1500
+`
+
+	// same contents with different formatting and key order
+	samePatch := omni.NewConfigPatch(resources.DefaultNamespace, "400-patch")
+	samePatch.Metadata().Labels().Set(omni.LabelCluster, "my-cluster")
+	samePatch.TypedSpec().Value.Data = `machine:
+    network:
+        interfaces: [{mtu: 1500, interface: eth0}]
+        hostname: foo
+`
+
+	changes, err := diff.Compute(oldPatch, samePatch)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	newPatch := omni.NewConfigPatch(resources.DefaultNamespace, "400-patch")
+	newPatch.Metadata().Labels().Set(omni.LabelCluster, "my-cluster")
+	newPatch.TypedSpec().Value.Data = `machine:
+  network:
+    interfaces:
+      - interface: eth0
+        mtu: 9000
+  install:
+    disk: /dev/vda
+`
+
+	changes, err = diff.Compute(oldPatch, newPatch)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`spec.data.machine.install.disk: "/dev/vda"`,
+		`spec.data.machine.network.hostname: "foo"`,
+		`spec.data.machine.network.interfaces[0].mtu: 1500 -> 9000`,
+	}, changesToStrings(changes))
+
+	assert.Equal(t, []diff.ChangeType{diff.Added, diff.Removed, diff.Modified}, changeTypes(changes))
+
+	// resources decoded from YAML are compared the same way as typed resources
+	raw, err := yaml.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"namespace": resources.DefaultNamespace,
+			"type":      omni.ConfigPatchType,
+			"id":        "400-patch",
+			"version":   1,
+			"phase":     "running",
+			"labels":    map[string]string{omni.LabelCluster: "my-cluster"},
+		},
+		"spec": map[string]any{
+			"data": newPatch.TypedSpec().Value.Data,
+		},
+	})
+	require.NoError(t, err)
+
+	var decoded protobuf.YAMLResource
+
+	require.NoError(t, yaml.Unmarshal(raw, &decoded))
+
+	changes, err = diff.Compute(newPatch, decoded.Resource())
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestComputeInlineManifests(t *testing.T) {
+	manifestsPatch := func(contents string) *omni.ConfigPatch {
+		patch := omni.NewConfigPatch(resources.DefaultNamespace, "380-manifests")
+
+		raw, err := yaml.Marshal(map[string]any{
+			"cluster": map[string]any{
+				"inlineManifests": []map[string]any{{"name": "apps", "contents": contents}},
+			},
+		})
+		require.NoError(t, err)
+
+		patch.TypedSpec().Value.Data = string(raw)
+
+		return patch
+	}
+
+	oldPatch := manifestsPatch(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: apps
+data:
+  level: info
+`)
+
+	// objects are reordered, one is modified, one is added
+	newPatch := manifestsPatch(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: apps
+  name: settings
+data:
+  level: debug
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: runner
+  namespace: apps
+`)
+
+	changes, err := diff.Compute(oldPatch, newPatch)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`spec.data.cluster.inlineManifests[0].contents["ConfigMap/apps/settings"].data.level: "info" -> "debug"`,
+		`spec.data.cluster.inlineManifests[0].contents["ServiceAccount/apps/runner"].apiVersion: "v1"`,
+		`spec.data.cluster.inlineManifests[0].contents["ServiceAccount/apps/runner"].kind: "ServiceAccount"`,
+		`spec.data.cluster.inlineManifests[0].contents["ServiceAccount/apps/runner"].metadata.name: "runner"`,
+		`spec.data.cluster.inlineManifests[0].contents["ServiceAccount/apps/runner"].metadata.namespace: "apps"`,
+	}, changesToStrings(changes))
+}
+
+func TestComputeLists(t *testing.T) {
+	patch := func(data string) *omni.ConfigPatch {
+		patch := omni.NewConfigPatch(resources.DefaultNamespace, "400-patch")
+		patch.TypedSpec().Value.Data = data
+
+		return patch
+	}
+
+	oldPatch := patch(`machine:
+  certSANs: [a.example.com, b.example.com]
+  network:
+    interfaces:
+      - interface: eth0
+        mtu: 1500
+      - deviceSelector:
+          hardwareAddr: "00:11:22:*"
+        dhcp: true
+      - interface: eth2
+        mtu: 1500
+`)
+
+	// items are inserted at the front and removed, the matching items are compared by key regardless of the position
+	newPatch := patch(`machine:
+  certSANs: [c.example.com, a.example.com, b.example.com]
+  network:
+    interfaces:
+      - interface: eth1
+        mtu: 1500
+      - interface: eth0
+        mtu: 9000
+      - deviceSelector:
+          hardwareAddr: "00:11:22:*"
+        dhcp: true
+`)
+
+	changes, err := diff.Compute(oldPatch, newPatch)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`spec.data.machine.certSANs[0]: "c.example.com"`,
+		`spec.data.machine.network.interfaces[0].interface: "eth1"`,
+		`spec.data.machine.network.interfaces[0].mtu: 1500`,
+		`spec.data.machine.network.interfaces[1].mtu: 1500 -> 9000`,
+		`spec.data.machine.network.interfaces[2].interface: "eth2"`,
+		`spec.data.machine.network.interfaces[2].mtu: 1500`,
+	}, changesToStrings(changes))
+
+	assert.Equal(t, []diff.ChangeType{diff.Added, diff.Added, diff.Added, diff.Modified, diff.Removed, diff.Removed}, changeTypes(changes))
+
+	// items without a key are compared by index
+	changes, err = diff.Compute(
+		patch("machine:\n  network:\n    extraHostEntries: [{ip: 10.0.0.1, aliases: [a]}]\n"),
+		patch("machine:\n  network:\n    extraHostEntries: [{ip: 10.0.0.2, aliases: [a]}]\n"),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`spec.data.machine.network.extraHostEntries[0].ip: "10.0.0.1" -> "10.0.0.2"`,
+	}, changesToStrings(changes))
+}
+
+func TestRender(t *testing.T) {
+	patch := omni.NewConfigPatch(resources.DefaultNamespace, "400-patch")
+	patch.TypedSpec().Value.Data = "machine:\n  network:\n    hostname: foo\n"
+
+	var sb strings.Builder
+
+	require.NoError(t, diff.Render(&sb, patch, patch))
+	assert.Empty(t, sb.String())
+
+	require.NoError(t, diff.Render(&sb, nil, patch))
+	assert.Contains(t, sb.String(), "--- /dev/null")
+	assert.Contains(t, sb.String(), `+ spec.data.machine.network.hostname: "foo"`)
+}
+
+func changesToStrings(changes []diff.Change) []string {
+	result := make([]string, 0, len(changes))
+
+	for _, change := range changes {
+		result = append(result, change.String())
+	}
+
+	return result
+}
+
+func changeTypes(changes []diff.Change) []diff.ChangeType {
+	result := make([]diff.ChangeType, 0, len(changes))
+
+	for _, change := range changes {
+		result = append(result, change.Type)
+	}
+
+	return result
+}
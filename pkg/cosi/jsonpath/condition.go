@@ -0,0 +1,212 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package jsonpath implements wait conditions over JSONPath query results, e.g. {.spec.phase}=Done.
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Operator compares the query results with the value of the condition.
+type Operator string
+
+// Supported operators, the ordering operators compare numbers.
+const (
+	OpExists         Operator = ""
+	OpEqual          Operator = "="
+	OpNotEqual       Operator = "!="
+	OpGreater        Operator = ">"
+	OpGreaterOrEqual Operator = ">="
+	OpLess           Operator = "<"
+	OpLessOrEqual    Operator = "<="
+)
+
+// operators in the order of matching, longer first.
+var operators = []Operator{OpNotEqual, OpGreaterOrEqual, OpLessOrEqual, "==", OpEqual, OpGreater, OpLess}
+
+// Condition is a JSONPath expression compared with a value.
+//
+// The condition holds if the expression has at least one result, and all results match the value.
+// Without the operator, all results should be present and not empty, false or zero.
+type Condition struct {
+	expr *jsonpath.JSONPath
+
+	Path  string
+	Op    Operator
+	Value string
+}
+
+// ParseCondition parses the condition in the form <expr>[<op><value>], e.g. {.phase}=Done or .machines.healthy>=3.
+//
+// The expression may omit the braces, then it ends at the first operator.
+func ParseCondition(s string) (*Condition, error) {
+	var path, rest string
+
+	if strings.HasPrefix(s, "{") {
+		end := closingBrace(s)
+		if end < 0 {
+			return nil, fmt.Errorf("unbalanced braces in jsonpath condition %q", s)
+		}
+
+		path, rest = s[:end+1], s[end+1:]
+	} else {
+		end := strings.IndexAny(s, "=!<>")
+		if end < 0 {
+			end = len(s)
+		}
+
+		path, rest = "{"+s[:end]+"}", s[end:]
+	}
+
+	condition := &Condition{
+		Path: path,
+	}
+
+	if rest != "" {
+		for _, op := range operators {
+			if strings.HasPrefix(rest, string(op)) {
+				condition.Op, condition.Value = op, rest[len(op):]
+
+				break
+			}
+		}
+
+		if condition.Op == "==" {
+			condition.Op = OpEqual
+		}
+
+		if condition.Op == OpExists {
+			return nil, fmt.Errorf("unexpected %q after the jsonpath expression in condition %q", rest, s)
+		}
+	}
+
+	switch condition.Op { //nolint:exhaustive
+	case OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual:
+		if _, err := strconv.ParseFloat(condition.Value, 64); err != nil {
+			return nil, fmt.Errorf("operator %q requires a number, got %q", condition.Op, condition.Value)
+		}
+	}
+
+	condition.expr = jsonpath.New("condition").AllowMissingKeys(true)
+
+	if err := condition.expr.Parse(condition.Path); err != nil {
+		return nil, fmt.Errorf("error parsing jsonpath %q: %w", condition.Path, err)
+	}
+
+	return condition, nil
+}
+
+// String implements fmt.Stringer.
+func (condition *Condition) String() string {
+	return condition.Path + string(condition.Op) + condition.Value
+}
+
+// Matches evaluates the condition against the data, which should be decoded JSON (maps, slices and scalars).
+func (condition *Condition) Matches(data any) (bool, error) {
+	results, err := condition.expr.FindResults(data)
+	if err != nil {
+		return false, fmt.Errorf("error evaluating jsonpath %q: %w", condition.Path, err)
+	}
+
+	found := false
+
+	for _, group := range results {
+		for _, result := range group {
+			found = true
+
+			if !condition.matchValue(result) {
+				return false, nil
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// Normalize converts the value to decoded JSON, so that the JSON field names are used in the expressions.
+func Normalize(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var data any
+
+	if err = json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (condition *Condition) matchValue(result reflect.Value) bool {
+	if result.Kind() == reflect.Interface {
+		if result.IsNil() {
+			return false
+		}
+
+		result = result.Elem()
+	}
+
+	if condition.Op == OpExists {
+		return !result.IsZero()
+	}
+
+	actual := fmt.Sprint(result.Interface())
+
+	actualNumber, actualErr := strconv.ParseFloat(actual, 64)
+	expectedNumber, expectedErr := strconv.ParseFloat(condition.Value, 64)
+	numbers := actualErr == nil && expectedErr == nil
+
+	switch condition.Op { //nolint:exhaustive
+	case OpEqual:
+		return actual == condition.Value || (numbers && actualNumber == expectedNumber)
+	case OpNotEqual:
+		return actual != condition.Value && (!numbers || actualNumber != expectedNumber)
+	}
+
+	if !numbers {
+		return false
+	}
+
+	switch condition.Op { //nolint:exhaustive
+	case OpGreater:
+		return actualNumber > expectedNumber
+	case OpGreaterOrEqual:
+		return actualNumber >= expectedNumber
+	case OpLess:
+		return actualNumber < expectedNumber
+	case OpLessOrEqual:
+		return actualNumber <= expectedNumber
+	}
+
+	return false
+}
+
+// closingBrace returns the index of the brace closing the first one, or -1.
+func closingBrace(s string) int {
+	depth := 0
+
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package jsonpath_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/jsonpath"
+)
+
+func TestCondition(t *testing.T) {
+	data, err := jsonpath.Normalize(map[string]any{
+		"phase": "Done",
+		"ready": true,
+		"machineSets": []map[string]any{
+			{"id": "workers", "counts": map[string]any{"healthy": 3}, "machines": []map[string]any{{"talosVersion": "1.6.4"}, {"talosVersion": "1.6.4"}}},
+			{"id": "workers-gpu", "counts": map[string]any{"healthy": 5}, "machines": []map[string]any{{"talosVersion": "1.6.3"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		condition string
+		expected  bool
+	}{
+		{condition: "{.phase}=Done", expected: true},
+		{condition: ".phase==Done", expected: true},
+		{condition: ".phase!=Done", expected: false},
+		{condition: ".ready", expected: true},
+		{condition: ".ready=true", expected: true},
+		{condition: ".missing", expected: false},
+		{condition: ".missing!=foo", expected: false},
+		{condition: `{.machineSets[?(@.id=="workers-gpu")].counts.healthy}>=5`, expected: true},
+		{condition: `{.machineSets[?(@.id=="workers")].counts.healthy}>3`, expected: false},
+		{condition: `{.machineSets[?(@.id=="workers")].counts.healthy}=3.0`, expected: true},
+		{condition: "{.machineSets[*].counts.healthy}<10", expected: true},
+		{condition: `{.machineSets[?(@.id=="workers")].machines[*].talosVersion}=1.6.4`, expected: true},
+		{condition: "{.machineSets[*].machines[*].talosVersion}=1.6.4", expected: false},
+	} {
+		t.Run(tt.condition, func(t *testing.T) {
+			condition, err := jsonpath.ParseCondition(tt.condition)
+			require.NoError(t, err)
+
+			matches, err := condition.Matches(data)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, matches)
+		})
+	}
+
+	for _, tt := range []struct {
+		condition     string
+		expectedError string
+	}{
+		{condition: "{.phase", expectedError: `unbalanced braces in jsonpath condition "{.phase"`},
+		{condition: "{.phase}Done", expectedError: `unexpected "Done" after the jsonpath expression in condition "{.phase}Done"`},
+		{condition: ".healthy>=five", expectedError: `operator ">=" requires a number, got "five"`},
+		{condition: "{.phase[}", expectedError: `error parsing jsonpath "{.phase[}"`},
+	} {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := jsonpath.ParseCondition(tt.condition)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
@@ -13,6 +13,18 @@ const (
 	// tsgen:ResourceManagedByClusterTemplates
 	ResourceManagedByClusterTemplates = SystemLabelPrefix + "managed-by-cluster-templates"
 
+	// LastAppliedTemplateHash is an annotation which contains the hash of the resource contents as they were last applied by cluster templates.
+	// tsgen:LastAppliedTemplateHash
+	LastAppliedTemplateHash = SystemLabelPrefix + "last-applied-template-hash"
+
+	// TemplateHostnamePattern is an annotation which contains the hostname pattern the hostname config patch was generated from by cluster templates.
+	// tsgen:TemplateHostnamePattern
+	TemplateHostnamePattern = SystemLabelPrefix + "template-hostname-pattern"
+
+	// TemplateHostnameIndex is an annotation which contains the machine index the hostname config patch was generated with by cluster templates.
+	// tsgen:TemplateHostnameIndex
+	TemplateHostnameIndex = SystemLabelPrefix + "template-hostname-index"
+
 	// ConfigPatchName human readable patch name.
 	// tsgen:ConfigPatchName
 	ConfigPatchName = "name"
@@ -21,9 +21,15 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/cosi/diff"
 	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
 )
 
+const (
+	diffFormatText       = "text"
+	diffFormatStructural = "structural"
+)
+
 var applyCmdFlags struct {
 	resFile string
 	options options
@@ -34,6 +40,14 @@ var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Create or update resource using YAML file as an input",
 	Args:  cobra.NoArgs,
+	PreRunE: func(*cobra.Command, []string) error {
+		switch applyCmdFlags.options.diffFormat {
+		case diffFormatText, diffFormatStructural:
+			return nil
+		default:
+			return fmt.Errorf("unknown diff format %q", applyCmdFlags.options.diffFormat)
+		}
+	},
 	RunE: func(*cobra.Command, []string) error {
 		yamlRaw, err := os.ReadFile(applyCmdFlags.resFile)
 		if err != nil {
@@ -96,8 +110,9 @@ func applyConfig(yamlRaw []byte) func(ctx context.Context, client *client.Client
 }
 
 type options struct {
-	dryRun  bool
-	verbose bool
+	diffFormat string
+	dryRun     bool
+	verbose    bool
 }
 
 func createResource(ctx context.Context, st state.State, res resource.Resource, opts options) error {
@@ -122,7 +137,15 @@ func createResource(ctx context.Context, st state.State, res resource.Resource,
 }
 
 func updateResource(ctx context.Context, st state.State, got resource.Resource, res resource.Resource, opts options) error {
-	if opts.verbose {
+	if opts.verbose && opts.diffFormat == diffFormatStructural {
+		fmt.Printf("Updating resource '%s'\n\n", res.Metadata().ID())
+
+		if err := diff.Render(os.Stdout, got, res); err != nil {
+			return fmt.Errorf("failed to diff resource '%s' '%s': %w", res.Metadata().ID(), res.Metadata().Type(), err)
+		}
+
+		fmt.Println()
+	} else if opts.verbose {
 		outGot, err := marshalResource(got)
 		if err != nil {
 			return err
@@ -169,6 +192,7 @@ func marshalResource(res resource.Resource) (string, error) {
 func init() {
 	applyCmd.PersistentFlags().StringVarP(&applyCmdFlags.resFile, "file", "f", "", "Resource file to load and apply")
 	applyCmd.PersistentFlags().BoolVarP(&applyCmdFlags.options.verbose, "verbose", "v", false, "Verbose output")
+	applyCmd.PersistentFlags().StringVar(&applyCmdFlags.options.diffFormat, "diff-format", diffFormatText, "Diff format for the verbose output (text, structural)")
 	applyCmd.PersistentFlags().BoolVarP(&applyCmdFlags.options.dryRun, "dry-run", "d", false, "Dry run, implies verbose")
 	ensure.NoError(applyCmd.MarkPersistentFlagRequired("file"))
 
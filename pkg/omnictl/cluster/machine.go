@@ -6,17 +6,13 @@ package cluster
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/cosi-project/runtime/pkg/resource"
-	"github.com/cosi-project/runtime/pkg/safe"
-	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/spf13/cobra"
 
 	"github.com/siderolabs/omni-client/pkg/client"
-	"github.com/siderolabs/omni-client/pkg/omni/resources"
-	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/machine"
 )
 
 var lockCmd = &cobra.Command{
@@ -41,26 +37,7 @@ var unlockCmd = &cobra.Command{
 
 func setLocked(machineID resource.ID, lock bool) func(context.Context, *client.Client) error {
 	return func(ctx context.Context, client *client.Client) error {
-		st := client.Omni().State()
-
-		machineSetNode, err := safe.StateGet[*omni.MachineSetNode](ctx, st, resource.NewMetadata(resources.DefaultNamespace, omni.MachineSetNodeType, machineID, resource.VersionUndefined))
-		if err != nil {
-			if state.IsNotFoundError(err) {
-				fmt.Printf("no machine set nodes with id %q found", machineID)
-			}
-		}
-
-		_, err = safe.StateUpdateWithConflicts(ctx, st, machineSetNode.Metadata(), func(res *omni.MachineSetNode) error {
-			if lock {
-				res.Metadata().Annotations().Set(omni.MachineLocked, "")
-			} else {
-				res.Metadata().Annotations().Delete(omni.MachineLocked)
-			}
-
-			return nil
-		})
-
-		return err
+		return machine.SetLocked(ctx, client.Omni().State(), machineID, lock)
 	}
 }
 
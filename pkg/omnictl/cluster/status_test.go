@@ -0,0 +1,132 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+// statusState creates a running cluster with a single control plane machine.
+func statusState(ctx context.Context, t *testing.T) state.State {
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	clusterStatus := omni.NewClusterStatus(resources.DefaultNamespace, "prod")
+	clusterStatus.TypedSpec().Value.Phase = specs.ClusterStatusSpec_RUNNING
+	clusterStatus.TypedSpec().Value.Ready = true
+	clusterStatus.TypedSpec().Value.KubernetesAPIReady = true
+	clusterStatus.TypedSpec().Value.ControlplaneReady = true
+	clusterStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 1, Healthy: 1, Connected: 1, Requested: 1}
+
+	machineSetStatus := omni.NewMachineSetStatus(resources.DefaultNamespace, omni.ControlPlanesResourceID("prod"))
+	machineSetStatus.Metadata().Labels().Set(omni.LabelCluster, "prod")
+	machineSetStatus.Metadata().Labels().Set(omni.LabelControlPlaneRole, "")
+	machineSetStatus.TypedSpec().Value.Phase = specs.MachineSetPhase_Running
+	machineSetStatus.TypedSpec().Value.Ready = true
+	machineSetStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 1, Healthy: 1, Connected: 1, Requested: 1}
+
+	clusterMachineStatus := omni.NewClusterMachineStatus(resources.DefaultNamespace, "machine")
+	clusterMachineStatus.Metadata().Labels().Set(omni.LabelCluster, "prod")
+	clusterMachineStatus.Metadata().Labels().Set(omni.LabelMachineSet, omni.ControlPlanesResourceID("prod"))
+	clusterMachineStatus.Metadata().Labels().Set(omni.MachineStatusLabelConnected, "")
+	clusterMachineStatus.TypedSpec().Value.Stage = specs.ClusterMachineStatusSpec_RUNNING
+	clusterMachineStatus.TypedSpec().Value.Ready = true
+	clusterMachineStatus.TypedSpec().Value.ConfigUpToDate = true
+	clusterMachineStatus.TypedSpec().Value.ConfigApplyStatus = specs.ConfigApplyStatus_APPLIED
+
+	require.NoError(t, st.Create(ctx, clusterStatus))
+	require.NoError(t, st.Create(ctx, machineSetStatus))
+	require.NoError(t, st.Create(ctx, clusterMachineStatus))
+
+	return st
+}
+
+// runStatus parses the flags of the status command and runs it against the state.
+func runStatus(ctx context.Context, t *testing.T, st state.State, args ...string) (string, error) {
+	t.Helper()
+
+	statusCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if sliceValue, ok := f.Value.(pflag.SliceValue); ok {
+			require.NoError(t, sliceValue.Replace(nil))
+		} else {
+			require.NoError(t, f.Value.Set(f.DefValue))
+		}
+
+		f.Changed = false
+	})
+
+	require.NoError(t, statusCmd.ParseFlags(args))
+
+	var out strings.Builder
+
+	err := status(ctx, st, &out, "prod")
+
+	return out.String(), err
+}
+
+func TestStatusOutput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	out, err := runStatus(ctx, t, st, "-o", "json", "--wait", "0")
+	require.NoError(t, err)
+
+	var doc operations.StatusDocument
+
+	require.NoError(t, json.Unmarshal([]byte(out), &doc))
+
+	assert.Equal(t, "prod", doc.Cluster)
+	assert.Equal(t, operations.ClusterConditionReady, doc.Condition)
+	require.Len(t, doc.MachineSets, 1)
+
+	_, err = runStatus(ctx, t, st, "-o", "xml", "--wait", "0")
+	require.EqualError(t, err, `unknown status format "xml"`)
+}
+
+func TestStatusFor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	_, err := runStatus(ctx, t, st, "-o", "json", "--wait", "0", "--for", "jsonpath={.machineSets[*].counts.healthy}=1", "--for", "condition=ready")
+	require.NoError(t, err)
+
+	out, err := runStatus(ctx, t, st, "-o", "json", "--wait", "0", "--for", "jsonpath={.machineSets[*].counts.healthy}>=2")
+
+	var statusErr *operations.StatusError
+
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, operations.StatusExitCodeNotReady, statusErr.ExitCode())
+	assert.Equal(t, []string{"jsonpath={.machineSets[*].counts.healthy}>=2"}, statusErr.Unmet)
+
+	var doc operations.StatusDocument
+
+	require.NoError(t, json.Unmarshal([]byte(out), &doc))
+
+	// the conditions are reset on each invocation
+	_, err = runStatus(ctx, t, st, "-o", "json", "--wait", "0")
+	require.NoError(t, err)
+
+	_, err = runStatus(ctx, t, st, "--wait", "0", "--for", "phase=Running")
+	require.EqualError(t, err, `unknown wait condition "phase=Running", expected condition=<condition>, delete or jsonpath=<expr>[<op><value>]`)
+}
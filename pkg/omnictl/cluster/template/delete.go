@@ -32,13 +32,11 @@ var deleteCmd = &cobra.Command{
 }
 
 func deleteImpl(ctx context.Context, client *client.Client) error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
-
 	return operations.DeleteTemplate(ctx, f, os.Stdout, client.Omni().State(), deleteCmdFlags.options)
 }
 
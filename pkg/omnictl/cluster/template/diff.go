@@ -15,6 +15,10 @@ import (
 	"github.com/siderolabs/omni-client/pkg/template/operations"
 )
 
+var diffCmdFlags struct {
+	format operations.DiffFormat
+}
+
 // diffCmd represents the template diff command.
 var diffCmd = &cobra.Command{
 	Use:     "diff",
@@ -28,17 +32,19 @@ var diffCmd = &cobra.Command{
 }
 
 func diff(ctx context.Context, client *client.Client) error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
-
-	return operations.DiffTemplate(ctx, f, os.Stdout, client.Omni().State())
+	return operations.DiffTemplate(ctx, f, os.Stdout, client.Omni().State(), operations.DiffOptions{
+		Format: diffCmdFlags.format,
+	})
 }
 
 func init() {
 	addRequiredFileFlag(diffCmd)
+	diffCmdFlags.format = operations.DiffFormatText
+	diffCmd.Flags().Var(&diffCmdFlags.format, "diff-format", "diff format (text, structural)")
 	templateCmd.AddCommand(diffCmd)
 }
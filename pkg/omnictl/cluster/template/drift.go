@@ -0,0 +1,47 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+var driftCmdFlags struct {
+	options operations.DriftOptions
+}
+
+// driftCmd represents the template drift command.
+var driftCmd = &cobra.Command{
+	Use:     "drift",
+	Short:   "Show resources which were modified outside of the template.",
+	Long:    `Compare the template, the last applied template state and the existing resources to find out which changes come from the template and which were made outside of it. This command requires API access.`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(drift)
+	},
+}
+
+func drift(ctx context.Context, client *client.Client) error {
+	f, err := openTemplate(ctx)
+	if err != nil {
+		return err
+	}
+
+	return operations.DriftTemplate(ctx, f, os.Stdout, client.Omni().State(), driftCmdFlags.options)
+}
+
+func init() {
+	addRequiredFileFlag(driftCmd)
+	driftCmd.PersistentFlags().BoolVarP(&driftCmdFlags.options.Verbose, "verbose", "v", false, "verbose output (show diff for each resource)")
+	templateCmd.AddCommand(driftCmd)
+}
@@ -19,52 +19,116 @@ import (
 )
 
 var exportCmdFlags struct {
-	cluster string
-	output  string
-	force   bool
+	cluster        string
+	output         string
+	outputDir      string
+	valuesOutput   string
+	blueprint      bool
+	secretKeys     []string
+	machineClasses bool
+	force          bool
+
+	secretPlaceholders bool
 }
 
 // exportCmd represents the template export command.
 var exportCmd = &cobra.Command{
 	Use:   "export cluster-name",
 	Short: "Export a cluster template from an existing cluster on Omni.",
-	Long:  `Export a cluster template from an existing cluster on Omni. This command requires API access.`,
-	Args:  cobra.NoArgs,
+	Long: `Export a cluster template from an existing cluster on Omni. This command requires API access.
+
+When --output-dir is set, the template is written to the template.yaml file in the directory, and each config patch is written
+to a separate file in the patches/ subdirectory. Patch file paths are relative to the directory, so the exported template
+should be used from within that directory.
+
+When --secret-placeholders is set, the secret values of the config patches (fields matching --secret-keys) are replaced
+with secretRef placeholders referring to the environment variables, so that the exported template can be committed.
+
+When --blueprint is set, a reusable blueprint is exported instead: the cluster name, Talos and Kubernetes versions and machine IDs
+are replaced with variables, and the values of the exported cluster are written to the --values-output file. The values file
+can be used as a starting point for new clusters, and the blueprint can be used with any template command with the --values flag.`,
+	Args: cobra.NoArgs,
 	RunE: func(*cobra.Command, []string) error {
 		return access.WithClient(export)
 	},
 }
 
 func export(ctx context.Context, client *client.Client) (err error) {
+	secretOptions := operations.SecretOptions{
+		Placeholders: exportCmdFlags.secretPlaceholders,
+		Keys:         exportCmdFlags.secretKeys,
+	}
+
+	if exportCmdFlags.outputDir != "" {
+		_, err = operations.ExportTemplateDir(ctx, client.Omni().State(), exportCmdFlags.cluster, exportCmdFlags.outputDir, operations.ExportDirOptions{
+			Force:   exportCmdFlags.force,
+			Secrets: secretOptions,
+		})
+
+		return err
+	}
+
 	output := os.Stdout
 
 	if exportCmdFlags.output != "" {
-		var openErr error
-
-		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
-		if exportCmdFlags.force {
-			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if output, err = openOutput(exportCmdFlags.output); err != nil {
+			return err
 		}
 
-		output, openErr = os.OpenFile(exportCmdFlags.output, flags, 0o644)
+		defer func() { err = errors.Join(err, output.Close()) }()
+	}
+
+	if exportCmdFlags.blueprint {
+		values, openErr := openOutput(exportCmdFlags.valuesOutput)
 		if openErr != nil {
-			return fmt.Errorf("failed to open output file: %w", openErr)
+			return openErr
 		}
 
-		defer func() { err = errors.Join(err, output.Close()) }()
+		defer func() { err = errors.Join(err, values.Close()) }()
+
+		return operations.ExportBlueprint(ctx, client.Omni().State(), exportCmdFlags.cluster, output, values, operations.BlueprintOptions{
+			MachineClasses: exportCmdFlags.machineClasses,
+			Secrets:        secretOptions,
+		})
 	}
 
-	_, err = operations.ExportTemplate(ctx, client.Omni().State(), exportCmdFlags.cluster, output)
+	_, err = operations.ExportTemplateWithOptions(ctx, client.Omni().State(), exportCmdFlags.cluster, output, operations.ExportOptions{
+		Secrets: secretOptions,
+	})
 
 	return err
 }
 
+func openOutput(path string) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if exportCmdFlags.force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+
+	return f, nil
+}
+
 func init() {
 	exportCmd.Flags().StringVarP(&exportCmdFlags.cluster, "cluster", "c", "", "cluster name")
 	exportCmd.Flags().StringVarP(&exportCmdFlags.output, "output", "o", "", "output file (default: stdout)")
+	exportCmd.Flags().StringVarP(&exportCmdFlags.outputDir, "output-dir", "d", "", "output directory, config patches are written to separate files")
+	exportCmd.Flags().BoolVar(&exportCmdFlags.blueprint, "blueprint", false, "export a reusable blueprint with variables instead of a template")
+	exportCmd.Flags().StringVar(&exportCmdFlags.valuesOutput, "values-output", "", "output file for the blueprint values")
+	exportCmd.Flags().BoolVar(&exportCmdFlags.machineClasses, "machine-classes", false, "convert static machine lists to machine class selectors in the blueprint")
+	exportCmd.Flags().BoolVar(&exportCmdFlags.secretPlaceholders, "secret-placeholders", false, "replace the secret values of the config patches with secretRef placeholders")
+	exportCmd.Flags().StringSliceVar(&exportCmdFlags.secretKeys, "secret-keys", operations.DefaultSecretKeys, "glob patterns of the secret field names (case-insensitive)")
 	exportCmd.Flags().BoolVarP(&exportCmdFlags.force, "force", "f", false, "overwrite output file if it exists")
 
 	ensure.NoError(exportCmd.MarkFlagRequired("cluster"))
 
+	exportCmd.MarkFlagsMutuallyExclusive("output", "output-dir")
+	exportCmd.MarkFlagsMutuallyExclusive("blueprint", "output-dir")
+	exportCmd.MarkFlagsRequiredTogether("blueprint", "values-output")
+
 	templateCmd.AddCommand(exportCmd)
 }
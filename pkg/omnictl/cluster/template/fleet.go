@@ -0,0 +1,172 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/siderolabs/gen/ensure"
+	"github.com/spf13/cobra"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	clustertemplate "github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+var fleetCmdFlags struct {
+	// Path to the fleet template file or directory.
+	path string
+
+	// Variables of the Jsonnet fleet template.
+	jsonnet clustertemplate.JsonnetOptions
+
+	options operations.FleetOptions
+}
+
+var fleetSyncCmdFlags struct {
+	options operations.SyncOptions
+}
+
+var fleetDiffCmdFlags struct {
+	format operations.DiffFormat
+}
+
+var fleetStatusCmdFlags struct {
+	options operations.StatusOptions
+	wait    time.Duration
+}
+
+// fleetCmd represents the template fleet sub-command.
+var fleetCmd = &cobra.Command{
+	Use:   "fleet",
+	Short: "Multi-cluster template management subcommands.",
+	Long: `Commands to manage many clusters with a single template file or a directory of template files.
+Each Cluster document starts a new cluster, the documents following it belong to that cluster.`,
+	Example: "",
+}
+
+// fleetSyncCmd represents the template fleet sync command.
+var fleetSyncCmd = &cobra.Command{
+	Use:     "sync",
+	Short:   "Apply fleet template to the Omni.",
+	Long:    `Sync each cluster of the fleet template, see 'template sync'. A failure of one cluster doesn't stop the others. This command requires API access.`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(fleetSync)
+	},
+}
+
+// fleetDiffCmd represents the template fleet diff command.
+var fleetDiffCmd = &cobra.Command{
+	Use:     "diff",
+	Short:   "Show diff in resources if the fleet template is synced.",
+	Long:    `Show diff for each cluster of the fleet template, see 'template diff'. This command requires API access.`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(fleetDiff)
+	},
+}
+
+// fleetStatusCmd represents the template fleet status command.
+var fleetStatusCmd = &cobra.Command{
+	Use:     "status",
+	Short:   "Show the status of each cluster of the fleet template.",
+	Long:    `Show the status of each cluster of the fleet template, see 'template status'. This command requires API access.`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(fleetStatus)
+	},
+}
+
+func fleetSync(ctx context.Context, client *client.Client) error {
+	templates, err := loadFleet(ctx)
+	if err != nil {
+		return err
+	}
+
+	fleetSyncCmdFlags.options.SchematicResolver = client.Management()
+
+	_, err = operations.FleetSync(ctx, templates, os.Stdout, client.Omni().State(), fleetCmdFlags.options, fleetSyncCmdFlags.options)
+
+	return err
+}
+
+func fleetDiff(ctx context.Context, client *client.Client) error {
+	templates, err := loadFleet(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = operations.FleetDiff(ctx, templates, os.Stdout, client.Omni().State(), fleetCmdFlags.options, operations.DiffOptions{
+		Format: fleetDiffCmdFlags.format,
+	})
+
+	return err
+}
+
+func fleetStatus(ctx context.Context, client *client.Client) error {
+	templates, err := loadFleet(ctx)
+	if err != nil {
+		return err
+	}
+
+	fleetStatusCmdFlags.options.Wait = fleetStatusCmdFlags.wait > 0
+
+	if fleetStatusCmdFlags.options.Wait {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, fleetStatusCmdFlags.wait)
+		defer cancel()
+	}
+
+	_, err = operations.FleetStatus(ctx, templates, os.Stdout, client.Omni().State(), fleetCmdFlags.options, fleetStatusCmdFlags.options)
+
+	return err
+}
+
+// loadFleet loads the fleet template from the file or the directory.
+func loadFleet(ctx context.Context) ([]*clustertemplate.Template, error) {
+	info, err := os.Stat(fleetCmdFlags.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return clustertemplate.LoadFleetDir(ctx, fleetCmdFlags.path, fleetCmdFlags.jsonnet)
+	}
+
+	return clustertemplate.LoadFleetFile(ctx, fleetCmdFlags.path, fleetCmdFlags.jsonnet)
+}
+
+func init() {
+	fleetCmd.PersistentFlags().StringVarP(&fleetCmdFlags.path, "file", "f", "", "path to the fleet template file (YAML, JSON or .jsonnet) or a directory of YAML, JSON and .jsonnet template files.")
+	addJsonnetFlags(fleetCmd.PersistentFlags(), &fleetCmdFlags.jsonnet)
+	fleetCmd.PersistentFlags().IntVarP(&fleetCmdFlags.options.Parallelism, "parallelism", "p", operations.DefaultFleetParallelism, "number of clusters processed at once")
+	ensure.NoError(fleetCmd.MarkPersistentFlagRequired("file"))
+
+	fleetSyncCmd.Flags().BoolVarP(&fleetSyncCmdFlags.options.Verbose, "verbose", "v", false, "verbose output (show diff for each resource)")
+	fleetSyncCmdFlags.options.DiffFormat = operations.DiffFormatText
+	fleetSyncCmd.Flags().Var(&fleetSyncCmdFlags.options.DiffFormat, "diff-format", "diff format for the verbose output (text, structural)")
+	fleetSyncCmd.Flags().BoolVarP(&fleetSyncCmdFlags.options.DryRun, "dry-run", "d", false, "dry run")
+	fleetSyncCmd.Flags().BoolVar(&fleetSyncCmdFlags.options.NoRollback, "no-rollback", false, "do not roll back the applied changes if the sync of a cluster fails")
+	fleetSyncCmd.Flags().BoolVar(&fleetSyncCmdFlags.options.Rollout.Staged, "staged", false, "roll out the changes one machine set at a time, waiting for each machine set to become healthy")
+	fleetSyncCmd.Flags().BoolVar(&fleetSyncCmdFlags.options.Rollout.ControlPlaneLast, "control-plane-last", false, "roll out the control plane after the workers in the staged mode")
+	fleetSyncCmd.Flags().DurationVar(&fleetSyncCmdFlags.options.Rollout.StageTimeout, "stage-timeout", operations.DefaultStageTimeout, "deadline for each stage to become healthy in the staged mode")
+
+	fleetDiffCmdFlags.format = operations.DiffFormatText
+	fleetDiffCmd.Flags().Var(&fleetDiffCmdFlags.format, "diff-format", "diff format (text, structural)")
+
+	fleetStatusCmd.Flags().BoolVarP(&fleetStatusCmdFlags.options.Quiet, "quiet", "q", false, "suppress output")
+	fleetStatusCmd.Flags().DurationVarP(&fleetStatusCmdFlags.wait, "wait", "w", 5*time.Minute, "wait timeout, if zero, report current status and exit")
+
+	fleetCmd.AddCommand(fleetSyncCmd, fleetDiffCmd, fleetStatusCmd)
+	templateCmd.AddCommand(fleetCmd)
+}
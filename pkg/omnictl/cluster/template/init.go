@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/spf13/cobra"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+var initCmdFlags struct {
+	options     operations.InitOptions
+	output      string
+	interactive bool
+	force       bool
+}
+
+// initCmd represents the template init command.
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a new cluster template from the available machines.",
+	Long: `Create a new cluster template from the available machines. This command requires API access.
+
+The available machines are filtered with --selector, and assigned to the control plane and the workers by their hardware:
+the smallest machines with at least 2 cores and 2 GiB of memory are suggested for the control plane, and the biggest remaining
+machines for the workers. The latest stable Talos version and the latest Kubernetes version compatible with it are used by default.
+
+With --interactive, the suggested values are prompted for confirmation.`,
+	Example: `  # Create a template with 3 control planes and all remaining amd64 machines as workers.
+  omnictl cluster template init --name prod --selector omni.sidero.dev/arch=amd64 --control-planes 3 -o prod.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(initImpl)
+	},
+}
+
+func initImpl(ctx context.Context, client *client.Client) (err error) {
+	st := client.Omni().State()
+
+	reader := bufio.NewReader(os.Stdin)
+
+	if initCmdFlags.interactive && initCmdFlags.options.ClusterName == "" {
+		if initCmdFlags.options.ClusterName, err = ask(reader, "Cluster name", ""); err != nil {
+			return err
+		}
+	}
+
+	plan, err := operations.PlanInit(ctx, st, initCmdFlags.options)
+	if err != nil {
+		return err
+	}
+
+	if initCmdFlags.interactive {
+		if err = askPlan(ctx, st, reader, plan); err != nil {
+			return err
+		}
+	}
+
+	tmpl, err := plan.Template()
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+
+	if initCmdFlags.output != "" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if initCmdFlags.force {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+
+		if output, err = os.OpenFile(initCmdFlags.output, flags, 0o644); err != nil {
+			return fmt.Errorf("failed to open output file: %w", err)
+		}
+
+		defer func() { err = errors.Join(err, output.Close()) }()
+	}
+
+	return tmpl.Encode(output)
+}
+
+// askPlan prompts for each suggested value of the plan, empty answer keeps the suggestion.
+func askPlan(ctx context.Context, st state.State, reader *bufio.Reader, plan *operations.InitPlan) error {
+	fmt.Fprintf(os.Stderr, "Available Talos versions: %s\n", strings.Join(plan.TalosVersions, ", "))
+
+	talosVersion, err := ask(reader, "Talos version", plan.TalosVersion)
+	if err != nil {
+		return err
+	}
+
+	if err = plan.SetTalosVersion(ctx, st, talosVersion); err != nil {
+		return err
+	}
+
+	compatible, err := plan.CompatibleKubernetesVersions(ctx, st)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Compatible Kubernetes versions: %s\n", strings.Join(compatible, ", "))
+
+	kubernetesVersion, err := ask(reader, "Kubernetes version", plan.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	if err = plan.SetKubernetesVersion(ctx, st, kubernetesVersion); err != nil {
+		return err
+	}
+
+	machines := plan.Machines()
+
+	for {
+		printPlan(plan)
+
+		controlPlanes, err := askInt(reader, "Number of control plane machines", len(plan.ControlPlanes))
+		if err != nil {
+			return err
+		}
+
+		workers, err := askInt(reader, "Number of worker machines", len(plan.Workers))
+		if err != nil {
+			return err
+		}
+
+		if err = plan.Assign(machines, controlPlanes, workers); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+
+			continue
+		}
+
+		printPlan(plan)
+
+		confirmed, err := ask(reader, "Write the template? [y/n]", "y")
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(confirmed, "y") || strings.EqualFold(confirmed, "yes") {
+			return nil
+		}
+	}
+}
+
+func printPlan(plan *operations.InitPlan) {
+	for _, group := range []struct {
+		name     string
+		machines []operations.InitMachine
+	}{
+		{"Control plane", plan.ControlPlanes},
+		{"Workers", plan.Workers},
+		{"Unassigned", plan.Unassigned},
+	} {
+		fmt.Fprintf(os.Stderr, "%s (%d):\n", group.name, len(group.machines))
+
+		for _, machine := range group.machines {
+			fmt.Fprintf(os.Stderr, "  %s\n", machine)
+		}
+	}
+}
+
+func ask(reader *bufio.Reader, prompt, suggestion string) (string, error) {
+	for {
+		if suggestion != "" {
+			fmt.Fprintf(os.Stderr, "%s (%s): ", prompt, suggestion)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: ", prompt)
+		}
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		response = strings.TrimSpace(response)
+
+		if response == "" {
+			response = suggestion
+		}
+
+		if response != "" {
+			return response, nil
+		}
+	}
+}
+
+func askInt(reader *bufio.Reader, prompt string, suggestion int) (int, error) {
+	for {
+		response, err := ask(reader, prompt, strconv.Itoa(suggestion))
+		if err != nil {
+			return 0, err
+		}
+
+		value, err := strconv.Atoi(response)
+		if err == nil && value >= 0 {
+			return value, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "%q is not a valid number\n", response)
+	}
+}
+
+func init() {
+	initCmd.Flags().StringVarP(&initCmdFlags.options.ClusterName, "name", "n", "", "cluster name")
+	initCmd.Flags().StringVarP(&initCmdFlags.options.Selector, "selector", "l", "", "label selector of the available machines, e.g. omni.sidero.dev/arch=amd64")
+	initCmd.Flags().StringVar(&initCmdFlags.options.TalosVersion, "talos-version", "", "Talos version (default: latest stable)")
+	initCmd.Flags().StringVar(&initCmdFlags.options.KubernetesVersion, "kubernetes-version", "", "Kubernetes version (default: latest compatible with the Talos version)")
+	initCmd.Flags().IntVar(&initCmdFlags.options.ControlPlanes, "control-planes", 0, "number of control plane machines (default: 3 if there are at least 4 machines, 1 otherwise)")
+	initCmd.Flags().IntVar(&initCmdFlags.options.Workers, "workers", -1, "number of worker machines, negative value uses all remaining machines")
+	initCmd.Flags().StringVarP(&initCmdFlags.output, "output", "o", "", "output file (default: stdout)")
+	initCmd.Flags().BoolVarP(&initCmdFlags.interactive, "interactive", "i", false, "prompt for the suggested values")
+	initCmd.Flags().BoolVarP(&initCmdFlags.force, "force", "f", false, "overwrite output file if it exists")
+
+	templateCmd.AddCommand(initCmd)
+}
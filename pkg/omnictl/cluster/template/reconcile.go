@@ -0,0 +1,123 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/siderolabs/gen/ensure"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+var reconcileCmdFlags struct {
+	dir        string
+	healthAddr string
+	logLevel   string
+	options    operations.ReconcileOptions
+}
+
+// reconcileCmd represents the template reconcile command.
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Continuously sync a directory of templates to the Omni.",
+	Long: `Watch a directory of cluster templates and the resources managed by them, and sync the templates whenever either side changes.
+The directory is loaded as a fleet, see 'template fleet', the Jsonnet templates are evaluated with the Jsonnet variables from the flags. The files referenced by the templates (patches, manifests, Helm charts, secrets) are watched as well. The command runs until interrupted, and is meant to run as a long-running agent.
+Logs are structured (JSON), the health of the latest sync is served on the health endpoint. This command requires API access.`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(reconcile)
+	},
+}
+
+func reconcile(ctx context.Context, client *client.Client) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
+
+	level, err := zap.ParseAtomicLevel(reconcileCmdFlags.logLevel)
+	if err != nil {
+		return err
+	}
+
+	loggerConfig := zap.NewProductionConfig()
+	loggerConfig.Level = level
+
+	logger, err := loggerConfig.Build()
+	if err != nil {
+		return err
+	}
+
+	defer logger.Sync() //nolint:errcheck
+
+	reconcileCmdFlags.options.Sync.SchematicResolver = client.Management()
+
+	reconciler := operations.NewReconciler(reconcileCmdFlags.dir, client.Omni().State(), logger, reconcileCmdFlags.options)
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		return reconciler.Run(ctx)
+	})
+
+	if reconcileCmdFlags.healthAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", reconciler)
+
+		srv := &http.Server{
+			Addr:              reconcileCmdFlags.healthAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		eg.Go(func() error {
+			logger.Info("serving health endpoint", zap.String("address", srv.Addr))
+
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("health endpoint failed: %w", err)
+			}
+
+			return nil
+		})
+
+		eg.Go(func() error {
+			<-ctx.Done()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			return srv.Shutdown(shutdownCtx) //nolint:contextcheck
+		})
+	}
+
+	return eg.Wait()
+}
+
+func init() {
+	reconcileCmd.Flags().StringVarP(&reconcileCmdFlags.dir, "dir", "d", "", "path to the directory of the cluster template files")
+	reconcileCmd.Flags().StringVar(&reconcileCmdFlags.healthAddr, "health-addr", ":8080", "address of the health endpoint (/healthz), empty to disable")
+	reconcileCmd.Flags().StringVar(&reconcileCmdFlags.logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	reconcileCmd.Flags().BoolVar(&reconcileCmdFlags.options.Sync.DryRun, "dry-run", false, "only report the changes, do not apply them")
+	reconcileCmd.Flags().BoolVar(&reconcileCmdFlags.options.Sync.NoRollback, "no-rollback", false, "do not roll back the applied changes if the sync of a cluster fails")
+	reconcileCmd.Flags().BoolVar(&reconcileCmdFlags.options.Sync.Rollout.Staged, "staged", false, "roll out the changes one machine set at a time, waiting for each machine set to become healthy")
+	reconcileCmd.Flags().DurationVar(&reconcileCmdFlags.options.Sync.Rollout.StageTimeout, "stage-timeout", operations.DefaultStageTimeout, "deadline for each stage to become healthy in the staged mode")
+	reconcileCmd.Flags().IntVarP(&reconcileCmdFlags.options.Fleet.Parallelism, "parallelism", "p", operations.DefaultFleetParallelism, "number of clusters synced at once")
+	reconcileCmd.Flags().DurationVar(&reconcileCmdFlags.options.MinSyncInterval, "min-sync-interval", operations.DefaultMinSyncInterval, "minimum interval between the syncs, changes coming in faster are coalesced")
+	reconcileCmd.Flags().DurationVar(&reconcileCmdFlags.options.ResyncInterval, "resync-interval", 10*time.Minute, "interval of the periodic sync, zero to disable")
+	addJsonnetFlags(reconcileCmd.Flags(), &reconcileCmdFlags.options.Jsonnet)
+	ensure.NoError(reconcileCmd.MarkFlagRequired("dir"))
+	templateCmd.AddCommand(reconcileCmd)
+}
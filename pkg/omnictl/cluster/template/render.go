@@ -5,6 +5,7 @@
 package template
 
 import (
+	"context"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -12,30 +13,43 @@ import (
 	"github.com/siderolabs/omni-client/pkg/template/operations"
 )
 
+var renderCmdFlags struct {
+	machine   string
+	effective bool
+}
+
 // renderCmd represents the template render command.
 var renderCmd = &cobra.Command{
-	Use:     "render",
-	Short:   "Render a cluster template to a set of resources.",
-	Long:    `Validate template contents, convert to resources and output resources to stdout as YAML. This command is offline (doesn't access API).`,
+	Use:   "render",
+	Short: "Render a cluster template to a set of resources.",
+	Long: `Validate template contents, convert to resources and output resources to stdout as YAML. This command is offline (doesn't access API).
+
+With --machine and --effective flags, the effective Talos machine configuration of the machine is rendered instead:
+the template patches for the machine are applied to a generated base configuration, and the secrets are redacted.`,
 	Example: "",
 	Args:    cobra.NoArgs,
-	RunE: func(*cobra.Command, []string) error {
-		return render()
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return render(cmd.Context())
 	},
 }
 
-func render() error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+func render(ctx context.Context) error {
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
+	if renderCmdFlags.effective {
+		return operations.RenderMachineConfig(f, os.Stdout, renderCmdFlags.machine)
+	}
 
 	return operations.RenderTemplate(f, os.Stdout)
 }
 
 func init() {
 	addRequiredFileFlag(renderCmd)
+	renderCmd.Flags().StringVar(&renderCmdFlags.machine, "machine", "", "machine ID to render the configuration for")
+	renderCmd.Flags().BoolVar(&renderCmdFlags.effective, "effective", false, "render the effective Talos machine configuration of the machine")
+	renderCmd.MarkFlagsRequiredTogether("machine", "effective")
 	templateCmd.AddCommand(renderCmd)
 }
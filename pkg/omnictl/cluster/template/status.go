@@ -19,28 +19,56 @@ import (
 var statusCmdFlags struct {
 	options operations.StatusOptions
 	wait    time.Duration
+	output  string
+	waitFor []string
 }
 
 // statusCmd represents the cluster status command.
 var statusCmd = &cobra.Command{
-	Use:     "status",
-	Short:   "Show template cluster status, wait for the cluster to be ready.",
-	Long:    `Shows current cluster status, if the terminal supports it, watch the status as it updates. The command waits for the cluster to be ready by default.`,
-	Example: "",
-	Args:    cobra.NoArgs,
+	Use:   "status",
+	Short: "Show template cluster status, wait for the cluster to be ready.",
+	Long: `Shows current cluster status, if the terminal supports it, watch the status as it updates. The command waits for the cluster to be ready by default.
+
+With --for, the command waits for the conditions instead of the cluster being ready, all of them should hold:
+  condition=<ready|notReady|degraded|notFound> - the cluster condition
+  delete - the cluster is destroyed
+  jsonpath=<expr>[<op><value>] - the JSONPath expression over the status document (see --output json),
+    the operators are =, !=, >, >=, < and <=, and all results of the expression should match
+
+The optional sections of the tree are enabled with --kubernetes, --etcd-backup, --image-pull and --tasks.
+
+With --output json or yaml, a structured status document is written once the cluster is ready (or the --for conditions hold),
+or when the wait timeout expires.
+
+The exit code reflects the condition of the cluster:
+  0 - ready
+  1 - other errors
+  2 - not ready, or the --for conditions do not hold
+  3 - degraded: a machine set or an upgrade failed, a machine is unreachable or failed to apply the config
+  4 - not found`,
+	Example: `  # Wait for the Kubernetes upgrade to finish.
+  omnictl cluster template status -f cluster.yaml --for 'jsonpath={.kubernetesUpgrade.phase}=Done'
+
+  # Wait for all machines to run Talos 1.7.0.
+  omnictl cluster template status -f cluster.yaml --for 'jsonpath={.machineSets[*].machines[*].talosVersion}=1.7.0'
+
+  # Wait for the machine set to have 5 healthy machines.
+  omnictl cluster template status -f cluster.yaml --for 'jsonpath={.machineSets[?(@.id=="my-cluster-workers-gpu")].counts.healthy}>=5'
+
+  # Wait for the cluster to be destroyed.
+  omnictl cluster template status -f cluster.yaml --for delete`,
+	Args: cobra.NoArgs,
 	RunE: func(*cobra.Command, []string) error {
 		return access.WithClient(status)
 	},
 }
 
 func status(ctx context.Context, client *client.Client) error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
-
 	if statusCmdFlags.wait > 0 {
 		var cancel context.CancelFunc
 
@@ -52,6 +80,18 @@ func status(ctx context.Context, client *client.Client) error {
 		statusCmdFlags.options.Wait = false
 	}
 
+	statusCmdFlags.options.Format = operations.StatusFormat(statusCmdFlags.output)
+	statusCmdFlags.options.For = nil
+
+	for _, expr := range statusCmdFlags.waitFor {
+		condition, err := operations.ParseStatusCondition(expr)
+		if err != nil {
+			return err
+		}
+
+		statusCmdFlags.options.For = append(statusCmdFlags.options.For, condition)
+	}
+
 	return operations.StatusTemplate(ctx, f, os.Stdout, client.Omni().State(), statusCmdFlags.options)
 }
 
@@ -59,5 +99,11 @@ func init() {
 	addRequiredFileFlag(statusCmd)
 	statusCmd.PersistentFlags().BoolVarP(&statusCmdFlags.options.Quiet, "quiet", "q", false, "suppress output")
 	statusCmd.PersistentFlags().DurationVarP(&statusCmdFlags.wait, "wait", "w", 5*time.Minute, "wait timeout, if zero, report current status and exit")
+	statusCmd.PersistentFlags().StringVarP(&statusCmdFlags.output, "output", "o", string(operations.StatusFormatTree), "output format (tree, json, yaml)")
+	statusCmd.PersistentFlags().StringArrayVar(&statusCmdFlags.waitFor, "for", nil, "wait condition: condition=<condition>, delete or jsonpath=<expr>[<op><value>], can be repeated")
+	statusCmd.PersistentFlags().BoolVar(&statusCmdFlags.options.Sections.Kubernetes, "kubernetes", false, "show Kubernetes node readiness, static pod versions and manifest sync status")
+	statusCmd.PersistentFlags().BoolVar(&statusCmdFlags.options.Sections.EtcdBackup, "etcd-backup", false, "show the etcd backup status")
+	statusCmd.PersistentFlags().BoolVar(&statusCmdFlags.options.Sections.ImagePull, "image-pull", false, "show the image pull progress")
+	statusCmd.PersistentFlags().BoolVar(&statusCmdFlags.options.Sections.Tasks, "tasks", false, "show the ongoing tasks of the cluster")
 	templateCmd.AddCommand(statusCmd)
 }
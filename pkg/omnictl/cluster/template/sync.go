@@ -32,12 +32,12 @@ var syncCmd = &cobra.Command{
 }
 
 func sync(ctx context.Context, client *client.Client) error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
+	syncCmdFlags.options.SchematicResolver = client.Management()
 
 	return operations.SyncTemplate(ctx, f, os.Stdout, client.Omni().State(), syncCmdFlags.options)
 }
@@ -45,6 +45,12 @@ func sync(ctx context.Context, client *client.Client) error {
 func init() {
 	addRequiredFileFlag(syncCmd)
 	syncCmd.PersistentFlags().BoolVarP(&syncCmdFlags.options.Verbose, "verbose", "v", false, "verbose output (show diff for each resource)")
+	syncCmdFlags.options.DiffFormat = operations.DiffFormatText
+	syncCmd.PersistentFlags().Var(&syncCmdFlags.options.DiffFormat, "diff-format", "diff format for the verbose output (text, structural)")
 	syncCmd.PersistentFlags().BoolVarP(&syncCmdFlags.options.DryRun, "dry-run", "d", false, "dry run")
+	syncCmd.PersistentFlags().BoolVar(&syncCmdFlags.options.NoRollback, "no-rollback", false, "do not roll back the applied changes if the sync fails")
+	syncCmd.PersistentFlags().BoolVar(&syncCmdFlags.options.Rollout.Staged, "staged", false, "roll out the changes one machine set at a time, waiting for each machine set to become healthy")
+	syncCmd.PersistentFlags().BoolVar(&syncCmdFlags.options.Rollout.ControlPlaneLast, "control-plane-last", false, "roll out the control plane after the workers in the staged mode")
+	syncCmd.PersistentFlags().DurationVar(&syncCmdFlags.options.Rollout.StageTimeout, "stage-timeout", operations.DefaultStageTimeout, "deadline for each stage to become healthy in the staged mode")
 	templateCmd.AddCommand(syncCmd)
 }
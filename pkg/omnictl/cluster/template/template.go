@@ -6,14 +6,29 @@
 package template
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+
 	"github.com/siderolabs/gen/ensure"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	clustertemplate "github.com/siderolabs/omni-client/pkg/template"
 )
 
 // cmdFlags contains shared cluster template flags.
 var cmdFlags struct {
 	// Path to the cluster template file.
 	TemplatePath string
+
+	// Path to the values file, if set, the template is rendered as a blueprint.
+	ValuesPath string
+
+	// Variables of the Jsonnet template.
+	Jsonnet clustertemplate.JsonnetOptions
 }
 
 // templateCmd represents the template sub-command.
@@ -31,6 +46,53 @@ func RootCmd() *cobra.Command {
 }
 
 func addRequiredFileFlag(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVarP(&cmdFlags.TemplatePath, "file", "f", "", "path to the cluster template file.")
+	cmd.PersistentFlags().StringVarP(&cmdFlags.TemplatePath, "file", "f", "", "path to the cluster template file (YAML, JSON or .jsonnet).")
+	cmd.PersistentFlags().StringVar(&cmdFlags.ValuesPath, "values", "", "path to the blueprint values file, if set, the template file is rendered as a blueprint.")
+	addJsonnetFlags(cmd.PersistentFlags(), &cmdFlags.Jsonnet)
 	ensure.NoError(cmd.MarkPersistentFlagRequired("file"))
 }
+
+func addJsonnetFlags(flags *pflag.FlagSet, options *clustertemplate.JsonnetOptions) {
+	flags.StringToStringVar(&options.ExtVars, "ext-str", nil, "Jsonnet external string variables, e.g. --ext-str env=prod")
+	flags.StringToStringVar(&options.ExtCode, "ext-code", nil, "Jsonnet external variables with code values, e.g. --ext-code replicas=3")
+	flags.StringToStringVar(&options.TLAVars, "tla-str", nil, "Jsonnet top-level string arguments")
+	flags.StringToStringVar(&options.TLACode, "tla-code", nil, "Jsonnet top-level arguments with code values")
+}
+
+// openTemplate reads the cluster template from the file, rendering it as a blueprint if the values file is set.
+//
+// Jsonnet templates are evaluated with the Jsonnet variables from the flags.
+func openTemplate(ctx context.Context) (io.Reader, error) {
+	if clustertemplate.IsJsonnet(cmdFlags.TemplatePath) {
+		if cmdFlags.ValuesPath != "" {
+			return nil, errors.New("values file can't be used with the Jsonnet template, use Jsonnet variables instead")
+		}
+
+		return clustertemplate.EvaluateJsonnet(ctx, cmdFlags.TemplatePath, cmdFlags.Jsonnet)
+	}
+
+	f, err := os.Open(cmdFlags.TemplatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	if cmdFlags.ValuesPath == "" {
+		raw, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(raw), nil
+	}
+
+	values, err := os.Open(cmdFlags.ValuesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer values.Close() //nolint:errcheck
+
+	return clustertemplate.RenderBlueprint(f, values)
+}
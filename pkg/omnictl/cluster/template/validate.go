@@ -5,8 +5,7 @@
 package template
 
 import (
-	"os"
-
+	"context"
 	"github.com/spf13/cobra"
 
 	"github.com/siderolabs/omni-client/pkg/template/operations"
@@ -19,19 +18,17 @@ var validateCmd = &cobra.Command{
 	Long:    `Validate that template contains valid structures, and there are no other warnings. This command is offline (doesn't access API).`,
 	Example: "",
 	Args:    cobra.NoArgs,
-	RunE: func(*cobra.Command, []string) error {
-		return validate()
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return validate(cmd.Context())
 	},
 }
 
-func validate() error {
-	f, err := os.Open(cmdFlags.TemplatePath)
+func validate(ctx context.Context) error {
+	f, err := openTemplate(ctx)
 	if err != nil {
 		return err
 	}
 
-	defer f.Close() //nolint:errcheck
-
 	return operations.ValidateTemplate(f)
 }
 
@@ -0,0 +1,106 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package dashboard implements the interactive terminal dashboard of the clusters and machines.
+package dashboard
+
+import (
+	"context"
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/spf13/cobra"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+)
+
+var dashboardCmdFlags struct {
+	tailLines int32
+}
+
+// dashboardCmd represents the dashboard command.
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Interactive dashboard of the clusters and machines.",
+	Long: `Interactive terminal dashboard which shows the clusters with their health, the machine sets and the machines of each cluster,
+and the ongoing Talos and Kubernetes upgrades. The dashboard is updated live from the resource watches.
+
+Key bindings:
+  up/k, down/j      move the selection
+  enter/right       open the selected cluster, machine set, or the logs of the selected machine
+  esc/left          close the logs, or go back to the parent list
+  L, U              lock or unlock the selected machine
+  q, ctrl+c         quit`,
+	Example: "",
+	Args:    cobra.NoArgs,
+	RunE: func(*cobra.Command, []string) error {
+		return access.WithClient(run)
+	},
+}
+
+// watchedTypes are the resources shown in the dashboard, all of them are labeled with the cluster, except for the ClusterStatus.
+var watchedTypes = []resource.Type{
+	omni.ClusterStatusType,
+	omni.MachineSetStatusType,
+	omni.MachineSetNodeType,
+	omni.ControlPlaneStatusType,
+	omni.LoadBalancerStatusType,
+	omni.KubernetesUpgradeStatusType,
+	omni.TalosUpgradeStatusType,
+	omni.ClusterMachineStatusType,
+	omni.ClusterMachineConfigStatusType,
+}
+
+// RootCmd exposes the dashboard command.
+func RootCmd() *cobra.Command {
+	return dashboardCmd
+}
+
+func run(ctx context.Context, client *client.Client) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	st := client.Omni().State()
+	watchCh := make(chan state.Event)
+
+	if err := watch(ctx, st, watchCh); err != nil {
+		return err
+	}
+
+	m := newModel(ctx, st, watchCh, len(watchedTypes), func(ctx context.Context, machineID string) (io.Reader, error) {
+		return client.Management().LogsReader(ctx, machineID, true, dashboardCmdFlags.tailLines)
+	})
+	m.endpoint = client.Endpoint()
+
+	if _, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run(); err != nil {
+		return err
+	}
+
+	return m.err
+}
+
+// watch starts the watches of all watchedTypes, each of them sends the Bootstrapped event after the initial contents.
+func watch(ctx context.Context, st state.State, watchCh chan<- state.Event) error {
+	for _, resourceType := range watchedTypes {
+		if err := st.WatchKind(
+			ctx,
+			resource.NewMetadata(resources.DefaultNamespace, resourceType, "", resource.VersionUndefined),
+			watchCh,
+			state.WithBootstrapContents(true),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	dashboardCmd.Flags().Int32Var(&dashboardCmdFlags.tailLines, "tail", 100, "number of the recent log lines to show when opening the machine logs")
+}
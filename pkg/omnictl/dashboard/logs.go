@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package dashboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxLogLines is the number of the recent log lines kept in the log pane.
+const maxLogLines = 1000
+
+// logMsg is a line of the machine logs, or the error which ended the stream.
+type logMsg struct {
+	err    error
+	line   string
+	stream int
+}
+
+// logStream is the log pane following the machine logs.
+type logStream struct {
+	ch        chan logMsg
+	cancel    context.CancelFunc
+	err       error
+	machineID string
+	lines     []string
+	id        int
+}
+
+// talosLogMessage is a log message as returned by the logs reader.
+type talosLogMessage struct {
+	TalosTime time.Time `json:"talos-time"`
+	Facility  string    `json:"facility"`
+	Message   string    `json:"msg"`
+}
+
+// openLogStream replaces the log pane with the logs of the machine, the lines are delivered as logMsg.
+func (m *model) openLogStream(machineID string) tea.Cmd {
+	m.closeLogStream()
+
+	m.logStreams++
+
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	logs := &logStream{
+		ch:        make(chan logMsg),
+		cancel:    cancel,
+		machineID: machineID,
+		id:        m.logStreams,
+	}
+
+	go func() {
+		defer close(logs.ch)
+
+		send := func(msg logMsg) bool {
+			msg.stream = logs.id
+
+			select {
+			case logs.ch <- msg:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		reader, err := m.openLogs(ctx, machineID)
+		if err != nil {
+			send(logMsg{err: fmt.Errorf("failed to get logs stream for %q: %w", machineID, err)})
+
+			return
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(nil, 1024*1024)
+
+		for scanner.Scan() {
+			if !send(logMsg{line: formatLogLine(scanner.Text())}) {
+				return
+			}
+		}
+
+		err = scanner.Err()
+		if err == nil {
+			err = errors.New("log stream closed")
+		}
+
+		send(logMsg{err: err})
+	}()
+
+	m.logs = logs
+
+	return logs.wait
+}
+
+func (m *model) closeLogStream() {
+	if m.logs == nil {
+		return
+	}
+
+	m.logs.cancel()
+	m.logs = nil
+}
+
+// wait delivers the next log line to the program.
+func (logs *logStream) wait() tea.Msg {
+	msg, ok := <-logs.ch
+	if !ok {
+		return nil
+	}
+
+	return msg
+}
+
+func (m *model) handleLog(msg logMsg) tea.Cmd {
+	// the lines of the closed streams are dropped
+	if m.logs == nil || msg.stream != m.logs.id {
+		return nil
+	}
+
+	if msg.err != nil {
+		m.logs.err = msg.err
+
+		return nil
+	}
+
+	m.logs.lines = append(m.logs.lines, msg.line)
+
+	if len(m.logs.lines) > maxLogLines {
+		m.logs.lines = slices.Clone(m.logs.lines[len(m.logs.lines)-maxLogLines:])
+	}
+
+	return m.logs.wait
+}
+
+// formatLogLine formats the log message as '<time> <facility>: <message>', the lines which are not JSON are kept as is.
+func formatLogLine(line string) string {
+	var msg talosLogMessage
+
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		return line
+	}
+
+	return fmt.Sprintf("%s %s: %s", msg.TalosTime.Format(time.TimeOnly), msg.Facility, strings.TrimRight(msg.Message, "\n"))
+}
@@ -0,0 +1,315 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/machine"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+// level is the depth of the drill-down.
+type level int
+
+const (
+	levelClusters level = iota
+	levelMachineSets
+	levelMachines
+)
+
+type (
+	// eventMsg is an event of the resource watches.
+	eventMsg state.Event
+
+	// resultMsg is the outcome of an action, e.g. locking a machine.
+	resultMsg struct {
+		err  error
+		text string
+	}
+)
+
+// model is the state of the dashboard.
+type model struct {
+	ctx      context.Context //nolint:containedctx
+	st       state.State
+	watchCh  <-chan state.Event
+	openLogs func(ctx context.Context, machineID string) (io.Reader, error)
+	err      error
+	logs     *logStream
+
+	// resources are the watched resources of each cluster, keyed by resource.String
+	resources map[string]map[string]resource.Resource
+	docs      map[string]*operations.StatusDocument
+	locked    map[resource.ID]bool
+
+	endpoint   string
+	cluster    string
+	machineSet string
+	result     resultMsg
+
+	pendingBootstraps int
+	logStreams        int
+	level             level
+	cursor            [levelMachines + 1]int
+	width, height     int
+}
+
+func newModel(ctx context.Context, st state.State, watchCh <-chan state.Event, watches int,
+	openLogs func(ctx context.Context, machineID string) (io.Reader, error),
+) *model {
+	return &model{
+		ctx:               ctx,
+		st:                st,
+		watchCh:           watchCh,
+		openLogs:          openLogs,
+		resources:         map[string]map[string]resource.Resource{},
+		docs:              map[string]*operations.StatusDocument{},
+		locked:            map[resource.ID]bool{},
+		pendingBootstraps: watches,
+	}
+}
+
+// Init implements tea.Model.
+func (m *model) Init() tea.Cmd {
+	return m.waitEvent
+}
+
+// waitEvent delivers the next watch event to the program.
+func (m *model) waitEvent() tea.Msg {
+	select {
+	case <-m.ctx.Done():
+		return nil
+	case event := <-m.watchCh:
+		return eventMsg(event)
+	}
+}
+
+// Update implements tea.Model.
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case eventMsg:
+		if msg.Type == state.Errored {
+			m.err = fmt.Errorf("watch failed: %w", msg.Error)
+
+			return m, m.quit()
+		}
+
+		m.handleEvent(state.Event(msg))
+
+		return m, m.waitEvent
+	case logMsg:
+		return m, m.handleLog(msg)
+	case resultMsg:
+		m.result = msg
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *model) handleEvent(event state.Event) {
+	switch event.Type {
+	case state.Bootstrapped:
+		m.pendingBootstraps--
+
+		return
+	case state.Created, state.Updated, state.Destroyed:
+	case state.Errored:
+		return
+	}
+
+	r := event.Resource
+
+	clusterName, ok := r.Metadata().Labels().Get(omni.LabelCluster)
+	if r.Metadata().Type() == omni.ClusterStatusType {
+		clusterName, ok = r.Metadata().ID(), true
+	}
+
+	if !ok {
+		return
+	}
+
+	if r.Metadata().Type() == omni.MachineSetNodeType {
+		_, locked := r.Metadata().Annotations().Get(omni.MachineLocked)
+		m.locked[r.Metadata().ID()] = locked && event.Type != state.Destroyed
+	}
+
+	clusterResources := m.resources[clusterName]
+	if clusterResources == nil {
+		clusterResources = map[string]resource.Resource{}
+		m.resources[clusterName] = clusterResources
+	}
+
+	if event.Type == state.Destroyed {
+		delete(clusterResources, resource.String(r))
+	} else {
+		clusterResources[resource.String(r)] = r
+	}
+
+	if len(clusterResources) == 0 {
+		delete(m.resources, clusterName)
+		delete(m.docs, clusterName)
+
+		return
+	}
+
+	m.docs[clusterName] = operations.BuildStatusDocument(clusterName, clusterResources)
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m.quit()
+	case "up", "k":
+		m.cursor[m.level] = max(m.selected()-1, 0)
+	case "down", "j":
+		m.cursor[m.level] = min(m.selected()+1, max(m.items()-1, 0))
+	case "enter", "right":
+		return m.open()
+	case "esc", "left", "backspace":
+		m.back()
+	case "L", "U":
+		if machine := m.selectedMachine(); machine != nil {
+			return m.setLocked(machine.ID, msg.String() == "L")
+		}
+	}
+
+	return nil
+}
+
+// open drills down into the selected item, the machine opens the logs.
+func (m *model) open() tea.Cmd {
+	switch m.level {
+	case levelClusters:
+		if clusters := m.clusters(); len(clusters) > 0 {
+			m.cluster = clusters[m.selected()]
+			m.level = levelMachineSets
+			m.cursor[levelMachineSets] = 0
+		}
+	case levelMachineSets:
+		if machineSets := m.machineSets(); len(machineSets) > 0 {
+			m.machineSet = machineSets[m.selected()].ID
+			m.level = levelMachines
+			m.cursor[levelMachines] = 0
+		}
+	case levelMachines:
+		if machine := m.selectedMachine(); machine != nil {
+			return m.openLogStream(machine.ID)
+		}
+	}
+
+	return nil
+}
+
+// back closes the logs, or goes back to the parent list.
+func (m *model) back() {
+	if m.logs != nil {
+		m.closeLogStream()
+
+		return
+	}
+
+	if m.level > levelClusters {
+		m.level--
+	}
+}
+
+func (m *model) quit() tea.Cmd {
+	m.closeLogStream()
+
+	return tea.Quit
+}
+
+func (m *model) setLocked(machineID resource.ID, lock bool) tea.Cmd {
+	return func() tea.Msg {
+		if err := machine.SetLocked(m.ctx, m.st, machineID, lock); err != nil {
+			return resultMsg{err: err}
+		}
+
+		if lock {
+			return resultMsg{text: fmt.Sprintf("locked machine %q", machineID)}
+		}
+
+		return resultMsg{text: fmt.Sprintf("unlocked machine %q", machineID)}
+	}
+}
+
+// clusters returns the names of the existing clusters in order.
+func (m *model) clusters() []string {
+	clusters := make([]string, 0, len(m.docs))
+
+	for name, doc := range m.docs {
+		if doc.Condition != operations.ClusterConditionNotFound {
+			clusters = append(clusters, name)
+		}
+	}
+
+	slices.Sort(clusters)
+
+	return clusters
+}
+
+func (m *model) machineSets() []operations.MachineSetStatusDocument {
+	doc, ok := m.docs[m.cluster]
+	if !ok {
+		return nil
+	}
+
+	return doc.MachineSets
+}
+
+func (m *model) machines() []operations.MachineStatusDocument {
+	for _, machineSet := range m.machineSets() {
+		if machineSet.ID == m.machineSet {
+			return machineSet.Machines
+		}
+	}
+
+	return nil
+}
+
+// items returns the number of items at the current level.
+func (m *model) items() int {
+	switch m.level {
+	case levelClusters:
+		return len(m.clusters())
+	case levelMachineSets:
+		return len(m.machineSets())
+	case levelMachines:
+		return len(m.machines())
+	}
+
+	return 0
+}
+
+// selected returns the cursor of the current level, kept in range as the items come and go.
+func (m *model) selected() int {
+	return min(m.cursor[m.level], max(m.items()-1, 0))
+}
+
+func (m *model) selectedMachine() *operations.MachineStatusDocument {
+	if m.level != levelMachines {
+		return nil
+	}
+
+	machines := m.machines()
+	if len(machines) == 0 {
+		return nil
+	}
+
+	return &machines[m.selected()]
+}
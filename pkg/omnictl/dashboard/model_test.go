@@ -0,0 +1,161 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package dashboard
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+const machineID = "1a2b3c4d-0000-4000-8000-000000000001"
+
+func dashboardState(ctx context.Context, t *testing.T) state.State {
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	clusterStatus := omni.NewClusterStatus(resources.DefaultNamespace, "prod")
+	clusterStatus.TypedSpec().Value.Phase = specs.ClusterStatusSpec_RUNNING
+	clusterStatus.TypedSpec().Value.Ready = true
+	clusterStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 1, Healthy: 1}
+
+	machineSetStatus := omni.NewMachineSetStatus(resources.DefaultNamespace, "prod-control-planes")
+	machineSetStatus.Metadata().Labels().Set(omni.LabelCluster, "prod")
+	machineSetStatus.Metadata().Labels().Set(omni.LabelControlPlaneRole, "")
+	machineSetStatus.TypedSpec().Value.Phase = specs.MachineSetPhase_Running
+	machineSetStatus.TypedSpec().Value.Ready = true
+	machineSetStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 1, Healthy: 1}
+
+	machineStatus := omni.NewClusterMachineStatus(resources.DefaultNamespace, machineID)
+	machineStatus.Metadata().Labels().Set(omni.LabelCluster, "prod")
+	machineStatus.Metadata().Labels().Set(omni.LabelMachineSet, "prod-control-planes")
+	machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelConnected, "")
+	machineStatus.TypedSpec().Value.Stage = specs.ClusterMachineStatusSpec_RUNNING
+	machineStatus.TypedSpec().Value.Ready = true
+
+	machineSet := omni.NewMachineSet(resources.DefaultNamespace, "prod-control-planes")
+	machineSet.Metadata().Labels().Set(omni.LabelCluster, "prod")
+
+	machineSetNode := omni.NewMachineSetNode(resources.DefaultNamespace, machineID, machineSet)
+
+	talosUpgradeStatus := omni.NewTalosUpgradeStatus(resources.DefaultNamespace, "prod")
+	talosUpgradeStatus.Metadata().Labels().Set(omni.LabelCluster, "prod")
+	talosUpgradeStatus.TypedSpec().Value.Phase = specs.TalosUpgradeStatusSpec_Upgrading
+	talosUpgradeStatus.TypedSpec().Value.LastUpgradeVersion = "1.6.4"
+	talosUpgradeStatus.TypedSpec().Value.CurrentUpgradeVersion = "1.7.0"
+
+	for _, r := range []resource.Resource{clusterStatus, machineSetStatus, machineStatus, machineSetNode, talosUpgradeStatus} {
+		require.NoError(t, st.Create(ctx, r))
+	}
+
+	return st
+}
+
+func keyMsg(key string) tea.KeyMsg {
+	switch key {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	default:
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+	}
+}
+
+// next runs the command and delivers the message to the model, like the program does.
+func next(t *testing.T, m *model, cmd tea.Cmd) tea.Cmd {
+	require.NotNil(t, cmd)
+
+	msg := cmd()
+	require.NotNil(t, msg)
+
+	_, cmd = m.Update(msg)
+
+	return cmd
+}
+
+func TestDashboard(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := dashboardState(ctx, t)
+	watchCh := make(chan state.Event)
+
+	require.NoError(t, watch(ctx, st, watchCh))
+
+	m := newModel(ctx, st, watchCh, len(watchedTypes), func(context.Context, string) (io.Reader, error) {
+		return strings.NewReader(`{"talos-time":"2024-01-02T03:04:05Z","facility":"kern","msg":"hello\n"}` + "\nnot json\n"), nil
+	})
+
+	assert.Equal(t, "Loading...\n", m.View())
+
+	for cmd := m.Init(); m.pendingBootstraps > 0; {
+		cmd = next(t, m, cmd)
+	}
+
+	// the machine is unlocked, and the upgrade is in progress
+	view := m.View()
+	assert.Contains(t, view, "prod                     notReady   RUNNING      1/1       Talos Upgrading")
+	assert.Contains(t, view, "prod                     Talos      Upgrading  1.6.4 -> 1.7.0")
+
+	m.Update(keyMsg("enter"))
+
+	view = m.View()
+	assert.Contains(t, view, "Clusters > prod\n")
+	assert.Contains(t, view, "prod-control-planes              controlplane Running    true   1/1")
+
+	m.Update(keyMsg("enter"))
+
+	view = m.View()
+	assert.Contains(t, view, "Clusters > prod > prod-control-planes\n")
+	assert.Contains(t, view, machineID+" RUNNING          true   true      UNKNOWN             false")
+
+	// lock is applied to the state, and the dashboard is updated from the watch
+	_, cmd := m.Update(keyMsg("L"))
+	next(t, m, cmd)
+
+	assert.Contains(t, m.View(), `locked machine "`+machineID+`"`)
+
+	for !m.locked[machineID] {
+		next(t, m, m.waitEvent)
+	}
+
+	machineSetNode, err := safe.StateGetByID[*omni.MachineSetNode](ctx, st, machineID)
+	require.NoError(t, err)
+
+	_, locked := machineSetNode.Metadata().Annotations().Get(omni.MachineLocked)
+	assert.True(t, locked)
+	assert.Contains(t, m.View(), "UNKNOWN             true")
+
+	// the logs are streamed until the stream is closed
+	_, cmd = m.Update(keyMsg("enter"))
+
+	for cmd != nil {
+		cmd = next(t, m, cmd)
+	}
+
+	view = m.View()
+	assert.Contains(t, view, "Logs of "+machineID+"\n03:04:05 kern: hello\nnot json\nlog stream closed\n")
+
+	m.Update(keyMsg("esc"))
+	assert.NotContains(t, m.View(), "Logs of")
+
+	m.Update(keyMsg("esc"))
+	assert.Contains(t, m.View(), "Clusters > prod\n")
+}
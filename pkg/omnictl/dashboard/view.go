@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package dashboard
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	headerStyle   = lipgloss.NewStyle().Faint(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	okStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	warningStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+
+	conditionStyles = map[operations.ClusterCondition]lipgloss.Style{
+		operations.ClusterConditionReady:    okStyle,
+		operations.ClusterConditionNotReady: warningStyle,
+		operations.ClusterConditionDegraded: errorStyle,
+	}
+)
+
+// minListLines is the minimum height of the list, the log pane takes the rest of the screen.
+const minListLines = 5
+
+// View implements tea.Model.
+func (m *model) View() string {
+	if m.pendingBootstraps > 0 {
+		return "Loading...\n"
+	}
+
+	title := "Omni dashboard"
+	if m.endpoint != "" {
+		title += " " + m.endpoint
+	}
+
+	top := []string{titleStyle.Render(title), m.breadcrumbs(), ""}
+
+	header, rows := m.list()
+
+	bottom := append([]string{""}, m.upgrades()...)
+
+	if m.result.err != nil {
+		bottom = append(bottom, "", errorStyle.Render(m.result.err.Error()))
+	} else if m.result.text != "" {
+		bottom = append(bottom, "", m.result.text)
+	}
+
+	bottom = append(bottom, "", headerStyle.Render(m.help()))
+
+	// the list is scrolled to the cursor if the screen is too small, the log pane gets the remaining lines
+	listLines := len(rows)
+	logLines := 0
+
+	if m.height > 0 {
+		available := m.height - len(top) - len(bottom) - 1
+
+		if m.logs != nil {
+			logLines = max(available/2, available-len(rows), 2)
+			available -= logLines
+		}
+
+		listLines = min(len(rows), max(available, minListLines))
+	} else if m.logs != nil {
+		logLines = 20
+	}
+
+	lines := append(top, headerStyle.Render(header))
+	lines = append(lines, scroll(rows, m.selected(), listLines)...)
+
+	if m.logs != nil {
+		lines = append(lines, m.logPane(logLines)...)
+	}
+
+	lines = append(lines, bottom...)
+
+	style := lipgloss.NewStyle()
+	if m.width > 0 {
+		style = style.MaxWidth(m.width)
+	}
+
+	if m.height > 0 {
+		style = style.MaxHeight(m.height)
+	}
+
+	return style.Render(strings.Join(lines, "\n"))
+}
+
+func (m *model) breadcrumbs() string {
+	crumbs := []string{"Clusters"}
+
+	if m.level >= levelMachineSets {
+		crumbs = append(crumbs, m.cluster)
+	}
+
+	if m.level >= levelMachines {
+		crumbs = append(crumbs, m.machineSet)
+	}
+
+	return strings.Join(crumbs, " > ")
+}
+
+// list returns the header and the rows of the current level, the selected row is highlighted.
+func (m *model) list() (string, []string) {
+	var (
+		header string
+		rows   []string
+	)
+
+	switch m.level {
+	case levelClusters:
+		header = fmt.Sprintf("%-24s %-10s %-12s %-9s %s", "NAME", "CONDITION", "PHASE", "MACHINES", "UPGRADE")
+
+		for _, name := range m.clusters() {
+			doc := m.docs[name]
+
+			rows = append(rows, fmt.Sprintf("%-24s %s %-12s %-9s %s",
+				name,
+				conditionStyles[doc.Condition].Render(fmt.Sprintf("%-10s", doc.Condition)),
+				doc.Phase,
+				fmt.Sprintf("%d/%d", doc.Machines.Healthy, doc.Machines.Total),
+				upgradeSummary(doc),
+			))
+		}
+	case levelMachineSets:
+		header = fmt.Sprintf("%-32s %-12s %-10s %-6s %s", "ID", "ROLE", "PHASE", "READY", "MACHINES")
+
+		for _, machineSet := range m.machineSets() {
+			row := fmt.Sprintf("%-32s %-12s %-10s %-6t %d/%d",
+				machineSet.ID,
+				machineSet.Role,
+				machineSet.Phase,
+				machineSet.Ready,
+				machineSet.Counts.Healthy,
+				machineSet.Counts.Total,
+			)
+
+			if machineSet.Error != "" {
+				row += " " + errorStyle.Render(machineSet.Error)
+			}
+
+			rows = append(rows, row)
+		}
+	case levelMachines:
+		header = fmt.Sprintf("%-36s %-16s %-6s %-9s %-10s %-8s %s", "ID", "STAGE", "READY", "CONNECTED", "CONFIG", "TALOS", "LOCKED")
+
+		for _, machine := range m.machines() {
+			row := fmt.Sprintf("%-36s %-16s %-6t %-9t %-10s %-8s %t",
+				machine.ID,
+				machine.Stage,
+				machine.Ready,
+				machine.Connected,
+				machine.ConfigApplyStatus,
+				machine.TalosVersion,
+				m.locked[machine.ID],
+			)
+
+			if machine.LastError != "" {
+				row += " " + errorStyle.Render(machine.LastError)
+			}
+
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return header, []string{headerStyle.Render("(none)")}
+	}
+
+	selected := m.selected()
+	rows[selected] = selectedStyle.Render(rows[selected])
+
+	return header, rows
+}
+
+// upgrades returns the panel of the upgrades which are in progress or failed in all clusters.
+func (m *model) upgrades() []string {
+	lines := []string{titleStyle.Render("Ongoing upgrades")}
+
+	for _, name := range m.clusters() {
+		doc := m.docs[name]
+
+		for _, upgrade := range []struct {
+			status *operations.UpgradeStatusDocument
+			kind   string
+		}{
+			{doc.TalosUpgrade, "Talos"},
+			{doc.KubernetesUpgrade, "Kubernetes"},
+		} {
+			if !upgradeOngoing(upgrade.status) {
+				continue
+			}
+
+			line := fmt.Sprintf("%-24s %-10s %-10s %s -> %s", name, upgrade.kind, upgrade.status.Phase, upgrade.status.LastVersion, upgrade.status.CurrentVersion)
+
+			if upgrade.status.Step != "" {
+				line += " " + upgrade.status.Step
+			}
+
+			if upgrade.status.Status != "" {
+				line += ": " + upgrade.status.Status
+			}
+
+			if upgrade.status.Error != "" {
+				line += " " + errorStyle.Render(upgrade.status.Error)
+			}
+
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 1 {
+		lines = append(lines, headerStyle.Render("(none)"))
+	}
+
+	return lines
+}
+
+// logPane returns the header and the last lines of the machine logs.
+func (m *model) logPane(height int) []string {
+	lines := []string{"", titleStyle.Render(fmt.Sprintf("Logs of %s", m.logs.machineID))}
+
+	logLines := m.logs.lines
+	if m.logs.err != nil {
+		logLines = append(logLines[:len(logLines):len(logLines)], errorStyle.Render(m.logs.err.Error()))
+	}
+
+	if height > len(lines) {
+		logLines = logLines[max(len(logLines)-(height-len(lines)), 0):]
+	}
+
+	return append(lines, logLines...)
+}
+
+func (m *model) help() string {
+	switch {
+	case m.logs != nil:
+		return "esc: close logs  L/U: lock/unlock  q: quit"
+	case m.level == levelMachines:
+		return "up/down: select  enter: logs  L/U: lock/unlock  esc: back  q: quit"
+	case m.level == levelMachineSets:
+		return "up/down: select  enter: machines  esc: back  q: quit"
+	default:
+		return "up/down: select  enter: machine sets  q: quit"
+	}
+}
+
+// upgradeSummary returns the phase of the ongoing upgrades of the cluster for the cluster list.
+func upgradeSummary(doc *operations.StatusDocument) string {
+	var upgrades []string
+
+	if upgradeOngoing(doc.TalosUpgrade) {
+		upgrades = append(upgrades, "Talos "+doc.TalosUpgrade.Phase)
+	}
+
+	if upgradeOngoing(doc.KubernetesUpgrade) {
+		upgrades = append(upgrades, "Kubernetes "+doc.KubernetesUpgrade.Phase)
+	}
+
+	return strings.Join(upgrades, ", ")
+}
+
+// upgradeOngoing returns true if the upgrade is in progress, being reverted or failed.
+func upgradeOngoing(status *operations.UpgradeStatusDocument) bool {
+	return status != nil && status.Phase != "Done" && status.Phase != "Unknown"
+}
+
+// scroll returns the window of the rows which contains the selected row.
+func scroll(rows []string, selected, height int) []string {
+	if len(rows) <= height {
+		return rows
+	}
+
+	start := max(selected-height+1, 0)
+
+	return rows[start : start+height]
+}
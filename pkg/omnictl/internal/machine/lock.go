@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package machine contains the cluster machine operations shared by the CLI commands.
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// SetLocked locks or unlocks the cluster machine by setting the locked annotation on its machine set node.
+//
+// No config updates, upgrades and downgrades are performed on the locked machines.
+func SetLocked(ctx context.Context, st state.State, machineID resource.ID, lock bool) error {
+	_, err := safe.StateUpdateWithConflicts(ctx, st,
+		resource.NewMetadata(resources.DefaultNamespace, omni.MachineSetNodeType, machineID, resource.VersionUndefined),
+		func(res *omni.MachineSetNode) error {
+			if lock {
+				res.Metadata().Annotations().Set(omni.MachineLocked, "")
+			} else {
+				res.Metadata().Annotations().Delete(omni.MachineLocked)
+			}
+
+			return nil
+		},
+	)
+	if err != nil {
+		if state.IsNotFoundError(err) {
+			return fmt.Errorf("no machine set nodes with id %q found", machineID)
+		}
+
+		return fmt.Errorf("failed to update machine %q: %w", machineID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package machine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/machine"
+)
+
+func TestSetLocked(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	machineSetNode := omni.NewMachineSetNode(resources.DefaultNamespace, "m1", omni.NewMachineSet(resources.DefaultNamespace, "prod-workers"))
+	require.NoError(t, st.Create(ctx, machineSetNode))
+
+	assertLocked := func(expected bool) {
+		res, err := safe.StateGet[*omni.MachineSetNode](ctx, st, machineSetNode.Metadata())
+		require.NoError(t, err)
+
+		_, locked := res.Metadata().Annotations().Get(omni.MachineLocked)
+		assert.Equal(t, expected, locked)
+	}
+
+	require.NoError(t, machine.SetLocked(ctx, st, "m1", true))
+	assertLocked(true)
+
+	// locking is idempotent
+	require.NoError(t, machine.SetLocked(ctx, st, "m1", true))
+	assertLocked(true)
+
+	require.NoError(t, machine.SetLocked(ctx, st, "m1", false))
+	assertLocked(false)
+
+	assert.EqualError(t, machine.SetLocked(ctx, st, "m2", true), `no machine set nodes with id "m2" found`)
+}
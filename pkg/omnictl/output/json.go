@@ -37,6 +37,20 @@ func (j *JSON) WriteHeader(_ *meta.ResourceDefinition, withEvents bool) error {
 
 // prepareEncodableData prepares the data of a resource to be encoded as JSON and populates it with some extra information.
 func (j *JSON) prepareEncodableData(r resource.Resource, event state.EventType) (map[string]any, error) {
+	data, err := ResourceData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.withEvents {
+		data["event"] = strings.ToLower(event.String())
+	}
+
+	return data, nil
+}
+
+// ResourceData converts the resource to the generic form used by the JSON and JSONPath outputs, with metadata and spec keys.
+func ResourceData(r resource.Resource) (map[string]any, error) {
 	out, err := resource.MarshalYAML(r)
 	if err != nil {
 		return nil, err
@@ -54,10 +68,6 @@ func (j *JSON) prepareEncodableData(r resource.Resource, event state.EventType)
 		return nil, err
 	}
 
-	if j.withEvents {
-		data["event"] = strings.ToLower(event.String())
-	}
-
 	return data, nil
 }
 
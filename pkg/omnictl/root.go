@@ -5,6 +5,7 @@
 package omnictl
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -22,6 +23,34 @@ var RootCmd = &cobra.Command{
 	DisableAutoGenTag: true,
 }
 
+// ExitCoder is implemented by the errors which define the exit code of omnictl, e.g. the cluster status errors.
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+// Execute runs the root command and returns the exit code of omnictl.
+//
+// The exit code is taken from the error if it implements ExitCoder, the other errors exit with code 1.
+func Execute() int {
+	return ExitCode(RootCmd.Execute())
+}
+
+// ExitCode returns the exit code of omnictl for the error returned by a command.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitCoder ExitCoder
+
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+
+	return 1
+}
+
 func init() {
 	RootCmd.PersistentFlags().StringVar(&access.CmdFlags.Omniconfig, "omniconfig", "",
 		fmt.Sprintf("The path to the omni configuration file. Defaults to '%s' env variable if set, otherwise the config directory according to the XDG specification.",
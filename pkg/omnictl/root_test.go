@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package omnictl_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/siderolabs/omni-client/pkg/omnictl"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct { //nolint:govet
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "no error",
+			expected: 0,
+		},
+		{
+			name:     "generic error",
+			err:      errors.New("failed"),
+			expected: 1,
+		},
+		{
+			name:     "degraded",
+			err:      &operations.StatusError{Cluster: "foo", Condition: operations.ClusterConditionDegraded},
+			expected: operations.StatusExitCodeDegraded,
+		},
+		{
+			name:     "wrapped not found",
+			err:      fmt.Errorf("error: %w", &operations.StatusError{Cluster: "foo", Condition: operations.ClusterConditionNotFound}),
+			expected: operations.StatusExitCodeNotFound,
+		},
+		{
+			name:     "unmet conditions",
+			err:      &operations.StatusError{Cluster: "foo", Condition: operations.ClusterConditionReady, Unmet: []string{"kubernetes-ready"}},
+			expected: operations.StatusExitCodeNotReady,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.expected, omnictl.ExitCode(tt.err))
+		})
+	}
+}
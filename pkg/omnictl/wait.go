@@ -0,0 +1,276 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package omnictl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/spf13/cobra"
+
+	"github.com/siderolabs/omni-client/pkg/client"
+	"github.com/siderolabs/omni-client/pkg/cosi/jsonpath"
+	"github.com/siderolabs/omni-client/pkg/cosi/labels"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omnictl/internal/access"
+	"github.com/siderolabs/omni-client/pkg/omnictl/output"
+)
+
+var waitCmdFlags struct {
+	namespace string
+	selector  string
+	condition string
+	timeout   time.Duration
+	all       bool
+}
+
+// waitCmd represents the wait (for resources) command.
+var waitCmd = &cobra.Command{
+	Use:   "wait <type> [<id>]",
+	Short: "Wait for a specific condition on one or many resources.",
+	Long: `Similar to 'kubectl wait', 'omnictl wait' watches the resources of the type until the condition is met.
+
+The condition is set with --for:
+  create                       a matching resource exists
+  delete                       a matching resource was deleted, or with --all no matching resources are left
+  jsonpath=<expr>[<op><value>] the JSONPath expression matches the value, operators are =, !=, >, >=, < and <=;
+                               without the operator the expression result should not be empty, false or zero
+
+By default the command exits as soon as the condition holds for one of the matching resources,
+with --all it holds for all of them. If the condition is not met before --timeout (30s by default, 0 waits forever), the command fails.`,
+	Example: `  # Wait for the cluster UUID to be assigned.
+  omnictl wait clusteruuid my-cluster --for create
+
+  # Wait for the manual etcd backup of the cluster to finish.
+  omnictl wait etcdmanualbackup my-cluster --for delete --timeout 10m
+
+  # Wait for all machines of the cluster to be connected.
+  omnictl wait machinestatus -l omni.sidero.dev/cluster=my-cluster --all --for 'jsonpath={.spec.connected}=true'`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return access.WithClient(waitResources(cmd, args))
+	},
+}
+
+// waitCondition is the parsed value of the --for flag.
+type waitCondition struct {
+	jsonPath *jsonpath.Condition
+	source   string
+	delete   bool
+}
+
+// String implements fmt.Stringer.
+func (condition waitCondition) String() string {
+	return condition.source
+}
+
+func parseWaitCondition(s string) (waitCondition, error) {
+	switch {
+	case s == "create":
+		return waitCondition{source: s}, nil
+	case s == "delete":
+		return waitCondition{source: s, delete: true}, nil
+	case strings.HasPrefix(s, "jsonpath="):
+		condition, err := jsonpath.ParseCondition(strings.TrimPrefix(s, "jsonpath="))
+		if err != nil {
+			return waitCondition{}, err
+		}
+
+		return waitCondition{jsonPath: condition, source: s}, nil
+	default:
+		return waitCondition{}, fmt.Errorf("unsupported condition %q, expected create, delete or jsonpath=<expr>[<op><value>]", s)
+	}
+}
+
+// satisfied reports whether the condition holds for the existing resource.
+func (condition waitCondition) satisfied(r resource.Resource) (bool, error) {
+	if condition.delete {
+		return false, nil
+	}
+
+	if condition.jsonPath == nil {
+		return true, nil
+	}
+
+	data, err := output.ResourceData(r)
+	if err != nil {
+		return false, err
+	}
+
+	return condition.jsonPath.Matches(data)
+}
+
+func waitResources(cmd *cobra.Command, args []string) func(ctx context.Context, client *client.Client) error {
+	return func(ctx context.Context, client *client.Client) error {
+		st := client.Omni().State()
+
+		condition, err := parseWaitCondition(waitCmdFlags.condition)
+		if err != nil {
+			return err
+		}
+
+		var (
+			resourceType = resource.Type(args[0]) //nolint:unconvert
+			resourceID   resource.ID
+		)
+
+		if len(args) > 1 {
+			resourceID = args[1]
+		}
+
+		rd, err := resolveResourceType(ctx, st, resourceType)
+		if err != nil {
+			return err
+		}
+
+		if !cmd.Flags().Lookup("namespace").Changed {
+			waitCmdFlags.namespace = rd.TypedSpec().DefaultNamespace
+		}
+
+		options := waitOptions{
+			condition: condition,
+			timeout:   waitCmdFlags.timeout,
+			all:       waitCmdFlags.all,
+		}
+
+		if waitCmdFlags.selector != "" {
+			if resourceID != "" {
+				return fmt.Errorf("cannot specify both resource ID and selector")
+			}
+
+			if options.labelQuery, err = labels.ParseQuery(waitCmdFlags.selector); err != nil {
+				return err
+			}
+		}
+
+		md := resource.NewMetadata(waitCmdFlags.namespace, rd.TypedSpec().Type, resourceID, resource.VersionUndefined)
+
+		return waitForCondition(ctx, st, md, options, cmd.OutOrStdout())
+	}
+}
+
+// waitOptions configure waitForCondition.
+type waitOptions struct {
+	labelQuery *resource.LabelQuery
+	condition  waitCondition
+	timeout    time.Duration
+	all        bool
+}
+
+// waitForCondition watches the resources of the kind until the condition holds, and reports the matching resources to the out.
+//
+// If the metadata has an ID, only the resource with that ID is watched.
+//
+//nolint:gocognit,gocyclo,cyclop
+func waitForCondition(ctx context.Context, st state.State, md resource.Metadata, options waitOptions, out io.Writer) error {
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	opts := []state.WatchKindOption{state.WithBootstrapContents(true)}
+
+	if md.ID() != "" {
+		opts = append(opts, state.WatchWithIDQuery(resource.IDRegexpMatch(regexp.MustCompile("^"+regexp.QuoteMeta(md.ID())+"$"))))
+	}
+
+	if options.labelQuery != nil {
+		opts = append(opts, state.WatchWithLabelQuery(resource.RawLabelQuery(*options.labelQuery)))
+	}
+
+	watchCh := make(chan state.Event)
+
+	if err := st.WatchKind(ctx, resource.NewMetadata(md.Namespace(), md.Type(), "", resource.VersionUndefined), watchCh, opts...); err != nil {
+		return err
+	}
+
+	var (
+		// matches maps the existing resources to whether the condition holds for them
+		matches      = map[resource.ID]bool{}
+		deleted      []resource.ID
+		bootstrapped bool
+		err          error
+	)
+
+	for {
+		var event state.Event
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("condition %q is not met: %w", options.condition, ctx.Err())
+		case event = <-watchCh:
+		}
+
+		switch event.Type {
+		case state.Errored:
+			return fmt.Errorf("watch error: %w", event.Error)
+		case state.Bootstrapped:
+			bootstrapped = true
+		case state.Created, state.Updated:
+			if matches[event.Resource.Metadata().ID()], err = options.condition.satisfied(event.Resource); err != nil {
+				return err
+			}
+		case state.Destroyed:
+			delete(matches, event.Resource.Metadata().ID())
+
+			deleted = append(deleted, event.Resource.Metadata().ID())
+		}
+
+		if !bootstrapped {
+			continue
+		}
+
+		if options.condition.delete {
+			if len(matches) == 0 || (!options.all && len(deleted) > 0) {
+				for _, id := range deleted {
+					fmt.Fprintf(out, "%s %s deleted\n", md.Type(), id)
+				}
+
+				return nil
+			}
+
+			continue
+		}
+
+		var satisfied []resource.ID
+
+		for id, match := range matches {
+			if match {
+				satisfied = append(satisfied, id)
+			}
+		}
+
+		if len(satisfied) == 0 || (options.all && len(satisfied) < len(matches)) {
+			continue
+		}
+
+		slices.Sort(satisfied)
+
+		for _, id := range satisfied {
+			fmt.Fprintf(out, "%s %s condition met\n", md.Type(), id)
+		}
+
+		return nil
+	}
+}
+
+func init() {
+	waitCmd.Flags().StringVarP(&waitCmdFlags.namespace, "namespace", "n", resources.DefaultNamespace, "The resource namespace.")
+	waitCmd.Flags().StringVarP(&waitCmdFlags.selector, "selector", "l", "", "Selector (label query) to filter on, supports '=' and '==' (e.g. -l key1=value1,key2=value2)")
+	waitCmd.Flags().StringVar(&waitCmdFlags.condition, "for", "create", "The condition to wait for: create, delete or jsonpath=<expr>[<op><value>].")
+	waitCmd.Flags().DurationVar(&waitCmdFlags.timeout, "timeout", 30*time.Second, "The maximum time to wait, zero means wait forever.")
+	waitCmd.Flags().BoolVar(&waitCmdFlags.all, "all", false, "Wait for the condition to hold for all matching resources instead of any of them.")
+
+	RootCmd.AddCommand(waitCmd)
+}
@@ -0,0 +1,300 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package omnictl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// watchedState signals when the watch is set up, so the test changes the resources after the bootstrap.
+type watchedState struct {
+	state.State
+	watching chan struct{}
+}
+
+func (st *watchedState) WatchKind(ctx context.Context, kind resource.Kind, ch chan<- state.Event, opts ...state.WatchKindOption) error {
+	if err := st.State.WatchKind(ctx, kind, ch, opts...); err != nil {
+		return err
+	}
+
+	close(st.watching)
+
+	return nil
+}
+
+type waitResult struct {
+	err    error
+	output string
+}
+
+// startWait runs waitForCondition in the background, it returns after the watch is set up.
+func startWait(ctx context.Context, t *testing.T, st state.State, id resource.ID, options waitOptions) <-chan waitResult {
+	t.Helper()
+
+	watched := &watchedState{State: st, watching: make(chan struct{})}
+	resultCh := make(chan waitResult, 1)
+
+	go func() {
+		var out strings.Builder
+
+		err := waitForCondition(ctx, watched, resource.NewMetadata(resources.DefaultNamespace, omni.MachineStatusType, id, resource.VersionUndefined), options, &out)
+
+		resultCh <- waitResult{output: out.String(), err: err}
+	}()
+
+	select {
+	case <-watched.watching:
+	case res := <-resultCh:
+		select {
+		case <-watched.watching:
+			// the condition was met by the initial contents
+			resultCh <- res
+		default:
+			require.FailNow(t, "wait returned before watching", "error: %v", res.err)
+		}
+	case <-ctx.Done():
+		require.FailNow(t, "timeout")
+	}
+
+	return resultCh
+}
+
+func waitDone(ctx context.Context, t *testing.T, resultCh <-chan waitResult) waitResult {
+	t.Helper()
+
+	select {
+	case res := <-resultCh:
+		return res
+	case <-ctx.Done():
+		require.FailNow(t, "timeout")
+	}
+
+	return waitResult{}
+}
+
+func assertWaiting(t *testing.T, resultCh <-chan waitResult) {
+	t.Helper()
+
+	select {
+	case res := <-resultCh:
+		require.FailNow(t, "wait returned early", "output: %q, error: %v", res.output, res.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func createMachineStatus(ctx context.Context, t *testing.T, st state.State, id, cluster string, connected bool) {
+	t.Helper()
+
+	machineStatus := omni.NewMachineStatus(resources.DefaultNamespace, id)
+	machineStatus.TypedSpec().Value.Connected = connected
+
+	if cluster != "" {
+		machineStatus.Metadata().Labels().Set(omni.LabelCluster, cluster)
+	}
+
+	require.NoError(t, st.Create(ctx, machineStatus))
+}
+
+func setConnected(ctx context.Context, t *testing.T, st state.State, id string) {
+	t.Helper()
+
+	_, err := safe.StateUpdateWithConflicts(ctx, st, omni.NewMachineStatus(resources.DefaultNamespace, id).Metadata(), func(res *omni.MachineStatus) error {
+		res.TypedSpec().Value.Connected = true
+
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func mustParseWaitCondition(t *testing.T, s string) waitCondition {
+	t.Helper()
+
+	condition, err := parseWaitCondition(s)
+	require.NoError(t, err)
+
+	return condition
+}
+
+//nolint:maintidx
+func TestWaitForCondition(t *testing.T) {
+	t.Parallel()
+
+	t.Run("create", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		resultCh := startWait(ctx, t, st, "m1", waitOptions{condition: mustParseWaitCondition(t, "create")})
+
+		createMachineStatus(ctx, t, st, "m2", "", false)
+
+		assertWaiting(t, resultCh)
+
+		createMachineStatus(ctx, t, st, "m1", "", false)
+
+		res := waitDone(ctx, t, resultCh)
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m1 condition met\n", res.output)
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "", true)
+		createMachineStatus(ctx, t, st, "m2", "", false)
+
+		// the existing resources are evaluated once the initial contents are received
+		res := waitDone(ctx, t, startWait(ctx, t, st, "", waitOptions{condition: mustParseWaitCondition(t, "jsonpath={.spec.connected}=true")}))
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m1 condition met\n", res.output)
+
+		// nothing to delete
+		res = waitDone(ctx, t, startWait(ctx, t, st, "m3", waitOptions{condition: mustParseWaitCondition(t, "delete")}))
+		require.NoError(t, res.err)
+		assert.Empty(t, res.output)
+	})
+
+	t.Run("selector all", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "prod", false)
+		createMachineStatus(ctx, t, st, "m2", "prod", false)
+		createMachineStatus(ctx, t, st, "m3", "staging", false)
+
+		resultCh := startWait(ctx, t, st, "", waitOptions{
+			condition:  mustParseWaitCondition(t, "jsonpath={.spec.connected}=true"),
+			labelQuery: &resource.LabelQuery{Terms: []resource.LabelTerm{{Key: omni.LabelCluster, Op: resource.LabelOpEqual, Value: []string{"prod"}}}},
+			all:        true,
+		})
+
+		setConnected(ctx, t, st, "m1")
+		setConnected(ctx, t, st, "m3")
+
+		assertWaiting(t, resultCh)
+
+		setConnected(ctx, t, st, "m2")
+
+		res := waitDone(ctx, t, resultCh)
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m1 condition met\nMachineStatuses.omni.sidero.dev m2 condition met\n", res.output)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "", false)
+		createMachineStatus(ctx, t, st, "m2", "", false)
+
+		resultCh := startWait(ctx, t, st, "", waitOptions{condition: mustParseWaitCondition(t, "delete")})
+
+		require.NoError(t, st.Destroy(ctx, omni.NewMachineStatus(resources.DefaultNamespace, "m2").Metadata()))
+
+		res := waitDone(ctx, t, resultCh)
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m2 deleted\n", res.output)
+	})
+
+	t.Run("delete all", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "", false)
+		createMachineStatus(ctx, t, st, "m2", "", false)
+
+		resultCh := startWait(ctx, t, st, "", waitOptions{condition: mustParseWaitCondition(t, "delete"), all: true})
+
+		require.NoError(t, st.Destroy(ctx, omni.NewMachineStatus(resources.DefaultNamespace, "m2").Metadata()))
+
+		assertWaiting(t, resultCh)
+
+		require.NoError(t, st.Destroy(ctx, omni.NewMachineStatus(resources.DefaultNamespace, "m1").Metadata()))
+
+		res := waitDone(ctx, t, resultCh)
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m2 deleted\nMachineStatuses.omni.sidero.dev m1 deleted\n", res.output)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "", false)
+
+		res := waitDone(ctx, t, startWait(ctx, t, st, "m1", waitOptions{
+			condition: mustParseWaitCondition(t, "jsonpath={.spec.connected}=true"),
+			timeout:   200 * time.Millisecond,
+		}))
+		require.ErrorIs(t, res.err, context.DeadlineExceeded)
+		assert.EqualError(t, res.err, `condition "jsonpath={.spec.connected}=true" is not met: context deadline exceeded`)
+		assert.Empty(t, res.output)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+		createMachineStatus(ctx, t, st, "m1", "", false)
+
+		// zero timeout waits until the condition is met
+		resultCh := startWait(ctx, t, st, "m1", waitOptions{condition: mustParseWaitCondition(t, "jsonpath={.spec.connected}=true")})
+
+		assertWaiting(t, resultCh)
+
+		setConnected(ctx, t, st, "m1")
+
+		res := waitDone(ctx, t, resultCh)
+		require.NoError(t, res.err)
+		assert.Equal(t, "MachineStatuses.omni.sidero.dev m1 condition met\n", res.output)
+	})
+}
+
+func TestWaitTimeoutDefault(t *testing.T) {
+	// like kubectl wait, the command doesn't wait forever unless asked to
+	assert.Equal(t, "30s", waitCmd.Flags().Lookup("timeout").DefValue)
+}
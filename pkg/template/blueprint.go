@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RenderBlueprint renders the cluster template blueprint using the values, and returns the resulting template.
+//
+// Blueprint is a cluster template which uses Go template syntax to reference the values, e.g. `name: {{ .clusterName }}`.
+// Values is a YAML document with the values for the blueprint variables, all referenced variables should be set.
+func RenderBlueprint(blueprint, values io.Reader) (io.Reader, error) {
+	blueprintRaw, err := io.ReadAll(blueprint)
+	if err != nil {
+		return nil, fmt.Errorf("error reading blueprint: %w", err)
+	}
+
+	var data map[string]any
+
+	if err = yaml.NewDecoder(values).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error decoding blueprint values: %w", err)
+	}
+
+	tmpl, err := template.New("blueprint").Option("missingkey=error").Parse(string(blueprintRaw))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing blueprint: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering blueprint: %w", err)
+	}
+
+	return &buf, nil
+}
@@ -0,0 +1,503 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// Cluster describes the cluster-wide settings of the template.
+type Cluster struct {
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Name of the cluster.
+	Name string
+
+	// KubernetesVersion is the Kubernetes version, e.g. v1.29.1.
+	KubernetesVersion string
+
+	// TalosVersion is the Talos version, e.g. v1.6.4.
+	TalosVersion string
+
+	// Cluster-wide patches.
+	Patches []Patch
+
+	// EtcdBackupInterval enables etcd backups with the interval.
+	EtcdBackupInterval time.Duration
+
+	// DiskEncryption enables KMS encryption.
+	DiskEncryption bool
+
+	// Schematic customization of all cluster machines.
+	Schematic Schematic
+
+	// AddressPool is the static address pool of the machines of the static machine sets.
+	AddressPool *AddressPool
+
+	// Link selects the network link of the machines with the static addresses.
+	Link *LinkSelector
+
+	// EnableWorkloadProxy enables workload proxy.
+	EnableWorkloadProxy bool
+}
+
+// MachineSet describes the control plane or a workers machine set of the template.
+//
+// Either Machines or MachineClass should be set.
+type MachineSet struct {
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// MachineClass picks the machines from the machine class.
+	MachineClass *MachineClass
+
+	// UpdateStrategy is the update strategy of the workers machine set.
+	UpdateStrategy *UpdateStrategy
+
+	// DeleteStrategy is the delete strategy of the workers machine set.
+	DeleteStrategy *UpdateStrategy
+
+	// Name of the workers machine set, empty for the default workers.
+	Name string
+
+	// Machines are IDs of the machines in the machine set.
+	Machines []string
+
+	// Machine set patches.
+	Patches []Patch
+
+	// Schematic customization of the machine set machines.
+	Schematic Schematic
+
+	// InstallDiskSelector selects the install disk of the machine set machines, it is overridden by the machine settings.
+	InstallDiskSelector *DiskSelector
+
+	// InstallDisk is the disk to install Talos to on the machine set machines, it is overridden by the machine settings.
+	InstallDisk string
+
+	// Hostname is the hostname pattern of the machine set machines, e.g. prod-cp-{{ .Index }}.
+	Hostname string
+
+	// NodeLabels are the Kubernetes labels of the machine set nodes.
+	NodeLabels map[string]string
+
+	// NodeTaints are the Kubernetes taints of the machine set nodes in the value:Effect format.
+	NodeTaints map[string]string
+
+	// AddressPool is the static address pool of the machine set machines, it overrides the cluster address pool.
+	AddressPool *AddressPool
+
+	// Link selects the network link of the machine set machines, it overrides the cluster link selector.
+	Link *LinkSelector
+}
+
+// MachineClass selects the machines of the machine set from a machine class.
+type MachineClass struct {
+	// Name of the machine class.
+	Name string
+
+	// Size is the number of machines to pull from the machine class.
+	Size MachineClassSize
+}
+
+// MachineClassSize is the number of machines pulled from a machine class.
+type MachineClassSize struct {
+	count     uint32
+	unlimited bool
+}
+
+// MachineCount pulls the fixed number of machines from the machine class.
+func MachineCount(count uint32) MachineClassSize {
+	return MachineClassSize{count: count}
+}
+
+// UnlimitedMachines pulls all available machines from the machine class.
+func UnlimitedMachines() MachineClassSize {
+	return MachineClassSize{unlimited: true}
+}
+
+// UpdateStrategy is the update or delete strategy of the machine set.
+type UpdateStrategy struct {
+	// MaxParallelism is the number of machines updated at once with the rolling strategy.
+	MaxParallelism uint32
+
+	// Rolling enables the rolling strategy, otherwise all machines are updated at once.
+	Rolling bool
+}
+
+// Machine describes the settings of a single machine of the template.
+type Machine struct {
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// ID of the machine.
+	ID string
+
+	// InstallDiskSelector selects the disk to install Talos to, see Template.ResolveInstallDisks.
+	InstallDiskSelector *DiskSelector
+
+	// InstallDisk is the disk to install Talos to.
+	InstallDisk string
+
+	// Machine patches.
+	Patches []Patch
+
+	// Schematic customization of the machine.
+	Schematic Schematic
+
+	// Hostname of the machine, it might be a pattern, it overrides the hostname pattern of the machine set.
+	Hostname string
+
+	// NodeLabels are the Kubernetes labels of the node.
+	NodeLabels map[string]string
+
+	// NodeTaints are the Kubernetes taints of the node in the value:Effect format.
+	NodeTaints map[string]string
+
+	// Address is the static address of the machine in the address pool of its machine set or cluster.
+	Address string
+
+	// Link selects the network link of the machine, it overrides the link selector of the machine set or cluster.
+	Link *LinkSelector
+
+	// Locked machines are not updated by the machine set.
+	Locked bool
+}
+
+// DiskSelector selects the install disk by the hardware criteria, all criteria which are set should match.
+type DiskSelector struct {
+	// MinSize is the minimum disk size, e.g. 100GB.
+	MinSize string
+
+	// MaxSize is the maximum disk size, e.g. 2TB.
+	MaxSize string
+
+	// Model is the glob pattern of the disk model.
+	Model string
+
+	// Serial is the glob pattern of the disk serial.
+	Serial string
+
+	// Type of the disk: nvme, ssd, hdd or sd.
+	Type string
+
+	// BusPath is the glob pattern of the disk bus path.
+	BusPath string
+}
+
+// AddressPool is a range of the static addresses allocated to the machines, see Template.ResolveNetworkLinks.
+type AddressPool struct {
+	// CIDR of the pool, e.g. 10.5.0.0/24.
+	CIDR string
+
+	// Start is the first address to allocate, by default the first address of the CIDR.
+	Start string
+
+	// Gateway is the address of the default gateway.
+	Gateway string
+
+	// Nameservers are the addresses of the DNS servers.
+	Nameservers []string
+
+	// VLAN is the VLAN ID, the addresses are configured on the VLAN interface when set.
+	VLAN uint16
+}
+
+// LinkSelector selects the network link of the machine, all criteria which are set should match.
+type LinkSelector struct {
+	// MAC is the glob pattern of the hardware address of the link.
+	MAC string
+
+	// Name is the glob pattern of the Linux name of the link.
+	Name string
+}
+
+// Schematic is the Image Factory schematic customization, see Template.ResolveSchematics.
+//
+// The customization of the most specific level is used as a whole, levels are not merged.
+type Schematic struct {
+	// Meta are the initial META partition values.
+	Meta map[uint32]string
+
+	// SystemExtensions are the names of the system extensions, e.g. siderolabs/iscsi-tools.
+	SystemExtensions []string
+
+	// ExtraKernelArgs are the extra kernel arguments.
+	ExtraKernelArgs []string
+}
+
+// Patch is a Talos machine configuration patch.
+//
+// Either File or Inline should be set.
+type Patch struct {
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Inline patch content.
+	Inline map[string]any
+
+	// Name of the patch, mandatory for inline patches if IDOverride is not set.
+	Name string
+
+	// IDOverride overrides the generated ID of the patch.
+	IDOverride string
+
+	// File is the path to the file containing the patch.
+	File string
+}
+
+// Builder builds a cluster template programmatically.
+//
+// The template built is the same as the one loaded from the equivalent YAML, see Template.Encode.
+type Builder struct {
+	models models.List
+}
+
+// NewBuilder creates a template builder for the cluster.
+func NewBuilder(cluster Cluster) *Builder {
+	return &Builder{
+		models: models.List{
+			&models.Cluster{
+				Meta:        models.Meta{Kind: models.KindCluster},
+				Name:        cluster.Name,
+				Descriptors: descriptors(cluster.Labels, cluster.Annotations),
+				Kubernetes:  models.KubernetesCluster{Version: cluster.KubernetesVersion},
+				Talos:       models.TalosCluster{Version: cluster.TalosVersion},
+				Features: models.Features{
+					DiskEncryption:      cluster.DiskEncryption,
+					EnableWorkloadProxy: cluster.EnableWorkloadProxy,
+					BackupConfiguration: models.BackupConfiguration{
+						Interval: cluster.EtcdBackupInterval,
+					},
+				},
+				Schematic: schematic(cluster.Schematic),
+				Network:   network(cluster.AddressPool, cluster.Link),
+				Patches:   patches(cluster.Patches),
+			},
+		},
+	}
+}
+
+// ControlPlane adds the control plane machine set.
+func (b *Builder) ControlPlane(machineSet MachineSet) *Builder {
+	b.models = append(b.models, &models.ControlPlane{MachineSet: buildMachineSet(models.KindControlPlane, machineSet)})
+
+	return b
+}
+
+// Workers adds a workers machine set.
+func (b *Builder) Workers(machineSet MachineSet) *Builder {
+	b.models = append(b.models, &models.Workers{MachineSet: buildMachineSet(models.KindWorkers, machineSet)})
+
+	return b
+}
+
+// Machine adds the machine settings.
+func (b *Builder) Machine(machine Machine) *Builder {
+	b.models = append(b.models, &models.Machine{
+		Meta:        models.Meta{Kind: models.KindMachine},
+		Name:        models.MachineID(machine.ID),
+		Descriptors: descriptors(machine.Labels, machine.Annotations),
+		Locked:      machine.Locked,
+		Install:     install(machine.InstallDisk, machine.InstallDiskSelector),
+		Schematic:   schematic(machine.Schematic),
+		NodeSettings: models.NodeSettings{
+			Hostname:   machine.Hostname,
+			NodeLabels: machine.NodeLabels,
+			NodeTaints: machine.NodeTaints,
+		},
+		Network: models.MachineNetwork{
+			Address: machine.Address,
+			Link:    linkSelector(machine.Link),
+		},
+		Patches: patches(machine.Patches),
+	})
+
+	return b
+}
+
+// Custom adds a document of the custom template kind, see RegisterKind.
+func (b *Builder) Custom(model Model) *Builder {
+	b.models = append(b.models, &customModel{Model: model})
+
+	return b
+}
+
+// Build validates and returns the template.
+func (b *Builder) Build() (*Template, error) {
+	template := &Template{models: b.models}
+
+	if err := template.Validate(); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// Encode the template as the multi-document YAML.
+//
+// The output can be loaded back with Load.
+func (t *Template) Encode(w io.Writer) (err error) {
+	encoder := yaml.NewEncoder(w)
+
+	defer func() {
+		err = errors.Join(err, encoder.Close())
+	}()
+
+	encoder.SetIndent(2)
+
+	for _, model := range t.models {
+		if err = encoder.Encode(model); err != nil {
+			return fmt.Errorf("error encoding model: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func buildMachineSet(kind string, machineSet MachineSet) models.MachineSet {
+	result := models.MachineSet{
+		Meta:           models.Meta{Kind: kind},
+		Name:           machineSet.Name,
+		Descriptors:    descriptors(machineSet.Labels, machineSet.Annotations),
+		UpdateStrategy: updateStrategy(machineSet.UpdateStrategy),
+		DeleteStrategy: updateStrategy(machineSet.DeleteStrategy),
+		Install:        install(machineSet.InstallDisk, machineSet.InstallDiskSelector),
+		Schematic:      schematic(machineSet.Schematic),
+		NodeSettings: models.NodeSettings{
+			Hostname:   machineSet.Hostname,
+			NodeLabels: machineSet.NodeLabels,
+			NodeTaints: machineSet.NodeTaints,
+		},
+		Network: network(machineSet.AddressPool, machineSet.Link),
+		Patches: patches(machineSet.Patches),
+	}
+
+	for _, machineID := range machineSet.Machines {
+		result.Machines = append(result.Machines, models.MachineID(machineID))
+	}
+
+	if machineSet.MachineClass != nil {
+		size := models.Size{Value: machineSet.MachineClass.Size.count}
+
+		if machineSet.MachineClass.Size.unlimited {
+			size = models.Size{AllocationType: specs.MachineSetSpec_MachineClass_Unlimited}
+		}
+
+		result.MachineClass = &models.MachineClassConfig{
+			Name: machineSet.MachineClass.Name,
+			Size: size,
+		}
+	}
+
+	return result
+}
+
+func updateStrategy(strategy *UpdateStrategy) *models.UpdateStrategyConfig {
+	if strategy == nil {
+		return nil
+	}
+
+	strategyType := models.UpdateStrategyType(specs.MachineSetSpec_Unset)
+
+	if strategy.Rolling {
+		strategyType = models.UpdateStrategyType(specs.MachineSetSpec_Rolling)
+	}
+
+	result := &models.UpdateStrategyConfig{Type: &strategyType}
+
+	if strategy.MaxParallelism > 0 {
+		result.Rolling = &models.RollingUpdateStrategyConfig{MaxParallelism: strategy.MaxParallelism}
+	}
+
+	return result
+}
+
+func patches(patchList []Patch) models.PatchList {
+	if len(patchList) == 0 {
+		return nil
+	}
+
+	result := make(models.PatchList, 0, len(patchList))
+
+	for _, patch := range patchList {
+		result = append(result, models.Patch{
+			Name:        patch.Name,
+			IDOverride:  patch.IDOverride,
+			Descriptors: descriptors(patch.Labels, patch.Annotations),
+			File:        patch.File,
+			Inline:      patch.Inline,
+		})
+	}
+
+	return result
+}
+
+func install(disk string, selector *DiskSelector) models.MachineInstall {
+	result := models.MachineInstall{Disk: disk}
+
+	if selector != nil {
+		result.DiskSelector = &models.DiskSelector{
+			Model:   selector.Model,
+			Serial:  selector.Serial,
+			Type:    selector.Type,
+			BusPath: selector.BusPath,
+		}
+
+		if selector.MinSize != "" || selector.MaxSize != "" {
+			result.DiskSelector.Size = &models.DiskSizeRange{Min: selector.MinSize, Max: selector.MaxSize}
+		}
+	}
+
+	return result
+}
+
+func network(pool *AddressPool, link *LinkSelector) models.Network {
+	result := models.Network{Link: linkSelector(link)}
+
+	if pool != nil {
+		result.AddressPool = &models.AddressPool{
+			CIDR:        pool.CIDR,
+			Start:       pool.Start,
+			Gateway:     pool.Gateway,
+			Nameservers: pool.Nameservers,
+			VLAN:        pool.VLAN,
+		}
+	}
+
+	return result
+}
+
+func linkSelector(selector *LinkSelector) *models.LinkSelector {
+	if selector == nil {
+		return nil
+	}
+
+	return &models.LinkSelector{MAC: selector.MAC, Name: selector.Name}
+}
+
+func schematic(s Schematic) models.Schematic {
+	return models.Schematic{
+		SystemExtensions: s.SystemExtensions,
+		ExtraKernelArgs:  s.ExtraKernelArgs,
+		Meta:             s.Meta,
+	}
+}
+
+func descriptors(labels, annotations map[string]string) models.Descriptors {
+	return models.Descriptors{
+		Labels:      labels,
+		Annotations: annotations,
+	}
+}
@@ -0,0 +1,171 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+func TestBuilder(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir("testdata"))
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	// same as testdata/cluster1.yaml
+	built, err := template.NewBuilder(template.Cluster{
+		Name:              "my-first-cluster",
+		KubernetesVersion: "v1.18.2",
+		TalosVersion:      "v1.3.0",
+		DiskEncryption:    true,
+		Patches: []template.Patch{
+			{File: "patches/my-cluster-patch.yaml"},
+			{File: "../testdata/patches/my-registry-mirrors.yaml"},
+		},
+	}).
+		ControlPlane(template.MachineSet{
+			Machines: []string{"430d882a-51a8-48b3-ae00-90c5b0b5b0b0", "4aed1106-6f44-4be9-9796-d4b5b0b5b0b0"},
+			Patches: []template.Patch{
+				{File: "patches/my-cp-patch.yaml"},
+				{
+					Name: "kubespan-enabled",
+					Inline: map[string]any{
+						"machine": map[string]any{"network": map[string]any{"kubespan": map[string]any{"enabled": true}}},
+					},
+				},
+			},
+		}).
+		Workers(template.MachineSet{
+			Machines: []string{"430d882a-51a8-48b3-ab00-d4b5b0b5b0b0"},
+		}).
+		Machine(template.Machine{
+			ID:          "430d882a-51a8-48b3-ae00-90c5b0b5b0b0",
+			InstallDisk: "/dev/vda",
+			Patches: []template.Patch{
+				{
+					Name: "my-address",
+					Inline: map[string]any{
+						"machine": map[string]any{
+							"network": map[string]any{
+								"interfaces": []any{
+									map[string]any{
+										"interface": "eth0",
+										"addresses": []any{"192.168.0.2/24"},
+										"routes":    []any{map[string]any{"gateway": "192.168.0.1"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}).
+		Machine(template.Machine{
+			ID:     "430d882a-51a8-48b3-ab00-d4b5b0b5b0b0",
+			Locked: true,
+		}).
+		Build()
+	require.NoError(t, err)
+
+	loaded, err := template.Load(bytes.NewReader(cluster1))
+	require.NoError(t, err)
+
+	assert.Equal(t, marshalResources(t, loaded), marshalResources(t, built))
+
+	// encoded template can be loaded back
+	var buf bytes.Buffer
+
+	require.NoError(t, built.Encode(&buf))
+
+	reloaded, err := template.Load(&buf)
+	require.NoError(t, err)
+
+	require.NoError(t, reloaded.Validate())
+
+	assert.Equal(t, marshalResources(t, built), marshalResources(t, reloaded))
+}
+
+func TestBuilderMachineClass(t *testing.T) {
+	built, err := template.NewBuilder(template.Cluster{
+		Name:              "machine-class",
+		KubernetesVersion: "v1.29.1",
+		TalosVersion:      "v1.6.4",
+	}).
+		ControlPlane(template.MachineSet{
+			MachineClass: &template.MachineClass{Name: "control-planes", Size: template.MachineCount(3)},
+		}).
+		Workers(template.MachineSet{
+			Name:           "large",
+			MachineClass:   &template.MachineClass{Name: "large", Size: template.UnlimitedMachines()},
+			UpdateStrategy: &template.UpdateStrategy{Rolling: true, MaxParallelism: 2},
+		}).
+		Build()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, built.Encode(&buf))
+
+	assert.Equal(t, strings.TrimSpace(`
+kind: Cluster
+name: machine-class
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machineClass:
+  name: control-planes
+  size: 3
+---
+kind: Workers
+name: large
+machineClass:
+  name: large
+  size: Unlimited
+updateStrategy:
+  type: Rolling
+  rolling:
+    maxParallelism: 2
+`), strings.TrimSpace(buf.String()))
+
+	_, err = template.NewBuilder(template.Cluster{Name: "invalid"}).Build()
+	require.Error(t, err)
+}
+
+// marshalResources marshals the ID, labels, annotations and spec of the template resources, so that the timestamps are not compared.
+func marshalResources(t *testing.T, tmpl *template.Template) string {
+	resources, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+
+	for _, r := range resources {
+		require.NoError(t, enc.Encode(map[string]any{
+			"id":          resource.String(r),
+			"labels":      r.Metadata().Labels().Raw(),
+			"annotations": r.Metadata().Annotations().Raw(),
+			"spec":        r.Spec(),
+		}))
+	}
+
+	return buf.String()
+}
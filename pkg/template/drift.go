@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// Drift is a three-way comparison of a resource: template vs. last applied vs. live.
+type Drift struct {
+	// TemplateModified is set when the template differs from the last applied state.
+	TemplateModified bool
+
+	// LiveModified is set when the live resource differs from the last applied state,
+	// i.e. the resource was modified outside of the template.
+	LiveModified bool
+
+	// Untracked is set when the live resource has no last applied state recorded.
+	//
+	// In that case neither TemplateModified nor LiveModified are set.
+	Untracked bool
+}
+
+// Conflict returns true if the resource was modified both in the template and outside of it.
+func (d Drift) Conflict() bool {
+	return d.TemplateModified && d.LiveModified
+}
+
+// Drift compares the live resource, the template resource and the last applied state.
+func (u UpdateChange) Drift() (Drift, error) {
+	return ResourceDrift(u.Old, u.New)
+}
+
+// ResourceDrift compares the live resource with the template resource using the last applied state recorded on the live resource.
+//
+// The template resource might be nil if the resource was removed from the template.
+func ResourceDrift(live, expected resource.Resource) (Drift, error) {
+	lastApplied, ok := live.Metadata().Annotations().Get(omni.LastAppliedTemplateHash)
+	if !ok {
+		return Drift{Untracked: true}, nil
+	}
+
+	liveHash, err := contentHash(live)
+	if err != nil {
+		return Drift{}, err
+	}
+
+	drift := Drift{
+		LiveModified:     liveHash != lastApplied,
+		TemplateModified: true,
+	}
+
+	if expected != nil {
+		expectedHash, err := contentHash(expected)
+		if err != nil {
+			return Drift{}, err
+		}
+
+		drift.TemplateModified = expectedHash != lastApplied
+	}
+
+	return drift, nil
+}
+
+// contentHash calculates the hash of the resource contents managed by the template.
+//
+// The hash doesn't include the last applied annotation itself.
+func contentHash(r resource.Resource) (string, error) {
+	annotations := make(map[string]string, len(r.Metadata().Annotations().Raw()))
+
+	for k, v := range r.Metadata().Annotations().Raw() {
+		if k != omni.LastAppliedTemplateHash {
+			annotations[k] = v
+		}
+	}
+
+	raw, err := yaml.Marshal(struct {
+		Labels      map[string]string `yaml:"labels,omitempty"`
+		Annotations map[string]string `yaml:"annotations,omitempty"`
+		Spec        any               `yaml:"spec"`
+	}{
+		Labels:      r.Metadata().Labels().Raw(),
+		Annotations: annotations,
+		Spec:        r.Spec(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling resource %s: %w", resource.String(r), err)
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// setLastApplied records the contents hash of the resource as the last applied state.
+func setLastApplied(r resource.Resource) error {
+	hash, err := contentHash(r)
+	if err != nil {
+		return err
+	}
+
+	r.Metadata().Annotations().Set(omni.LastAppliedTemplateHash, hash)
+
+	return nil
+}
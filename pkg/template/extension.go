@@ -0,0 +1,62 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"github.com/cosi-project/runtime/pkg/resource"
+
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// Meta should be embedded into the custom template kinds.
+type Meta struct {
+	Kind string `yaml:"kind"`
+}
+
+// TranslateContext is passed to the custom template kinds on translation.
+type TranslateContext struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string
+}
+
+// Model is a custom template kind.
+type Model interface {
+	// Validate the document.
+	Validate() error
+
+	// Translate the document into resources.
+	//
+	// Resources should have the cluster label set, and their types should be registered with RegisterResourceType.
+	Translate(TranslateContext) ([]resource.Resource, error)
+}
+
+// RegisterKind registers a custom template kind.
+//
+// The factory should return a pointer to the empty document, which is decoded from the template YAML.
+// Documents of the kind are validated and translated along with the built-in kinds.
+//
+// RegisterKind is not safe for concurrent use, it should be called during the initialization.
+func RegisterKind(kind string, factory func() Model) error {
+	return models.Register(kind, func() models.Model {
+		return &customModel{Model: factory()}
+	})
+}
+
+// customModel adapts Model to the internal model interface.
+type customModel struct {
+	Model
+}
+
+// Translate implements models.Model.
+func (m *customModel) Translate(ctx models.TranslateContext) ([]resource.Resource, error) {
+	return m.Model.Translate(TranslateContext{
+		ClusterName: ctx.ClusterName,
+	})
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m *customModel) MarshalYAML() (any, error) {
+	return m.Model, nil
+}
@@ -0,0 +1,144 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/siderolabs/gen/xslices"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// machineClassModel is a custom template kind which creates a machine class.
+type machineClassModel struct {
+	template.Meta `yaml:",inline"`
+
+	Name        string   `yaml:"name"`
+	MatchLabels []string `yaml:"matchLabels"`
+}
+
+func (m *machineClassModel) Validate() error {
+	if m.Name == "" {
+		return errors.New("machine class name is required")
+	}
+
+	return nil
+}
+
+func (m *machineClassModel) Translate(ctx template.TranslateContext) ([]resource.Resource, error) {
+	machineClass := omni.NewMachineClass(resources.DefaultNamespace, ctx.ClusterName+"-"+m.Name)
+	machineClass.Metadata().Labels().Set(omni.LabelCluster, ctx.ClusterName)
+	machineClass.TypedSpec().Value.MatchLabels = m.MatchLabels
+
+	return []resource.Resource{machineClass}, nil
+}
+
+// unregisteredModel produces resources of the type which is not registered.
+type unregisteredModel struct {
+	template.Meta `yaml:",inline"`
+}
+
+func (m *unregisteredModel) Validate() error { return nil }
+
+func (m *unregisteredModel) Translate(ctx template.TranslateContext) ([]resource.Resource, error) {
+	machineLabels := omni.NewMachineLabels(resources.DefaultNamespace, ctx.ClusterName)
+	machineLabels.Metadata().Labels().Set(omni.LabelCluster, ctx.ClusterName)
+
+	return []resource.Resource{machineLabels}, nil
+}
+
+func init() {
+	if err := template.RegisterKind("MachineClass", func() template.Model { return &machineClassModel{} }); err != nil {
+		panic(err)
+	}
+
+	if err := template.RegisterKind("Unregistered", func() template.Model { return &unregisteredModel{} }); err != nil {
+		panic(err)
+	}
+
+	if err := template.RegisterResourceType(template.ResourceType{Type: omni.MachineClassType, Order: 25, DeletionPhase: 1}); err != nil {
+		panic(err)
+	}
+}
+
+const customKindTemplate = `kind: Cluster
+name: custom
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machineClass:
+  name: custom-cp
+  size: 1
+---
+kind: MachineClass
+name: cp
+matchLabels:
+  - role=cp
+`
+
+func TestCustomKind(t *testing.T) {
+	ctx := context.Background()
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	require.Error(t, template.RegisterKind("Cluster", func() template.Model { return &machineClassModel{} }))
+	require.Error(t, template.RegisterResourceType(template.ResourceType{Type: omni.ClusterType, Order: 1}))
+
+	tmpl, err := template.Load(strings.NewReader(customKindTemplate))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	syncResult, err := tmpl.Sync(ctx, st)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"Clusters.omni.sidero.dev(default/custom)",
+		"MachineClasses.omni.sidero.dev(default/custom-cp)",
+		"MachineSets.omni.sidero.dev(default/custom-control-planes)",
+	}, xslices.Map(syncResult.Create, resource.String))
+
+	for _, r := range syncResult.Create {
+		require.NoError(t, st.Create(ctx, r))
+	}
+
+	// the custom kind is encoded back
+	var buf bytes.Buffer
+
+	require.NoError(t, tmpl.Encode(&buf))
+	assert.Contains(t, buf.String(), "kind: MachineClass\nname: cp\nmatchLabels:\n  - role=cp\n")
+
+	// custom resources are not torn down with the cluster, so they are destroyed explicitly
+	syncResult, err = tmpl.Delete(ctx, st)
+	require.NoError(t, err)
+
+	require.Len(t, syncResult.Destroy, 2)
+	assert.Equal(t, []string{
+		"Clusters.omni.sidero.dev(default/custom)",
+		"MachineClasses.omni.sidero.dev(default/custom-cp)",
+	}, xslices.Map(syncResult.Destroy[1], resource.String))
+
+	// resources of the unregistered types are rejected
+	tmpl, err = template.Load(strings.NewReader(customKindTemplate + "---\nkind: Unregistered\n"))
+	require.NoError(t, err)
+
+	_, err = tmpl.Translate()
+	require.ErrorContains(t, err, "unregistered type")
+}
@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// LoadFleet loads a multi-cluster template from the input.
+//
+// Each Cluster document starts a new cluster template, and the documents following it belong to that cluster.
+func LoadFleet(input io.Reader) ([]*Template, error) {
+	modelList, err := decodeModels(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*Template
+
+	for _, model := range modelList {
+		if _, ok := model.(*models.Cluster); ok {
+			templates = append(templates, &Template{})
+		}
+
+		if len(templates) == 0 {
+			return nil, errors.New("fleet template should start with a Cluster document")
+		}
+
+		templates[len(templates)-1].models = append(templates[len(templates)-1].models, model)
+	}
+
+	return templates, checkFleet(templates)
+}
+
+// LoadFleetDir loads a multi-cluster template from the YAML, JSON and Jsonnet files in the directory.
+//
+// Files are read in the lexical order, each file should start with a Cluster document, see LoadFleetFile.
+// All Jsonnet files of the directory are evaluated with the same options, the shared code should go to .libsonnet files.
+func LoadFleetDir(ctx context.Context, dir string, jsonnetOptions JsonnetOptions) ([]*Template, error) {
+	paths, err := FleetDirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*Template
+
+	for _, path := range paths {
+		fileTemplates, err := LoadFleetFile(ctx, path, jsonnetOptions)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %q: %w", path, err)
+		}
+
+		templates = append(templates, fileTemplates...)
+	}
+
+	return templates, checkFleet(templates)
+}
+
+// FleetDirFiles returns the paths of the template files in the directory loaded by LoadFleetDir, in the lexical order.
+func FleetDirFiles(dir string) ([]string, error) {
+	var paths []string
+
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json", "*.jsonnet"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+// LoadFleetFile loads a multi-cluster template from the file, see LoadFleet.
+//
+// Jsonnet files are evaluated first, see EvaluateJsonnet, and the files they import are reported by Template.Files.
+// The relative file paths in the templates are resolved against the directory of the file.
+func LoadFleetFile(ctx context.Context, path string, jsonnetOptions JsonnetOptions) ([]*Template, error) {
+	var (
+		templates []*Template
+		imports   []string
+		err       error
+	)
+
+	if IsJsonnet(path) {
+		if imports, err = jsonnetImports(path); err != nil {
+			return nil, err
+		}
+
+		var evaluated io.Reader
+
+		if evaluated, err = EvaluateJsonnet(ctx, path, jsonnetOptions); err != nil {
+			return nil, err
+		}
+
+		if templates, err = LoadFleet(evaluated); err != nil {
+			return nil, err
+		}
+	} else {
+		if templates, err = loadFleetFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, template := range templates {
+		template.SetDir(filepath.Dir(path))
+		template.imports = imports
+	}
+
+	return templates, nil
+}
+
+func loadFleetFile(path string) ([]*Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return LoadFleet(f)
+}
+
+func checkFleet(templates []*Template) error {
+	clusters := map[string]struct{}{}
+
+	for _, template := range templates {
+		clusterName, err := template.ClusterName()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := clusters[clusterName]; ok {
+			return fmt.Errorf("duplicate cluster %q in the fleet template", clusterName)
+		}
+
+		clusters[clusterName] = struct{}{}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/fleet/10-alpha-beta.yaml
+var fleetAlphaBeta []byte
+
+func TestLoadFleet(t *testing.T) {
+	templates, err := template.LoadFleet(bytes.NewReader(fleetAlphaBeta))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alpha", "beta"}, clusterNames(t, templates))
+
+	// documents are scoped by the preceding cluster
+	for _, tmpl := range templates {
+		require.NoError(t, tmpl.Validate())
+
+		clusterName, err := tmpl.ClusterName()
+		require.NoError(t, err)
+
+		resources, err := tmpl.Translate()
+		require.NoError(t, err)
+
+		for _, r := range resources {
+			if r.Metadata().Type() == omni.ClusterType {
+				continue
+			}
+
+			assert.Equal(t, clusterName, labelValue(r, omni.LabelCluster), resource.String(r))
+		}
+	}
+
+	for _, tt := range []struct {
+		name          string
+		data          string
+		expectedError string
+	}{
+		{
+			name:          "no cluster first",
+			data:          "kind: ControlPlane\nmachines: [1d7e3f0a-6b2c-4e8d-9f1a-0c5b7d3e2a10]\n---\n" + string(fleetAlphaBeta),
+			expectedError: "fleet template should start with a Cluster document",
+		},
+		{
+			name:          "duplicate cluster",
+			data:          string(fleetAlphaBeta) + "\n---\nkind: Cluster\nname: alpha\n",
+			expectedError: `duplicate cluster "alpha" in the fleet template`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := template.LoadFleet(strings.NewReader(tt.data))
+			require.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestLoadFleetDir(t *testing.T) {
+	templates, err := template.LoadFleetDir(context.Background(), "testdata/fleet", template.JsonnetOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alpha", "beta", "gamma"}, clusterNames(t, templates))
+}
+
+func clusterNames(t *testing.T, templates []*template.Template) []string {
+	names := make([]string, 0, len(templates))
+
+	for _, tmpl := range templates {
+		name, err := tmpl.ClusterName()
+		require.NoError(t, err)
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func labelValue(r resource.Resource, label string) string {
+	value, _ := r.Metadata().Labels().Get(label)
+
+	return value
+}
+
+func TestLoadFleetDirRelativePaths(t *testing.T) {
+	dir, err := filepath.Abs("testdata/fleet")
+	require.NoError(t, err)
+
+	// the referenced files are resolved against the template directory, not the working directory
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir(t.TempDir()))
+
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	templates, err := template.LoadFleetDir(context.Background(), dir, template.JsonnetOptions{})
+	require.NoError(t, err)
+	require.Len(t, templates, 3)
+
+	gamma := templates[2]
+
+	require.NoError(t, gamma.Validate())
+
+	resources, err := gamma.Translate()
+	require.NoError(t, err)
+
+	patches := map[string]string{}
+
+	for _, r := range resources {
+		if patch, ok := r.(*omni.ConfigPatch); ok {
+			name, _ := patch.Metadata().Annotations().Get("name")
+
+			patches[name] = patch.TypedSpec().Value.GetData()
+		}
+	}
+
+	assert.Contains(t, patches["gamma-sysctls"], `net.core.somaxconn: "1024"`)
+	assert.Contains(t, patches["gamma-registry-auth"], "password: gamma-password")
+}
+
+func TestTemplateFiles(t *testing.T) {
+	dir, err := filepath.Abs("testdata/fleet")
+	require.NoError(t, err)
+
+	templates, err := template.LoadFleetDir(context.Background(), dir, template.JsonnetOptions{})
+	require.NoError(t, err)
+	require.Len(t, templates, 3)
+
+	assert.Empty(t, templates[0].Files())
+	assert.Equal(t, []string{
+		filepath.Join(dir, "patches", "gamma-sysctls.yaml"),
+		filepath.Join(dir, "secrets", "gamma-registry-password"),
+	}, templates[2].Files())
+}
+
+func TestLoadFleetDirJsonnet(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, contents := range map[string]string{
+		"10-alpha-beta.yaml": string(fleetAlphaBeta),
+		"lib.libsonnet": `{
+  cluster(name):: { kind: 'Cluster', name: name, kubernetes: { version: 'v1.29.1' }, talos: { version: 'v1.6.4' } },
+}
+`,
+		"20-gamma.jsonnet": `local lib = import 'lib.libsonnet';
+
+[
+  lib.cluster(std.extVar('name')),
+  { kind: 'ControlPlane', machines: ['1a2b3c4d-0000-4000-8000-000000000003'] },
+]
+`,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+
+	paths, err := template.FleetDirFiles(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{filepath.Join(dir, "10-alpha-beta.yaml"), filepath.Join(dir, "20-gamma.jsonnet")}, paths)
+
+	templates, err := template.LoadFleetDir(context.Background(), dir, template.JsonnetOptions{ExtVars: map[string]string{"name": "gamma"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alpha", "beta", "gamma"}, clusterNames(t, templates))
+
+	gamma := templates[2]
+
+	require.NoError(t, gamma.Validate())
+
+	// the imports of the Jsonnet template are reported with the referenced files
+	assert.Equal(t, []string{filepath.Join(dir, "lib.libsonnet")}, gamma.Files())
+
+	_, err = template.LoadFleetDir(context.Background(), dir, template.JsonnetOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "20-gamma.jsonnet")
+}
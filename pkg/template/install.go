@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/xslices"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// NeedsInstallDisks returns true if the template has install disk selectors which should be resolved before the translation.
+func (t *Template) NeedsInstallDisks() bool {
+	return len(t.models.DiskSelectors()) > 0
+}
+
+// ResolveInstallDisks resolves the install disk selectors against the block devices of the machines.
+//
+// Each selector should match exactly one disk of the machine.
+func (t *Template) ResolveInstallDisks(ctx context.Context, st state.State) error {
+	selectors := t.models.DiskSelectors()
+	if len(selectors) == 0 {
+		return nil
+	}
+
+	machineIDs := make([]models.MachineID, 0, len(selectors))
+
+	for machineID := range selectors {
+		machineIDs = append(machineIDs, machineID)
+	}
+
+	slices.Sort(machineIDs)
+
+	var multiErr error
+
+	installDisks := make(map[models.MachineID]string, len(selectors))
+
+	for _, machineID := range machineIDs {
+		disk, err := resolveInstallDisk(ctx, st, machineID, selectors[machineID])
+		if err != nil {
+			multiErr = multierror.Append(multiErr, err)
+
+			continue
+		}
+
+		installDisks[machineID] = disk
+	}
+
+	if multiErr != nil {
+		return multiErr
+	}
+
+	t.installDisks = installDisks
+
+	return nil
+}
+
+func resolveInstallDisk(ctx context.Context, st state.State, machineID models.MachineID, selector *models.DiskSelector) (string, error) {
+	machineStatus, err := safe.StateGetByID[*omni.MachineStatus](ctx, st, string(machineID))
+	if err != nil {
+		return "", fmt.Errorf("failed to get status of machine %q: %w", machineID, err)
+	}
+
+	blockDevices := machineStatus.TypedSpec().Value.GetHardware().GetBlockdevices()
+	if len(blockDevices) == 0 {
+		return "", fmt.Errorf("machine %q has no block devices reported", machineID)
+	}
+
+	matches := xslices.Filter(blockDevices, selector.Match)
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no disks of machine %q match the install disk selector", machineID)
+	case 1:
+		return matches[0].GetLinuxName(), nil
+	default:
+		return "", fmt.Errorf("install disk selector of machine %q is ambiguous, it matches disks %q", machineID,
+			xslices.Map(matches, (*specs.MachineStatusSpec_HardwareStatus_BlockDevice).GetLinuxName))
+	}
+}
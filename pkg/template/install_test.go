@@ -0,0 +1,176 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/cluster-install-disks.yaml
+var clusterInstallDisks []byte
+
+type blockDevice = specs.MachineStatusSpec_HardwareStatus_BlockDevice
+
+const (
+	gb = 1000 * 1000 * 1000
+	tb = 1000 * gb
+)
+
+func createMachineStatus(ctx context.Context, t *testing.T, st state.State, id string, blockDevices ...*blockDevice) {
+	machineStatus := omni.NewMachineStatus(resources.DefaultNamespace, id)
+	machineStatus.TypedSpec().Value.Hardware = &specs.MachineStatusSpec_HardwareStatus{
+		Blockdevices: blockDevices,
+	}
+
+	require.NoError(t, st.Create(ctx, machineStatus))
+}
+
+func TestInstallDisks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	tmpl, err := template.Load(bytes.NewReader(clusterInstallDisks))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+	require.True(t, tmpl.NeedsInstallDisks())
+
+	_, err = tmpl.Translate()
+	require.ErrorContains(t, err, `install disk of machine "1a2b3c4d-0000-4000-8000-000000000001" is not resolved`)
+
+	createMachineStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000001",
+		&blockDevice{LinuxName: "/dev/sda", Type: "ssd", Size: 500 * gb},
+		&blockDevice{LinuxName: "/dev/nvme0n1", Type: "nvme", Size: 500 * gb},
+		&blockDevice{LinuxName: "/dev/nvme1n1", Type: "nvme", Size: 2 * tb},
+	)
+	createMachineStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000002",
+		&blockDevice{LinuxName: "/dev/sda", Model: "Samsung SSD 870", Size: 500 * gb},
+		&blockDevice{LinuxName: "/dev/sdb", Model: "Samsung SSD 870", Size: 2 * tb},
+		&blockDevice{LinuxName: "/dev/sdc", Model: "WDC WD10EZEX", Size: 500 * gb},
+	)
+	createMachineStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000003",
+		&blockDevice{LinuxName: "/dev/sda", BusPath: "/pci0000:00/0000:00:1f.2/ata1/host0"},
+	)
+
+	err = tmpl.ResolveInstallDisks(ctx, st)
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, `install disk selector of machine "1a2b3c4d-0000-4000-8000-000000000001" is ambiguous, it matches disks ["/dev/nvme0n1" "/dev/nvme1n1"]`)
+	assert.NotContains(t, err.Error(), "1a2b3c4d-0000-4000-8000-000000000004", "the machine with the literal install disk doesn't need the status")
+
+	_, err = tmpl.Translate()
+	require.Error(t, err, "failed resolution should not be used")
+
+	tmpl, err = template.Load(bytes.NewReader(bytes.Replace(clusterInstallDisks, []byte("type: nvme"), []byte("type: nvme\n    size:\n      max: 1TB"), 1)))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.ResolveInstallDisks(ctx, st))
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	installDisks := map[string]string{}
+
+	for _, r := range resourceList {
+		if _, ok := r.Metadata().Labels().Get(omni.LabelSystemPatch); !ok {
+			continue
+		}
+
+		var data struct {
+			Machine struct {
+				Install struct {
+					Disk string `yaml:"disk"`
+				} `yaml:"install"`
+			} `yaml:"machine"`
+		}
+
+		require.NoError(t, yaml.Unmarshal([]byte(r.(*omni.ConfigPatch).TypedSpec().Value.GetData()), &data))
+
+		installDisks[r.Metadata().ID()] = data.Machine.Install.Disk
+	}
+
+	assert.Equal(t, map[string]string{
+		"000-cm-1a2b3c4d-0000-4000-8000-000000000001-install-disk": "/dev/nvme0n1",
+		"000-cm-1a2b3c4d-0000-4000-8000-000000000002-install-disk": "/dev/sda",
+		"000-cm-1a2b3c4d-0000-4000-8000-000000000003-install-disk": "/dev/sda",
+		"000-cm-1a2b3c4d-0000-4000-8000-000000000004-install-disk": "/dev/vda",
+	}, installDisks)
+
+	// no matching disk
+	tmpl, err = template.Load(bytes.NewReader(bytes.Replace(clusterInstallDisks, []byte("model: Samsung*"), []byte("model: Intel*"), 1)))
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, tmpl.ResolveInstallDisks(ctx, st), `no disks of machine "1a2b3c4d-0000-4000-8000-000000000002" match the install disk selector`)
+}
+
+func TestInstallDisksValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		install  string
+		expected string
+	}{
+		{
+			name:     "empty selector",
+			install:  "diskSelector: {}",
+			expected: "disk selector should have at least one criterion",
+		},
+		{
+			name:     "disk and selector",
+			install:  "disk: /dev/sda\n  diskSelector:\n    type: ssd",
+			expected: "install disk and disk selector can not be used together",
+		},
+		{
+			name:     "invalid type",
+			install:  "diskSelector:\n    type: floppy",
+			expected: `disk selector type "floppy" is invalid`,
+		},
+		{
+			name:     "invalid size",
+			install:  "diskSelector:\n    size:\n      min: 2TB\n      max: 1TB",
+			expected: "disk selector size min 2TB is greater than max 1TB",
+		},
+		{
+			name:     "invalid pattern",
+			install:  "diskSelector:\n    model: '[Samsung'",
+			expected: `disk selector model pattern "[Samsung" is invalid`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.Load(bytes.NewReader([]byte(`kind: Cluster
+name: invalid
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 1a2b3c4d-0000-4000-8000-000000000001
+install:
+  ` + tt.install + "\n")))
+			require.NoError(t, err)
+
+			assert.ErrorContains(t, tmpl.Validate(), tt.expected)
+		})
+	}
+}
@@ -44,6 +44,12 @@ type Cluster struct { //nolint:govet
 	// Features settings.
 	Features Features `yaml:"features,omitempty"`
 
+	// Schematic customization of all cluster machines.
+	Schematic Schematic `yaml:",inline"`
+
+	// Network addressing of the machines of the static machine sets.
+	Network Network `yaml:"network,omitempty"`
+
 	// Cluster-wide patches.
 	Patches PatchList `yaml:"patches,omitempty"`
 }
@@ -76,6 +82,14 @@ type TalosCluster struct {
 	Version string `yaml:"version"`
 }
 
+func (cluster *Cluster) setDir(dir string) {
+	cluster.Patches.setDir(dir)
+}
+
+func (cluster *Cluster) files() []string {
+	return cluster.Patches.files()
+}
+
 // Validate the model.
 func (cluster *Cluster) Validate() error {
 	var multiErr error
@@ -96,7 +110,8 @@ func (cluster *Cluster) Validate() error {
 		multiErr = multierror.Append(multiErr, err)
 	}
 
-	multiErr = joinErrors(multiErr, cluster.Kubernetes.Validate(), cluster.Talos.Validate(), cluster.Patches.Validate())
+	multiErr = joinErrors(multiErr, cluster.Kubernetes.Validate(), cluster.Talos.Validate(), cluster.Schematic.Validate(), cluster.Network.Validate(),
+		cluster.Patches.Validate())
 
 	if multiErr != nil {
 		return fmt.Errorf("error validating cluster %q: %w", cluster.Name, multiErr)
@@ -146,7 +161,7 @@ func (talos *TalosCluster) Validate() error {
 }
 
 // Translate into Omni resources.
-func (cluster *Cluster) Translate(TranslateContext) ([]resource.Resource, error) {
+func (cluster *Cluster) Translate(ctx TranslateContext) ([]resource.Resource, error) {
 	clusterResource := omni.NewCluster(resources.DefaultNamespace, cluster.Name)
 
 	clusterResource.Metadata().Annotations().Set(omni.ResourceManagedByClusterTemplates, "")
@@ -175,7 +190,12 @@ func (cluster *Cluster) Translate(TranslateContext) ([]resource.Resource, error)
 		clusterResource.TypedSpec().Value.BackupConfiguration = &specs.EtcdBackupConf{Interval: durationpb.New(interval), Enabled: true}
 	}
 
-	return append([]resource.Resource{clusterResource}, patches...), nil
+	schematicConfigurations, err := cluster.Schematic.translate(ctx, cluster.Name, specs.SchematicConfigurationSpec_Cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]resource.Resource{clusterResource}, patches...), schematicConfigurations...), nil
 }
 
 func init() {
@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"os"
+	"slices"
+
+	"github.com/siderolabs/omni-client/pkg/template/internal/secrets"
+)
+
+// fileReferrer is implemented by the models which reference local files.
+type fileReferrer interface {
+	// setDir sets the directory the relative paths of the model are resolved against.
+	setDir(dir string)
+
+	// files returns the local files and directories referenced by the model.
+	files() []string
+}
+
+// SetDir sets the directory the relative file paths of the models are resolved against.
+//
+// By default, the relative paths are resolved against the working directory.
+func (l List) SetDir(dir string) {
+	for _, model := range l {
+		if referrer, ok := model.(fileReferrer); ok {
+			referrer.setDir(dir)
+		}
+	}
+}
+
+// Files returns the sorted local files and directories referenced by the models, including the files of the secret placeholders.
+//
+// The files which can't be read are still returned, so that they are picked up once they are created.
+func (l List) Files() []string {
+	var files []string
+
+	for _, model := range l {
+		if referrer, ok := model.(fileReferrer); ok {
+			files = append(files, referrer.files()...)
+		}
+	}
+
+	slices.Sort(files)
+
+	return slices.Compact(files)
+}
+
+// fileWithSecrets returns the file and the files of the secret placeholders in it.
+func fileWithSecrets(path, dir string) []string {
+	files := []string{path}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return files
+	}
+
+	if raw, err = secrets.Decrypt(raw); err != nil {
+		return files
+	}
+
+	return append(files, secrets.DocumentFiles(raw, dir)...)
+}
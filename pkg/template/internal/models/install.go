@@ -0,0 +1,144 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+)
+
+// DiskTypes are the disk types which can be used in the disk selector.
+var DiskTypes = []string{"nvme", "ssd", "hdd", "sd"}
+
+// DiskSelector selects the install disk by the hardware criteria, all criteria which are set should match.
+//
+// Model, serial and bus path are glob patterns in the path.Match syntax, so '*' doesn't match the '/' separators.
+type DiskSelector struct {
+	// Size is the range of the disk size.
+	Size *DiskSizeRange `yaml:"size,omitempty"`
+
+	// Model of the disk.
+	Model string `yaml:"model,omitempty"`
+
+	// Serial of the disk.
+	Serial string `yaml:"serial,omitempty"`
+
+	// Type of the disk: nvme, ssd, hdd or sd.
+	Type string `yaml:"type,omitempty"`
+
+	// BusPath of the disk.
+	BusPath string `yaml:"busPath,omitempty"`
+}
+
+// DiskSizeRange is an inclusive range of the disk size, e.g. 100GB or 1TiB.
+type DiskSizeRange struct {
+	// Min is the minimum disk size.
+	Min string `yaml:"min,omitempty"`
+
+	// Max is the maximum disk size.
+	Max string `yaml:"max,omitempty"`
+}
+
+// Validate the model.
+func (selector *DiskSelector) Validate() error {
+	var multiErr error
+
+	if selector.Size == nil && selector.Model == "" && selector.Serial == "" && selector.Type == "" && selector.BusPath == "" {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector should have at least one criterion"))
+	}
+
+	if selector.Size != nil {
+		multiErr = joinErrors(multiErr, selector.Size.Validate())
+	}
+
+	for _, pattern := range []struct {
+		name  string
+		value string
+	}{
+		{"model", selector.Model},
+		{"serial", selector.Serial},
+		{"busPath", selector.BusPath},
+	} {
+		if _, err := path.Match(pattern.value, ""); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector %s pattern %q is invalid: %w", pattern.name, pattern.value, err))
+		}
+	}
+
+	if selector.Type != "" && !slices.Contains(DiskTypes, strings.ToLower(selector.Type)) {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector type %q is invalid, expected one of %q", selector.Type, DiskTypes))
+	}
+
+	return multiErr
+}
+
+// Validate the model.
+func (size *DiskSizeRange) Validate() error {
+	var multiErr error
+
+	if size.Min == "" && size.Max == "" {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector size should have min or max set"))
+	}
+
+	minSize, minErr := parseDiskSize(size.Min)
+	if minErr != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector size min is invalid: %w", minErr))
+	}
+
+	maxSize, maxErr := parseDiskSize(size.Max)
+	if maxErr != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector size max is invalid: %w", maxErr))
+	}
+
+	if minErr == nil && maxErr == nil && size.Max != "" && minSize > maxSize {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("disk selector size min %s is greater than max %s", size.Min, size.Max))
+	}
+
+	return multiErr
+}
+
+// Match returns true if the block device matches the selector.
+//
+// Match assumes that the selector is valid.
+func (selector *DiskSelector) Match(disk *specs.MachineStatusSpec_HardwareStatus_BlockDevice) bool {
+	if selector.Size != nil {
+		minSize, _ := parseDiskSize(selector.Size.Min) //nolint:errcheck
+		maxSize, _ := parseDiskSize(selector.Size.Max) //nolint:errcheck
+
+		if disk.GetSize() < minSize || (selector.Size.Max != "" && disk.GetSize() > maxSize) {
+			return false
+		}
+	}
+
+	if selector.Type != "" && !strings.EqualFold(selector.Type, disk.GetType()) {
+		return false
+	}
+
+	return globMatch(selector.Model, disk.GetModel()) && globMatch(selector.Serial, disk.GetSerial()) && globMatch(selector.BusPath, disk.GetBusPath())
+}
+
+func parseDiskSize(size string) (uint64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	return humanize.ParseBytes(size)
+}
+
+func globMatch(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, value) //nolint:errcheck
+
+	return matched
+}
@@ -6,9 +6,11 @@ package models
 
 import (
 	"fmt"
+	"net/netip"
 	"slices"
 
 	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/dustin/go-humanize"
 	"github.com/hashicorp/go-multierror"
 	"github.com/siderolabs/gen/maps"
 	"github.com/siderolabs/gen/xslices"
@@ -39,6 +41,7 @@ func (l List) Validate() error {
 		controlPlaneMachines MachineIDList
 
 		workerMachineSetNameToCount        = make(map[string]int)
+		manifestsNameToCount               = make(map[string]int)
 		workerMachineIDToWorkerMachineSets = make(map[MachineID][]string)
 	)
 
@@ -62,6 +65,8 @@ func (l List) Validate() error {
 			if m.Locked {
 				lockedMachines[m.Name] = struct{}{}
 			}
+		case *Manifests:
+			manifestsNameToCount[m.Name]++
 		}
 	}
 
@@ -79,6 +84,12 @@ func (l List) Validate() error {
 		}
 	}
 
+	for name, count := range manifestsNameToCount {
+		if count > 1 {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("duplicate manifests with name %q", name))
+		}
+	}
+
 	for machineID, machineSets := range workerMachineIDToWorkerMachineSets {
 		if len(machineSets) > 1 {
 			multiErr = multierror.Append(multiErr, fmt.Errorf("machine %q is used in multiple workers: %q", machineID, machineSets))
@@ -115,16 +126,29 @@ func (l List) Validate() error {
 		}
 	}
 
+	if clusterCount == 1 {
+		_, err := l.hostnames()
+		multiErr = joinErrors(multiErr, err)
+	}
+
+	_, err := l.machineAddresses()
+	multiErr = joinErrors(multiErr, err)
+
 	return multiErr
 }
 
 // Translate a set of models (template) to a set of Omni resources.
 //
-// Translate assumes that the template is valid.
-func (l List) Translate() ([]resource.Resource, error) {
+// Translate assumes that the template is valid, and that all schematic customizations and disk selectors are resolved.
+func (l List) Translate(resolved Resolved) ([]resource.Resource, error) {
 	context := TranslateContext{
 		LockedMachines:     make(map[MachineID]struct{}),
 		MachineDescriptors: make(map[MachineID]Descriptors),
+		MachineInstalls:    l.machineInstalls(),
+		InstallDisks:       resolved.InstallDisks,
+		NetworkLinks:       resolved.NetworkLinks,
+		SchematicIDs:       resolved.SchematicIDs,
+		SkipUnresolved:     resolved.SkipUnresolved,
 	}
 
 	for _, model := range l {
@@ -140,9 +164,24 @@ func (l List) Translate() ([]resource.Resource, error) {
 		}
 	}
 
+	hostnames, err := l.hostnames()
+	if err != nil {
+		return nil, err
+	}
+
+	context.Hostnames = hostnames
+
+	machineAddresses, err := l.machineAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	context.MachineAddresses = machineAddresses
+
 	var (
 		multiErr      error
 		resourcesList []resource.Resource
+		manifestsSize int
 	)
 
 	for _, model := range l {
@@ -153,9 +192,23 @@ func (l List) Translate() ([]resource.Resource, error) {
 			continue
 		}
 
+		if _, ok := model.(*Manifests); ok {
+			for _, r := range resources {
+				if configPatch, ok := r.(*omni.ConfigPatch); ok {
+					manifestsSize += len(configPatch.TypedSpec().Value.GetData())
+				}
+			}
+		}
+
 		resourcesList = append(resourcesList, resources...)
 	}
 
+	// all inline manifests end up in the same machine configuration of the control plane machines
+	if manifestsSize > MaxManifestsSize {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("total size of manifests %s exceeds the limit of %s",
+			humanize.IBytes(uint64(manifestsSize)), humanize.IBytes(MaxManifestsSize)))
+	}
+
 	// perform additional validation:
 	// - all resources except for cluster itself should have a cluster label
 	// - all resources should have a unique ID
@@ -184,6 +237,444 @@ func (l List) Translate() ([]resource.Resource, error) {
 	return resourcesList, multiErr
 }
 
+// Schematics returns all non-empty schematic customizations in the template.
+func (l List) Schematics() []Schematic {
+	var schematics []Schematic
+
+	for _, model := range l {
+		var schematic Schematic
+
+		switch m := model.(type) {
+		case *Cluster:
+			schematic = m.Schematic
+		case *ControlPlane:
+			schematic = m.Schematic
+		case *Workers:
+			schematic = m.Schematic
+		case *Machine:
+			schematic = m.Schematic
+		}
+
+		if !schematic.IsEmpty() {
+			schematics = append(schematics, schematic)
+		}
+	}
+
+	return schematics
+}
+
+// DiskSelectors returns the effective disk selectors of the machines.
+//
+// The install specification of the machine overrides the one of its machine set.
+func (l List) DiskSelectors() map[MachineID]*DiskSelector {
+	selectors := map[MachineID]*DiskSelector{}
+
+	for machineID, install := range l.machineInstalls() {
+		if install.DiskSelector != nil {
+			selectors[machineID] = install.DiskSelector
+		}
+	}
+
+	return selectors
+}
+
+// machineInstalls returns the effective install specifications of the machines.
+func (l List) machineInstalls() map[MachineID]MachineInstall {
+	installs := map[MachineID]MachineInstall{}
+
+	for _, model := range l {
+		var machineSet *MachineSet
+
+		switch m := model.(type) {
+		case *ControlPlane:
+			machineSet = &m.MachineSet
+		case *Workers:
+			machineSet = &m.MachineSet
+		default:
+			continue
+		}
+
+		if machineSet.Install.IsEmpty() {
+			continue
+		}
+
+		for _, machineID := range machineSet.Machines {
+			installs[machineID] = machineSet.Install
+		}
+	}
+
+	for _, model := range l {
+		if machine, ok := model.(*Machine); ok && !machine.Install.IsEmpty() {
+			installs[machine.Name] = machine.Install
+		}
+	}
+
+	return installs
+}
+
+// LinkSelectors returns the link selectors of the machines with the static addresses, which should be resolved against the network links of the machines.
+//
+// The selectors with the exact hardware address don't need to be resolved, so they are not returned.
+func (l List) LinkSelectors() map[MachineID]LinkSelector {
+	_, networks := l.machineNetworks()
+
+	selectors := map[MachineID]LinkSelector{}
+
+	for machineID, network := range networks {
+		if network.pool != nil && network.link.ExactMAC() == "" {
+			selectors[machineID] = network.link
+		}
+	}
+
+	return selectors
+}
+
+type machineNetwork struct {
+	pool    *AddressPool
+	link    LinkSelector
+	address string
+}
+
+// machineNetworks returns the effective network settings of the machines and the machine IDs in the template order.
+//
+// The settings of the machine override the settings of the machine set, which override the settings of the cluster.
+func (l List) machineNetworks() ([]MachineID, map[MachineID]machineNetwork) {
+	var clusterNetwork Network
+
+	for _, model := range l {
+		if cluster, ok := model.(*Cluster); ok {
+			clusterNetwork = cluster.Network
+		}
+	}
+
+	var machineIDs []MachineID
+
+	networks := map[MachineID]machineNetwork{}
+
+	for _, model := range l {
+		var machineSet *MachineSet
+
+		switch m := model.(type) {
+		case *ControlPlane:
+			machineSet = &m.MachineSet
+		case *Workers:
+			machineSet = &m.MachineSet
+		default:
+			continue
+		}
+
+		pool := clusterNetwork.AddressPool
+		if machineSet.Network.AddressPool != nil {
+			pool = machineSet.Network.AddressPool
+		}
+
+		link := clusterNetwork.Link
+		if machineSet.Network.Link != nil {
+			link = machineSet.Network.Link
+		}
+
+		for _, machineID := range machineSet.Machines {
+			network := machineNetwork{pool: pool}
+
+			if link != nil {
+				network.link = *link
+			}
+
+			machineIDs = append(machineIDs, machineID)
+			networks[machineID] = network
+		}
+	}
+
+	for _, model := range l {
+		machine, ok := model.(*Machine)
+		if !ok {
+			continue
+		}
+
+		network, ok := networks[machine.Name]
+		if !ok {
+			continue
+		}
+
+		if machine.Network.Link != nil {
+			network.link = *machine.Network.Link
+		}
+
+		network.address = machine.Network.Address
+
+		networks[machine.Name] = network
+	}
+
+	return machineIDs, networks
+}
+
+// machineAddresses allocates the static addresses to the machines from the address pools.
+//
+// The addresses set explicitly on the machines are reserved first, then the rest of the machines get the addresses
+// of their pools in the template order. Machine sets with the same pool share the addresses.
+//
+//nolint:gocognit,gocyclo,cyclop
+func (l List) machineAddresses() (map[MachineID]MachineAddress, error) {
+	machineIDs, networks := l.machineNetworks()
+
+	var multiErr error
+
+	addresses := map[MachineID]MachineAddress{}
+	explicit := map[netip.Addr]MachineID{}
+
+	for _, machineID := range machineIDs {
+		network := networks[machineID]
+		if network.address == "" {
+			continue
+		}
+
+		if network.pool == nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("machine %q has the network address %q, but no address pool", machineID, network.address))
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(network.address)
+		if err != nil {
+			continue // reported by the machine validation
+		}
+
+		prefix, err := netip.ParsePrefix(network.pool.CIDR)
+		if err != nil {
+			continue // reported by the pool validation
+		}
+
+		if !prefix.Contains(addr) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("network address %q of machine %q is not in the address pool %q", addr, machineID, network.pool.CIDR))
+
+			continue
+		}
+
+		if _, ok := network.pool.reserved()[addr]; ok {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("network address %q of machine %q is reserved in the address pool %q", addr, machineID, network.pool.CIDR))
+
+			continue
+		}
+
+		if other, ok := explicit[addr]; ok {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("network address %q is used by machines %q and %q", addr, other, machineID))
+
+			continue
+		}
+
+		explicit[addr] = machineID
+		addresses[machineID] = MachineAddress{
+			Pool:    network.pool,
+			Link:    network.link,
+			Address: netip.PrefixFrom(addr, prefix.Bits()),
+		}
+	}
+
+	next := map[string]netip.Addr{}
+	allocated := map[netip.Addr]MachineID{}
+
+	for _, machineID := range machineIDs {
+		network := networks[machineID]
+		if network.pool == nil || network.address != "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(network.pool.CIDR)
+		if err != nil {
+			continue // reported by the pool validation
+		}
+
+		key := network.pool.key()
+
+		addr, ok := next[key]
+		if !ok {
+			addr = prefix.Masked().Addr()
+
+			if start, err := netip.ParseAddr(network.pool.Start); err == nil {
+				addr = start
+			}
+		}
+
+		reserved := network.pool.reserved()
+
+		for prefix.Contains(addr) {
+			_, isReserved := reserved[addr]
+			_, isExplicit := explicit[addr]
+
+			if !isReserved && !isExplicit {
+				break
+			}
+
+			addr = addr.Next()
+		}
+
+		if !prefix.Contains(addr) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("address pool %q is exhausted, no address left for machine %q", network.pool.CIDR, machineID))
+			next[key] = addr
+
+			continue
+		}
+
+		next[key] = addr.Next()
+
+		// the pools might overlap
+		if other, ok := allocated[addr]; ok {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("network address %q is allocated to machines %q and %q, check the address pools for overlaps", addr, other, machineID))
+
+			continue
+		}
+
+		allocated[addr] = machineID
+		addresses[machineID] = MachineAddress{
+			Pool:    network.pool,
+			Link:    network.link,
+			Address: netip.PrefixFrom(addr, prefix.Bits()),
+		}
+	}
+
+	return addresses, multiErr
+}
+
+// hostnames renders the hostname patterns of the machines.
+//
+// The hostname of the machine overrides the hostname pattern of its machine set, rendered hostnames should be unique.
+func (l List) hostnames() (map[MachineID]Hostname, error) {
+	clusterName, err := l.ClusterName()
+	if err != nil {
+		return nil, err
+	}
+
+	type machineHostname struct {
+		index   *int
+		data    HostnameData
+		pattern string
+	}
+
+	machines := map[MachineID]machineHostname{}
+
+	for _, model := range l {
+		var (
+			machineSet *MachineSet
+			nameSuffix string
+		)
+
+		switch m := model.(type) {
+		case *ControlPlane:
+			machineSet, nameSuffix = &m.MachineSet, omni.ControlPlanesIDSuffix
+		case *Workers:
+			machineSet, nameSuffix = &m.MachineSet, m.Name
+
+			if nameSuffix == "" {
+				nameSuffix = omni.DefaultWorkersIDSuffix
+			}
+		default:
+			continue
+		}
+
+		for _, machineID := range machineSet.Machines {
+			machines[machineID] = machineHostname{
+				pattern: machineSet.NodeSettings.Hostname,
+				data: HostnameData{
+					ClusterName: clusterName,
+					MachineSet:  omni.AdditionalWorkersResourceID(clusterName, nameSuffix),
+					MachineID:   string(machineID),
+				},
+			}
+		}
+	}
+
+	for _, model := range l {
+		machine, ok := model.(*Machine)
+		if !ok || (machine.NodeSettings.Hostname == "" && machine.Index == nil) {
+			continue
+		}
+
+		m := machines[machine.Name]
+
+		if machine.NodeSettings.Hostname != "" {
+			m.pattern = machine.NodeSettings.Hostname
+		}
+
+		if machine.Index != nil {
+			m.index = machine.Index
+			m.data.Index = *machine.Index
+		}
+
+		m.data.ClusterName = clusterName
+		m.data.MachineID = string(machine.Name)
+
+		machines[machine.Name] = m
+	}
+
+	machineIDs := maps.Keys(machines)
+	slices.Sort(machineIDs)
+
+	var multiErr error
+
+	hostnames := map[MachineID]Hostname{}
+	hostnameMachines := map[string]MachineID{}
+
+	for _, machineID := range machineIDs {
+		m := machines[machineID]
+		if m.pattern == "" {
+			continue
+		}
+
+		hostname, err := RenderHostname(m.pattern, m.data)
+		if err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("machine %q: %w", machineID, err))
+
+			continue
+		}
+
+		// the position of the machine in the machine set is not used as the index, as it changes when the machines are removed or reordered
+		var index *int
+
+		if hostnameUsesIndex(m.pattern, m.data) {
+			if m.index == nil {
+				multiErr = multierror.Append(multiErr, fmt.Errorf("machine %q: hostname pattern %q uses the index, but the machine has no index", machineID, m.pattern))
+
+				continue
+			}
+
+			index = m.index
+		}
+
+		if other, ok := hostnameMachines[hostname]; ok {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("hostname %q is used by machines %q and %q", hostname, other, machineID))
+
+			continue
+		}
+
+		hostnameMachines[hostname] = machineID
+
+		pattern := m.pattern
+		if pattern == hostname {
+			// literal hostname, not a pattern
+			pattern = ""
+		}
+
+		hostnames[machineID] = Hostname{
+			Hostname: hostname,
+			Index:    index,
+			Pattern:  pattern,
+		}
+	}
+
+	return hostnames, multiErr
+}
+
+// TalosVersion returns the Talos version of the cluster in the template.
+func (l List) TalosVersion() (string, error) {
+	for _, model := range l {
+		if cluster, ok := model.(*Cluster); ok {
+			return cluster.Talos.Version, nil
+		}
+	}
+
+	return "", fmt.Errorf("cluster model not found")
+}
+
 // ClusterName returns the name of the cluster in the template.
 func (l List) ClusterName() (string, error) {
 	for _, model := range l {
@@ -12,6 +12,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/siderolabs/gen/pair"
 
+	"github.com/siderolabs/omni-client/api/omni/specs"
 	"github.com/siderolabs/omni-client/pkg/constants"
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 )
@@ -41,14 +42,33 @@ type Machine struct { //nolint:govet
 	// Install specification.
 	Install MachineInstall `yaml:"install,omitempty"`
 
+	// Schematic customization of the machine.
+	Schematic Schematic `yaml:",inline"`
+
+	// NodeSettings of the machine, the hostname overrides the hostname pattern of the machine set.
+	NodeSettings NodeSettings `yaml:",inline"`
+
+	// Index of the machine in the hostname pattern.
+	//
+	// It is required if the hostname pattern uses the index, so that the hostnames don't change when the machines are added, removed or reordered.
+	Index *int `yaml:"index,omitempty"`
+
+	// Network addressing of the machine.
+	Network MachineNetwork `yaml:"network,omitempty"`
+
 	// ClusterMachine patches.
 	Patches PatchList `yaml:"patches,omitempty"`
 }
 
 // MachineInstall provides machine install configuration.
+//
+// Either Disk or DiskSelector can be set.
 type MachineInstall struct {
+	// DiskSelector selects the disk by the hardware criteria, it is resolved for each machine during the sync.
+	DiskSelector *DiskSelector `yaml:"diskSelector,omitempty"`
+
 	// Disk device name.
-	Disk string `yaml:"disk"`
+	Disk string `yaml:"disk,omitempty"`
 }
 
 // Validate the list of machines.
@@ -71,9 +91,30 @@ func (id MachineID) Validate() error {
 	return nil
 }
 
+// IsEmpty returns true if the install configuration is not set.
+func (install *MachineInstall) IsEmpty() bool {
+	return install.Disk == "" && install.DiskSelector == nil
+}
+
 // Validate the model.
 func (install *MachineInstall) Validate() error {
-	return nil
+	if install.DiskSelector == nil {
+		return nil
+	}
+
+	if install.Disk != "" {
+		return fmt.Errorf("install disk and disk selector can not be used together")
+	}
+
+	return install.DiskSelector.Validate()
+}
+
+func (machine *Machine) setDir(dir string) {
+	machine.Patches.setDir(dir)
+}
+
+func (machine *Machine) files() []string {
+	return machine.Patches.files()
 }
 
 // Validate the model.
@@ -88,7 +129,12 @@ func (machine *Machine) Validate() error {
 		multiErr = multierror.Append(multiErr, err)
 	}
 
-	multiErr = joinErrors(multiErr, machine.Name.Validate(), machine.Install.Validate(), machine.Patches.Validate())
+	if machine.Index != nil && *machine.Index < 0 {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("index should not be negative"))
+	}
+
+	multiErr = joinErrors(multiErr, machine.Name.Validate(), machine.Install.Validate(), machine.Schematic.Validate(), machine.NodeSettings.Validate(), machine.Network.Validate(),
+		machine.Patches.Validate())
 
 	if multiErr != nil {
 		return fmt.Errorf("machine %q is invalid: %w", machine.Name, multiErr)
@@ -101,32 +147,30 @@ func (machine *Machine) Validate() error {
 func (machine *Machine) Translate(context TranslateContext) ([]resource.Resource, error) {
 	var resourceList []resource.Resource
 
-	if machine.Install.Disk != "" {
-		patch := Patch{
-			Name: "install-disk",
-			Inline: map[string]any{
-				"machine": map[string]any{
-					"install": map[string]any{
-						"disk": machine.Install.Disk,
-					},
-				},
-			},
-		}
-
-		patchResource, err := patch.Translate(
-			fmt.Sprintf("cm-%s", machine.Name),
-			constants.PatchWeightInstallDisk,
-			pair.MakePair(omni.LabelCluster, context.ClusterName),
-			pair.MakePair(omni.LabelClusterMachine, string(machine.Name)),
-			pair.MakePair(omni.LabelSystemPatch, ""),
-		)
+	// the install specification might be inherited from the machine set
+	if install, ok := context.MachineInstalls[machine.Name]; ok {
+		installDiskPatches, err := translateInstallDisk(context, machine.Name, install)
 		if err != nil {
 			return nil, err
 		}
 
-		resourceList = append(resourceList, patchResource)
+		resourceList = append(resourceList, installDiskPatches...)
 	}
 
+	nodeSettingsPatches, err := machine.NodeSettings.translateMachine(context, machine.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceList = append(resourceList, nodeSettingsPatches...)
+
+	networkPatches, err := translateNetwork(context, machine.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceList = append(resourceList, networkPatches...)
+
 	patches, err := machine.Patches.Translate(
 		fmt.Sprintf("cm-%s", machine.Name),
 		constants.PatchBaseWeightClusterMachine,
@@ -137,9 +181,60 @@ func (machine *Machine) Translate(context TranslateContext) ([]resource.Resource
 		return nil, err
 	}
 
-	return append(resourceList, patches...), nil
+	schematicConfigurations, err := machine.Schematic.translate(
+		context,
+		string(machine.Name),
+		specs.SchematicConfigurationSpec_ClusterMachine,
+		omni.LabelClusterMachine,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(resourceList, patches...), schematicConfigurations...), nil
 }
 
 func init() {
 	register[Machine](KindMachine)
 }
+
+// translateInstallDisk generates the install disk patch of the machine.
+func translateInstallDisk(context TranslateContext, machineID MachineID, install MachineInstall) ([]resource.Resource, error) {
+	disk := install.Disk
+
+	if install.DiskSelector != nil {
+		var ok bool
+
+		if disk, ok = context.InstallDisks[machineID]; !ok {
+			if context.SkipUnresolved {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("install disk of machine %q is not resolved", machineID)
+		}
+	}
+
+	patch := Patch{
+		Name: "install-disk",
+		Inline: map[string]any{
+			"machine": map[string]any{
+				"install": map[string]any{
+					"disk": disk,
+				},
+			},
+		},
+	}
+
+	configPatch, err := patch.Translate(
+		fmt.Sprintf("cm-%s", machineID),
+		constants.PatchWeightInstallDisk,
+		pair.MakePair(omni.LabelCluster, context.ClusterName),
+		pair.MakePair(omni.LabelClusterMachine, string(machineID)),
+		pair.MakePair(omni.LabelSystemPatch, ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []resource.Resource{configPatch}, nil
+}
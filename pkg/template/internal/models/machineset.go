@@ -41,6 +41,18 @@ type MachineSet struct {
 	// DeleteStrategy defines the delete strategy for the machine set.
 	DeleteStrategy *UpdateStrategyConfig `yaml:"deleteStrategy,omitempty"`
 
+	// Install specification of the machine set machines, it is overridden by the install specification of the machine.
+	Install MachineInstall `yaml:"install,omitempty"`
+
+	// Schematic customization of the machine set machines.
+	Schematic Schematic `yaml:",inline"`
+
+	// NodeSettings of the machine set machines, the hostname is a pattern rendered for each machine.
+	NodeSettings NodeSettings `yaml:",inline"`
+
+	// Network addressing of the machine set machines, it overrides the network addressing of the cluster.
+	Network Network `yaml:"network,omitempty"`
+
 	// MachineSet patches.
 	Patches PatchList `yaml:"patches,omitempty"`
 }
@@ -148,6 +160,14 @@ type UpdateStrategyConfig struct {
 	Rolling *RollingUpdateStrategyConfig `yaml:"rolling,omitempty"`
 }
 
+func (machineset *MachineSet) setDir(dir string) {
+	machineset.Patches.setDir(dir)
+}
+
+func (machineset *MachineSet) files() []string {
+	return machineset.Patches.files()
+}
+
 // Validate checks the machine set fields correctness.
 func (machineset *MachineSet) Validate() error {
 	var multiErr error
@@ -160,6 +180,38 @@ func (machineset *MachineSet) Validate() error {
 		multiErr = multierror.Append(multiErr, fmt.Errorf("machine set can not have both machines and machine class defined"))
 	}
 
+	if machineset.MachineClass != nil && machineset.MachineClass.Name == "" {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("machine class name is required"))
+	}
+
+	if !machineset.Install.IsEmpty() && machineset.MachineClass != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("install is not supported in the machine set with machine class"))
+	}
+
+	if machineset.NodeSettings.Hostname != "" && machineset.MachineClass != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("hostname is not supported in the machine set with machine class"))
+	}
+
+	if !machineset.Network.IsEmpty() && machineset.MachineClass != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("network is not supported in the machine set with machine class"))
+	}
+
+	if err := machineset.Network.Validate(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	if err := machineset.NodeSettings.Validate(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	if err := machineset.Install.Validate(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	if err := machineset.Schematic.Validate(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
 	return multiErr
 }
 
@@ -231,9 +283,44 @@ func (machineset *MachineSet) translate(ctx TranslateContext, nameSuffix, roleLa
 			}
 
 			resourceList = append(resourceList, machineSetNode)
+
+			// the machines with the Machine document generate the install disk, hostname and network patches themselves
+			if _, hasMachine := ctx.MachineDescriptors[machineID]; hasMachine {
+				continue
+			}
+
+			if !machineset.Install.IsEmpty() {
+				installDiskPatches, err := translateInstallDisk(ctx, machineID, machineset.Install)
+				if err != nil {
+					return nil, err
+				}
+
+				resourceList = append(resourceList, installDiskPatches...)
+			}
+
+			hostnamePatches, err := (&NodeSettings{}).translateMachine(ctx, machineID)
+			if err != nil {
+				return nil, err
+			}
+
+			resourceList = append(resourceList, hostnamePatches...)
+
+			networkPatches, err := translateNetwork(ctx, machineID)
+			if err != nil {
+				return nil, err
+			}
+
+			resourceList = append(resourceList, networkPatches...)
 		}
 	}
 
+	nodeSettingsPatches, err := machineset.NodeSettings.translateMachineSet(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceList = append(resourceList, nodeSettingsPatches...)
+
 	patches, err := machineset.Patches.Translate(
 		id,
 		constants.PatchBaseWeightMachineSet,
@@ -244,5 +331,10 @@ func (machineset *MachineSet) translate(ctx TranslateContext, nameSuffix, roleLa
 		return nil, err
 	}
 
-	return append(resourceList, patches...), nil
+	schematicConfigurations, err := machineset.Schematic.translate(ctx, id, specs.SchematicConfigurationSpec_MachineSet, omni.LabelMachineSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(resourceList, patches...), schematicConfigurations...), nil
 }
@@ -0,0 +1,402 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/dustin/go-humanize"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/pair"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/constants"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/secrets"
+)
+
+// KindManifests is Manifests model kind.
+const KindManifests = "Manifests"
+
+// MaxManifestsSize is the maximum total size of the inline manifests of the cluster.
+//
+// Inline manifests end up in the machine configuration of the control plane machines, which is delivered in a single gRPC message,
+// so some room is left for the rest of the machine configuration.
+const MaxManifestsSize = constants.GRPCMaxMessageSize - 1024*1024
+
+// manifestExtensions are the extensions of the files loaded from the manifest directories.
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// Manifests describes Kubernetes manifests which are applied to the cluster as Talos inline manifests.
+type Manifests struct {
+	Meta `yaml:",inline"`
+
+	// Name of the inline manifest.
+	Name string `yaml:"name"`
+
+	// Files are the paths to the manifest files or directories, the directories are not traversed recursively.
+	Files []string `yaml:"files,omitempty"`
+
+	// Helm charts rendered with the local helm binary.
+	Helm []HelmChart `yaml:"helm,omitempty"`
+
+	// dir is the directory the relative file paths are resolved against.
+	dir string
+}
+
+// HelmChart is a Helm chart rendered locally with `helm template`.
+type HelmChart struct {
+	// Chart is the path to the chart directory or archive.
+	Chart string `yaml:"chart"`
+
+	// Release name, defaults to the name of the manifests.
+	Release string `yaml:"release,omitempty"`
+
+	// Namespace of the release.
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Values are the paths to the values files.
+	Values []string `yaml:"values,omitempty"`
+
+	// dir is the directory the relative file paths are resolved against.
+	dir string
+}
+
+// Validate the model.
+func (manifests *Manifests) Validate() error {
+	var multiErr error
+
+	if manifests.Name == "" {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("name is required"))
+	}
+
+	if len(manifests.Files) == 0 && len(manifests.Helm) == 0 {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("files or helm is required"))
+	}
+
+	if _, err := manifests.loadFiles(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	for _, chart := range manifests.Helm {
+		multiErr = joinErrors(multiErr, chart.Validate())
+	}
+
+	if multiErr != nil {
+		return fmt.Errorf("manifests %q is invalid: %w", manifests.Name, multiErr)
+	}
+
+	return nil
+}
+
+func (manifests *Manifests) setDir(dir string) {
+	manifests.dir = dir
+
+	for i := range manifests.Helm {
+		manifests.Helm[i].dir = dir
+	}
+}
+
+// files returns the manifest files and directories, the files of the secret placeholders in them, and the files of the Helm charts.
+func (manifests *Manifests) files() []string {
+	var files []string
+
+	for _, path := range manifests.Files {
+		path = secrets.ResolvePath(manifests.dir, path)
+
+		paths, err := manifestPaths(path)
+		if err != nil {
+			files = append(files, path)
+
+			continue
+		}
+
+		if len(paths) != 1 || paths[0] != path {
+			// the directory is listed to pick up the new files
+			files = append(files, path)
+		}
+
+		for _, path := range paths {
+			files = append(files, fileWithSecrets(path, manifests.dir)...)
+		}
+	}
+
+	for _, chart := range manifests.Helm {
+		files = append(files, chart.files()...)
+	}
+
+	return files
+}
+
+// files returns the chart files, including the files in the chart directory, and the values files.
+func (chart *HelmChart) files() []string {
+	files := []string{chart.chartPath()}
+
+	filepath.WalkDir(chart.chartPath(), func(path string, _ fs.DirEntry, err error) error { //nolint:errcheck
+		if err == nil && path != chart.chartPath() {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	for _, values := range chart.Values {
+		files = append(files, secrets.ResolvePath(chart.dir, values))
+	}
+
+	return files
+}
+
+func (chart *HelmChart) chartPath() string {
+	return secrets.ResolvePath(chart.dir, chart.Chart)
+}
+
+// Validate the model.
+func (chart *HelmChart) Validate() error {
+	if chart.Chart == "" {
+		return fmt.Errorf("helm chart is required")
+	}
+
+	var multiErr error
+
+	for _, path := range append([]string{chart.Chart}, chart.Values...) {
+		if _, err := os.Stat(secrets.ResolvePath(chart.dir, path)); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("failed to access %q: %w", path, err))
+		}
+	}
+
+	return multiErr
+}
+
+// Translate the model.
+func (manifests *Manifests) Translate(ctx TranslateContext) ([]resource.Resource, error) {
+	objects, err := manifests.loadFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chart := range manifests.Helm {
+		rendered, err := chart.render(manifests.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		chartObjects, err := parseManifests(chart.Chart, rendered)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, chartObjects...)
+	}
+
+	contents := make([]string, 0, len(objects))
+
+	for _, object := range objects {
+		raw, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal manifests %q: %w", manifests.Name, err)
+		}
+
+		contents = append(contents, string(raw))
+	}
+
+	controlPlanesID := omni.ControlPlanesResourceID(ctx.ClusterName)
+
+	patch := Patch{
+		Name: manifests.Name,
+		Inline: map[string]any{
+			"cluster": map[string]any{
+				"inlineManifests": []map[string]any{
+					{
+						"name":     manifests.Name,
+						"contents": strings.Join(contents, "---\n"),
+					},
+				},
+			},
+		},
+	}
+
+	r, err := patch.Translate(
+		controlPlanesID+"-manifests",
+		constants.PatchWeightManifests,
+		pair.MakePair(omni.LabelCluster, ctx.ClusterName),
+		pair.MakePair(omni.LabelMachineSet, controlPlanesID),
+		pair.MakePair(omni.LabelSystemPatch, ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if size := len(r.TypedSpec().Value.GetData()); size > MaxManifestsSize {
+		return nil, fmt.Errorf("manifests %q size %s exceeds the limit of %s", manifests.Name, humanize.IBytes(uint64(size)), humanize.IBytes(MaxManifestsSize))
+	}
+
+	return []resource.Resource{r}, nil
+}
+
+// loadFiles loads the objects from the manifest files and directories.
+func (manifests *Manifests) loadFiles() ([]map[string]any, error) {
+	var (
+		multiErr error
+		objects  []map[string]any
+	)
+
+	for _, path := range manifests.Files {
+		paths, err := manifestPaths(secrets.ResolvePath(manifests.dir, path))
+		if err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("failed to access %q: %w", path, err))
+
+			continue
+		}
+
+		for _, path := range paths {
+			raw, err := os.ReadFile(path)
+			if err == nil {
+				raw, err = secrets.Decrypt(raw)
+			}
+
+			if err == nil {
+				raw, err = secrets.ResolveDocuments(raw, manifests.dir)
+			}
+
+			if err != nil {
+				multiErr = multierror.Append(multiErr, fmt.Errorf("failed to read %q: %w", path, err))
+
+				continue
+			}
+
+			fileObjects, err := parseManifests(path, raw)
+			if err != nil {
+				multiErr = multierror.Append(multiErr, err)
+
+				continue
+			}
+
+			objects = append(objects, fileObjects...)
+		}
+	}
+
+	return objects, multiErr
+}
+
+// manifestPaths returns the path itself for a file, or the manifest files of the directory sorted by name.
+func manifestPaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && slices.Contains(manifestExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("directory has no %q files", manifestExtensions)
+	}
+
+	return paths, nil
+}
+
+// render the chart with `helm template`.
+func (chart *HelmChart) render(name string) ([]byte, error) {
+	release := chart.Release
+	if release == "" {
+		release = name
+	}
+
+	args := []string{"template", release, chart.chartPath()}
+
+	if chart.Namespace != "" {
+		args = append(args, "--namespace", chart.Namespace)
+	}
+
+	for _, values := range chart.Values {
+		args = append(args, "--values", secrets.ResolvePath(chart.dir, values))
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("helm", args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render helm chart %q: %w: %s", chart.Chart, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// parseManifests parses the multi-document YAML or JSON into Kubernetes objects, skipping the empty documents.
+func parseManifests(source string, raw []byte) ([]map[string]any, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+
+	var objects []map[string]any
+
+	for i := 0; ; i++ {
+		var object map[string]any
+
+		if err := decoder.Decode(&object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+
+			return nil, fmt.Errorf("failed to parse manifests %q: %w", source, err)
+		}
+
+		if object == nil {
+			continue
+		}
+
+		if err := validateObject(object); err != nil {
+			return nil, fmt.Errorf("failed to parse manifests %q: document %d: %w", source, i, err)
+		}
+
+		objects = append(objects, object)
+	}
+}
+
+func validateObject(object map[string]any) error {
+	for _, field := range []string{"apiVersion", "kind"} {
+		if value, _ := object[field].(string); value == "" {
+			return fmt.Errorf("%s is required", field)
+		}
+	}
+
+	metadata, _ := object["metadata"].(map[string]any)
+
+	if name, _ := metadata["name"].(string); name == "" {
+		return fmt.Errorf("metadata.name is required")
+	}
+
+	return nil
+}
+
+func init() {
+	register[Manifests](KindManifests)
+}
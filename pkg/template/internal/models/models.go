@@ -26,8 +26,44 @@ type TranslateContext struct {
 
 	MachineDescriptors map[MachineID]Descriptors
 
+	// MachineInstalls are the effective install specifications of the machines, the machine overrides its machine set.
+	MachineInstalls map[MachineID]MachineInstall
+
+	// InstallDisks are the resolved install disks of the machines with the disk selectors.
+	InstallDisks map[MachineID]string
+
+	// SchematicIDs maps the schematic customization keys to the resolved schematic IDs.
+	SchematicIDs map[string]string
+
+	// Hostnames are the rendered hostnames of the machines.
+	Hostnames map[MachineID]Hostname
+
+	// MachineAddresses are the static addresses allocated to the machines.
+	MachineAddresses map[MachineID]MachineAddress
+
+	// NetworkLinks are the resolved hardware addresses of the network links of the machines with the link selectors.
+	NetworkLinks map[MachineID]string
+
 	// ClusterName is the name of the cluster.
 	ClusterName string
+
+	// SkipUnresolved skips the resources which depend on the unresolved settings instead of failing.
+	SkipUnresolved bool
+}
+
+// Resolved contains the template settings which are resolved against the Omni state before the translation.
+type Resolved struct {
+	// SchematicIDs maps the schematic customization keys to the schematic IDs.
+	SchematicIDs map[string]string
+
+	// InstallDisks are the install disks of the machines with the disk selectors.
+	InstallDisks map[MachineID]string
+
+	// NetworkLinks are the hardware addresses of the network links of the machines with the link selectors.
+	NetworkLinks map[MachineID]string
+
+	// SkipUnresolved skips the resources which depend on the unresolved settings, e.g. when rendering the template offline.
+	SkipUnresolved bool
 }
 
 // Descriptors are the user descriptors (i.e. Labels, Annotations) to apply to the resource.
@@ -83,13 +119,22 @@ type model[T any] interface {
 }
 
 func register[T any, P model[T]](kind string) {
-	if _, ok := registeredModels[kind]; ok {
-		panic(fmt.Sprintf("model %s already registered", kind))
+	if err := Register(kind, func() Model {
+		return P(new(T))
+	}); err != nil {
+		panic(err)
 	}
+}
 
-	registeredModels[kind] = func() Model {
-		return P(new(T))
+// Register a model factory for the kind.
+func Register(kind string, factory func() Model) error {
+	if _, ok := registeredModels[kind]; ok {
+		return fmt.Errorf("model %s already registered", kind)
 	}
+
+	registeredModels[kind] = factory
+
+	return nil
 }
 
 // New creates a model by kind.
@@ -0,0 +1,350 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/pair"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/constants"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// Network defines the static network addressing of the machines.
+//
+// The settings of the machine set override the settings of the cluster.
+type Network struct {
+	// AddressPool to allocate the machine addresses from.
+	AddressPool *AddressPool `yaml:"addressPool,omitempty"`
+
+	// Link selects the network link of the machines to configure, by default the only link which is up is used.
+	Link *LinkSelector `yaml:"link,omitempty"`
+}
+
+// AddressPool is a range of the static addresses.
+//
+// The addresses are allocated to the machines in the order of the machine sets and machines in the template,
+// skipping the network, broadcast, gateway and nameserver addresses and the addresses set explicitly on the machines.
+type AddressPool struct {
+	// CIDR of the pool, e.g. 10.5.0.0/24.
+	CIDR string `yaml:"cidr"`
+
+	// Start is the first address to allocate, by default the first address of the CIDR.
+	Start string `yaml:"start,omitempty"`
+
+	// Gateway is the address of the default gateway.
+	Gateway string `yaml:"gateway,omitempty"`
+
+	// Nameservers are the addresses of the DNS servers.
+	Nameservers []string `yaml:"nameservers,omitempty"`
+
+	// VLAN is the VLAN ID, the addresses are configured on the VLAN interface when set.
+	VLAN uint16 `yaml:"vlan,omitempty"`
+}
+
+// LinkSelector selects the network link of the machine, all criteria which are set should match.
+//
+// MAC and name are glob patterns in the path.Match syntax.
+type LinkSelector struct {
+	// MAC is the hardware address of the link.
+	MAC string `yaml:"mac,omitempty"`
+
+	// Name is the Linux name of the link.
+	Name string `yaml:"name,omitempty"`
+}
+
+// MachineNetwork defines the static network addressing of the machine.
+type MachineNetwork struct {
+	// Address is the static address of the machine, it should belong to the address pool of the machine set or cluster.
+	Address string `yaml:"address,omitempty"`
+
+	// Link selects the network link of the machine, it overrides the link selector of the machine set or cluster.
+	Link *LinkSelector `yaml:"link,omitempty"`
+}
+
+// MachineAddress is the allocated address of the machine.
+type MachineAddress struct {
+	// Pool is the address pool the address belongs to.
+	Pool *AddressPool
+
+	// Link selects the network link of the machine.
+	Link LinkSelector
+
+	// Address with the prefix length of the pool.
+	Address netip.Prefix
+}
+
+// IsEmpty returns true if the network is not set.
+func (network *Network) IsEmpty() bool {
+	return network.AddressPool == nil && network.Link == nil
+}
+
+// Validate the model.
+func (network *Network) Validate() error {
+	var multiErr error
+
+	if network.AddressPool != nil {
+		multiErr = joinErrors(multiErr, network.AddressPool.Validate())
+	}
+
+	if network.Link != nil {
+		multiErr = joinErrors(multiErr, network.Link.Validate())
+	}
+
+	return multiErr
+}
+
+// Validate the model.
+func (pool *AddressPool) Validate() error {
+	prefix, err := netip.ParsePrefix(pool.CIDR)
+	if err != nil {
+		return fmt.Errorf("address pool cidr %q is invalid: %w", pool.CIDR, err)
+	}
+
+	var multiErr error
+
+	if prefix.Masked() != prefix {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("address pool cidr %q should be a network prefix, e.g. %q", pool.CIDR, prefix.Masked()))
+	}
+
+	for _, address := range []struct {
+		name  string
+		value string
+	}{
+		{"start", pool.Start},
+		{"gateway", pool.Gateway},
+	} {
+		if address.value == "" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(address.value)
+		if err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("address pool %s %q is invalid: %w", address.name, address.value, err))
+
+			continue
+		}
+
+		if !prefix.Contains(addr) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("address pool %s %q is not in cidr %q", address.name, address.value, pool.CIDR))
+		}
+	}
+
+	for _, nameserver := range pool.Nameservers {
+		if _, err := netip.ParseAddr(nameserver); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("address pool nameserver %q is invalid: %w", nameserver, err))
+		}
+	}
+
+	if pool.VLAN > 4094 {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("address pool vlan %d is invalid, expected 1-4094", pool.VLAN))
+	}
+
+	return multiErr
+}
+
+// key identifies the pool, machine sets with the same pool share the addresses.
+func (pool *AddressPool) key() string {
+	return pool.CIDR + "@" + pool.Start
+}
+
+// reserved returns the addresses of the pool which are never allocated to the machines.
+func (pool *AddressPool) reserved() map[netip.Addr]struct{} {
+	prefix := netip.MustParsePrefix(pool.CIDR)
+
+	reserved := map[netip.Addr]struct{}{
+		prefix.Addr(): {},
+	}
+
+	if prefix.Addr().Is4() {
+		reserved[lastAddr(prefix)] = struct{}{}
+	}
+
+	for _, address := range append([]string{pool.Gateway}, pool.Nameservers...) {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			reserved[addr] = struct{}{}
+		}
+	}
+
+	return reserved
+}
+
+// lastAddr returns the last address of the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr().AsSlice()
+	bits := prefix.Bits()
+
+	for i := range addr {
+		switch {
+		case bits >= 8:
+			bits -= 8
+		case bits > 0:
+			addr[i] |= 0xff >> bits
+			bits = 0
+		default:
+			addr[i] = 0xff
+		}
+	}
+
+	last, _ := netip.AddrFromSlice(addr)
+
+	return last
+}
+
+// Validate the model.
+func (selector *LinkSelector) Validate() error {
+	var multiErr error
+
+	if selector.MAC == "" && selector.Name == "" {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("link selector should have at least one criterion"))
+	}
+
+	for _, pattern := range []struct {
+		name  string
+		value string
+	}{
+		{"mac", selector.MAC},
+		{"name", selector.Name},
+	} {
+		if _, err := path.Match(pattern.value, ""); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("link selector %s pattern %q is invalid: %w", pattern.name, pattern.value, err))
+		}
+	}
+
+	return multiErr
+}
+
+// Match returns true if the network link matches the selector.
+//
+// The empty selector matches the links which are up.
+func (selector *LinkSelector) Match(link *specs.MachineStatusSpec_NetworkStatus_NetworkLinkStatus) bool {
+	if selector.MAC == "" && selector.Name == "" {
+		return link.GetLinkUp()
+	}
+
+	return globMatch(strings.ToLower(selector.MAC), strings.ToLower(link.GetHardwareAddress())) && globMatch(selector.Name, link.GetLinuxName())
+}
+
+// ExactMAC returns the hardware address if the selector selects the link by the exact hardware address, so it doesn't need to be resolved.
+func (selector *LinkSelector) ExactMAC() string {
+	if selector.Name != "" || strings.ContainsAny(selector.MAC, `*?[\`) {
+		return ""
+	}
+
+	mac, err := net.ParseMAC(selector.MAC)
+	if err != nil {
+		return ""
+	}
+
+	return mac.String()
+}
+
+// Validate the model.
+func (network *MachineNetwork) Validate() error {
+	var multiErr error
+
+	if network.Address != "" {
+		if _, err := netip.ParseAddr(network.Address); err != nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("network address %q is invalid: %w", network.Address, err))
+		}
+	}
+
+	if network.Link != nil {
+		multiErr = joinErrors(multiErr, network.Link.Validate())
+	}
+
+	return multiErr
+}
+
+// translateNetwork generates the network patch of the machine.
+func translateNetwork(ctx TranslateContext, machineID MachineID) ([]resource.Resource, error) {
+	address, ok := ctx.MachineAddresses[machineID]
+	if !ok {
+		return nil, nil
+	}
+
+	mac := address.Link.ExactMAC()
+	if mac == "" {
+		if mac, ok = ctx.NetworkLinks[machineID]; !ok {
+			if ctx.SkipUnresolved {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("network link of machine %q is not resolved", machineID)
+		}
+	}
+
+	config := map[string]any{
+		"addresses": []string{address.Address.String()},
+	}
+
+	if address.Pool.Gateway != "" {
+		defaultRoute := "0.0.0.0/0"
+		if address.Address.Addr().Is6() {
+			defaultRoute = "::/0"
+		}
+
+		config["routes"] = []map[string]any{
+			{
+				"network": defaultRoute,
+				"gateway": address.Pool.Gateway,
+			},
+		}
+	}
+
+	device := map[string]any{
+		"deviceSelector": map[string]any{
+			"hardwareAddr": mac,
+		},
+	}
+
+	if address.Pool.VLAN != 0 {
+		config["vlanId"] = int(address.Pool.VLAN)
+
+		device["vlans"] = []map[string]any{config}
+	} else {
+		for k, v := range config {
+			device[k] = v
+		}
+	}
+
+	network := map[string]any{
+		"interfaces": []map[string]any{device},
+	}
+
+	if len(address.Pool.Nameservers) > 0 {
+		network["nameservers"] = address.Pool.Nameservers
+	}
+
+	patch := Patch{
+		Name: "network",
+		Inline: map[string]any{
+			"machine": map[string]any{
+				"network": network,
+			},
+		},
+	}
+
+	r, err := patch.Translate(
+		fmt.Sprintf("cm-%s", machineID),
+		constants.PatchWeightClusterMachineNetwork,
+		pair.MakePair(omni.LabelCluster, ctx.ClusterName),
+		pair.MakePair(omni.LabelClusterMachine, string(machineID)),
+		pair.MakePair(omni.LabelSystemPatch, ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []resource.Resource{r}, nil
+}
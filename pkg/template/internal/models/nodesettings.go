@@ -0,0 +1,236 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/pair"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/siderolabs/omni-client/pkg/constants"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// NodeSettings are the Kubernetes node settings of the machines.
+type NodeSettings struct {
+	// Hostname is a pattern of the machine hostname, e.g. prod-cp-{{ .Index }} or {{ .MachineID | short }}.
+	Hostname string `yaml:"hostname,omitempty"`
+
+	// NodeLabels are the Kubernetes labels of the node.
+	NodeLabels map[string]string `yaml:"nodeLabels,omitempty"`
+
+	// NodeTaints are the Kubernetes taints of the node in the value:Effect format.
+	NodeTaints map[string]string `yaml:"nodeTaints,omitempty"`
+}
+
+// HostnameData is the data available in the hostname pattern.
+type HostnameData struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string
+
+	// MachineSet is the ID of the machine set of the machine.
+	MachineSet string
+
+	// MachineID is the ID of the machine.
+	MachineID string
+
+	// Index is the index of the machine, set on the machine.
+	Index int
+}
+
+var hostnameFuncs = template.FuncMap{
+	// short returns the first group of the machine UUID
+	"short": func(id string) string {
+		short, _, _ := strings.Cut(id, "-")
+
+		return short
+	},
+}
+
+var taintValueRegexp = regexp.MustCompile(`^([^:]*):(NoSchedule|PreferNoSchedule|NoExecute)$`)
+
+// Validate the model.
+func (settings *NodeSettings) Validate() error {
+	var multiErr error
+
+	if settings.Hostname != "" {
+		// render the hostname for an example machine to catch the errors early
+		if _, err := RenderHostname(settings.Hostname, HostnameData{
+			ClusterName: "cluster",
+			MachineSet:  "cluster-workers",
+			MachineID:   "00000000-0000-0000-0000-000000000000",
+		}); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+
+	for key, value := range settings.NodeLabels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("node label key %q is invalid: %s", key, msg))
+		}
+
+		for _, msg := range validation.IsValidLabelValue(value) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("node label %q value %q is invalid: %s", key, value, msg))
+		}
+	}
+
+	for key, value := range settings.NodeTaints {
+		for _, msg := range validation.IsQualifiedName(key) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("node taint key %q is invalid: %s", key, msg))
+		}
+
+		matches := taintValueRegexp.FindStringSubmatch(value)
+		if matches == nil {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("node taint %q value %q is invalid: expected value:Effect, with Effect one of NoSchedule, PreferNoSchedule, NoExecute", key, value))
+
+			continue
+		}
+
+		for _, msg := range validation.IsValidLabelValue(matches[1]) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("node taint %q value %q is invalid: %s", key, value, msg))
+		}
+	}
+
+	return multiErr
+}
+
+// RenderHostname renders the hostname pattern and validates the result.
+func RenderHostname(pattern string, data HostnameData) (string, error) {
+	tmpl, err := template.New("hostname").Funcs(hostnameFuncs).Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return "", fmt.Errorf("hostname pattern %q is invalid: %w", pattern, err)
+	}
+
+	var sb strings.Builder
+
+	if err = tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("hostname pattern %q is invalid: %w", pattern, err)
+	}
+
+	hostname := sb.String()
+
+	if msgs := validation.IsDNS1123Subdomain(hostname); len(msgs) > 0 {
+		return "", fmt.Errorf("hostname %q rendered from pattern %q is invalid: %s", hostname, pattern, strings.Join(msgs, ", "))
+	}
+
+	return hostname, nil
+}
+
+// hostnameUsesIndex returns true if the hostname rendered from the pattern depends on the machine index.
+func hostnameUsesIndex(pattern string, data HostnameData) bool {
+	data.Index = 0
+
+	first, err := RenderHostname(pattern, data)
+	if err != nil {
+		return false
+	}
+
+	data.Index = 1
+
+	second, err := RenderHostname(pattern, data)
+
+	return err == nil && first != second
+}
+
+// translateMachineSet translates the node labels and taints of the machine set.
+func (settings *NodeSettings) translateMachineSet(ctx TranslateContext, machineSetID string) ([]resource.Resource, error) {
+	if len(settings.NodeLabels) == 0 && len(settings.NodeTaints) == 0 {
+		return nil, nil
+	}
+
+	patch := Patch{
+		Name:   "node-settings",
+		Inline: nodeSettingsPatch("", settings.NodeLabels, settings.NodeTaints),
+	}
+
+	r, err := patch.Translate(
+		machineSetID,
+		constants.PatchWeightMachineSetNodeSettings,
+		pair.MakePair(omni.LabelCluster, ctx.ClusterName),
+		pair.MakePair(omni.LabelMachineSet, machineSetID),
+		pair.MakePair(omni.LabelSystemPatch, ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []resource.Resource{r}, nil
+}
+
+// translateMachine translates the hostname of the machine and the node labels and taints set on the machine.
+func (settings *NodeSettings) translateMachine(ctx TranslateContext, machineID MachineID) ([]resource.Resource, error) {
+	hostname := ctx.Hostnames[machineID]
+
+	if hostname.Hostname == "" && len(settings.NodeLabels) == 0 && len(settings.NodeTaints) == 0 {
+		return nil, nil
+	}
+
+	patch := Patch{
+		Name:   "node-settings",
+		Inline: nodeSettingsPatch(hostname.Hostname, settings.NodeLabels, settings.NodeTaints),
+	}
+
+	r, err := patch.Translate(
+		fmt.Sprintf("cm-%s", machineID),
+		constants.PatchWeightClusterMachineNodeSettings,
+		pair.MakePair(omni.LabelCluster, ctx.ClusterName),
+		pair.MakePair(omni.LabelClusterMachine, string(machineID)),
+		pair.MakePair(omni.LabelSystemPatch, ""),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if hostname.Pattern != "" {
+		r.Metadata().Annotations().Set(omni.TemplateHostnamePattern, hostname.Pattern)
+	}
+
+	if hostname.Index != nil {
+		r.Metadata().Annotations().Set(omni.TemplateHostnameIndex, strconv.Itoa(*hostname.Index))
+	}
+
+	return []resource.Resource{r}, nil
+}
+
+func nodeSettingsPatch(hostname string, nodeLabels, nodeTaints map[string]string) map[string]any {
+	machine := map[string]any{}
+
+	if hostname != "" {
+		machine["network"] = map[string]any{
+			"hostname": hostname,
+		}
+	}
+
+	if len(nodeLabels) > 0 {
+		machine["nodeLabels"] = nodeLabels
+	}
+
+	if len(nodeTaints) > 0 {
+		machine["nodeTaints"] = nodeTaints
+	}
+
+	return map[string]any{
+		"machine": machine,
+	}
+}
+
+// Hostname is the rendered hostname of the machine.
+type Hostname struct {
+	// Hostname is the rendered hostname.
+	Hostname string
+
+	// Index is the machine index, set if the hostname pattern uses it.
+	Index *int
+
+	// Pattern is the hostname pattern.
+	Pattern string
+}
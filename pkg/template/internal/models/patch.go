@@ -15,6 +15,7 @@ import (
 
 	"github.com/siderolabs/omni-client/pkg/omni/resources"
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/secrets"
 )
 
 // PatchList is a list of patches.
@@ -40,6 +41,25 @@ type Patch struct { //nolint:govet
 
 	// Inline patch content.
 	Inline map[string]any `yaml:"inline,omitempty"`
+
+	// dir is the directory the relative file paths are resolved against.
+	dir string
+}
+
+func (l PatchList) setDir(dir string) {
+	for i := range l {
+		l[i].dir = dir
+	}
+}
+
+func (l PatchList) files() []string {
+	var files []string
+
+	for _, patch := range l {
+		files = append(files, patch.files()...)
+	}
+
+	return files
 }
 
 // Validate the model.
@@ -92,7 +112,7 @@ func (patch *Patch) Validate() error {
 
 	switch {
 	case patch.File != "":
-		raw, err := os.ReadFile(patch.File)
+		raw, err := patch.fileContent()
 		if err != nil {
 			multiErr = multierror.Append(multiErr, fmt.Errorf("failed to access %q: %w", patch.File, err))
 		} else {
@@ -105,7 +125,7 @@ func (patch *Patch) Validate() error {
 			multiErr = multierror.Append(multiErr, fmt.Errorf("either name or idOverride is required for inline patches"))
 		}
 
-		raw, err := yaml.Marshal(patch.Inline)
+		raw, err := patch.inlineContent()
 		if err != nil {
 			multiErr = multierror.Append(multiErr, fmt.Errorf("failed to marshal inline patch %q: %w", name, err))
 		} else {
@@ -141,9 +161,9 @@ func (patch *Patch) Translate(prefix string, weight int, labels ...pair.Pair[str
 
 	switch {
 	case patch.File != "":
-		raw, err = os.ReadFile(patch.File)
+		raw, err = patch.fileContent()
 	case patch.Inline != nil:
-		raw, err = yaml.Marshal(patch.Inline)
+		raw, err = patch.inlineContent()
 	default:
 		panic("missing patch contents?")
 	}
@@ -161,3 +181,36 @@ func (patch *Patch) Translate(prefix string, weight int, labels ...pair.Pair[str
 
 	return patchResource, nil
 }
+
+// files returns the patch file and the files of the secret placeholders.
+func (patch *Patch) files() []string {
+	if patch.File != "" {
+		return fileWithSecrets(secrets.ResolvePath(patch.dir, patch.File), patch.dir)
+	}
+
+	return secrets.Files(patch.Inline, patch.dir)
+}
+
+// fileContent reads the patch file, decrypting it if it's encrypted, and resolves the secret placeholders.
+func (patch *Patch) fileContent() ([]byte, error) {
+	raw, err := os.ReadFile(secrets.ResolvePath(patch.dir, patch.File))
+	if err != nil {
+		return nil, err
+	}
+
+	if raw, err = secrets.Decrypt(raw); err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return secrets.ResolveDocuments(raw, patch.dir)
+}
+
+// inlineContent marshals the inline patch with the secret placeholders resolved.
+func (patch *Patch) inlineContent() ([]byte, error) {
+	inline, err := secrets.Resolve(patch.Inline, patch.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(inline)
+}
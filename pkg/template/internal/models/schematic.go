@@ -0,0 +1,122 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/meta"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// Schematic defines the Image Factory schematic customization of the machines.
+//
+// The customization of the most specific level (machine, machine set, cluster) is used as a whole, levels are not merged.
+type Schematic struct {
+	// SystemExtensions is a list of the system extension names, e.g. siderolabs/iscsi-tools.
+	SystemExtensions []string `yaml:"systemExtensions,omitempty"`
+
+	// ExtraKernelArgs is a list of the extra kernel arguments.
+	ExtraKernelArgs []string `yaml:"extraKernelArgs,omitempty"`
+
+	// Meta is a set of the initial META partition values.
+	Meta map[uint32]string `yaml:"meta,omitempty"`
+}
+
+// IsEmpty returns true if the schematic has no customizations.
+func (schematic *Schematic) IsEmpty() bool {
+	return len(schematic.SystemExtensions) == 0 && len(schematic.ExtraKernelArgs) == 0 && len(schematic.Meta) == 0
+}
+
+// Key returns the canonical representation of the schematic customization.
+//
+// Extensions are sorted, as their order doesn't matter, while the order of the kernel arguments is preserved.
+func (schematic *Schematic) Key() string {
+	extensions := slices.Clone(schematic.SystemExtensions)
+	slices.Sort(extensions)
+
+	// map keys are sorted by encoding/json
+	key, _ := json.Marshal(struct { //nolint:errcheck,errchkjson
+		Meta       map[uint32]string `json:"m,omitempty"`
+		Extensions []string          `json:"e,omitempty"`
+		KernelArgs []string          `json:"k,omitempty"`
+	}{
+		Extensions: extensions,
+		KernelArgs: schematic.ExtraKernelArgs,
+		Meta:       schematic.Meta,
+	})
+
+	return string(key)
+}
+
+// Validate the model.
+func (schematic *Schematic) Validate() error {
+	var multiErr error
+
+	extensions := map[string]struct{}{}
+
+	for _, extension := range schematic.SystemExtensions {
+		if extension == "" {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("system extension name should not be empty"))
+
+			continue
+		}
+
+		if _, ok := extensions[extension]; ok {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("system extension %q is duplicated", extension))
+		}
+
+		extensions[extension] = struct{}{}
+	}
+
+	for _, arg := range schematic.ExtraKernelArgs {
+		if arg == "" {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("extra kernel argument should not be empty"))
+		}
+	}
+
+	for key := range schematic.Meta {
+		if !meta.CanSetMetaKey(int(key)) {
+			multiErr = multierror.Append(multiErr, fmt.Errorf("meta key 0x%x is not allowed", key))
+		}
+	}
+
+	return multiErr
+}
+
+// translate the schematic customization into the schematic configuration.
+func (schematic *Schematic) translate(ctx TranslateContext, id resource.ID, target specs.SchematicConfigurationSpec_Target, labels ...string) ([]resource.Resource, error) {
+	if schematic.IsEmpty() {
+		return nil, nil
+	}
+
+	schematicID, ok := ctx.SchematicIDs[schematic.Key()]
+	if !ok {
+		if ctx.SkipUnresolved {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("schematic for %q is not resolved", id)
+	}
+
+	schematicConfiguration := omni.NewSchematicConfiguration(resources.DefaultNamespace, id)
+	schematicConfiguration.Metadata().Labels().Set(omni.LabelCluster, ctx.ClusterName)
+
+	for _, label := range labels {
+		schematicConfiguration.Metadata().Labels().Set(label, id)
+	}
+
+	schematicConfiguration.TypedSpec().Value.SchematicId = schematicID
+	schematicConfiguration.TypedSpec().Value.Target = target
+
+	return []resource.Resource{schematicConfiguration}, nil
+}
@@ -0,0 +1,134 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/getsops/sops/v3"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/decrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables holding the age identities, same as used by SOPS.
+const (
+	AgeKeyEnvVar     = sopsage.SopsAgeKeyEnv
+	AgeKeyFileEnvVar = sopsage.SopsAgeKeyFileEnv
+)
+
+const (
+	ageHeader = "age-encryption.org/v1\n"
+	sopsKey   = "sops"
+)
+
+// Decrypt decrypts the age-encrypted file or the SOPS YAML file.
+//
+// Unencrypted input is returned as is.
+//
+// The age identities are read from the SOPS_AGE_KEY environment variable, from the file in the SOPS_AGE_KEY_FILE environment variable,
+// or from the default SOPS keys file (sops/age/keys.txt in the user config directory).
+//
+// SOPS files are decrypted by SOPS itself, so the data key is decrypted with any of the SOPS key sources configured
+// in the environment, and the file is checked against the SOPS MAC.
+func Decrypt(raw []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(raw, []byte(ageHeader)), bytes.HasPrefix(bytes.TrimSpace(raw), []byte(armor.Header)):
+		return decryptAge(raw)
+	case bytes.Contains(raw, []byte(sopsKey+":")):
+		return decryptSOPS(raw)
+	default:
+		return raw, nil
+	}
+}
+
+func decryptAge(raw []byte) ([]byte, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	var in io.Reader = bytes.NewReader(raw)
+
+	if !bytes.HasPrefix(raw, []byte(ageHeader)) {
+		in = armor.NewReader(bytes.NewReader(bytes.TrimSpace(raw)))
+	}
+
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func ageIdentities() ([]age.Identity, error) {
+	var keys strings.Builder
+
+	if key := os.Getenv(AgeKeyEnvVar); key != "" {
+		keys.WriteString(key)
+		keys.WriteString("\n")
+	}
+
+	keyFile := os.Getenv(AgeKeyFileEnvVar)
+	if keyFile == "" {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			keyFile = filepath.Join(configDir, "sops", "age", "keys.txt")
+		}
+	}
+
+	if keyFile != "" {
+		contents, err := os.ReadFile(keyFile)
+
+		switch {
+		case err == nil:
+			keys.Write(contents)
+		case !errors.Is(err, os.ErrNotExist) || os.Getenv(AgeKeyFileEnvVar) != "":
+			return nil, fmt.Errorf("error reading age keys file: %w", err)
+		}
+	}
+
+	if keys.Len() == 0 {
+		return nil, fmt.Errorf("no age identities found, set %s or %s", AgeKeyEnvVar, AgeKeyFileEnvVar)
+	}
+
+	return age.ParseIdentities(strings.NewReader(keys.String()))
+}
+
+func decryptSOPS(raw []byte) ([]byte, error) {
+	plaintext, err := decrypt.DataWithFormat(raw, formats.Yaml)
+	if err != nil {
+		if errors.Is(err, sops.MetadataNotFound) {
+			// not a SOPS file
+			return raw, nil
+		}
+
+		// the user error lists the failures of each key, e.g. the missing age identities
+		var userErr sops.UserError
+
+		if errors.As(err, &userErr) {
+			return nil, errors.New(userErr.UserError())
+		}
+
+		return nil, err
+	}
+
+	// the plaintext is re-encoded with the indentation of the templates
+	docs, err := decodeDocuments[yaml.Node](plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeDocuments(docs)
+}
@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package secrets_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/template/internal/secrets"
+)
+
+func TestDecryptSOPS(t *testing.T) {
+	t.Setenv(secrets.AgeKeyFileEnvVar, "../../testdata/age-key.txt")
+
+	raw, err := os.ReadFile("../../testdata/patches/registry-auth.sops.yaml")
+	require.NoError(t, err)
+
+	encrypted := string(raw)
+
+	decrypted, err := secrets.Decrypt(raw)
+	require.NoError(t, err)
+
+	assert.Equal(t, `machine:
+  registries:
+    config:
+      ghcr.io:
+        auth:
+          username: robot
+          password: s3cr3t
+  sysctls:
+    net.core.somaxconn: "1024"
+`, string(decrypted))
+
+	lines := strings.Split(encrypted, "\n")
+	username, password := lines[5], lines[6]
+
+	for _, test := range []struct {
+		name     string
+		modified string
+		err      string
+	}{
+		{
+			name:     "reordered values",
+			modified: strings.Replace(encrypted, username+"\n"+password, password+"\n"+username, 1),
+			err:      "Failed to verify data integrity",
+		},
+		{
+			name:     "deleted value",
+			modified: strings.Replace(encrypted, password+"\n", "", 1),
+			err:      "Failed to verify data integrity",
+		},
+		{
+			name:     "added value",
+			modified: strings.Replace(encrypted, password+"\n", password+"\n                    auth: token\n", 1),
+			err:      "Could not decrypt value",
+		},
+		{
+			name: "swapped values",
+			modified: strings.NewReplacer(
+				username, strings.Replace(password, "password:", "username:", 1),
+				password, strings.Replace(username, "username:", "password:", 1),
+			).Replace(encrypted),
+			err: "Could not decrypt with AES_GCM",
+		},
+		{
+			name:     "modified MAC",
+			modified: regexp.MustCompile(`mac: ENC\[AES256_GCM,data:..`).ReplaceAllString(encrypted, "mac: ENC[AES256_GCM,data:AA"),
+			err:      "Failed to decrypt original mac",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require.NotEqual(t, encrypted, test.modified)
+
+			_, err := secrets.Decrypt([]byte(test.modified))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestDecryptSOPSWrongKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	require.NoError(t, os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0o600))
+
+	t.Setenv(secrets.AgeKeyFileEnvVar, keyFile)
+
+	raw, err := os.ReadFile("../../testdata/patches/registry-auth.sops.yaml")
+	require.NoError(t, err)
+
+	_, err = secrets.Decrypt(raw)
+	assert.ErrorContains(t, err, "Failed to get the data key required to decrypt the SOPS file")
+	assert.ErrorContains(t, err, "no identity matched any of the recipients")
+}
+
+func TestDecryptPlain(t *testing.T) {
+	// the files mentioning SOPS without the SOPS metadata are not encrypted
+	raw := []byte("machine:\n  nodeLabels:\n    sops: managed\n")
+
+	decrypted, err := secrets.Decrypt(raw)
+	require.NoError(t, err)
+
+	assert.Equal(t, raw, decrypted)
+}
@@ -0,0 +1,275 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package secrets implements secret placeholders and decryption of the encrypted patch files.
+//
+// Secret placeholder is a map with the single `secretRef` key, which is replaced with the secret value:
+//
+//	password:
+//	  secretRef:
+//	    env: REGISTRY_PASSWORD # value of the environment variable
+//	key:
+//	  secretRef:
+//	    file: secrets/ca.key # contents of the file, without the trailing newline
+//
+// Relative file paths are resolved against the directory of the template.
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RefKey is the key of the secret placeholder.
+const RefKey = "secretRef"
+
+// Ref is the secret reference.
+type Ref struct {
+	// Env is the name of the environment variable holding the secret.
+	Env string `yaml:"env,omitempty"`
+
+	// File is the path to the file holding the secret.
+	File string `yaml:"file,omitempty"`
+}
+
+// Placeholder returns the placeholder for the secret stored in the environment variable.
+func Placeholder(env string) map[string]any {
+	return map[string]any{
+		RefKey: map[string]any{
+			"env": env,
+		},
+	}
+}
+
+// Resolve returns a copy of the value with all secret placeholders replaced with the secret values.
+//
+// Relative file paths are resolved against the directory, if it is set.
+func Resolve(value any, dir string) (any, error) {
+	return resolve("", value, dir)
+}
+
+// ResolveDocuments replaces the secret placeholders in the multi-document YAML, see Resolve.
+//
+// If there are no placeholders, the input is returned as is.
+func ResolveDocuments(raw []byte, dir string) ([]byte, error) {
+	if !bytes.Contains(raw, []byte(RefKey)) {
+		return raw, nil
+	}
+
+	docs, err := decodeDocuments[any](raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, doc := range docs {
+		if docs[i], err = Resolve(doc, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeDocuments(docs)
+}
+
+func resolve(path string, value any, dir string) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if ref, ok := v[RefKey]; ok && len(v) == 1 {
+			secret, err := resolveRef(ref, dir)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving secret at %q: %w", path, err)
+			}
+
+			return secret, nil
+		}
+
+		result := make(map[string]any, len(v))
+
+		for key, item := range v {
+			resolved, err := resolve(joinPath(path, key), item, dir)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = resolved
+		}
+
+		return result, nil
+	case []any:
+		result := make([]any, 0, len(v))
+
+		for i, item := range v {
+			resolved, err := resolve(fmt.Sprintf("%s[%d]", path, i), item, dir)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, resolved)
+		}
+
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// Files returns the files of the secret placeholders in the value, resolved against the directory.
+func Files(value any, dir string) []string {
+	switch v := value.(type) {
+	case map[string]any:
+		if ref, ok := v[RefKey]; ok && len(v) == 1 {
+			if decoded, err := decodeRef(ref); err == nil && decoded.File != "" {
+				return []string{ResolvePath(dir, decoded.File)}
+			}
+
+			return nil
+		}
+
+		var files []string
+
+		for _, item := range v {
+			files = append(files, Files(item, dir)...)
+		}
+
+		return files
+	case []any:
+		var files []string
+
+		for _, item := range v {
+			files = append(files, Files(item, dir)...)
+		}
+
+		return files
+	default:
+		return nil
+	}
+}
+
+// DocumentFiles returns the files of the secret placeholders in the multi-document YAML, see Files.
+func DocumentFiles(raw []byte, dir string) []string {
+	if !bytes.Contains(raw, []byte(RefKey)) {
+		return nil
+	}
+
+	docs, err := decodeDocuments[any](raw)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+
+	for _, doc := range docs {
+		files = append(files, Files(doc, dir)...)
+	}
+
+	return files
+}
+
+func decodeRef(value any) (Ref, error) {
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	var ref Ref
+
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+
+	if err = decoder.Decode(&ref); err != nil {
+		return Ref{}, fmt.Errorf("invalid %s: %w", RefKey, err)
+	}
+
+	return ref, nil
+}
+
+func resolveRef(value any, dir string) (string, error) {
+	ref, err := decodeRef(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case ref.Env != "" && ref.File != "":
+		return "", errors.New("env and file are mutually exclusive")
+	case ref.Env != "":
+		secret, ok := os.LookupEnv(ref.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", ref.Env)
+		}
+
+		return secret, nil
+	case ref.File != "":
+		secret, err := os.ReadFile(ResolvePath(dir, ref.File))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSuffix(string(secret), "\n"), nil
+	default:
+		return "", errors.New("either env or file is required")
+	}
+}
+
+// ResolvePath resolves the relative path against the directory, if it is set.
+func ResolvePath(dir, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func decodeDocuments[T any](raw []byte) ([]T, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+
+	var docs []T
+
+	for {
+		var doc T
+
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return docs, nil
+			}
+
+			return nil, err
+		}
+
+		docs = append(docs, doc)
+	}
+}
+
+func encodeDocuments[T any](docs []T) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	for i := range docs {
+		if err := encoder.Encode(&docs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+)
+
+// JsonnetOptions are the variables passed to the Jsonnet template.
+type JsonnetOptions struct {
+	// ExtVars are the external string variables, available with std.extVar.
+	ExtVars map[string]string
+
+	// ExtCode are the external variables with Jsonnet code values.
+	ExtCode map[string]string
+
+	// TLAVars are the top-level string arguments of the function returned by the template.
+	TLAVars map[string]string
+
+	// TLACode are the top-level arguments with Jsonnet code values.
+	TLACode map[string]string
+}
+
+// IsJsonnet returns true if the template file should be evaluated as Jsonnet.
+func IsJsonnet(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".jsonnet")
+}
+
+// EvaluateJsonnet evaluates the Jsonnet template file, the imports are resolved relative to the importing file.
+//
+// The template should evaluate to a document or to an array of documents, the result can be loaded with Load.
+// The result is always a JSON array, so the errors of Load refer to the documents by the index in the array.
+//
+// The evaluation can't be interrupted: if the context is canceled, the function returns, but the evaluation is left
+// running in the background until it finishes. The recursion depth is limited, so a runaway recursion fails,
+// but a long computation keeps its goroutine, so the long-running callers should not re-evaluate the template
+// more often than it takes to evaluate it, e.g. the reconciler evaluates the templates at most once per sync.
+func EvaluateJsonnet(ctx context.Context, path string, options JsonnetOptions) (io.Reader, error) {
+	vm := jsonnet.MakeVM()
+
+	for key, value := range options.ExtVars {
+		vm.ExtVar(key, value)
+	}
+
+	for key, value := range options.ExtCode {
+		vm.ExtCode(key, value)
+	}
+
+	for key, value := range options.TLAVars {
+		vm.TLAVar(key, value)
+	}
+
+	for key, value := range options.TLACode {
+		vm.TLACode(key, value)
+	}
+
+	type result struct {
+		err    error
+		output string
+	}
+
+	resultCh := make(chan result, 1)
+
+	go func() {
+		output, err := vm.EvaluateFile(path)
+
+		resultCh <- result{output: output, err: err}
+	}()
+
+	var res result
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("error evaluating jsonnet template %q: %w", path, ctx.Err())
+	case res = <-resultCh:
+	}
+
+	if res.err != nil {
+		// the error contains the positions in the Jsonnet files
+		return nil, fmt.Errorf("error evaluating jsonnet template %q: %w", path, res.err)
+	}
+
+	// the errors of Load refer to the documents of the JSON array by the index, the positions in the evaluated output are meaningless
+	if strings.HasPrefix(strings.TrimSpace(res.output), "[") {
+		return strings.NewReader(res.output), nil
+	}
+
+	return strings.NewReader("[" + res.output + "]"), nil
+}
+
+// jsonnetImports returns the absolute paths of the files imported by the Jsonnet template file, directly or transitively.
+func jsonnetImports(path string) ([]string, error) {
+	imports, err := jsonnet.MakeVM().FindDependencies("", []string{path})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing jsonnet template %q: %w", path, err)
+	}
+
+	return imports, nil
+}
@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+const jsonTemplate = `[
+  {"kind": "Cluster", "name": "json", "kubernetes": {"version": "v1.29.1"}, "talos": {"version": "v1.6.4"}},
+  {"kind": "ControlPlane", "machines": ["1a2b3c4d-0000-4000-8000-000000000001"]},
+  {"kind": "Workers", "machines": ["1a2b3c4d-0000-4000-8000-000000000002"]}
+]
+`
+
+func TestLoadJSON(t *testing.T) {
+	tmpl, err := template.Load(strings.NewReader(jsonTemplate))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	clusterName, err := tmpl.ClusterName()
+	require.NoError(t, err)
+	assert.Equal(t, "json", clusterName)
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+	assert.NotEmpty(t, resourceList)
+
+	for _, tt := range []struct {
+		name          string
+		input         string
+		expectedError string
+	}{
+		{
+			name:          "unknown field",
+			input:         `[{"kind": "Cluster", "name": "json"}, {"kind": "ControlPlane", "machine": []}]`,
+			expectedError: "error decoding document 1: yaml: unmarshal errors:\n  line 1: field machine not found in type models.ControlPlane",
+		},
+		{
+			name:          "unknown kind",
+			input:         `[{"kind": "Cluster", "name": "json"}, {"kind": "ControlPlane"}, {"kind": "FunnyWorkers"}]`,
+			expectedError: `error in document 2: unknown model kind "FunnyWorkers"`,
+		},
+		{
+			name:          "index continues across YAML documents",
+			input:         "kind: Cluster\nname: json\n---\n" + `[{"kind": "ControlPlane"}, {"name": "workers"}]`,
+			expectedError: "error in document 2: kind field not found",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := template.Load(strings.NewReader(tt.input))
+			assert.EqualError(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestEvaluateJsonnet(t *testing.T) {
+	assert.True(t, template.IsJsonnet("fleet/prod.jsonnet"))
+	assert.False(t, template.IsJsonnet("prod.json"))
+
+	dir := t.TempDir()
+
+	for name, contents := range map[string]string{
+		"lib.libsonnet": `{
+  machineSet(kind, machines):: { kind: kind, machines: machines },
+}
+`,
+		"cluster.jsonnet": `local lib = import 'lib.libsonnet';
+
+function(name, ha) [
+  {
+    kind: 'Cluster',
+    name: name,
+    kubernetes: { version: 'v1.29.1' },
+    talos: { version: 'v1.6.4' },
+    annotations: { env: std.extVar('env'), replicas: std.toString(std.extVar('replicas')), ha: std.toString(ha) },
+  },
+  lib.machineSet('ControlPlane', ['1a2b3c4d-0000-4000-8000-000000000001']),
+  lib.machineSet(std.extVar('workersKind'), ['1a2b3c4d-0000-4000-8000-000000000002']),
+]
+`,
+		"broken.jsonnet": `{ kind: 'Cluster', name: self.foo }
+`,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+
+	ctx := context.Background()
+
+	evaluate := func(workersKind string) (*template.Template, error) {
+		evaluated, err := template.EvaluateJsonnet(ctx, filepath.Join(dir, "cluster.jsonnet"), template.JsonnetOptions{
+			ExtVars: map[string]string{"env": "prod", "workersKind": workersKind},
+			ExtCode: map[string]string{"replicas": "1 + 2"},
+			TLAVars: map[string]string{"name": "jsonnet"},
+			TLACode: map[string]string{"ha": "true"},
+		})
+		require.NoError(t, err)
+
+		return template.Load(evaluated)
+	}
+
+	tmpl, err := evaluate("Workers")
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	cluster := resourceList[0]
+
+	assert.Equal(t, "jsonnet", cluster.Metadata().ID())
+
+	for key, expected := range map[string]string{"env": "prod", "replicas": "3", "ha": "true"} {
+		value, _ := cluster.Metadata().Annotations().Get(key)
+		assert.Equal(t, expected, value, key)
+	}
+
+	// the document index is the index in the evaluated array
+	_, err = evaluate("FunnyWorkers")
+	assert.EqualError(t, err, `error in document 2: unknown model kind "FunnyWorkers"`)
+
+	// the evaluation errors point to the Jsonnet source
+	_, err = template.EvaluateJsonnet(ctx, filepath.Join(dir, "broken.jsonnet"), template.JsonnetOptions{})
+	assert.ErrorContains(t, err, "Field does not exist: foo")
+	assert.ErrorContains(t, err, "broken.jsonnet:1:")
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = template.EvaluateJsonnet(canceledCtx, filepath.Join(dir, "cluster.jsonnet"), template.JsonnetOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
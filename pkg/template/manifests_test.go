@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// fakeHelm puts a fake helm binary into the PATH, which renders a deployment with the passed arguments in the annotation.
+func fakeHelm(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "helm"), []byte(`#!/bin/sh
+cat <<EOF
+---
+# Source: monitoring/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: $2
+  annotations:
+    args: "$*"
+EOF
+`), 0o755))
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestManifests(t *testing.T) {
+	fakeHelm(t)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir("testdata"))
+
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	f, err := os.Open("cluster-manifests.yaml")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, f.Close())
+	})
+
+	tmpl, err := template.Load(f)
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	patches := map[string]*omni.ConfigPatch{}
+
+	for _, r := range resourceList {
+		if configPatch, ok := r.(*omni.ConfigPatch); ok {
+			patches[configPatch.Metadata().ID()] = configPatch
+		}
+	}
+
+	require.Len(t, patches, 2)
+
+	apps := patches["380-manifests-control-planes-manifests-apps"]
+	require.NotNil(t, apps)
+
+	machineSet, _ := apps.Metadata().Labels().Get(omni.LabelMachineSet)
+	assert.Equal(t, "manifests-control-planes", machineSet)
+
+	_, ok := apps.Metadata().Labels().Get(omni.LabelSystemPatch)
+	assert.True(t, ok)
+
+	assert.Equal(t, `cluster:
+    inlineManifests:
+        - contents: |
+            apiVersion: v1
+            kind: Namespace
+            metadata:
+                name: apps
+            ---
+            apiVersion: v1
+            data:
+                level: info
+            kind: ConfigMap
+            metadata:
+                name: settings
+                namespace: apps
+            ---
+            apiVersion: v1
+            kind: ServiceAccount
+            metadata:
+                name: runner
+                namespace: apps
+          name: apps
+`, apps.TypedSpec().Value.GetData())
+
+	monitoring := patches["380-manifests-control-planes-manifests-monitoring"]
+	require.NotNil(t, monitoring)
+
+	assert.Contains(t, monitoring.TypedSpec().Value.GetData(),
+		"args: template monitoring manifests/charts/monitoring --namespace monitoring --values manifests/monitoring-values.yaml")
+}
+
+func TestManifestsInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "no-kind.yaml"), []byte("apiVersion: v1\nmetadata:\n  name: foo\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "empty"), 0o755))
+
+	tmpl, err := template.Load(strings.NewReader(`kind: Cluster
+name: manifests
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 1a2b3c4d-0000-4000-8000-000000000001
+---
+kind: Manifests
+name: apps
+files:
+  - ` + filepath.Join(dir, "no-kind.yaml") + `
+  - ` + filepath.Join(dir, "empty") + `
+---
+kind: Manifests
+name: apps
+helm:
+  - chart: ` + filepath.Join(dir, "missing-chart") + `
+`))
+	require.NoError(t, err)
+
+	err = tmpl.Validate()
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, "document 0: kind is required")
+	assert.ErrorContains(t, err, `directory has no [".yaml" ".yml" ".json"] files`)
+	assert.ErrorContains(t, err, "missing-chart")
+	assert.ErrorContains(t, err, `duplicate manifests with name "apps"`)
+}
+
+func TestManifestsSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "large.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: large\ndata:\n  blob: "+
+		strings.Repeat("a", 32*1024*1024)+"\n"), 0o644))
+
+	tmpl, err := template.Load(strings.NewReader(`kind: Cluster
+name: manifests
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 1a2b3c4d-0000-4000-8000-000000000001
+---
+kind: Manifests
+name: large
+files:
+  - ` + path + `
+`))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	_, err = tmpl.Translate()
+	assert.ErrorContains(t, err, `manifests "large" size 32 MiB exceeds the limit of 31 MiB`)
+}
@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/xslices"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// NeedsNetworkLinks returns true if the template has network link selectors which should be resolved before the translation.
+func (t *Template) NeedsNetworkLinks() bool {
+	return len(t.models.LinkSelectors()) > 0
+}
+
+// ResolveNetworkLinks resolves the network link selectors of the machines with the static addresses against the network links of the machines.
+//
+// Each selector should match exactly one link of the machine.
+func (t *Template) ResolveNetworkLinks(ctx context.Context, st state.State) error {
+	selectors := t.models.LinkSelectors()
+	if len(selectors) == 0 {
+		return nil
+	}
+
+	machineIDs := make([]models.MachineID, 0, len(selectors))
+
+	for machineID := range selectors {
+		machineIDs = append(machineIDs, machineID)
+	}
+
+	slices.Sort(machineIDs)
+
+	var multiErr error
+
+	networkLinks := make(map[models.MachineID]string, len(selectors))
+
+	for _, machineID := range machineIDs {
+		selector := selectors[machineID]
+
+		mac, err := resolveNetworkLink(ctx, st, machineID, &selector)
+		if err != nil {
+			multiErr = multierror.Append(multiErr, err)
+
+			continue
+		}
+
+		networkLinks[machineID] = mac
+	}
+
+	if multiErr != nil {
+		return multiErr
+	}
+
+	t.networkLinks = networkLinks
+
+	return nil
+}
+
+func resolveNetworkLink(ctx context.Context, st state.State, machineID models.MachineID, selector *models.LinkSelector) (string, error) {
+	machineStatus, err := safe.StateGetByID[*omni.MachineStatus](ctx, st, string(machineID))
+	if err != nil {
+		return "", fmt.Errorf("failed to get status of machine %q: %w", machineID, err)
+	}
+
+	links := machineStatus.TypedSpec().Value.GetNetwork().GetNetworkLinks()
+	if len(links) == 0 {
+		return "", fmt.Errorf("machine %q has no network links reported", machineID)
+	}
+
+	matches := xslices.Filter(links, selector.Match)
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no network links of machine %q match the link selector", machineID)
+	case 1:
+		mac, err := net.ParseMAC(matches[0].GetHardwareAddress())
+		if err != nil {
+			return "", fmt.Errorf("network link %q of machine %q has invalid hardware address: %w", matches[0].GetLinuxName(), machineID, err)
+		}
+
+		return mac.String(), nil
+	default:
+		return "", fmt.Errorf("link selector of machine %q is ambiguous, it matches links %q", machineID,
+			xslices.Map(matches, (*specs.MachineStatusSpec_NetworkStatus_NetworkLinkStatus).GetLinuxName))
+	}
+}
@@ -0,0 +1,211 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/cluster-network.yaml
+var clusterNetwork []byte
+
+type networkLink = specs.MachineStatusSpec_NetworkStatus_NetworkLinkStatus
+
+func createMachineNetworkStatus(ctx context.Context, t *testing.T, st state.State, id string, links ...*networkLink) {
+	machineStatus := omni.NewMachineStatus(resources.DefaultNamespace, id)
+	machineStatus.TypedSpec().Value.Network = &specs.MachineStatusSpec_NetworkStatus{
+		NetworkLinks: links,
+	}
+
+	require.NoError(t, st.Create(ctx, machineStatus))
+}
+
+func TestNetwork(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	tmpl, err := template.Load(bytes.NewReader(clusterNetwork))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+	require.True(t, tmpl.NeedsNetworkLinks())
+
+	_, err = tmpl.Translate()
+	require.ErrorContains(t, err, `network link of machine "1a2b3c4d-0000-4000-8000-000000000002" is not resolved`)
+
+	createMachineNetworkStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000002",
+		&networkLink{LinuxName: "eth0", HardwareAddress: "52:54:00:aa:00:02", LinkUp: true},
+		&networkLink{LinuxName: "eth1", HardwareAddress: "52:54:00:bb:00:02"},
+	)
+	createMachineNetworkStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000003",
+		&networkLink{LinuxName: "eth0", HardwareAddress: "52:54:00:aa:00:03", LinkUp: true},
+		&networkLink{LinuxName: "eth1", HardwareAddress: "52:54:00:bb:00:03", LinkUp: true},
+	)
+
+	err = tmpl.ResolveNetworkLinks(ctx, st)
+	require.Error(t, err)
+
+	assert.ErrorContains(t, err, `failed to get status of machine "1a2b3c4d-0000-4000-8000-000000000004"`)
+	assert.NotContains(t, err.Error(), "1a2b3c4d-0000-4000-8000-000000000001", "the machine with the exact hardware address doesn't need the status")
+
+	createMachineNetworkStatus(ctx, t, st, "1a2b3c4d-0000-4000-8000-000000000004",
+		&networkLink{LinuxName: "eth1", HardwareAddress: "52:54:00:BB:00:04"},
+	)
+
+	require.NoError(t, tmpl.ResolveNetworkLinks(ctx, st))
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	patches := map[string]string{}
+
+	for _, r := range resourceList {
+		if _, ok := r.Metadata().Labels().Get(omni.LabelSystemPatch); !ok {
+			continue
+		}
+
+		patches[r.Metadata().ID()] = r.(*omni.ConfigPatch).TypedSpec().Value.GetData()
+	}
+
+	assert.Equal(t, map[string]string{
+		"385-cm-1a2b3c4d-0000-4000-8000-000000000001-network": flatNetworkPatch("52:54:00:aa:00:01", "10.5.0.4/24"),
+		"385-cm-1a2b3c4d-0000-4000-8000-000000000002-network": flatNetworkPatch("52:54:00:aa:00:02", "10.5.0.3/24"),
+		"385-cm-1a2b3c4d-0000-4000-8000-000000000003-network": vlanNetworkPatch("52:54:00:bb:00:03", "10.6.0.100/24"),
+		"385-cm-1a2b3c4d-0000-4000-8000-000000000004-network": vlanNetworkPatch("52:54:00:bb:00:04", "10.6.0.101/24"),
+	}, patches)
+
+	for id, data := range patches {
+		assert.NoError(t, omni.ValidateConfigPatch(data), "patch %q is invalid", id)
+	}
+}
+
+func flatNetworkPatch(mac, address string) string {
+	return `machine:
+    network:
+        interfaces:
+            - addresses:
+                - ` + address + `
+              deviceSelector:
+                hardwareAddr: ` + mac + `
+              routes:
+                - gateway: 10.5.0.1
+                  network: 0.0.0.0/0
+        nameservers:
+            - 10.5.0.2
+`
+}
+
+func vlanNetworkPatch(mac, address string) string {
+	return `machine:
+    network:
+        interfaces:
+            - deviceSelector:
+                hardwareAddr: ` + mac + `
+              vlans:
+                - addresses:
+                    - ` + address + `
+                  vlanId: 200
+`
+}
+
+func TestNetworkValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		network  string
+		machines string
+		expected string
+	}{
+		{
+			name:     "address collision",
+			network:  "addressPool:\n    cidr: 10.5.0.0/24",
+			machines: "network:\n  address: 10.5.0.10\n---\nkind: Machine\nname: 1a2b3c4d-0000-4000-8000-000000000002\nnetwork:\n  address: 10.5.0.10",
+			expected: `network address "10.5.0.10" is used by machines "1a2b3c4d-0000-4000-8000-000000000001" and "1a2b3c4d-0000-4000-8000-000000000002"`,
+		},
+		{
+			name:     "overlapping pools",
+			network:  "addressPool:\n    cidr: 10.5.0.0/24",
+			machines: "network:\n  address: 10.5.0.10\n---\nkind: Workers\nmachines:\n  - 1a2b3c4d-0000-4000-8000-000000000003\nnetwork:\n  addressPool:\n    cidr: 10.5.0.0/25",
+			expected: `network address "10.5.0.1" is allocated to machines "1a2b3c4d-0000-4000-8000-000000000002" and "1a2b3c4d-0000-4000-8000-000000000003"`,
+		},
+		{
+			name:     "exhausted pool",
+			network:  "addressPool:\n    cidr: 10.5.0.0/30\n    gateway: 10.5.0.1",
+			expected: `address pool "10.5.0.0/30" is exhausted, no address left for machine "1a2b3c4d-0000-4000-8000-000000000002"`,
+		},
+		{
+			name:     "address out of pool",
+			network:  "addressPool:\n    cidr: 10.5.0.0/24",
+			machines: "network:\n  address: 10.6.0.10",
+			expected: `network address "10.6.0.10" of machine "1a2b3c4d-0000-4000-8000-000000000001" is not in the address pool "10.5.0.0/24"`,
+		},
+		{
+			name:     "reserved address",
+			network:  "addressPool:\n    cidr: 10.5.0.0/24\n    gateway: 10.5.0.1",
+			machines: "network:\n  address: 10.5.0.1",
+			expected: `network address "10.5.0.1" of machine "1a2b3c4d-0000-4000-8000-000000000001" is reserved in the address pool "10.5.0.0/24"`,
+		},
+		{
+			name:     "address without pool",
+			network:  "link:\n    name: eth0",
+			machines: "network:\n  address: 10.5.0.10",
+			expected: `machine "1a2b3c4d-0000-4000-8000-000000000001" has the network address "10.5.0.10", but no address pool`,
+		},
+		{
+			name:     "invalid cidr",
+			network:  "addressPool:\n    cidr: 10.5.0.1/24",
+			expected: `address pool cidr "10.5.0.1/24" should be a network prefix, e.g. "10.5.0.0/24"`,
+		},
+		{
+			name:     "gateway out of cidr",
+			network:  "addressPool:\n    cidr: 10.5.0.0/24\n    gateway: 10.6.0.1",
+			expected: `address pool gateway "10.6.0.1" is not in cidr "10.5.0.0/24"`,
+		},
+		{
+			name:     "empty link selector",
+			network:  "link: {}",
+			expected: "link selector should have at least one criterion",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.Load(bytes.NewReader([]byte(`kind: Cluster
+name: invalid
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 1a2b3c4d-0000-4000-8000-000000000001
+  - 1a2b3c4d-0000-4000-8000-000000000002
+network:
+  ` + tt.network + `
+---
+kind: Machine
+name: 1a2b3c4d-0000-4000-8000-000000000001
+` + tt.machines + "\n")))
+			require.NoError(t, err)
+
+			assert.ErrorContains(t, tmpl.Validate(), tt.expected)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	_ "embed"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/cluster-node-settings.yaml
+var clusterNodeSettings []byte
+
+func TestNodeSettings(t *testing.T) {
+	patches, patterns, indexes := translateNodeSettings(t, clusterNodeSettings)
+
+	assert.Equal(t, map[string]string{
+		"390-node-settings-control-planes-node-settings":            "machine:\n    nodeLabels:\n        topology.kubernetes.io/region: eu-central\n",
+		"390-node-settings-storage-node-settings":                   "machine:\n    nodeTaints:\n        dedicated: storage:NoSchedule\n",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000001-node-settings": "machine:\n    network:\n        hostname: prod-cp-1\n",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000002-node-settings": "machine:\n    network:\n        hostname: prod-cp-2\n    nodeLabels:\n        topology.kubernetes.io/zone: zone-b\n",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000003-node-settings": "machine:\n    network:\n        hostname: node-settings-storage-1a2b3c4d\n",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000004-node-settings": "machine:\n    network:\n        hostname: storage-special\n",
+	}, patches)
+
+	assert.Equal(t, map[string]string{
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000001-node-settings": "prod-cp-{{ .Index }}",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000002-node-settings": "prod-cp-{{ .Index }}",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000003-node-settings": "{{ .MachineSet }}-{{ .MachineID | short }}",
+	}, patterns)
+
+	assert.Equal(t, map[string]string{
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000001-node-settings": "1",
+		"395-cm-1a2b3c4d-0000-4000-8000-000000000002-node-settings": "2",
+	}, indexes)
+
+	// removing the machine from the machine set doesn't rename the other machines
+	removed := strings.NewReplacer(
+		"  - 1a2b3c4d-0000-4000-8000-000000000001\n", "",
+		"kind: Machine\nname: 1a2b3c4d-0000-4000-8000-000000000001\nindex: 1\n---\n", "",
+	).Replace(string(clusterNodeSettings))
+
+	patches, _, _ = translateNodeSettings(t, []byte(removed))
+
+	assert.Equal(t, "machine:\n    network:\n        hostname: prod-cp-2\n    nodeLabels:\n        topology.kubernetes.io/zone: zone-b\n",
+		patches["395-cm-1a2b3c4d-0000-4000-8000-000000000002-node-settings"])
+}
+
+// translateNodeSettings returns the data, the hostname patterns and the hostname indexes of the system patches.
+func translateNodeSettings(t *testing.T, raw []byte) (patches, patterns, indexes map[string]string) {
+	tmpl, err := template.Load(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	patches = map[string]string{}
+	patterns = map[string]string{}
+	indexes = map[string]string{}
+
+	for _, r := range resourceList {
+		configPatch, ok := r.(*omni.ConfigPatch)
+		if !ok {
+			continue
+		}
+
+		if _, ok = configPatch.Metadata().Labels().Get(omni.LabelSystemPatch); !ok {
+			continue
+		}
+
+		patches[configPatch.Metadata().ID()] = configPatch.TypedSpec().Value.GetData()
+
+		if pattern, ok := configPatch.Metadata().Annotations().Get(omni.TemplateHostnamePattern); ok {
+			patterns[configPatch.Metadata().ID()] = pattern
+		}
+
+		if index, ok := configPatch.Metadata().Annotations().Get(omni.TemplateHostnameIndex); ok {
+			indexes[configPatch.Metadata().ID()] = index
+		}
+	}
+
+	return patches, patterns, indexes
+}
+
+func TestNodeSettingsValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		settings string
+		expected string
+	}{
+		{
+			name:     "unknown field",
+			settings: "hostname: '{{ .Name }}'",
+			expected: `can't evaluate field Name`,
+		},
+		{
+			name:     "invalid hostname",
+			settings: "hostname: Prod_CP",
+			expected: `hostname "Prod_CP" rendered from pattern "Prod_CP" is invalid`,
+		},
+		{
+			name:     "duplicate hostname",
+			settings: "hostname: prod-cp",
+			expected: `hostname "prod-cp" is used by machines "1a2b3c4d-0000-4000-8000-000000000001" and "1a2b3c4d-0000-4000-8000-000000000002"`,
+		},
+		{
+			name:     "missing index",
+			settings: "hostname: prod-cp-{{ .Index }}",
+			expected: `hostname pattern "prod-cp-{{ .Index }}" uses the index, but the machine has no index`,
+		},
+		{
+			name:     "invalid label",
+			settings: "nodeLabels:\n  bad key: value",
+			expected: `node label key "bad key" is invalid`,
+		},
+		{
+			name:     "invalid taint effect",
+			settings: "nodeTaints:\n  dedicated: storage:NoRun",
+			expected: `node taint "dedicated" value "storage:NoRun" is invalid`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.Load(bytes.NewReader([]byte(`kind: Cluster
+name: invalid
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 1a2b3c4d-0000-4000-8000-000000000001
+  - 1a2b3c4d-0000-4000-8000-000000000002
+` + tt.settings + "\n")))
+			require.NoError(t, err)
+
+			assert.ErrorContains(t, tmpl.Validate(), tt.expected)
+		})
+	}
+}
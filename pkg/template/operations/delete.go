@@ -78,5 +78,5 @@ func deleteTemplate(ctx context.Context, tmpl *template.Template, out io.Writer,
 			append([][]resource.Resource{allPatches}, syncResult.Destroy...)...)
 	}
 
-	return syncDelete(ctx, syncResult, out, st, syncOptions)
+	return syncDelete(ctx, syncResult, nil, out, st, syncOptions)
 }
@@ -9,14 +9,61 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/state"
 
+	"github.com/siderolabs/omni-client/pkg/cosi/diff"
 	"github.com/siderolabs/omni-client/pkg/template"
 	"github.com/siderolabs/omni-client/pkg/template/operations/internal/utils"
 )
 
+// DiffFormat is the format of the resource diff output.
+type DiffFormat string
+
+// Diff formats.
+const (
+	// DiffFormatText is a line-based diff of the marshaled resources, the inline manifests are diffed per Kubernetes object.
+	DiffFormatText DiffFormat = "text"
+
+	// DiffFormatStructural is a diff of the parsed resources reported by path, it ignores formatting and key order.
+	//
+	// The inline manifests are reported by the Kubernetes object key, e.g. `contents["ConfigMap/kube-system/settings"].data.level`.
+	DiffFormatStructural DiffFormat = "structural"
+)
+
+// String implements pflag.Value.
+func (f *DiffFormat) String() string {
+	return string(*f)
+}
+
+// Set implements pflag.Value, so that the format is validated when the flags are parsed.
+func (f *DiffFormat) Set(value string) error {
+	switch format := DiffFormat(value); format {
+	case DiffFormatText, DiffFormatStructural:
+		*f = format
+
+		return nil
+	default:
+		return fmt.Errorf("unknown diff format %q, supported formats: %s, %s", value, DiffFormatText, DiffFormatStructural)
+	}
+}
+
+// Type implements pflag.Value.
+func (f *DiffFormat) Type() string {
+	return "format"
+}
+
+// DiffOptions contains options for DiffTemplate.
+type DiffOptions struct {
+	// Format is the format of the diff output, defaults to DiffFormatText.
+	Format DiffFormat
+}
+
 // DiffTemplate outputs the diff between template resources and existing resources.
-func DiffTemplate(ctx context.Context, templateReader io.Reader, output io.Writer, st state.State) error {
+//
+// The diff doesn't change the Omni state, the schematic customizations are resolved to the existing schematics.
+// Config patches are compared structurally, so the patches which differ only in the formatting are not reported.
+func DiffTemplate(ctx context.Context, templateReader io.Reader, output io.Writer, st state.State, options DiffOptions) error {
 	tmpl, err := template.Load(templateReader)
 	if err != nil {
 		return fmt.Errorf("error loading template: %w", err)
@@ -26,26 +73,45 @@ func DiffTemplate(ctx context.Context, templateReader io.Reader, output io.Write
 		return err
 	}
 
+	return diffTemplate(ctx, tmpl, output, st, options)
+}
+
+func diffTemplate(ctx context.Context, tmpl *template.Template, output io.Writer, st state.State, options DiffOptions) error {
+	if err := resolveTemplate(ctx, tmpl, st, template.SchematicLookup{State: st}); err != nil {
+		return err
+	}
+
 	syncResult, err := tmpl.Sync(ctx, st)
 	if err != nil {
 		return fmt.Errorf("error syncing template: %w", err)
 	}
 
 	for _, p := range syncResult.Update {
-		if err = utils.RenderDiff(output, p.Old, p.New); err != nil {
+		// config patches generated with a different formatting are updated by the sync, but they are not a change
+		var changes []diff.Change
+
+		if changes, err = diff.Compute(p.Old, p.New); err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			continue
+		}
+
+		if err = renderDiff(output, p.Old, p.New, options.Format); err != nil {
 			return err
 		}
 	}
 
 	for _, r := range syncResult.Create {
-		if err = utils.RenderDiff(output, nil, r); err != nil {
+		if err = renderDiff(output, nil, r, options.Format); err != nil {
 			return err
 		}
 	}
 
 	for _, phase := range syncResult.Destroy {
 		for _, r := range phase {
-			if err = utils.RenderDiff(output, r, nil); err != nil {
+			if err = renderDiff(output, r, nil, options.Format); err != nil {
 				return err
 			}
 		}
@@ -53,3 +119,21 @@ func DiffTemplate(ctx context.Context, templateReader io.Reader, output io.Write
 
 	return nil
 }
+
+// renderDiff outputs the diff between two resources in the requested format.
+//
+// One of the resources might be nil.
+func renderDiff(w io.Writer, oldR, newR resource.Resource, format DiffFormat) error {
+	switch format {
+	case DiffFormatText, "":
+		if ok, err := renderManifestsDiff(w, oldR, newR); ok || err != nil {
+			return err
+		}
+
+		return utils.RenderDiff(w, oldR, newR)
+	case DiffFormatStructural:
+		return diff.Render(w, oldR, newR)
+	default:
+		return fmt.Errorf("unknown diff format %q", format)
+	}
+}
@@ -0,0 +1,144 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/siderolabs/gen/maps"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/diff"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/operations/internal/utils"
+)
+
+// renderManifestsDiff outputs the line-based diff of the config patches with the inline manifests per Kubernetes object.
+//
+// The rest of the patch is diffed as usual, with the manifest contents stripped.
+// It returns false if neither of the resources has inline manifests.
+func renderManifestsDiff(w io.Writer, oldR, newR resource.Resource) (bool, error) {
+	oldStripped, oldObjects, oldOk, err := splitInlineManifests(oldR)
+	if err != nil {
+		return false, err
+	}
+
+	newStripped, newObjects, newOk, err := splitInlineManifests(newR)
+	if err != nil {
+		return false, err
+	}
+
+	if !oldOk && !newOk {
+		return false, nil
+	}
+
+	if err = utils.RenderDiff(w, oldStripped, newStripped); err != nil {
+		return true, err
+	}
+
+	keys := maps.Keys(oldObjects)
+
+	for key := range newObjects {
+		if _, ok := oldObjects[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		oldPath, newPath := "/dev/null", "/dev/null"
+
+		if _, ok := oldObjects[key]; ok {
+			oldPath = resource.String(oldR) + "/" + key
+		}
+
+		if _, ok := newObjects[key]; ok {
+			newPath = resource.String(newR) + "/" + key
+		}
+
+		utils.RenderTextDiff(w, oldPath, newPath, oldObjects[key], newObjects[key])
+	}
+
+	return true, nil
+}
+
+// splitInlineManifests splits the config patch into the patch with the inline manifest contents stripped,
+// and the marshaled objects of the manifests keyed by the manifest name and the object key.
+func splitInlineManifests(r resource.Resource) (resource.Resource, map[string]string, bool, error) {
+	configPatch, ok := r.(*omni.ConfigPatch)
+	if !ok {
+		return r, nil, false, nil
+	}
+
+	var patch map[string]any
+
+	if err := yaml.Unmarshal([]byte(configPatch.TypedSpec().Value.GetData()), &patch); err != nil {
+		// not a single document patch, so it's not generated from the manifests
+		return r, nil, false, nil //nolint:nilerr
+	}
+
+	cluster, _ := patch["cluster"].(map[string]any)
+	inlineManifests, _ := cluster["inlineManifests"].([]any)
+
+	if len(inlineManifests) == 0 {
+		return r, nil, false, nil
+	}
+
+	objects := map[string]string{}
+
+	for _, inlineManifest := range inlineManifests {
+		inlineManifestMap, _ := inlineManifest.(map[string]any)
+		name, _ := inlineManifestMap["name"].(string)
+
+		contents, ok := inlineManifestMap["contents"].(string)
+		if !ok {
+			continue
+		}
+
+		manifestObjects, err := diff.ManifestObjects(contents)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("error parsing inline manifest %q of %s: %w", name, resource.String(r), err)
+		}
+
+		for key, object := range manifestObjects {
+			raw, err := marshalObject(object)
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+			objects[name+"/"+key] = raw
+		}
+
+		delete(inlineManifestMap, "contents")
+	}
+
+	raw, err := yaml.Marshal(patch)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	stripped := configPatch.DeepCopy().(*omni.ConfigPatch) //nolint:forcetypeassert,errcheck
+	stripped.TypedSpec().Value.Data = string(raw)
+
+	return stripped, objects, true, nil
+}
+
+func marshalObject(object any) (string, error) {
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(object); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/fatih/color"
+
+	"github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations/internal/utils"
+)
+
+// DriftOptions contains options for DriftTemplate.
+type DriftOptions struct {
+	// Verbose indicates that diff for each drifted resource should be printed.
+	Verbose bool
+}
+
+// DriftTemplate outputs the three-way comparison between the template, the last applied state and the live resources.
+func DriftTemplate(ctx context.Context, templateReader io.Reader, out io.Writer, st state.State, options DriftOptions) error {
+	tmpl, err := template.Load(templateReader)
+	if err != nil {
+		return fmt.Errorf("error loading template: %w", err)
+	}
+
+	if err = tmpl.Validate(); err != nil {
+		return err
+	}
+
+	if err = resolveTemplate(ctx, tmpl, st, template.SchematicLookup{State: st}); err != nil {
+		return err
+	}
+
+	syncResult, err := tmpl.Sync(ctx, st)
+	if err != nil {
+		return fmt.Errorf("error syncing template: %w", err)
+	}
+
+	for _, p := range syncResult.Update {
+		if err = renderDrift(out, p.Old, p.New, options); err != nil {
+			return err
+		}
+	}
+
+	for _, phase := range syncResult.Destroy {
+		for _, r := range phase {
+			if err = renderDrift(out, r, nil, options); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range syncResult.Create {
+		color.New(color.FgGreen).Fprintf(out, "* %s: missing, will be created\n", utils.Describe(r)) //nolint:errcheck
+	}
+
+	return nil
+}
+
+func renderDrift(out io.Writer, live, expected resource.Resource, options DriftOptions) error {
+	drift, err := template.ResourceDrift(live, expected)
+	if err != nil {
+		return err
+	}
+
+	var (
+		c      *color.Color
+		status string
+	)
+
+	switch {
+	case drift.Untracked:
+		c, status = color.New(color.FgYellow), "no last applied state recorded, changes can't be attributed"
+	case drift.Conflict():
+		c, status = color.New(color.FgRed), "modified both in the template and outside of it"
+	case drift.LiveModified:
+		c, status = color.New(color.FgRed), "modified outside of the template, sync will overwrite the changes"
+	case expected == nil:
+		c, status = color.New(color.FgYellow), "removed from the template"
+	default:
+		c, status = color.New(color.FgYellow), "changed in the template"
+	}
+
+	c.Fprintf(out, "* %s: %s\n", utils.Describe(live), status) //nolint:errcheck
+
+	if options.Verbose {
+		return utils.RenderDiff(out, live, expected)
+	}
+
+	return nil
+}
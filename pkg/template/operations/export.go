@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,25 +32,57 @@ type clusterResources struct {
 	machineSetConfigPatches     map[string][]*omni.ConfigPatch
 	clusterMachineConfigPatches map[string][]*omni.ConfigPatch
 	clusterMachineInstallDisks  map[string]string
+	machineSetNodeSettings      map[string]models.NodeSettings
+	clusterMachineNodeSettings  map[string]models.NodeSettings
+	clusterMachineNetworks      map[string]exportedNetwork
+	hostnamePatterns            map[string]string
+	hostnameIndexes             map[string]int
+	machineSetSchematics        map[string]models.Schematic
+	clusterMachineSchematics    map[string]models.Schematic
 
 	cluster *omni.Cluster
 
+	clusterSchematic models.Schematic
+
 	machineSets          []*omni.MachineSet
 	clusterConfigPatches []*omni.ConfigPatch
 }
 
 // ExportTemplate exports the cluster configuration as a template.
 func ExportTemplate(ctx context.Context, st state.State, clusterID string, writer io.Writer) (models.List, error) {
+	return ExportTemplateWithOptions(ctx, st, clusterID, writer, ExportOptions{})
+}
+
+// ExportTemplateWithOptions exports the cluster configuration as a template with the options.
+func ExportTemplateWithOptions(ctx context.Context, st state.State, clusterID string, writer io.Writer, options ExportOptions) (models.List, error) {
 	resources, err := collectClusterResources(ctx, st, clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	clusterModel, err := transformClusterToModel(resources.cluster, resources.clusterConfigPatches)
+	modelList, err := exportModels(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = exportSecretPlaceholders(modelList, options.Secrets); err != nil {
+		return nil, err
+	}
+
+	return modelList, writeYAML(writer, modelList)
+}
+
+func exportModels(resources clusterResources) (models.List, error) {
+	clusterNetwork, machineSetNetworks, machineNetworks := collapseNetworks(resources)
+
+	clusterModel, err := transformClusterToModel(resources.cluster, resources.clusterConfigPatches, resources.clusterSchematic, clusterNetwork)
 	if err != nil {
 		return nil, err
 	}
 
+	machineSetInstallDisks := collapseInstallDisks(resources)
+	collapseHostnames(resources)
+
 	var controlPlaneMachineSetModel models.ControlPlane
 
 	workerMachineSetModels := make([]models.Workers, 0, len(resources.machineSets))
@@ -57,7 +90,11 @@ func ExportTemplate(ctx context.Context, st state.State, clusterID string, write
 	for _, machineSet := range resources.machineSets {
 		machineSetModel, transformErr := transformMachineSetToModel(machineSet,
 			resources.machineSetNodes[machineSet.Metadata().ID()],
-			resources.machineSetConfigPatches[machineSet.Metadata().ID()])
+			resources.machineSetConfigPatches[machineSet.Metadata().ID()],
+			machineSetInstallDisks[machineSet.Metadata().ID()],
+			resources.machineSetSchematics[machineSet.Metadata().ID()],
+			resources.machineSetNodeSettings[machineSet.Metadata().ID()],
+			machineSetNetworks[machineSet.Metadata().ID()])
 		if transformErr != nil {
 			return nil, transformErr
 		}
@@ -78,6 +115,10 @@ func ExportTemplate(ctx context.Context, st state.State, clusterID string, write
 			machineModel, transformErr := transformMachineSetNodeToModel(machineSetNode,
 				resources.clusterMachineConfigPatches[machineSetNode.Metadata().ID()],
 				resources.clusterMachineInstallDisks[machineSetNode.Metadata().ID()],
+				resources.clusterMachineSchematics[machineSetNode.Metadata().ID()],
+				resources.clusterMachineNodeSettings[machineSetNode.Metadata().ID()],
+				machineNetworks[machineSetNode.Metadata().ID()],
+				resources.hostnameIndex(machineSetNode.Metadata().ID()),
 			)
 			if transformErr != nil {
 				return nil, transformErr
@@ -92,7 +133,103 @@ func ExportTemplate(ctx context.Context, st state.State, clusterID string, write
 		return nil, fmt.Errorf("error validating models: %w", err)
 	}
 
-	return modelList, writeYAML(writer, modelList)
+	return modelList, nil
+}
+
+// collapseInstallDisks moves the install disks shared by all machines of a machine set to the machine set.
+//
+// The install disks of the machine set machines are removed from the resources.
+func collapseInstallDisks(resources clusterResources) map[string]string {
+	machineSetInstallDisks := map[string]string{}
+
+	for machineSetID, nodes := range resources.machineSetNodes {
+		if len(nodes) < 2 {
+			continue
+		}
+
+		installDisk := resources.clusterMachineInstallDisks[nodes[0].Metadata().ID()]
+		if installDisk == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(nodes, func(node *omni.MachineSetNode) bool {
+			return resources.clusterMachineInstallDisks[node.Metadata().ID()] != installDisk
+		}) {
+			continue
+		}
+
+		machineSetInstallDisks[machineSetID] = installDisk
+
+		for _, node := range nodes {
+			delete(resources.clusterMachineInstallDisks, node.Metadata().ID())
+		}
+	}
+
+	return machineSetInstallDisks
+}
+
+// collapseHostnames restores the hostname patterns of the machines and moves the patterns shared by all machines of a machine set to the machine set.
+//
+// The pattern is restored only if it still renders into the hostname of the machine with the recorded machine index.
+func collapseHostnames(resources clusterResources) {
+	for machineSetID, nodes := range resources.machineSetNodes {
+		for _, node := range nodes {
+			settings := resources.clusterMachineNodeSettings[node.Metadata().ID()]
+
+			pattern := resources.hostnamePatterns[node.Metadata().ID()]
+			if settings.Hostname == "" || pattern == "" {
+				continue
+			}
+
+			hostname, err := models.RenderHostname(pattern, models.HostnameData{
+				ClusterName: resources.cluster.Metadata().ID(),
+				MachineSet:  machineSetID,
+				MachineID:   node.Metadata().ID(),
+				Index:       resources.hostnameIndexes[node.Metadata().ID()],
+			})
+			if err != nil || hostname != settings.Hostname {
+				continue
+			}
+
+			settings.Hostname = pattern
+			resources.clusterMachineNodeSettings[node.Metadata().ID()] = settings
+		}
+
+		if len(nodes) < 2 {
+			continue
+		}
+
+		pattern := resources.hostnamePatterns[nodes[0].Metadata().ID()]
+		if pattern == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(nodes, func(node *omni.MachineSetNode) bool {
+			return resources.clusterMachineNodeSettings[node.Metadata().ID()].Hostname != pattern
+		}) {
+			continue
+		}
+
+		machineSetSettings := resources.machineSetNodeSettings[machineSetID]
+		machineSetSettings.Hostname = pattern
+		resources.machineSetNodeSettings[machineSetID] = machineSetSettings
+
+		for _, node := range nodes {
+			settings := resources.clusterMachineNodeSettings[node.Metadata().ID()]
+			settings.Hostname = ""
+			resources.clusterMachineNodeSettings[node.Metadata().ID()] = settings
+		}
+	}
+}
+
+// hostnameIndex returns the machine index the hostname of the machine was generated with, if any.
+func (resources clusterResources) hostnameIndex(machineID string) *int {
+	index, ok := resources.hostnameIndexes[machineID]
+	if !ok {
+		return nil
+	}
+
+	return &index
 }
 
 func buildModelList(clusterModel models.Cluster, controlPlaneMachineSetModel models.ControlPlane,
@@ -177,7 +314,9 @@ func transformConfigPatchesToModels(configPatches []*omni.ConfigPatch) (models.P
 	return patchModels, nil
 }
 
-func transformMachineSetNodeToModel(machineSetNode *omni.MachineSetNode, patches []*omni.ConfigPatch, installDisk string) (models.Machine, error) {
+func transformMachineSetNodeToModel(machineSetNode *omni.MachineSetNode, patches []*omni.ConfigPatch, installDisk string, schematic models.Schematic,
+	nodeSettings models.NodeSettings, network models.MachineNetwork, index *int,
+) (models.Machine, error) {
 	_, locked := machineSetNode.Metadata().Annotations().Get(omni.MachineLocked)
 
 	patchModels, err := transformConfigPatchesToModels(patches)
@@ -195,11 +334,17 @@ func transformMachineSetNodeToModel(machineSetNode *omni.MachineSetNode, patches
 		Install: models.MachineInstall{
 			Disk: installDisk,
 		},
-		Patches: patchModels,
+		Schematic:    schematic,
+		NodeSettings: nodeSettings,
+		Index:        index,
+		Network:      network,
+		Patches:      patchModels,
 	}, nil
 }
 
-func transformMachineSetToModel(machineSet *omni.MachineSet, nodes []*omni.MachineSetNode, patches []*omni.ConfigPatch) (models.MachineSet, error) {
+func transformMachineSetToModel(machineSet *omni.MachineSet, nodes []*omni.MachineSetNode, patches []*omni.ConfigPatch, installDisk string,
+	schematic models.Schematic, nodeSettings models.NodeSettings, network models.Network,
+) (models.MachineSet, error) {
 	cluster, _ := machineSet.Metadata().Labels().Get(omni.LabelCluster)
 	_, isControlPlane := machineSet.Metadata().Labels().Get(omni.LabelControlPlaneRole)
 	_, isWorker := machineSet.Metadata().Labels().Get(omni.LabelWorkerRole)
@@ -299,10 +444,16 @@ func transformMachineSetToModel(machineSet *omni.MachineSet, nodes []*omni.Machi
 		Patches:        patchModels,
 		UpdateStrategy: updateStrategyConfig,
 		DeleteStrategy: deleteStrategyConfig,
+		Install: models.MachineInstall{
+			Disk: installDisk,
+		},
+		Schematic:    schematic,
+		NodeSettings: nodeSettings,
+		Network:      network,
 	}, nil
 }
 
-func transformClusterToModel(cluster *omni.Cluster, patches []*omni.ConfigPatch) (models.Cluster, error) {
+func transformClusterToModel(cluster *omni.Cluster, patches []*omni.ConfigPatch, schematic models.Schematic, network models.Network) (models.Cluster, error) {
 	spec := cluster.TypedSpec().Value
 	backupIntervalDuration := time.Duration(0)
 
@@ -334,7 +485,9 @@ func transformClusterToModel(cluster *omni.Cluster, patches []*omni.ConfigPatch)
 				Interval: backupIntervalDuration,
 			},
 		},
-		Patches: patchModels,
+		Schematic: schematic,
+		Network:   network,
+		Patches:   patchModels,
 	}, nil
 }
 
@@ -415,6 +568,11 @@ func collectClusterResources(ctx context.Context, st state.State, clusterID stri
 	machineSetConfigPatches := make(map[string][]*omni.ConfigPatch, configPatchList.Len())
 	clusterMachineConfigPatches := make(map[string][]*omni.ConfigPatch, configPatchList.Len())
 	clusterMachineInstallDisks := make(map[string]string, configPatchList.Len())
+	machineSetNodeSettings := make(map[string]models.NodeSettings, configPatchList.Len())
+	clusterMachineNodeSettings := make(map[string]models.NodeSettings, configPatchList.Len())
+	hostnamePatterns := make(map[string]string, configPatchList.Len())
+	hostnameIndexes := make(map[string]int, configPatchList.Len())
+	clusterMachineNetworks := make(map[string]exportedNetwork, configPatchList.Len())
 
 	for iter := configPatchList.Iterator(); iter.Next(); {
 		configPatch := iter.Value()
@@ -434,12 +592,42 @@ func collectClusterResources(ctx context.Context, st state.State, clusterID stri
 				continue
 			}
 
+			if network, ok := getNetworkFromConfigPatch(configPatch); ok {
+				clusterMachineNetworks[clusterMachineLabel] = network
+
+				continue
+			}
+
+			nodeSettingsID := fmt.Sprintf("%03d-cm-%s-node-settings", constants.PatchWeightClusterMachineNodeSettings, clusterMachineLabel)
+			if nodeSettings, ok := getNodeSettingsFromConfigPatch(configPatch, nodeSettingsID, true); ok {
+				clusterMachineNodeSettings[clusterMachineLabel] = nodeSettings
+
+				if pattern, ok := configPatch.Metadata().Annotations().Get(omni.TemplateHostnamePattern); ok {
+					hostnamePatterns[clusterMachineLabel] = pattern
+				}
+
+				if index, ok := configPatch.Metadata().Annotations().Get(omni.TemplateHostnameIndex); ok {
+					if hostnameIndexes[clusterMachineLabel], err = strconv.Atoi(index); err != nil {
+						return clusterResources{}, fmt.Errorf("invalid hostname index of machine %q: %w", clusterMachineLabel, err)
+					}
+				}
+
+				continue
+			}
+
 			clusterMachineConfigPatches[clusterMachineLabel] = append(clusterMachineConfigPatches[clusterMachineLabel], configPatch)
 
 			continue
 		}
 
 		if machineSetLabel, ok := configPatch.Metadata().Labels().Get(omni.LabelMachineSet); ok {
+			nodeSettingsID := fmt.Sprintf("%03d-%s-node-settings", constants.PatchWeightMachineSetNodeSettings, machineSetLabel)
+			if nodeSettings, ok := getNodeSettingsFromConfigPatch(configPatch, nodeSettingsID, false); ok {
+				machineSetNodeSettings[machineSetLabel] = nodeSettings
+
+				continue
+			}
+
 			machineSetConfigPatches[machineSetLabel] = append(machineSetConfigPatches[machineSetLabel], configPatch)
 
 			continue
@@ -450,17 +638,92 @@ func collectClusterResources(ctx context.Context, st state.State, clusterID stri
 		}
 	}
 
+	clusterSchematic, machineSetSchematics, clusterMachineSchematics, err := collectSchematics(ctx, st, clusterID)
+	if err != nil {
+		return clusterResources{}, err
+	}
+
 	return clusterResources{
 		cluster:                     cluster,
+		clusterSchematic:            clusterSchematic,
+		machineSetSchematics:        machineSetSchematics,
+		clusterMachineSchematics:    clusterMachineSchematics,
 		machineSets:                 listToSlice(machineSetList),
 		machineSetNodes:             machineSetNodes,
 		clusterConfigPatches:        clusterConfigPatches,
 		machineSetConfigPatches:     machineSetConfigPatches,
 		clusterMachineConfigPatches: clusterMachineConfigPatches,
 		clusterMachineInstallDisks:  clusterMachineInstallDisks,
+		machineSetNodeSettings:      machineSetNodeSettings,
+		clusterMachineNodeSettings:  clusterMachineNodeSettings,
+		hostnamePatterns:            hostnamePatterns,
+		hostnameIndexes:             hostnameIndexes,
+		clusterMachineNetworks:      clusterMachineNetworks,
 	}, nil
 }
 
+// collectSchematics collects the schematic customizations of the cluster, machine sets and cluster machines.
+//
+// Omni keeps only the system extensions of the schematics, so the kernel arguments and META values are not exported.
+func collectSchematics(ctx context.Context, st state.State, clusterID string) (
+	clusterSchematic models.Schematic, machineSetSchematics, clusterMachineSchematics map[string]models.Schematic, err error,
+) {
+	schematicConfigurationList, err := safe.StateListAll[*omni.SchematicConfiguration](ctx, st, state.WithLabelQuery(resource.LabelEqual(omni.LabelCluster, clusterID)))
+	if err != nil {
+		return models.Schematic{}, nil, nil, fmt.Errorf("error listing schematic configurations of cluster %q: %w", clusterID, err)
+	}
+
+	machineSetSchematics = make(map[string]models.Schematic, schematicConfigurationList.Len())
+	clusterMachineSchematics = make(map[string]models.Schematic, schematicConfigurationList.Len())
+
+	for iter := schematicConfigurationList.Iterator(); iter.Next(); {
+		schematicConfiguration := iter.Value()
+
+		// skip the schematic configurations with an owner, as they are not user-defined
+		if schematicConfiguration.Metadata().Owner() != "" {
+			continue
+		}
+
+		schematicID := schematicConfiguration.TypedSpec().Value.SchematicId
+
+		schematic, err := safe.StateGetByID[*omni.Schematic](ctx, st, schematicID)
+		if err != nil {
+			return models.Schematic{}, nil, nil, fmt.Errorf("error getting schematic %q of %q: %w", schematicID, schematicConfiguration.Metadata().ID(), err)
+		}
+
+		schematicModel := models.Schematic{
+			SystemExtensions: slices.Clone(schematic.TypedSpec().Value.Extensions),
+		}
+
+		switch schematicConfiguration.TypedSpec().Value.Target {
+		case specs.SchematicConfigurationSpec_Cluster:
+			clusterSchematic = schematicModel
+		case specs.SchematicConfigurationSpec_MachineSet:
+			machineSetSchematics[schematicConfiguration.Metadata().ID()] = schematicModel
+		case specs.SchematicConfigurationSpec_ClusterMachine:
+			clusterMachineSchematics[schematicConfiguration.Metadata().ID()] = schematicModel
+		case specs.SchematicConfigurationSpec_Unknown:
+		}
+	}
+
+	return clusterSchematic, machineSetSchematics, clusterMachineSchematics, nil
+}
+
+// allConfigPatches returns all user config patches of the cluster, except for the install disk patches.
+func (resources clusterResources) allConfigPatches() []*omni.ConfigPatch {
+	result := slices.Clone(resources.clusterConfigPatches)
+
+	for _, patches := range resources.machineSetConfigPatches {
+		result = append(result, patches...)
+	}
+
+	for _, patches := range resources.clusterMachineConfigPatches {
+		result = append(result, patches...)
+	}
+
+	return result
+}
+
 func getInstallDiskFromConfigPatch(configPatch *omni.ConfigPatch) string {
 	clusterMachine, ok := configPatch.Metadata().Labels().Get(omni.LabelClusterMachine)
 	if !ok {
@@ -500,6 +763,76 @@ func getInstallDiskFromConfigPatch(configPatch *omni.ConfigPatch) string {
 	return disk
 }
 
+// getNodeSettingsFromConfigPatch converts the node settings patch generated by the template back into the node settings.
+//
+// The patch is converted only if it contains nothing but the node settings, otherwise it's kept as a regular patch.
+//
+//nolint:gocyclo,cyclop
+func getNodeSettingsFromConfigPatch(configPatch *omni.ConfigPatch, expectedID string, allowHostname bool) (models.NodeSettings, bool) {
+	if _, ok := configPatch.Metadata().Labels().Get(omni.LabelSystemPatch); !ok || configPatch.Metadata().ID() != expectedID {
+		return models.NodeSettings{}, false
+	}
+
+	var data map[string]any
+
+	if err := yaml.Unmarshal([]byte(configPatch.TypedSpec().Value.GetData()), &data); err != nil {
+		return models.NodeSettings{}, false // ignore the error, as it will be caught by the validation later
+	}
+
+	machine, ok := data["machine"].(map[string]any)
+	if !ok || len(data) != 1 {
+		return models.NodeSettings{}, false
+	}
+
+	var settings models.NodeSettings
+
+	for key, value := range machine {
+		switch key {
+		case "network":
+			network, ok := value.(map[string]any)
+			if !ok || len(network) != 1 || !allowHostname {
+				return models.NodeSettings{}, false
+			}
+
+			if settings.Hostname, ok = network["hostname"].(string); !ok {
+				return models.NodeSettings{}, false
+			}
+		case "nodeLabels":
+			if settings.NodeLabels, ok = toStringMap(value); !ok {
+				return models.NodeSettings{}, false
+			}
+		case "nodeTaints":
+			if settings.NodeTaints, ok = toStringMap(value); !ok {
+				return models.NodeSettings{}, false
+			}
+		default:
+			return models.NodeSettings{}, false
+		}
+	}
+
+	return settings, true
+}
+
+func toStringMap(value any) (map[string]string, bool) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	result := make(map[string]string, len(m))
+
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+
+		result[k] = s
+	}
+
+	return result, true
+}
+
 func listToSlice[T resource.Resource](list safe.List[T]) []T {
 	result := make([]T, 0, list.Len())
 
@@ -0,0 +1,325 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/labels"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// BlueprintOptions contains options for ExportBlueprint.
+type BlueprintOptions struct {
+	// MachineClasses converts static machine lists of the machine sets into machine class selectors.
+	//
+	// Per-machine customizations can't be applied to machines picked from a machine class, so they are dropped in this mode.
+	MachineClasses bool
+
+	// Secrets configures the export of the secret values.
+	Secrets SecretOptions
+}
+
+// blueprintValues is the set of variables of the exported blueprint.
+type blueprintValues struct {
+	ClusterName       string            `yaml:"clusterName"`
+	KubernetesVersion string            `yaml:"kubernetesVersion"`
+	TalosVersion      string            `yaml:"talosVersion"`
+	Machines          map[string]string `yaml:"machines,omitempty"`
+	MachinePatches    map[string]bool   `yaml:"machinePatches,omitempty"`
+	MachineClasses    map[string]string `yaml:"machineClasses,omitempty"`
+}
+
+var patchWeightPrefix = regexp.MustCompile(`^\d{3}-`)
+
+// blueprintBuilder replaces the cluster specific values in the models with placeholders.
+//
+// Placeholders are plain YAML scalars, so that the models can be marshaled as usual, and they are replaced
+// with Go template actions in the marshaled output.
+type blueprintBuilder struct {
+	placeholders map[string]string
+}
+
+func (b *blueprintBuilder) variable(action string) string {
+	placeholder := fmt.Sprintf("__blueprint_var_%d__", len(b.placeholders))
+
+	b.placeholders[placeholder] = "{{ " + action + " }}"
+
+	return placeholder
+}
+
+func (b *blueprintBuilder) render(raw []byte) []byte {
+	for placeholder, action := range b.placeholders {
+		raw = bytes.ReplaceAll(raw, []byte(placeholder), []byte(action))
+	}
+
+	return raw
+}
+
+// ExportBlueprint exports the cluster configuration as a reusable blueprint.
+//
+// The cluster name, Talos and Kubernetes versions and machine IDs are replaced with variables, which are written
+// to the values output with the values of the exported cluster, so that they can be used as a starting point for new clusters.
+// Per-machine patches are kept as optional blocks, which can be enabled or disabled via the values, and the machine classes
+// default to the existing classes which select the machines of the exported cluster.
+//
+// The blueprint can be rendered into a template with template.RenderBlueprint.
+//
+//nolint:gocognit,gocyclo,cyclop
+func ExportBlueprint(ctx context.Context, st state.State, clusterID string, blueprintWriter, valuesWriter io.Writer, options BlueprintOptions) error {
+	resources, err := collectClusterResources(ctx, st, clusterID)
+	if err != nil {
+		return err
+	}
+
+	modelList, err := exportModels(resources)
+	if err != nil {
+		return err
+	}
+
+	if err = exportSecretPlaceholders(modelList, options.Secrets); err != nil {
+		return err
+	}
+
+	// the static addresses would collide with the machines of the exported cluster
+	clearNetworks(modelList)
+
+	builder := &blueprintBuilder{placeholders: map[string]string{}}
+	clusterNameVar := builder.variable(".clusterName")
+
+	var values blueprintValues
+
+	machineKeys := map[models.MachineID]string{}
+
+	for _, model := range modelList {
+		var machineSet *models.MachineSet
+
+		switch m := model.(type) {
+		case *models.Cluster:
+			values.ClusterName = m.Name
+			values.KubernetesVersion = m.Kubernetes.Version
+			values.TalosVersion = m.Talos.Version
+
+			m.Name = clusterNameVar
+			m.Kubernetes.Version = builder.variable(".kubernetesVersion")
+			m.Talos.Version = builder.variable(".talosVersion")
+
+			continue
+		case *models.ControlPlane:
+			machineSet = &m.MachineSet
+		case *models.Workers:
+			machineSet = &m.MachineSet
+		default:
+			continue
+		}
+
+		// restoring from a backup is specific to the exported cluster
+		machineSet.BootstrapSpec = nil
+
+		setKey := machineSetKey(machineSet)
+
+		if options.MachineClasses && len(machineSet.Machines) > 0 {
+			if values.MachineClasses == nil {
+				values.MachineClasses = map[string]string{}
+			}
+
+			// an existing machine class is suggested, otherwise the value is left empty to be set by the user
+			if values.MachineClasses[setKey], err = matchingMachineClass(ctx, st, machineSet.Machines); err != nil {
+				return err
+			}
+
+			machineSet.MachineClass = &models.MachineClassConfig{
+				Name: builder.variable(fmt.Sprintf("index .machineClasses %q", setKey)),
+				Size: models.Size{Value: uint32(len(machineSet.Machines))},
+			}
+			machineSet.Machines = nil
+
+			// the install disks of the machines are not known in advance, the same as with the dropped machine documents
+			machineSet.Install = models.MachineInstall{}
+			machineSet.NodeSettings.Hostname = ""
+
+			continue
+		}
+
+		for i, machineID := range machineSet.Machines {
+			if values.Machines == nil {
+				values.Machines = map[string]string{}
+			}
+
+			key := fmt.Sprintf("%s-%d", setKey, i)
+
+			values.Machines[key] = string(machineID)
+			machineKeys[machineID] = key
+		}
+	}
+
+	var buf bytes.Buffer
+
+	for _, model := range modelList {
+		for _, patches := range modelPatchLists(models.List{model}) {
+			for i := range *patches {
+				(*patches)[i].IDOverride = blueprintPatchID((*patches)[i].IDOverride, values.ClusterName, clusterNameVar)
+			}
+		}
+
+		var machinePatches []byte
+
+		if machine, ok := model.(*models.Machine); ok {
+			key, ok := machineKeys[machine.Name]
+			if !ok {
+				// the machine set of the machine is converted to a machine class
+				continue
+			}
+
+			// the patches of the machine are optional, the other machine settings are always kept
+			if len(machine.Patches) > 0 {
+				if values.MachinePatches == nil {
+					values.MachinePatches = map[string]bool{}
+				}
+
+				values.MachinePatches[key] = true
+
+				raw, err := marshalModel(struct {
+					Patches models.PatchList `yaml:"patches"`
+				}{machine.Patches})
+				if err != nil {
+					return err
+				}
+
+				machinePatches = fmt.Appendf(nil, "{{- if index .machinePatches %q }}\n%s{{- end }}\n", key, escapeActions(raw))
+
+				machineCopy := *machine
+				machineCopy.Patches = nil
+				model = &machineCopy
+			}
+		}
+
+		raw, err := marshalModel(model)
+		if err != nil {
+			return err
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString("---\n")
+		}
+
+		buf.Write(escapeActions(raw))
+		buf.Write(machinePatches)
+	}
+
+	blueprint := builder.render(buf.Bytes())
+
+	// machine IDs are UUIDs, so they can be safely replaced everywhere in the blueprint (e.g. in patch IDs)
+	for machineID, key := range machineKeys {
+		blueprint = bytes.ReplaceAll(blueprint, []byte(machineID), []byte(fmt.Sprintf("{{ index .machines %q }}", key)))
+	}
+
+	if _, err = blueprintWriter.Write(blueprint); err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(valuesWriter)
+	encoder.SetIndent(2)
+
+	if err = encoder.Encode(values); err != nil {
+		return fmt.Errorf("error encoding blueprint values: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// matchingMachineClass returns the first machine class (by name) which selects all the machines, or an empty string.
+func matchingMachineClass(ctx context.Context, st state.State, machines models.MachineIDList) (string, error) {
+	machineClasses, err := safe.StateListAll[*omni.MachineClass](ctx, st)
+	if err != nil {
+		return "", err
+	}
+
+	machineLabels := make([]*resource.Labels, 0, len(machines))
+
+	for _, machineID := range machines {
+		machineStatus, err := safe.StateGetByID[*omni.MachineStatus](ctx, st, string(machineID))
+		if err != nil {
+			if state.IsNotFoundError(err) {
+				return "", nil
+			}
+
+			return "", err
+		}
+
+		machineLabels = append(machineLabels, machineStatus.Metadata().Labels())
+	}
+
+	for it := machineClasses.Iterator(); it.Next(); {
+		queries, err := labels.ParseSelectors(it.Value().TypedSpec().Value.MatchLabels)
+		if err != nil {
+			continue
+		}
+
+		if !slices.ContainsFunc(machineLabels, func(l *resource.Labels) bool { return !queries.Matches(*l) }) {
+			return it.Value().Metadata().ID(), nil
+		}
+	}
+
+	return "", nil
+}
+
+func machineSetKey(machineSet *models.MachineSet) string {
+	switch {
+	case machineSet.Kind == models.KindControlPlane:
+		return "controlPlane"
+	case machineSet.Name == "":
+		return "workers"
+	default:
+		return machineSet.Name
+	}
+}
+
+// blueprintPatchID makes the patch ID unique for each cluster rendered from the blueprint, keeping the weight prefix.
+func blueprintPatchID(id, clusterName, clusterNameVar string) string {
+	if strings.Contains(id, clusterName) {
+		return strings.ReplaceAll(id, clusterName, clusterNameVar)
+	}
+
+	if prefix := patchWeightPrefix.FindString(id); prefix != "" {
+		return prefix + clusterNameVar + "-" + strings.TrimPrefix(id, prefix)
+	}
+
+	return clusterNameVar + "-" + id
+}
+
+// escapeActions keeps the Go template delimiters in the marshaled model as is, e.g. in the hostname patterns and the patch data.
+func escapeActions(raw []byte) []byte {
+	return bytes.ReplaceAll(raw, []byte("{{"), []byte(`{{"{{"}}`))
+}
+
+func marshalModel(model any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(model); err != nil {
+		return nil, fmt.Errorf("error encoding model: %w", err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
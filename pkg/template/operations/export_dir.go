@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+const (
+	// ExportTemplateFile is the name of the template file in the exported template directory.
+	ExportTemplateFile = "template.yaml"
+
+	// ExportPatchesDir is the name of the directory containing config patches in the exported template directory.
+	ExportPatchesDir = "patches"
+)
+
+// ExportDirOptions contains options for ExportTemplateDir.
+type ExportDirOptions struct {
+	// Secrets configures the export of the secret values.
+	Secrets SecretOptions
+
+	// Force overwrites existing files in the directory.
+	Force bool
+}
+
+// ExportTemplateDir exports the cluster configuration as a template directory.
+//
+// The directory contains the template file and a config patch file for each patch, the template references the
+// patches by their paths relative to the directory, so the template should be used from within that directory.
+func ExportTemplateDir(ctx context.Context, st state.State, clusterID, dir string, options ExportDirOptions) (models.List, error) {
+	resources, err := collectClusterResources(ctx, st, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	modelList, err := exportModels(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = exportSecretPlaceholders(modelList, options.Secrets); err != nil {
+		return nil, err
+	}
+
+	patchData := map[string]string{}
+
+	for _, configPatch := range resources.allConfigPatches() {
+		patchData[configPatch.Metadata().ID()] = configPatch.TypedSpec().Value.GetData()
+	}
+
+	if err = os.MkdirAll(filepath.Join(dir, ExportPatchesDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	patchFiles := map[string]struct{}{}
+
+	for _, patches := range modelPatchLists(modelList) {
+		for i := range *patches {
+			patch := &(*patches)[i]
+
+			data, ok := patchData[patch.IDOverride]
+			if !ok {
+				return nil, fmt.Errorf("config patch %q not found", patch.IDOverride)
+			}
+
+			// the patch data contains the secret values, write the inline patch with the placeholders instead
+			if options.Secrets.Placeholders {
+				raw, marshalErr := yaml.Marshal(patch.Inline)
+				if marshalErr != nil {
+					return nil, marshalErr
+				}
+
+				data = string(raw)
+			}
+
+			patch.File = filepath.ToSlash(filepath.Join(ExportPatchesDir, patchFileName(patch)))
+			patch.Inline = nil
+
+			if _, ok = patchFiles[patch.File]; ok {
+				return nil, fmt.Errorf("duplicate patch file name %q", patch.File)
+			}
+
+			patchFiles[patch.File] = struct{}{}
+
+			if err = writeExportFile(filepath.Join(dir, patch.File), []byte(data), options.Force); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return modelList, writeExportTemplate(filepath.Join(dir, ExportTemplateFile), modelList, options.Force)
+}
+
+// patchFileName builds the file name for the exported patch from its ID and name annotation.
+func patchFileName(patch *models.Patch) string {
+	base := patch.IDOverride
+
+	if name := sanitizeFileName(patch.Descriptors.Annotations[omni.ConfigPatchName]); name != "" && !strings.HasSuffix(base, name) {
+		base += "-" + name
+	}
+
+	return sanitizeFileName(base) + ".yaml"
+}
+
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, name)
+
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+
+	return strings.Trim(name, "-.")
+}
+
+// modelPatchLists returns pointers to all patch lists in the model list.
+func modelPatchLists(modelList models.List) []*models.PatchList {
+	var result []*models.PatchList
+
+	for _, model := range modelList {
+		switch m := model.(type) {
+		case *models.Cluster:
+			result = append(result, &m.Patches)
+		case *models.ControlPlane:
+			result = append(result, &m.Patches)
+		case *models.Workers:
+			result = append(result, &m.Patches)
+		case *models.Machine:
+			result = append(result, &m.Patches)
+		}
+	}
+
+	return result
+}
+
+func openExportFile(path string, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+
+	return f, nil
+}
+
+func writeExportFile(path string, data []byte, force bool) (err error) {
+	f, err := openExportFile(path, force)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	_, err = f.Write(data)
+
+	return err
+}
+
+func writeExportTemplate(path string, modelList models.List, force bool) (err error) {
+	f, err := openExportFile(path, force)
+	if err != nil {
+		return err
+	}
+
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	return writeYAML(f, modelList)
+}
@@ -0,0 +1,243 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/constants"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// exportedNetwork is the static network addressing of the machine parsed from the network patch generated by the template.
+type exportedNetwork struct {
+	configPatch *omni.ConfigPatch
+	pool        models.AddressPool
+	mac         string
+	address     netip.Addr
+}
+
+type networkPatchRoute struct {
+	Network string `yaml:"network"`
+	Gateway string `yaml:"gateway"`
+}
+
+type networkPatchVLAN struct {
+	Addresses []string            `yaml:"addresses"`
+	Routes    []networkPatchRoute `yaml:"routes"`
+	VLANID    uint16              `yaml:"vlanId"`
+}
+
+type networkPatchInterface struct {
+	DeviceSelector struct {
+		HardwareAddr string `yaml:"hardwareAddr"`
+	} `yaml:"deviceSelector"`
+	Addresses []string            `yaml:"addresses"`
+	Routes    []networkPatchRoute `yaml:"routes"`
+	VLANs     []networkPatchVLAN  `yaml:"vlans"`
+}
+
+type networkPatch struct {
+	Machine struct {
+		Network struct {
+			Interfaces  []networkPatchInterface `yaml:"interfaces"`
+			Nameservers []string                `yaml:"nameservers"`
+		} `yaml:"network"`
+	} `yaml:"machine"`
+}
+
+// getNetworkFromConfigPatch converts the network patch generated by the template back into the static network addressing.
+//
+// The patch is converted only if it has exactly the structure generated by the template, otherwise it's kept as a regular patch.
+func getNetworkFromConfigPatch(configPatch *omni.ConfigPatch) (exportedNetwork, bool) {
+	clusterMachine, ok := configPatch.Metadata().Labels().Get(omni.LabelClusterMachine)
+	if !ok {
+		return exportedNetwork{}, false
+	}
+
+	if _, ok = configPatch.Metadata().Labels().Get(omni.LabelSystemPatch); !ok {
+		return exportedNetwork{}, false
+	}
+
+	if configPatch.Metadata().ID() != fmt.Sprintf("%03d-cm-%s-network", constants.PatchWeightClusterMachineNetwork, clusterMachine) {
+		return exportedNetwork{}, false
+	}
+
+	var patch networkPatch
+
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(configPatch.TypedSpec().Value.GetData())))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&patch); err != nil || len(patch.Machine.Network.Interfaces) != 1 {
+		return exportedNetwork{}, false
+	}
+
+	device := patch.Machine.Network.Interfaces[0]
+
+	network := exportedNetwork{
+		configPatch: configPatch,
+		mac:         device.DeviceSelector.HardwareAddr,
+		pool: models.AddressPool{
+			Nameservers: patch.Machine.Network.Nameservers,
+		},
+	}
+
+	addresses, routes := device.Addresses, device.Routes
+
+	if len(device.VLANs) > 0 {
+		if len(device.VLANs) != 1 || len(addresses) != 0 || len(routes) != 0 {
+			return exportedNetwork{}, false
+		}
+
+		addresses, routes = device.VLANs[0].Addresses, device.VLANs[0].Routes
+		network.pool.VLAN = device.VLANs[0].VLANID
+	}
+
+	if network.mac == "" || len(addresses) != 1 || len(routes) > 1 {
+		return exportedNetwork{}, false
+	}
+
+	prefix, err := netip.ParsePrefix(addresses[0])
+	if err != nil {
+		return exportedNetwork{}, false
+	}
+
+	network.address = prefix.Addr()
+	network.pool.CIDR = prefix.Masked().String()
+
+	if len(routes) == 1 {
+		if routes[0].Network != "0.0.0.0/0" && routes[0].Network != "::/0" {
+			return exportedNetwork{}, false
+		}
+
+		network.pool.Gateway = routes[0].Gateway
+	}
+
+	return network, true
+}
+
+func samePool(a, b models.AddressPool) bool {
+	return a.CIDR == b.CIDR && a.Start == b.Start && a.Gateway == b.Gateway && a.VLAN == b.VLAN && slices.Equal(a.Nameservers, b.Nameservers)
+}
+
+// collapseNetworks restores the address pools of the machine sets from the network addressing of their machines.
+//
+// The pool is restored only if all machines of the machine set share it, otherwise the network patches are kept as regular patches.
+// The pool shared by the most machine sets is moved to the cluster, if all static machine sets have a pool.
+// The machines keep their addresses and links, so that the sync doesn't reallocate them.
+func collapseNetworks(resources clusterResources) (models.Network, map[string]models.Network, map[string]models.MachineNetwork) {
+	machineSetNetworks := map[string]models.Network{}
+	machineNetworks := map[string]models.MachineNetwork{}
+
+	machineSetIDs := make([]string, 0, len(resources.machineSetNodes))
+
+	for machineSetID := range resources.machineSetNodes {
+		machineSetIDs = append(machineSetIDs, machineSetID)
+	}
+
+	slices.Sort(machineSetIDs)
+
+	allHavePools := true
+
+	for _, machineSetID := range machineSetIDs {
+		nodes := resources.machineSetNodes[machineSetID]
+
+		first, ok := resources.clusterMachineNetworks[nodes[0].Metadata().ID()]
+
+		shared := ok && !slices.ContainsFunc(nodes, func(node *omni.MachineSetNode) bool {
+			network, ok := resources.clusterMachineNetworks[node.Metadata().ID()]
+
+			return !ok || !samePool(network.pool, first.pool)
+		})
+
+		if !shared {
+			allHavePools = false
+
+			// keep the network patches of the machine set as regular patches
+			for _, node := range nodes {
+				if network, ok := resources.clusterMachineNetworks[node.Metadata().ID()]; ok {
+					resources.clusterMachineConfigPatches[node.Metadata().ID()] = append(resources.clusterMachineConfigPatches[node.Metadata().ID()], network.configPatch)
+				}
+			}
+
+			continue
+		}
+
+		pool := first.pool
+		machineSetNetworks[machineSetID] = models.Network{AddressPool: &pool}
+
+		for _, node := range nodes {
+			network := resources.clusterMachineNetworks[node.Metadata().ID()]
+
+			machineNetworks[node.Metadata().ID()] = models.MachineNetwork{
+				Address: network.address.String(),
+				Link:    &models.LinkSelector{MAC: network.mac},
+			}
+		}
+	}
+
+	var clusterNetwork models.Network
+
+	if !allHavePools {
+		return clusterNetwork, machineSetNetworks, machineNetworks
+	}
+
+	var (
+		clusterPool *models.AddressPool
+		maxCount    int
+	)
+
+	for _, machineSetID := range machineSetIDs {
+		pool := machineSetNetworks[machineSetID].AddressPool
+
+		count := 0
+
+		for _, network := range machineSetNetworks {
+			if samePool(*network.AddressPool, *pool) {
+				count++
+			}
+		}
+
+		if count >= 2 && count > maxCount {
+			clusterPool, maxCount = pool, count
+		}
+	}
+
+	if clusterPool == nil {
+		return clusterNetwork, machineSetNetworks, machineNetworks
+	}
+
+	clusterNetwork.AddressPool = clusterPool
+
+	for machineSetID, network := range machineSetNetworks {
+		if samePool(*network.AddressPool, *clusterPool) {
+			delete(machineSetNetworks, machineSetID)
+		}
+	}
+
+	return clusterNetwork, machineSetNetworks, machineNetworks
+}
+
+// clearNetworks removes the static network addressing from the models, as the addresses are specific to the exported cluster.
+func clearNetworks(modelList models.List) {
+	for _, model := range modelList {
+		switch m := model.(type) {
+		case *models.Cluster:
+			m.Network = models.Network{}
+		case *models.ControlPlane:
+			m.Network = models.Network{}
+		case *models.Workers:
+			m.Network = models.Network{}
+		case *models.Machine:
+			m.Network = models.MachineNetwork{}
+		}
+	}
+}
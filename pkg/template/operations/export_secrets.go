@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+	"github.com/siderolabs/omni-client/pkg/template/internal/secrets"
+)
+
+// DefaultSecretKeys are the default patterns of the secret field names.
+var DefaultSecretKeys = []string{"key", "*privatekey*", "*apikey*", "*password*", "*secret*", "*token*"}
+
+// SecretOptions configures the export of the secret values of the config patches.
+type SecretOptions struct {
+	// Keys are the glob patterns of the secret field names, matched case-insensitively, defaults to DefaultSecretKeys.
+	Keys []string
+
+	// Placeholders replaces the secret values with the secretRef placeholders referring to the environment variables.
+	//
+	// The environment variable names are derived from the patch ID and the field path, e.g. SECRET_400_MY_PATCH_CLUSTER_CA_KEY.
+	Placeholders bool
+}
+
+// ExportOptions contains options for ExportTemplateWithOptions.
+type ExportOptions struct {
+	// Secrets configures the export of the secret values.
+	Secrets SecretOptions
+}
+
+// exportSecretPlaceholders replaces the secret values of the inline patches with placeholders.
+func exportSecretPlaceholders(modelList models.List, options SecretOptions) error {
+	if !options.Placeholders {
+		return nil
+	}
+
+	keys := options.Keys
+	if len(keys) == 0 {
+		keys = DefaultSecretKeys
+	}
+
+	for _, pattern := range keys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid secret key pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, patches := range modelPatchLists(modelList) {
+		for i := range *patches {
+			patch := &(*patches)[i]
+
+			if patch.Inline == nil {
+				continue
+			}
+
+			patch.Inline = replaceSecrets(envName("SECRET", patch.IDOverride), patch.Inline, keys).(map[string]any) //nolint:forcetypeassert,errcheck
+		}
+	}
+
+	return nil
+}
+
+func replaceSecrets(prefix string, value any, keys []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+
+		for key, item := range v {
+			env := envName(prefix, key)
+
+			if secret, ok := item.(string); ok && secret != "" && isSecretKey(key, keys) {
+				result[key] = secrets.Placeholder(env)
+
+				continue
+			}
+
+			result[key] = replaceSecrets(env, item, keys)
+		}
+
+		return result
+	case []any:
+		result := make([]any, 0, len(v))
+
+		for i, item := range v {
+			result = append(result, replaceSecrets(envName(prefix, fmt.Sprint(i)), item, keys))
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+func isSecretKey(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), key); matched { //nolint:errcheck
+			return true
+		}
+	}
+
+	return false
+}
+
+// envName joins the prefix and the name into the environment variable name.
+func envName(prefix, name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, name)
+
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+
+	return prefix + "_" + strings.Trim(name, "_")
+}
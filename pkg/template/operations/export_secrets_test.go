@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+const secretsPatch = `---
+kind: Machine
+name: 4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a
+patches:
+  - name: registry-auth
+    inline:
+      machine:
+        registries:
+          config:
+            ghcr.io:
+              auth:
+                username: robot
+                password: s3cr3t
+`
+
+func TestExportSecretPlaceholders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	template := strings.ReplaceAll(rolloutClusterTemplate, "SOMAXCONN", "128") + secretsPatch
+
+	require.NoError(t, operations.SyncTemplate(ctx, strings.NewReader(template), &strings.Builder{}, st, operations.SyncOptions{}))
+
+	var exported strings.Builder
+
+	_, err := operations.ExportTemplateWithOptions(ctx, st, "rollout-test", &exported, operations.ExportOptions{
+		Secrets: operations.SecretOptions{Placeholders: true},
+	})
+	require.NoError(t, err)
+
+	const env = "SECRET_400_CM_4B3AB7C8_3C6B_4B8D_9A5E_3F1F4C6F1E2A_REGISTRY_AUTH_MACHINE_REGISTRIES_CONFIG_GHCR_IO_AUTH_PASSWORD"
+
+	assert.NotContains(t, exported.String(), "s3cr3t")
+	assert.Contains(t, exported.String(), "username: robot")
+	assert.Contains(t, exported.String(), "password:\n                  secretRef:\n                    env: "+env+"\n")
+
+	// the exported template syncs back without changes once the secret is provided
+	t.Setenv(env, "s3cr3t")
+
+	var out strings.Builder
+
+	require.NoError(t, operations.SyncTemplate(ctx, strings.NewReader(exported.String()), &out, st, operations.SyncOptions{DryRun: true}))
+	assert.Empty(t, out.String())
+}
@@ -7,10 +7,16 @@ package operations_test
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -21,12 +27,17 @@ import (
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
 	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/google/uuid"
 	"github.com/siderolabs/gen/maps"
+	"github.com/siderolabs/gen/xslices"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 
+	"github.com/siderolabs/omni-client/api/omni/management"
+	omniresources "github.com/siderolabs/omni-client/pkg/omni/resources"
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
 	"github.com/siderolabs/omni-client/pkg/template/internal/models"
 	"github.com/siderolabs/omni-client/pkg/template/operations"
 )
@@ -38,10 +49,42 @@ var clusterTemplate string
 var clusterResources []byte
 
 type resources struct {
-	clusters        map[string]*omni.Cluster
-	machineSets     map[string]*omni.MachineSet
-	machineSetNodes map[string]*omni.MachineSetNode
-	configPatches   map[string]*omni.ConfigPatch
+	clusters                map[string]*omni.Cluster
+	machineSets             map[string]*omni.MachineSet
+	machineSetNodes         map[string]*omni.MachineSetNode
+	configPatches           map[string]*omni.ConfigPatch
+	schematicConfigurations map[string]*omni.SchematicConfiguration
+}
+
+// stateSchematicResolver resolves the schematics to the existing schematics with the same extensions.
+type stateSchematicResolver struct {
+	st state.State
+}
+
+func (r stateSchematicResolver) CreateSchematic(ctx context.Context, req *management.CreateSchematicRequest) (*management.CreateSchematicResponse, error) {
+	schematics, err := safe.StateListAll[*omni.Schematic](ctx, r.st)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := sortedStrings(req.Extensions)
+
+	for iter := schematics.Iterator(); iter.Next(); {
+		if len(req.ExtraKernelArgs) == 0 && len(req.MetaValues) == 0 && slices.Equal(sortedStrings(iter.Value().TypedSpec().Value.Extensions), extensions) {
+			return &management.CreateSchematicResponse{SchematicId: iter.Value().Metadata().ID()}, nil
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprint(extensions, req.ExtraKernelArgs, req.MetaValues)))
+
+	return &management.CreateSchematicResponse{SchematicId: hex.EncodeToString(hash[:])}, nil
+}
+
+func sortedStrings(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+
+	return s
 }
 
 func TestExport(t *testing.T) {
@@ -66,7 +109,9 @@ func assertSync(ctx context.Context, t *testing.T, st state.State, exportedTempl
 
 	resourcesBeforeSync := readResources(ctx, t, st)
 
-	err := operations.SyncTemplate(ctx, strings.NewReader(exportedTemplate), &sb, st, operations.SyncOptions{})
+	err := operations.SyncTemplate(ctx, strings.NewReader(exportedTemplate), &sb, st, operations.SyncOptions{
+		SchematicResolver: stateSchematicResolver{st: st},
+	})
 	require.NoError(t, err)
 
 	resourcesAfterSync := readResources(ctx, t, st)
@@ -75,11 +120,13 @@ func assertSync(ctx context.Context, t *testing.T, st state.State, exportedTempl
 	assert.ElementsMatch(t, maps.Keys(resourcesBeforeSync.machineSets), maps.Keys(resourcesAfterSync.machineSets))
 	assert.ElementsMatch(t, maps.Keys(resourcesBeforeSync.machineSetNodes), maps.Keys(resourcesAfterSync.machineSetNodes))
 	assert.ElementsMatch(t, maps.Keys(resourcesBeforeSync.configPatches), maps.Keys(resourcesAfterSync.configPatches))
+	assert.ElementsMatch(t, maps.Keys(resourcesBeforeSync.schematicConfigurations), maps.Keys(resourcesAfterSync.schematicConfigurations))
 
 	// we expect everything other than config patches to be completely unchanged
 	assertVersionsUnchanged(t, resourcesBeforeSync.clusters, resourcesAfterSync.clusters)
 	assertVersionsUnchanged(t, resourcesBeforeSync.machineSets, resourcesAfterSync.machineSets)
 	assertVersionsUnchanged(t, resourcesBeforeSync.machineSetNodes, resourcesAfterSync.machineSetNodes)
+	assertVersionsUnchanged(t, resourcesBeforeSync.schematicConfigurations, resourcesAfterSync.schematicConfigurations)
 
 	// config patches might be updated due to discrepancies between how the cluster templates and the frontend generate them, e.g.:
 	// they might differ in the indentation/comments of the patch data, so we do a yaml-equality check on data instead of byte-equality.
@@ -103,7 +150,13 @@ func assertConfigPatches(t *testing.T, before map[string]*omni.ConfigPatch, afte
 		}
 
 		assert.Equal(t, beforeConfigPatch.Metadata().Labels(), afterConfigPatch.Metadata().Labels(), "labels changed for resource: %q", beforeConfigPatch.Metadata())
-		assert.Equal(t, beforeConfigPatch.Metadata().Annotations(), afterConfigPatch.Metadata().Annotations(), "annotations changed for resource: %q", beforeConfigPatch.Metadata())
+		// the sync records the last applied state on the updated resources
+		afterAnnotations := afterConfigPatch.Metadata().Annotations().Raw()
+		assert.Contains(t, afterAnnotations, omni.LastAppliedTemplateHash)
+
+		afterAnnotations = maps.Filter(afterAnnotations, func(k, _ string) bool { return k != omni.LastAppliedTemplateHash })
+
+		assert.Equal(t, beforeConfigPatch.Metadata().Annotations().Raw(), afterAnnotations, "annotations changed for resource: %q", beforeConfigPatch.Metadata())
 
 		assert.YAMLEq(t, beforeConfigPatch.TypedSpec().Value.GetData(), afterConfigPatch.TypedSpec().Value.GetData(),
 			"config patch data changed for resource: %q", beforeConfigPatch.Metadata())
@@ -123,11 +176,15 @@ func readResources(ctx context.Context, t *testing.T, st state.State) resources
 	configPatchList, err := safe.StateListAll[*omni.ConfigPatch](ctx, st)
 	require.NoError(t, err)
 
+	schematicConfigurationList, err := safe.StateListAll[*omni.SchematicConfiguration](ctx, st)
+	require.NoError(t, err)
+
 	return resources{
-		clusters:        listToMap(clusterList),
-		machineSets:     listToMap(machineSetList),
-		machineSetNodes: listToMap(machineSetNodeList),
-		configPatches:   listToMap(configPatchList),
+		clusters:                listToMap(clusterList),
+		machineSets:             listToMap(machineSetList),
+		machineSetNodes:         listToMap(machineSetNodeList),
+		configPatches:           listToMap(configPatchList),
+		schematicConfigurations: listToMap(schematicConfigurationList),
 	}
 }
 
@@ -211,3 +268,198 @@ func listToMap[T resource.Resource](list safe.List[T]) map[resource.ID]T {
 
 	return result
 }
+
+func TestExportDir(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := buildState(ctx, t)
+	dir := t.TempDir()
+
+	_, err := operations.ExportTemplateDir(ctx, st, "export-test", dir, operations.ExportDirOptions{})
+	require.NoError(t, err)
+
+	// exporting again without force should fail as the files already exist
+	_, err = operations.ExportTemplateDir(ctx, st, "export-test", dir, operations.ExportDirOptions{})
+	require.Error(t, err)
+
+	patchFiles, err := os.ReadDir(filepath.Join(dir, operations.ExportPatchesDir))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"499-2e4b9030-aade-47cf-8f7f-3031b7ae49bb-user-defined-patch.yaml",
+		"500-1104d832-79fb-4121-a67f-752fa8f763e9-user-defined-patch.yaml",
+		"500-2e2a2a64-5085-407a-a205-f75f4c64a060-user-defined-patch.yaml",
+		"500-32fe29d6-221a-4e6e-a55e-6b1700cae09d-user-defined-patch.yaml",
+		"500-3792b0d9-0fc2-46fb-becf-4d5439bbe5ba-user-defined-patch.yaml",
+		"500-ae981813-420d-464f-a246-fd7e861402f1-user-defined-patch.yaml",
+		"600-3fb9b4d2-b13c-48a7-9929-3632e68ff5da-user-defined-patch.yaml",
+		"666-4a5ca2e0-4f57-4761-bf61-c1e4cf583170-user-defined-patch.yaml",
+	}, xslices.Map(patchFiles, os.DirEntry.Name))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	f, err := os.Open(operations.ExportTemplateFile)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { f.Close() }) //nolint:errcheck
+
+	tmpl, err := template.Load(f)
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+	require.NoError(t, tmpl.ResolveSchematics(ctx, st, stateSchematicResolver{st: st}))
+
+	// the exported directory should be in sync with the cluster
+	syncResult, err := tmpl.Sync(ctx, st)
+	require.NoError(t, err)
+
+	assert.Empty(t, syncResult.Create)
+
+	// install disk patches are generated by the template with a different indentation, all other resources should be unchanged
+	for _, u := range syncResult.Update {
+		_, isSystemPatch := u.New.Metadata().Labels().Get(omni.LabelSystemPatch)
+
+		assert.True(t, isSystemPatch, "unexpected update of %s", resource.String(u.New))
+	}
+
+	for _, phase := range syncResult.Destroy {
+		assert.Empty(t, phase)
+	}
+
+	// the patches are compared structurally by the diff, so the exported directory loads back without any diff
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	var diff strings.Builder
+
+	require.NoError(t, operations.DiffTemplate(ctx, f, &diff, st, operations.DiffOptions{}))
+	assert.Empty(t, diff.String())
+}
+
+func TestExportBlueprint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := buildState(ctx, t)
+
+	// the machines of the cluster are selected by the "amd64" machine class, "a-arm64" is listed first, but doesn't match them
+	machineSetNodes, err := safe.StateListAll[*omni.MachineSetNode](ctx, st)
+	require.NoError(t, err)
+
+	for it := machineSetNodes.Iterator(); it.Next(); {
+		machineStatus := omni.NewMachineStatus(omniresources.DefaultNamespace, it.Value().Metadata().ID())
+		machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelArch, "amd64")
+
+		require.NoError(t, st.Create(ctx, machineStatus))
+	}
+
+	for id, arch := range map[string]string{"a-arm64": "arm64", "amd64": "amd64"} {
+		machineClass := omni.NewMachineClass(omniresources.DefaultNamespace, id)
+		machineClass.TypedSpec().Value.MatchLabels = []string{omni.MachineStatusLabelArch + "=" + arch}
+
+		require.NoError(t, st.Create(ctx, machineClass))
+	}
+
+	// Go template actions in the patches are kept as is
+	templatedPatch := omni.NewConfigPatch(omniresources.DefaultNamespace, "400-templated-patch")
+	templatedPatch.Metadata().Labels().Set(omni.LabelCluster, "export-test")
+	templatedPatch.TypedSpec().Value.Data = "machine:\n  env:\n    GREETING: '{{ .Greeting }}'\n"
+
+	require.NoError(t, st.Create(ctx, templatedPatch))
+
+	for _, tt := range []struct {
+		name    string
+		options operations.BlueprintOptions
+	}{
+		{
+			name: "machines",
+		},
+		{
+			name:    "machine classes",
+			options: operations.BlueprintOptions{MachineClasses: true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var blueprint, values bytes.Buffer
+
+			require.NoError(t, operations.ExportBlueprint(ctx, st, "export-test", &blueprint, &values, tt.options))
+
+			assert.NotContains(t, blueprint.String(), "export-test")
+			assert.NotContains(t, blueprint.String(), "3f8b33d2-52b1-42ed-8505-4025ddbc31f1")
+
+			// default values render the exported cluster
+			rendered, err := renderBlueprint(blueprint.Bytes(), values.Bytes())
+			require.NoError(t, err)
+
+			tmpl, err := template.Load(bytes.NewReader(rendered))
+			require.NoError(t, err)
+
+			require.NoError(t, tmpl.Validate())
+
+			clusterName, err := tmpl.ClusterName()
+			require.NoError(t, err)
+
+			assert.Equal(t, "export-test", clusterName)
+			assert.Contains(t, string(rendered), "{{ .Greeting }}")
+
+			// a new cluster with a different name doesn't conflict with the exported one
+			var valuesMap map[string]any
+
+			require.NoError(t, yaml.Unmarshal(values.Bytes(), &valuesMap))
+
+			if tt.options.MachineClasses {
+				assert.Equal(t, map[string]any{"controlPlane": "amd64", "storage": "amd64", "workers": "amd64"}, valuesMap["machineClasses"])
+			}
+
+			valuesMap["clusterName"] = "new-cluster"
+			valuesMap["machinePatches"] = map[string]bool{}
+
+			if machines, ok := valuesMap["machines"].(map[string]any); ok {
+				for key := range machines {
+					machines[key] = uuid.NewString()
+				}
+			}
+
+			newValues, err := yaml.Marshal(valuesMap)
+			require.NoError(t, err)
+
+			rendered, err = renderBlueprint(blueprint.Bytes(), newValues)
+			require.NoError(t, err)
+
+			// disabling the machine patches keeps the other machine settings
+			if !tt.options.MachineClasses {
+				assert.Contains(t, string(rendered), "{{ .MachineSet }}-{{ .MachineID | short }}")
+				assert.Contains(t, string(rendered), "locked: true")
+				assert.Contains(t, string(rendered), "disk: /dev/sdc")
+			}
+
+			tmpl, err = template.Load(bytes.NewReader(rendered))
+			require.NoError(t, err)
+
+			require.NoError(t, tmpl.Validate())
+			require.NoError(t, tmpl.ResolveSchematics(ctx, st, stateSchematicResolver{st: st}))
+
+			syncResult, err := tmpl.Sync(ctx, st)
+			require.NoError(t, err)
+
+			assert.NotEmpty(t, syncResult.Create)
+			assert.Empty(t, syncResult.Update)
+		})
+	}
+}
+
+func renderBlueprint(blueprint, values []byte) ([]byte, error) {
+	rendered, err := template.RenderBlueprint(bytes.NewReader(blueprint), bytes.NewReader(values))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(rendered)
+}
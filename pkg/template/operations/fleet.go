@@ -0,0 +1,167 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/fatih/color"
+
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// DefaultFleetParallelism is the default number of clusters processed at once by the fleet operations.
+const DefaultFleetParallelism = 4
+
+// FleetOptions configures the fleet operations.
+type FleetOptions struct {
+	// Parallelism is the number of clusters processed at once, defaults to DefaultFleetParallelism.
+	Parallelism int
+}
+
+// FleetResult is the outcome of the fleet operation for a single cluster.
+type FleetResult struct {
+	// Err is nil if the operation succeeded for the cluster.
+	Err error
+
+	// Cluster is the name of the cluster.
+	Cluster string
+}
+
+// FleetSync performs resource sync to Omni for each cluster of the fleet, see SyncTemplate.
+//
+// A failure of one cluster doesn't stop the others, the results are returned for each cluster in the fleet order.
+func FleetSync(ctx context.Context, templates []*template.Template, out io.Writer, st state.State, fleetOptions FleetOptions, syncOptions SyncOptions) ([]FleetResult, error) {
+	return runFleet(ctx, templates, out, fleetOptions, func(ctx context.Context, tmpl *template.Template, out io.Writer) error {
+		return syncTemplate(ctx, tmpl, out, st, syncOptions)
+	})
+}
+
+// FleetDiff outputs the diff between template resources and existing resources for each cluster of the fleet, see DiffTemplate.
+func FleetDiff(ctx context.Context, templates []*template.Template, out io.Writer, st state.State, fleetOptions FleetOptions, diffOptions DiffOptions) ([]FleetResult, error) {
+	return runFleet(ctx, templates, out, fleetOptions, func(ctx context.Context, tmpl *template.Template, out io.Writer) error {
+		return diffTemplate(ctx, tmpl, out, st, diffOptions)
+	})
+}
+
+// FleetStatus queries, renders and (optionally) waits for the status of each cluster of the fleet, see StatusTemplate.
+//
+// Only the latest status of each cluster is printed.
+func FleetStatus(ctx context.Context, templates []*template.Template, out io.Writer, st state.State, fleetOptions FleetOptions, statusOptions StatusOptions) ([]FleetResult, error) {
+	return runFleet(ctx, templates, out, fleetOptions, func(ctx context.Context, tmpl *template.Template, out io.Writer) error {
+		return statusTemplate(ctx, tmpl, &latestWriter{w: out}, st, statusOptions)
+	})
+}
+
+// runFleet runs the operation for each cluster with the bounded parallelism.
+//
+// The output of each cluster is buffered and printed as a whole once the cluster is done, followed by the summary.
+func runFleet(ctx context.Context, templates []*template.Template, out io.Writer, options FleetOptions,
+	operation func(ctx context.Context, tmpl *template.Template, out io.Writer) error,
+) ([]FleetResult, error) {
+	parallelism := options.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultFleetParallelism
+	}
+
+	boldFunc := color.New(color.Bold).SprintfFunc()
+	results := make([]FleetResult, len(templates))
+	sem := make(chan struct{}, parallelism)
+
+	var (
+		wg    sync.WaitGroup
+		outMu sync.Mutex
+	)
+
+	for i, tmpl := range templates {
+		clusterName, err := tmpl.ClusterName()
+		if err != nil {
+			return nil, err
+		}
+
+		results[i].Cluster = clusterName
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var buf bytes.Buffer
+
+			results[i].Err = runFleetCluster(ctx, tmpl, &buf, operation)
+
+			outMu.Lock()
+			defer outMu.Unlock()
+
+			fmt.Fprintf(out, "%s\n", boldFunc("=== cluster %s ===", clusterName)) //nolint:errcheck
+			out.Write(buf.Bytes())                                                //nolint:errcheck
+
+			if results[i].Err != nil {
+				fmt.Fprintf(out, "%s\n", results[i].Err) //nolint:errcheck
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return results, printFleetSummary(out, results)
+}
+
+func runFleetCluster(ctx context.Context, tmpl *template.Template, out io.Writer, operation func(ctx context.Context, tmpl *template.Template, out io.Writer) error) error {
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+
+	return operation(ctx, tmpl, out)
+}
+
+func printFleetSummary(out io.Writer, results []FleetResult) error {
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+	boldFunc := color.New(color.Bold).SprintfFunc()
+
+	fmt.Fprintf(out, "%s\n", boldFunc("=== summary ===")) //nolint:errcheck
+
+	var failed int
+
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+
+			red.Fprintf(out, "! %s: %s\n", result.Cluster, result.Err) //nolint:errcheck
+
+			continue
+		}
+
+		green.Fprintf(out, "* %s: ok\n", result.Cluster) //nolint:errcheck
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cluster(s) failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// latestWriter keeps only the latest write, so that the buffered status output contains only the latest status tree.
+type latestWriter struct {
+	w io.Writer
+}
+
+func (lw *latestWriter) Write(p []byte) (int, error) {
+	if buf, ok := lw.w.(*bytes.Buffer); ok {
+		buf.Reset()
+	}
+
+	return lw.w.Write(p)
+}
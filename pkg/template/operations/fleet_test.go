@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	_ "embed"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+//go:embed testdata/fleet/fleet.yaml
+var fleetTemplate string
+
+func TestFleetSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	templates, err := template.LoadFleet(strings.NewReader(fleetTemplate))
+	require.NoError(t, err)
+
+	var sb strings.Builder
+
+	results, err := operations.FleetSync(ctx, templates, &sb, st, operations.FleetOptions{Parallelism: 2}, operations.SyncOptions{})
+	require.EqualError(t, err, "1 of 3 cluster(s) failed")
+
+	require.Len(t, results, 3)
+	assert.Equal(t, "alpha", results[0].Cluster)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "beta", results[1].Cluster)
+	assert.ErrorContains(t, results[1].Err, "error validating Kubernetes version")
+	assert.Equal(t, "gamma", results[2].Cluster)
+	assert.NoError(t, results[2].Err)
+
+	// the failed cluster doesn't stop the others
+	clusters, err := safe.StateListAll[*omni.Cluster](ctx, st)
+	require.NoError(t, err)
+
+	var names []string
+
+	clusters.ForEach(func(cluster *omni.Cluster) {
+		names = append(names, cluster.Metadata().ID())
+	})
+
+	assert.Equal(t, []string{"alpha", "gamma"}, names)
+
+	assert.Contains(t, sb.String(), "=== cluster gamma ===")
+	assert.Contains(t, sb.String(), "* alpha: ok")
+	assert.Contains(t, sb.String(), "! beta: ")
+
+	// the second run is a no-op for the synced clusters
+	sb.Reset()
+
+	results, err = operations.FleetDiff(ctx, templates[:1], &sb, st, operations.FleetOptions{}, operations.DiffOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "=== cluster alpha ===\n=== summary ===\n* alpha: ok\n", sb.String())
+}
@@ -0,0 +1,419 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/dustin/go-humanize"
+	"github.com/siderolabs/gen/xslices"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/labels"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// Minimum hardware of the machine suggested for the control plane.
+const (
+	controlPlaneMinCores  = 2
+	controlPlaneMinMemory = 2 * humanize.GiByte
+)
+
+// InitOptions contains options for PlanInit.
+type InitOptions struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string
+
+	// Selector filters the available machines by labels, e.g. omni.sidero.dev/arch=amd64.
+	Selector string
+
+	// TalosVersion is the Talos version, defaults to the latest stable version.
+	TalosVersion string
+
+	// KubernetesVersion is the Kubernetes version, defaults to the latest stable version compatible with the Talos version.
+	KubernetesVersion string
+
+	// ControlPlanes is the number of the control plane machines, defaults to 3 if there are at least 4 machines, and to 1 otherwise.
+	ControlPlanes int
+
+	// Workers is the number of the worker machines, negative value means all remaining machines.
+	Workers int
+}
+
+// InitMachine is an available machine with its hardware.
+type InitMachine struct {
+	// ID of the machine.
+	ID string
+
+	// Cores is the number of CPU cores, zero if not reported.
+	Cores int
+
+	// Memory is the total memory in bytes, zero if not reported.
+	Memory uint64
+}
+
+// String implements fmt.Stringer.
+func (m InitMachine) String() string {
+	cores, memory := "?", "?"
+
+	if m.Cores > 0 {
+		cores = strconv.Itoa(m.Cores)
+	}
+
+	if m.Memory > 0 {
+		memory = humanize.IBytes(m.Memory)
+	}
+
+	return fmt.Sprintf("%s (cores: %s, mem: %s)", m.ID, cores, memory)
+}
+
+// controlPlaneCapable returns false if the machine is known to have not enough resources for the control plane.
+func (m InitMachine) controlPlaneCapable() bool {
+	return (m.Cores == 0 || m.Cores >= controlPlaneMinCores) && (m.Memory == 0 || m.Memory >= controlPlaneMinMemory)
+}
+
+// InitPlan is the suggested template for the available machines.
+type InitPlan struct {
+	// ClusterName is the name of the cluster.
+	ClusterName string
+
+	// TalosVersion is the Talos version of the cluster.
+	TalosVersion string
+
+	// KubernetesVersion is the Kubernetes version of the cluster.
+	KubernetesVersion string
+
+	// TalosVersions are all available Talos versions, the latest first.
+	TalosVersions []string
+
+	// ControlPlanes are the machines suggested for the control plane.
+	ControlPlanes []InitMachine
+
+	// Workers are the machines suggested for the workers.
+	Workers []InitMachine
+
+	// Unassigned are the available machines which are not used in the template.
+	Unassigned []InitMachine
+}
+
+// InitTemplate writes a new cluster template for the available machines.
+func InitTemplate(ctx context.Context, st state.State, output io.Writer, options InitOptions) error {
+	plan, err := PlanInit(ctx, st, options)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := plan.Template()
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Encode(output)
+}
+
+// PlanInit suggests the cluster template for the available machines.
+//
+// Machines with the fewest resources which still meet the control plane requirements are suggested for the control plane,
+// so that the bigger machines run the workloads.
+func PlanInit(ctx context.Context, st state.State, options InitOptions) (*InitPlan, error) {
+	if options.ClusterName == "" {
+		return nil, errors.New("cluster name is required")
+	}
+
+	machines, err := availableMachines(ctx, st, options.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(machines) == 0 {
+		return nil, errors.New("no available machines match the selector")
+	}
+
+	plan := &InitPlan{
+		ClusterName: options.ClusterName,
+	}
+
+	if err = plan.pickVersions(ctx, st, options.TalosVersion, options.KubernetesVersion); err != nil {
+		return nil, err
+	}
+
+	controlPlanes := options.ControlPlanes
+	if controlPlanes == 0 {
+		controlPlanes = 1
+
+		if len(machines) >= 4 {
+			controlPlanes = 3
+		}
+	}
+
+	if err = plan.Assign(machines, controlPlanes, options.Workers); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// Assign the machines to the control plane and the workers.
+//
+// Negative number of workers means all remaining machines.
+func (plan *InitPlan) Assign(machines []InitMachine, controlPlanes, workers int) error {
+	if controlPlanes < 1 {
+		return errors.New("at least one control plane machine is required")
+	}
+
+	// smallest capable machines first, machines with unknown hardware last
+	candidates := xslices.Filter(machines, InitMachine.controlPlaneCapable)
+
+	slices.SortStableFunc(candidates, func(a, b InitMachine) int {
+		return cmp.Or(
+			cmp.Compare(hardwareUnknown(a), hardwareUnknown(b)),
+			cmp.Compare(a.Cores, b.Cores),
+			cmp.Compare(a.Memory, b.Memory),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	if len(candidates) < controlPlanes {
+		return fmt.Errorf("%d control plane machines requested, but only %d available machines have at least %d cores and %s of memory",
+			controlPlanes, len(candidates), controlPlaneMinCores, humanize.IBytes(controlPlaneMinMemory))
+	}
+
+	plan.ControlPlanes = slices.Clone(candidates[:controlPlanes])
+
+	// biggest machines first
+	rest := xslices.Filter(machines, func(m InitMachine) bool {
+		return !slices.Contains(plan.ControlPlanes, m)
+	})
+
+	slices.SortStableFunc(rest, func(a, b InitMachine) int {
+		return cmp.Or(
+			cmp.Compare(b.Cores, a.Cores),
+			cmp.Compare(b.Memory, a.Memory),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	if workers < 0 || workers > len(rest) {
+		if workers > len(rest) {
+			return fmt.Errorf("%d worker machines requested, but only %d machines are left after the control plane", workers, len(rest))
+		}
+
+		workers = len(rest)
+	}
+
+	plan.Workers = rest[:workers]
+	plan.Unassigned = rest[workers:]
+
+	return nil
+}
+
+// Machines returns all available machines of the plan.
+func (plan *InitPlan) Machines() []InitMachine {
+	return slices.Concat(plan.ControlPlanes, plan.Workers, plan.Unassigned)
+}
+
+// Template builds the cluster template from the plan.
+func (plan *InitPlan) Template() (*template.Template, error) {
+	builder := template.NewBuilder(template.Cluster{
+		Name:              plan.ClusterName,
+		KubernetesVersion: "v" + plan.KubernetesVersion,
+		TalosVersion:      "v" + plan.TalosVersion,
+	}).ControlPlane(template.MachineSet{
+		Machines: xslices.Map(plan.ControlPlanes, func(m InitMachine) string { return m.ID }),
+	})
+
+	if len(plan.Workers) > 0 {
+		builder = builder.Workers(template.MachineSet{
+			Machines: xslices.Map(plan.Workers, func(m InitMachine) string { return m.ID }),
+		})
+	}
+
+	return builder.Build()
+}
+
+// SetTalosVersion sets the Talos version, the Kubernetes version is reset to the latest one if it's not compatible with the new Talos version.
+func (plan *InitPlan) SetTalosVersion(ctx context.Context, st state.State, talosVersion string) error {
+	previous := plan.KubernetesVersion
+
+	if err := plan.pickVersions(ctx, st, talosVersion, ""); err != nil {
+		return err
+	}
+
+	compatible, err := plan.CompatibleKubernetesVersions(ctx, st)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(compatible, previous) {
+		plan.KubernetesVersion = previous
+	}
+
+	return nil
+}
+
+// SetKubernetesVersion sets the Kubernetes version, it should be compatible with the Talos version of the plan.
+func (plan *InitPlan) SetKubernetesVersion(ctx context.Context, st state.State, kubernetesVersion string) error {
+	return plan.pickVersions(ctx, st, plan.TalosVersion, kubernetesVersion)
+}
+
+// CompatibleKubernetesVersions returns the Kubernetes versions compatible with the Talos version of the plan, the latest first.
+func (plan *InitPlan) CompatibleKubernetesVersions(ctx context.Context, st state.State) ([]string, error) {
+	talosVersion, err := safe.StateGetByID[*omni.TalosVersion](ctx, st, plan.TalosVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Talos version %q: %w", plan.TalosVersion, err)
+	}
+
+	return sortVersions(talosVersion.TypedSpec().Value.GetCompatibleKubernetesVersions()), nil
+}
+
+// pickVersions picks the Talos and Kubernetes versions, the empty versions default to the latest stable ones.
+func (plan *InitPlan) pickVersions(ctx context.Context, st state.State, talosVersion, kubernetesVersion string) error {
+	talosVersions, err := safe.StateListAll[*omni.TalosVersion](ctx, st)
+	if err != nil {
+		return fmt.Errorf("error listing Talos versions: %w", err)
+	}
+
+	versions := make([]string, 0, talosVersions.Len())
+
+	for iter := talosVersions.Iterator(); iter.Next(); {
+		versions = append(versions, iter.Value().Metadata().ID())
+	}
+
+	plan.TalosVersions = sortVersions(versions)
+
+	talosVersion = strings.TrimPrefix(talosVersion, "v")
+
+	if talosVersion == "" {
+		talosVersion = latestStable(plan.TalosVersions)
+	}
+
+	if !slices.Contains(plan.TalosVersions, talosVersion) {
+		return fmt.Errorf("talos version %q is not available, available versions: %q", talosVersion, plan.TalosVersions)
+	}
+
+	plan.TalosVersion = talosVersion
+
+	compatible, err := plan.CompatibleKubernetesVersions(ctx, st)
+	if err != nil {
+		return err
+	}
+
+	if len(compatible) == 0 {
+		return fmt.Errorf("talos version %q has no compatible Kubernetes versions", talosVersion)
+	}
+
+	kubernetesVersion = strings.TrimPrefix(kubernetesVersion, "v")
+
+	if kubernetesVersion == "" {
+		kubernetesVersion = latestStable(compatible)
+	}
+
+	if !slices.Contains(compatible, kubernetesVersion) {
+		return fmt.Errorf("kubernetes version %q is not compatible with Talos version %q, compatible versions: %q", kubernetesVersion, talosVersion, compatible)
+	}
+
+	plan.KubernetesVersion = kubernetesVersion
+
+	return nil
+}
+
+// availableMachines lists the available machines matching the selector.
+func availableMachines(ctx context.Context, st state.State, selector string) ([]InitMachine, error) {
+	query := resource.LabelQuery{
+		Terms: []resource.LabelTerm{
+			{Key: omni.MachineStatusLabelAvailable, Op: resource.LabelOpExists},
+		},
+	}
+
+	if selector != "" {
+		selectorQuery, err := labels.ParseQuery(selector)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing selector %q: %w", selector, err)
+		}
+
+		query.Terms = append(query.Terms, selectorQuery.Terms...)
+	}
+
+	machineStatuses, err := safe.StateListAll[*omni.MachineStatus](ctx, st, state.WithLabelQuery(resource.RawLabelQuery(query)))
+	if err != nil {
+		return nil, fmt.Errorf("error listing available machines: %w", err)
+	}
+
+	machines := make([]InitMachine, 0, machineStatuses.Len())
+
+	for iter := machineStatuses.Iterator(); iter.Next(); {
+		machineStatus := iter.Value()
+
+		machine := InitMachine{
+			ID: machineStatus.Metadata().ID(),
+		}
+
+		if cores, ok := machineStatus.Metadata().Labels().Get(omni.MachineStatusLabelCores); ok {
+			machine.Cores, _ = strconv.Atoi(cores) //nolint:errcheck
+		}
+
+		if memory, ok := machineStatus.Metadata().Labels().Get(omni.MachineStatusLabelMem); ok {
+			machine.Memory, _ = humanize.ParseBytes(memory) //nolint:errcheck
+		}
+
+		machines = append(machines, machine)
+	}
+
+	return machines, nil
+}
+
+func hardwareUnknown(m InitMachine) int {
+	if m.Cores == 0 || m.Memory == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// sortVersions sorts the versions from the latest to the oldest, the versions which are not semver are dropped.
+func sortVersions(versions []string) []string {
+	parsed := make([]semver.Version, 0, len(versions))
+
+	for _, version := range versions {
+		v, err := semver.ParseTolerant(version)
+		if err != nil {
+			continue
+		}
+
+		parsed = append(parsed, v)
+	}
+
+	slices.SortFunc(parsed, func(a, b semver.Version) int {
+		return b.Compare(a)
+	})
+
+	return xslices.Map(parsed, semver.Version.String)
+}
+
+// latestStable returns the first version without the pre-release, or the first version if all are pre-releases.
+func latestStable(sorted []string) string {
+	for _, version := range sorted {
+		if v, err := semver.Parse(version); err == nil && len(v.Pre) == 0 {
+			return version
+		}
+	}
+
+	if len(sorted) == 0 {
+		return ""
+	}
+
+	return sorted[0]
+}
@@ -0,0 +1,165 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/siderolabs/gen/xslices"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	omniresources "github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+// machine IDs of the init test state.
+const (
+	smallMachine     = "1a2b3c4d-0000-4000-8000-000000000001"
+	tinyMachine      = "1a2b3c4d-0000-4000-8000-000000000002"
+	mediumMachine    = "1a2b3c4d-0000-4000-8000-000000000003"
+	largeMachine     = "1a2b3c4d-0000-4000-8000-000000000004"
+	unknownMachine   = "1a2b3c4d-0000-4000-8000-000000000005"
+	armMachine       = "1a2b3c4d-0000-4000-8000-000000000006"
+	allocatedMachine = "1a2b3c4d-0000-4000-8000-000000000007"
+)
+
+func initState(ctx context.Context, t *testing.T) state.State {
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	for _, machine := range []struct {
+		id        string
+		cores     string
+		mem       string
+		available bool
+		arch      string
+	}{
+		{id: smallMachine, cores: "2", mem: "4GiB", available: true, arch: "amd64"},
+		{id: tinyMachine, cores: "1", mem: "1GiB", available: true, arch: "amd64"},
+		{id: mediumMachine, cores: "4", mem: "8GiB", available: true, arch: "amd64"},
+		{id: largeMachine, cores: "16", mem: "64GiB", available: true, arch: "amd64"},
+		{id: unknownMachine, available: true, arch: "amd64"},
+		{id: armMachine, cores: "8", mem: "16GiB", available: true, arch: "arm64"},
+		{id: allocatedMachine, cores: "8", mem: "16GiB", arch: "amd64"},
+	} {
+		machineStatus := omni.NewMachineStatus(omniresources.DefaultNamespace, machine.id)
+		machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelArch, machine.arch)
+
+		if machine.available {
+			machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelAvailable, "")
+		}
+
+		if machine.cores != "" {
+			machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelCores, machine.cores)
+			machineStatus.Metadata().Labels().Set(omni.MachineStatusLabelMem, machine.mem)
+		}
+
+		require.NoError(t, st.Create(ctx, machineStatus))
+	}
+
+	for version, compatible := range map[string][]string{
+		"1.6.4":         {"1.28.5", "1.29.1"},
+		"1.5.5":         {"1.27.4", "1.28.5"},
+		"1.7.0-alpha.0": {"1.29.1", "1.30.0-alpha.1"},
+	} {
+		talosVersion := omni.NewTalosVersion(omniresources.DefaultNamespace, version)
+		talosVersion.TypedSpec().Value.Version = version
+		talosVersion.TypedSpec().Value.CompatibleKubernetesVersions = compatible
+
+		require.NoError(t, st.Create(ctx, talosVersion))
+	}
+
+	return st
+}
+
+func machineIDs(machines []operations.InitMachine) []string {
+	return xslices.Map(machines, func(m operations.InitMachine) string { return m.ID })
+}
+
+func TestPlanInit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := initState(ctx, t)
+
+	plan, err := operations.PlanInit(ctx, st, operations.InitOptions{
+		ClusterName: "init",
+		Selector:    omni.MachineStatusLabelArch + "=amd64",
+		Workers:     -1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.6.4", plan.TalosVersion)
+	assert.Equal(t, "1.29.1", plan.KubernetesVersion)
+	assert.Equal(t, []string{"1.7.0-alpha.0", "1.6.4", "1.5.5"}, plan.TalosVersions)
+
+	// tiny is not capable of running the control plane, unknown hardware goes last
+	assert.Equal(t, []string{smallMachine, mediumMachine, largeMachine}, machineIDs(plan.ControlPlanes))
+	assert.Equal(t, []string{tinyMachine, unknownMachine}, machineIDs(plan.Workers))
+	assert.Empty(t, plan.Unassigned)
+
+	require.NoError(t, plan.Assign(plan.Machines(), 1, 1))
+
+	assert.Equal(t, []string{smallMachine}, machineIDs(plan.ControlPlanes))
+	assert.Equal(t, []string{largeMachine}, machineIDs(plan.Workers))
+	assert.Equal(t, []string{mediumMachine, tinyMachine, unknownMachine}, machineIDs(plan.Unassigned))
+
+	assert.EqualError(t, plan.Assign(plan.Machines(), 5, 0), "5 control plane machines requested, but only 4 available machines have at least 2 cores and 2.0 GiB of memory")
+	assert.EqualError(t, plan.Assign(plan.Machines(), 1, 5), "5 worker machines requested, but only 4 machines are left after the control plane")
+
+	// Kubernetes version is kept if compatible with the new Talos version
+	require.NoError(t, plan.SetTalosVersion(ctx, st, "v1.7.0-alpha.0"))
+	assert.Equal(t, "1.29.1", plan.KubernetesVersion)
+
+	require.NoError(t, plan.SetTalosVersion(ctx, st, "1.5.5"))
+	assert.Equal(t, "1.28.5", plan.KubernetesVersion)
+
+	assert.EqualError(t, plan.SetKubernetesVersion(ctx, st, "1.29.1"),
+		`kubernetes version "1.29.1" is not compatible with Talos version "1.5.5", compatible versions: ["1.28.5" "1.27.4"]`)
+	assert.ErrorContains(t, plan.SetTalosVersion(ctx, st, "1.4.0"), `talos version "1.4.0" is not available`)
+}
+
+func TestInitTemplate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := initState(ctx, t)
+
+	var out strings.Builder
+
+	require.NoError(t, operations.InitTemplate(ctx, st, &out, operations.InitOptions{
+		ClusterName:       "init",
+		KubernetesVersion: "v1.28.5",
+		Selector:          omni.MachineStatusLabelArch + "=amd64",
+		ControlPlanes:     1,
+		Workers:           1,
+	}))
+
+	tmpl, err := template.Load(strings.NewReader(out.String()))
+	require.NoError(t, err)
+	require.NoError(t, tmpl.Validate())
+
+	assert.Contains(t, out.String(), "version: v1.28.5")
+	assert.Contains(t, out.String(), "version: v1.6.4")
+	assert.Contains(t, out.String(), "kind: ControlPlane\nmachines:\n  - "+smallMachine+"\n")
+	assert.Contains(t, out.String(), "kind: Workers\nmachines:\n  - "+largeMachine+"\n")
+	assert.NotContains(t, out.String(), tinyMachine)
+	assert.NotContains(t, out.String(), armMachine)
+	assert.NotContains(t, out.String(), allocatedMachine)
+
+	_, err = operations.PlanInit(ctx, st, operations.InitOptions{ClusterName: "init", Selector: omni.MachineStatusLabelArch + "=riscv64"})
+	assert.EqualError(t, err, "no available machines match the selector")
+
+	_, err = operations.PlanInit(ctx, st, operations.InitOptions{ClusterName: "init", KubernetesVersion: "1.27.4"})
+	assert.ErrorContains(t, err, `kubernetes version "1.27.4" is not compatible with Talos version "1.6.4"`)
+}
@@ -6,6 +6,7 @@ package statustree
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fatih/color"
 
@@ -202,3 +203,69 @@ func machineSetName(machineSet *omni.MachineSetStatus) string {
 
 	return "Additional Workers"
 }
+
+func errorString(err string) string {
+	if err == "" {
+		return ""
+	}
+
+	return " " + color.RedString("Error: %s", err)
+}
+
+func timestampString(prefix string, t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+
+	return prefix + " " + t.UTC().Format(time.RFC3339)
+}
+
+func manifestsOutOfSyncString(outOfSync int32) string {
+	if outOfSync == 0 {
+		return color.GreenString("In Sync")
+	}
+
+	return color.HiYellowString("%d Out of Sync", outOfSync)
+}
+
+func etcdBackupStatusString(status specs.EtcdBackupStatusSpec_Status) string {
+	statusString := status.String()
+
+	var c func(string, ...any) string
+
+	switch status {
+	case specs.EtcdBackupStatusSpec_Ok:
+		c = color.GreenString
+	case specs.EtcdBackupStatusSpec_Running:
+		c = color.HiYellowString
+	case specs.EtcdBackupStatusSpec_Error:
+		c = color.HiRedString
+	case specs.EtcdBackupStatusSpec_Unknown:
+		c = color.YellowString
+	default:
+		c = fmt.Sprintf
+	}
+
+	return c(statusString)
+}
+
+func imagePullString(processed, total uint32) string {
+	if processed >= total {
+		return color.GreenString("Done")
+	}
+
+	return color.HiYellowString("Pulling")
+}
+
+func ongoingTaskString(task *specs.OngoingTaskSpec) string {
+	switch details := task.GetDetails().(type) {
+	case *specs.OngoingTaskSpec_TalosUpgrade:
+		return fmt.Sprintf("%s %s", talosUpgradePhaseString(details.TalosUpgrade.GetPhase()), details.TalosUpgrade.GetStep())
+	case *specs.OngoingTaskSpec_KubernetesUpgrade:
+		return fmt.Sprintf("%s %s", kubernetesUpgradePhaseString(details.KubernetesUpgrade.GetPhase()), details.KubernetesUpgrade.GetStep())
+	case *specs.OngoingTaskSpec_Destroy:
+		return color.HiRedString(details.Destroy.GetPhase())
+	default:
+		return ""
+	}
+}
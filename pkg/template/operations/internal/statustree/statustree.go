@@ -11,6 +11,7 @@ import (
 
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/fatih/color"
+	"github.com/xlab/treeprint"
 
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 )
@@ -79,16 +80,108 @@ func (t NodeWrapper) String() string {
 			color.YellowString("Load Balancer"),
 			readyString(node.TypedSpec().Value.Healthy),
 		)
+	case *omni.KubernetesStatus:
+		nodes := node.TypedSpec().Value.GetNodes()
+		ready := 0
+
+		for _, n := range nodes {
+			if n.GetReady() {
+				ready++
+			}
+		}
+
+		return fmt.Sprintf(
+			"%s %s (%d/%d) (ready/total nodes)",
+			color.YellowString("Kubernetes"),
+			readyString(len(nodes) > 0 && ready == len(nodes)),
+			ready,
+			len(nodes),
+		)
+	case *omni.KubernetesUpgradeManifestStatus:
+		return fmt.Sprintf(
+			"%s %s%s",
+			color.YellowString("Manifests"),
+			manifestsOutOfSyncString(node.TypedSpec().Value.OutOfSync),
+			errorString(node.TypedSpec().Value.LastFatalError),
+		)
+	case *omni.EtcdBackupStatus:
+		return fmt.Sprintf(
+			"%s %s%s%s",
+			color.YellowString("Etcd Backup"),
+			etcdBackupStatusString(node.TypedSpec().Value.Status),
+			timestampString(" last backup", node.TypedSpec().Value.GetLastBackupTime().AsTime()),
+			errorString(node.TypedSpec().Value.Error),
+		)
+	case *omni.ImagePullStatus:
+		return fmt.Sprintf(
+			"%s %s (%d/%d) (pulled/total images)%s",
+			color.YellowString("Image Pull"),
+			imagePullString(node.TypedSpec().Value.ProcessedCount, node.TypedSpec().Value.TotalCount),
+			node.TypedSpec().Value.ProcessedCount,
+			node.TypedSpec().Value.TotalCount,
+			errorString(node.TypedSpec().Value.LastProcessedError),
+		)
+	case *omni.OngoingTask:
+		return fmt.Sprintf(
+			"%s %q %s",
+			color.YellowString("Task"),
+			node.TypedSpec().Value.Title,
+			ongoingTaskString(node.TypedSpec().Value),
+		)
 	default:
 		return resource.String(t.Resource)
 	}
 }
 
+// AddDetails adds the leaves which are not resources to the tree of the node, e.g. the Kubernetes nodes.
+func (t NodeWrapper) AddDetails(tree treeprint.Tree) {
+	node, ok := t.Resource.(*omni.KubernetesStatus)
+	if !ok {
+		return
+	}
+
+	staticPods := map[string][]string{}
+
+	for _, nodeStaticPods := range node.TypedSpec().Value.GetStaticPods() {
+		for _, pod := range nodeStaticPods.GetStaticPods() {
+			staticPods[nodeStaticPods.GetNodename()] = append(staticPods[nodeStaticPods.GetNodename()],
+				fmt.Sprintf("%s %s %s", pod.GetApp(), pod.GetVersion(), readyString(pod.GetReady())))
+		}
+	}
+
+	for _, n := range node.TypedSpec().Value.GetNodes() {
+		branch := tree.AddBranch(fmt.Sprintf(
+			"%s %q %s %s",
+			color.YellowString("Node"),
+			n.GetNodename(),
+			n.GetKubeletVersion(),
+			readyString(n.GetReady()),
+		))
+
+		for _, pod := range staticPods[n.GetNodename()] {
+			branch.AddNode(pod)
+		}
+	}
+}
+
 // IsParentOf allows to find parent-child relationships between resources.
 func (t NodeWrapper) IsParentOf(r resource.Resource) bool {
 	switch node := t.Resource.(type) {
 	case *omni.ClusterStatus:
-		return r.Metadata().Type() == omni.MachineSetStatusType || r.Metadata().Type() == omni.KubernetesUpgradeStatusType || r.Metadata().Type() == omni.TalosUpgradeStatusType
+		switch r.Metadata().Type() {
+		case omni.MachineSetStatusType,
+			omni.KubernetesUpgradeStatusType,
+			omni.TalosUpgradeStatusType,
+			omni.KubernetesStatusType,
+			omni.EtcdBackupStatusType,
+			omni.ImagePullStatusType,
+			omni.OngoingTaskType:
+			return true
+		}
+
+		return false
+	case *omni.KubernetesStatus:
+		return r.Metadata().Type() == omni.KubernetesUpgradeManifestStatusType
 	case *omni.MachineSetStatus:
 		_, isControlPlane := node.Metadata().Labels().Get(omni.LabelControlPlaneRole)
 		if isControlPlane && r.Metadata().Type() == omni.ControlPlaneStatusType {
@@ -115,18 +208,28 @@ func resourceTypeOrder(resourceType resource.Type) int {
 	switch resourceType {
 	case omni.ClusterStatusType:
 		return 0
-	case omni.KubernetesUpgradeStatusType:
+	case omni.OngoingTaskType:
 		return 1
-	case omni.TalosUpgradeStatusType:
+	case omni.KubernetesUpgradeStatusType:
 		return 2
-	case omni.MachineSetStatusType:
+	case omni.TalosUpgradeStatusType:
 		return 3
-	case omni.LoadBalancerStatusType:
+	case omni.KubernetesStatusType:
 		return 4
-	case omni.ControlPlaneStatusType:
+	case omni.KubernetesUpgradeManifestStatusType:
 		return 5
-	case omni.ClusterMachineStatusType:
+	case omni.EtcdBackupStatusType:
 		return 6
+	case omni.ImagePullStatusType:
+		return 7
+	case omni.MachineSetStatusType:
+		return 8
+	case omni.LoadBalancerStatusType:
+		return 9
+	case omni.ControlPlaneStatusType:
+		return 10
+	case omni.ClusterMachineStatusType:
+		return 11
 	default:
 		panic("unknown resource type " + resourceType)
 	}
@@ -70,14 +70,19 @@ func RenderDiff(w io.Writer, oldR, newR resource.Resource) error {
 		newPath = "/dev/null"
 	}
 
-	edits := myers.ComputeEdits(span.URIFromPath(oldPath), string(oldYaml), string(newYaml))
-	diff := gotextdiff.ToUnified(oldPath, newPath, string(oldYaml), edits)
-
-	outputDiff(w, diff)
+	RenderTextDiff(w, oldPath, newPath, string(oldYaml), string(newYaml))
 
 	return nil
 }
 
+// RenderTextDiff outputs colorized line-based diff between two texts.
+func RenderTextDiff(w io.Writer, oldPath, newPath, oldText, newText string) {
+	edits := myers.ComputeEdits(span.URIFromPath(oldPath), oldText, newText)
+	diff := gotextdiff.ToUnified(oldPath, newPath, oldText, edits)
+
+	outputDiff(w, diff)
+}
+
 func outputDiff(w io.Writer, u gotextdiff.Unified) {
 	if len(u.Hunks) == 0 {
 		return
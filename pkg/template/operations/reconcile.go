@@ -0,0 +1,596 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// DefaultMinSyncInterval is the default minimum interval between the syncs of the reconciler.
+const DefaultMinSyncInterval = 10 * time.Second
+
+// loadTimeout bounds the loading of the templates by the reconciler.
+//
+// The evaluation of a Jsonnet template can't be interrupted, so a template which doesn't finish in time
+// fails the sync and keeps evaluating in the background, see template.EvaluateJsonnet.
+// The templates are loaded once per sync, so the syncs rate limit such evaluations.
+const loadTimeout = time.Minute
+
+// ReconcileOptions configures the continuous reconcile of the templates.
+type ReconcileOptions struct {
+	// Sync configures the sync of each cluster, set Sync.DryRun to only report the changes.
+	Sync SyncOptions
+
+	// Fleet configures the parallelism of the sync.
+	Fleet FleetOptions
+
+	// MinSyncInterval rate limits the syncs, defaults to DefaultMinSyncInterval.
+	//
+	// Changes coming in faster are coalesced into a single sync.
+	MinSyncInterval time.Duration
+
+	// ResyncInterval forces a sync even if no changes were observed, zero disables the periodic sync.
+	ResyncInterval time.Duration
+
+	// Jsonnet are the variables of the Jsonnet templates of the directory.
+	Jsonnet template.JsonnetOptions
+}
+
+// ReconcileHealth is the outcome of the latest sync of the reconciler.
+type ReconcileHealth struct {
+	// LastSync is the time the latest sync finished.
+	LastSync time.Time `json:"lastSync"`
+
+	// Clusters maps the cluster name to "ok", or to the error of the latest sync of the cluster.
+	Clusters map[string]string `json:"clusters,omitempty"`
+
+	// Error is the error loading the templates.
+	Error string `json:"error,omitempty"`
+
+	// Syncs is the number of the syncs done.
+	Syncs int `json:"syncs"`
+
+	// DryRun is set if the reconciler only reports the changes.
+	DryRun bool `json:"dryRun"`
+}
+
+// Healthy returns true if the latest sync succeeded for all clusters.
+func (health ReconcileHealth) Healthy() bool {
+	if health.Syncs == 0 || health.Error != "" {
+		return false
+	}
+
+	for _, result := range health.Clusters {
+		if result != "ok" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Reconciler continuously syncs the templates of the directory to Omni.
+//
+// The templates are loaded as a fleet, see template.LoadFleetDir, and synced whenever the template files,
+// the files referenced by the templates (see Template.Files) or the resources managed by the templates change.
+// The changes made by the sync itself don't trigger another sync.
+// Clusters removed from the directory are not destroyed, use DeleteTemplate for that.
+type Reconciler struct {
+	st     state.State
+	logger *zap.Logger
+
+	// managed clusters by name, as of the latest sync
+	managed map[string]struct{}
+	pending chan string
+
+	// writes of the latest sync: resource versions written by the sync, and the resources torn down by it
+	written  map[string]resource.Version
+	deleted  map[string]struct{}
+	observed []state.Event
+
+	// watcher of the template directory and of the directories of the files referenced by the templates
+	watcher *fsnotify.Watcher
+	watched map[string]struct{}
+
+	dir    string
+	digest string
+	// files referenced by the templates loaded by the latest sync
+	files   []string
+	options ReconcileOptions
+	health  ReconcileHealth
+
+	mu      sync.Mutex
+	syncing bool
+}
+
+// NewReconciler creates a reconciler of the templates in the directory.
+func NewReconciler(dir string, st state.State, logger *zap.Logger, options ReconcileOptions) *Reconciler {
+	if options.MinSyncInterval == 0 {
+		options.MinSyncInterval = DefaultMinSyncInterval
+	}
+
+	return &Reconciler{
+		st:      st,
+		logger:  logger,
+		dir:     dir,
+		options: options,
+		managed: map[string]struct{}{},
+		written: map[string]resource.Version{},
+		deleted: map[string]struct{}{},
+		watched: map[string]struct{}{},
+		pending: make(chan string, 1),
+		health:  ReconcileHealth{DryRun: options.Sync.DryRun},
+	}
+}
+
+// Health returns the outcome of the latest sync.
+func (r *Reconciler) Health() ReconcileHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.health
+}
+
+// ServeHTTP implements http.Handler, it serves the health of the reconciler as JSON.
+//
+// The status code is 200 if the latest sync succeeded, 503 otherwise.
+func (r *Reconciler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	health := r.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !health.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(health) //nolint:errcheck,errchkjson
+}
+
+// Run syncs the templates until the context is canceled.
+func (r *Reconciler) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close() //nolint:errcheck
+
+	if err = watcher.Add(r.dir); err != nil {
+		return fmt.Errorf("error watching %q: %w", r.dir, err)
+	}
+
+	r.mu.Lock()
+	r.watcher = watcher
+	r.mu.Unlock()
+
+	watchCh := make(chan state.Event)
+
+	for _, resourceType := range template.ResourceTypes() {
+		if err = r.st.WatchKind(ctx, resource.NewMetadata(resources.DefaultNamespace, resourceType, "", resource.VersionUndefined), watchCh); err != nil {
+			return err
+		}
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		return r.watch(ctx, watcher, watchCh)
+	})
+
+	eg.Go(func() error {
+		return r.syncLoop(ctx)
+	})
+
+	if err = eg.Wait(); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
+
+// watch requests a sync on the changes of the templates and of the managed resources.
+func (r *Reconciler) watch(ctx context.Context, watcher *fsnotify.Watcher, watchCh <-chan state.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-watcher.Events:
+			// the events of the other files, and the events which don't change the templates (e.g. chmod) are ignored
+			loadedDigest, files := r.loaded()
+
+			if digest, err := fleetDigest(r.dir, files); err == nil && digest == loadedDigest {
+				continue
+			}
+
+			r.logger.Debug("template changed", zap.String("file", event.Name), zap.Stringer("op", event.Op))
+
+			r.requestSync("template changed")
+		case err := <-watcher.Errors:
+			return fmt.Errorf("template directory watch failed: %w", err)
+		case event := <-watchCh:
+			switch event.Type {
+			case state.Errored:
+				return fmt.Errorf("resource watch failed: %w", event.Error)
+			case state.Created, state.Updated, state.Destroyed:
+				if !r.isManaged(event.Resource) || r.ignoreEvent(event) {
+					continue
+				}
+
+				r.logger.Debug("resource changed", zap.String("resource", resource.String(event.Resource)), zap.Stringer("event", event.Type))
+
+				r.requestSync("resource changed")
+			case state.Bootstrapped:
+				// ignore
+			}
+		}
+	}
+}
+
+// syncLoop runs the requested syncs, rate limited.
+func (r *Reconciler) syncLoop(ctx context.Context) error {
+	limiter := rate.NewLimiter(rate.Every(r.options.MinSyncInterval), 1)
+
+	var resyncCh <-chan time.Time
+
+	if r.options.ResyncInterval > 0 {
+		ticker := time.NewTicker(r.options.ResyncInterval)
+		defer ticker.Stop()
+
+		resyncCh = ticker.C
+	}
+
+	r.requestSync("startup")
+
+	for {
+		var reason string
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resyncCh:
+			reason = "periodic resync"
+		case reason = <-r.pending:
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		// changes observed while waiting are covered by this sync
+		select {
+		case <-r.pending:
+		default:
+		}
+
+		r.sync(ctx, reason)
+	}
+}
+
+func (r *Reconciler) requestSync(reason string) {
+	select {
+	case r.pending <- reason:
+	default:
+		// sync is already pending
+	}
+}
+
+func (r *Reconciler) isManaged(res resource.Resource) bool {
+	clusterName := res.Metadata().ID()
+
+	if res.Metadata().Type() != omni.ClusterType {
+		clusterName, _ = res.Metadata().Labels().Get(omni.LabelCluster)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.managed[clusterName]
+
+	return ok
+}
+
+// ignoreEvent checks if the resource event is caused by the sync.
+//
+// The events observed while the sync is running are deferred until it finishes, as the writes are recorded after they are done.
+func (r *Reconciler) ignoreEvent(event state.Event) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.syncing {
+		r.observed = append(r.observed, event)
+
+		return true
+	}
+
+	return r.isOwnWrite(event)
+}
+
+func (r *Reconciler) isOwnWrite(event state.Event) bool {
+	key := resourceKey(event.Resource.Metadata())
+
+	if _, ok := r.deleted[key]; ok && (event.Type == state.Destroyed || event.Resource.Metadata().Phase() == resource.PhaseTearingDown) {
+		return true
+	}
+
+	version, ok := r.written[key]
+
+	return ok && event.Type != state.Destroyed && version.Equal(event.Resource.Metadata().Version())
+}
+
+// loaded returns the digest of the files loaded by the latest sync, and the files referenced by the templates.
+func (r *Reconciler) loaded() (string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.digest, r.files
+}
+
+func (r *Reconciler) sync(ctx context.Context, reason string) {
+	logger := r.logger.With(zap.String("reason", reason), zap.Bool("dry_run", r.options.Sync.DryRun))
+	logger.Info("sync started")
+
+	start := time.Now()
+	health := ReconcileHealth{DryRun: r.options.Sync.DryRun}
+
+	_, loadedFiles := r.loaded()
+
+	// the digest is taken before loading, so that the changes made while loading trigger another sync
+	digest, _ := fleetDigest(r.dir, loadedFiles) //nolint:errcheck
+
+	r.mu.Lock()
+	r.syncing = true
+	r.digest = digest
+	r.written = map[string]resource.Version{}
+	r.deleted = map[string]struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		health.LastSync = time.Now()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		health.Syncs = r.health.Syncs + 1
+		r.health = health
+
+		// the changes made by others while the sync was running need another sync
+		r.syncing = false
+
+		for _, event := range r.observed {
+			if !r.isOwnWrite(event) {
+				r.requestSync("resource changed")
+
+				break
+			}
+		}
+
+		r.observed = nil
+	}()
+
+	loadCtx, cancel := context.WithTimeout(ctx, loadTimeout)
+	templates, err := template.LoadFleetDir(loadCtx, r.dir, r.options.Jsonnet)
+
+	cancel()
+
+	if err != nil {
+		logger.Error("failed to load templates", zap.Error(err))
+
+		health.Error = err.Error()
+
+		return
+	}
+
+	var (
+		managed = make(map[string]struct{}, len(templates))
+		files   []string
+	)
+
+	for _, tmpl := range templates {
+		clusterName, _ := tmpl.ClusterName() //nolint:errcheck
+
+		managed[clusterName] = struct{}{}
+		files = append(files, tmpl.Files()...)
+	}
+
+	r.mu.Lock()
+	r.managed = managed
+	r.files = files
+	r.mu.Unlock()
+
+	r.watchFiles(files)
+
+	var out bytes.Buffer
+
+	results, _ := FleetSync(ctx, templates, &out, &recordingState{State: r.st, reconciler: r}, r.options.Fleet, r.options.Sync) //nolint:errcheck
+
+	logger.Debug("sync report", zap.String("report", out.String()))
+
+	health.Clusters = make(map[string]string, len(results))
+
+	for _, result := range results {
+		if result.Err != nil {
+			logger.Error("cluster sync failed", zap.String("cluster", result.Cluster), zap.Error(result.Err))
+
+			health.Clusters[result.Cluster] = result.Err.Error()
+
+			continue
+		}
+
+		logger.Info("cluster synced", zap.String("cluster", result.Cluster))
+
+		health.Clusters[result.Cluster] = "ok"
+	}
+
+	logger.Info("sync finished", zap.Int("clusters", len(results)), zap.Duration("duration", time.Since(start)))
+}
+
+// recordingState records the writes of the sync, so that the reconciler ignores the resource events caused by them.
+type recordingState struct {
+	state.State
+
+	reconciler *Reconciler
+}
+
+func (st *recordingState) Create(ctx context.Context, res resource.Resource, opts ...state.CreateOption) error {
+	if err := st.State.Create(ctx, res, opts...); err != nil {
+		return err
+	}
+
+	st.reconciler.recordWrite(res.Metadata())
+
+	return nil
+}
+
+func (st *recordingState) Update(ctx context.Context, res resource.Resource, opts ...state.UpdateOption) error {
+	if err := st.State.Update(ctx, res, opts...); err != nil {
+		return err
+	}
+
+	st.reconciler.recordWrite(res.Metadata())
+
+	return nil
+}
+
+func (st *recordingState) Teardown(ctx context.Context, ptr resource.Pointer, opts ...state.TeardownOption) (bool, error) {
+	st.reconciler.recordDelete(ptr)
+
+	return st.State.Teardown(ctx, ptr, opts...)
+}
+
+func (st *recordingState) Destroy(ctx context.Context, ptr resource.Pointer, opts ...state.DestroyOption) error {
+	st.reconciler.recordDelete(ptr)
+
+	return st.State.Destroy(ctx, ptr, opts...)
+}
+
+func (r *Reconciler) recordWrite(md *resource.Metadata) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.written[resourceKey(md)] = md.Version()
+}
+
+func (r *Reconciler) recordDelete(ptr resource.Pointer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleted[resourceKey(ptr)] = struct{}{}
+}
+
+func resourceKey(ptr resource.Pointer) string {
+	return ptr.Type() + "/" + ptr.Namespace() + "/" + ptr.ID()
+}
+
+// watchFiles watches the directories of the files, so that the changes of the files referenced by the templates trigger a sync.
+//
+// The directories are watched instead of the files to pick up the files replaced by the editors, and the files created later.
+func (r *Reconciler) watchFiles(files []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.watcher == nil {
+		return
+	}
+
+	dirs := map[string]struct{}{}
+
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dirs[filepath.Clean(path)] = struct{}{}
+
+			continue
+		}
+
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+
+	for dir := range r.watched {
+		if _, ok := dirs[dir]; !ok {
+			r.watcher.Remove(dir) //nolint:errcheck
+
+			delete(r.watched, dir)
+		}
+	}
+
+	for dir := range dirs {
+		if _, ok := r.watched[dir]; ok || dir == filepath.Clean(r.dir) {
+			continue
+		}
+
+		if err := r.watcher.Add(dir); err != nil {
+			r.logger.Warn("failed to watch the directory of the referenced files", zap.String("dir", dir), zap.Error(err))
+
+			continue
+		}
+
+		r.watched[dir] = struct{}{}
+	}
+}
+
+// fleetDigest returns the digest of the template files in the directory and of the files referenced by the templates.
+//
+// The digest covers the names and the contents of the files, the missing files and the entries of the directories.
+// The templates are not loaded, as the evaluation of the Jsonnet templates might be expensive.
+func fleetDigest(dir string, referenced []string) (string, error) {
+	files, err := template.FleetDirFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	files = append(files, referenced...)
+
+	hash := sha256.New()
+
+	for _, path := range files {
+		info, err := os.Stat(path)
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(hash, "%s\x00missing\x00", path)
+		case info.IsDir():
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(hash, "%s\x00dir\x00%d\x00", path, len(entries))
+
+			for _, entry := range entries {
+				fmt.Fprintf(hash, "%s\x00", entry.Name())
+			}
+		default:
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(hash, "%s\x00%d\x00", path, len(contents))
+			hash.Write(contents)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,293 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+func TestReconciler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cluster.yaml")
+
+	writeTemplate := func(somaxconn string) {
+		require.NoError(t, os.WriteFile(path, []byte(strings.NewReplacer("SOMAXCONN", somaxconn, "KEEPALIVE", "600").Replace(rolloutClusterTemplate)), 0o644))
+	}
+
+	writeTemplate("128")
+
+	reconciler := operations.NewReconciler(dir, st, zaptest.NewLogger(t), operations.ReconcileOptions{
+		MinSyncInterval: 10 * time.Millisecond,
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- reconciler.Run(ctx)
+	}()
+
+	// initial sync
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "128")
+	assertSyncedEventually(t, reconciler)
+
+	rec := httptest.NewRecorder()
+	reconciler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"rollout-test":"ok"`)
+
+	// template change is synced once, the changes made by the sync don't trigger another sync
+	syncs := reconciler.Health().Syncs
+
+	writeTemplate("256")
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "256")
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, syncs+1, reconciler.Health().Syncs)
+
+	// changes of the other files, and the changes which don't affect the templates are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644))
+	require.NoError(t, os.Chmod(path, 0o600))
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, syncs+1, reconciler.Health().Syncs)
+
+	// drift of the managed resource is reverted
+	patches, err := safe.StateListAll[*omni.ConfigPatch](ctx, st, state.WithLabelQuery(resource.LabelEqual(omni.LabelMachineSet, rolloutControlPlanes)))
+	require.NoError(t, err)
+	require.Equal(t, 1, patches.Len())
+
+	_, err = safe.StateUpdateWithConflicts(ctx, st, patches.Get(0).Metadata(), func(patch *omni.ConfigPatch) error {
+		patch.TypedSpec().Value.Data = "machine: {}\n"
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "256")
+
+	// JSON templates are watched as well
+	dec := yaml.NewDecoder(strings.NewReader(strings.NewReplacer("SOMAXCONN", "512", "KEEPALIVE", "600").Replace(rolloutClusterTemplate)))
+
+	var docs []any
+
+	for {
+		var doc any
+
+		if err = dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.NoError(t, err)
+
+		docs = append(docs, doc)
+	}
+
+	jsonTemplate, err := json.Marshal(docs)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster.json"), jsonTemplate, 0o644))
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "512")
+
+	path = filepath.Join(dir, "cluster.json")
+
+	// broken template makes the reconciler unhealthy
+	require.NoError(t, os.WriteFile(path, []byte("kind: Cluster\nname: [\n"), 0o644))
+
+	require.Eventually(t, func() bool {
+		return reconciler.Health().Error != ""
+	}, 10*time.Second, 10*time.Millisecond)
+
+	rec = httptest.NewRecorder()
+	reconciler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	cancel()
+
+	require.NoError(t, <-errCh)
+}
+
+const reconcileReferencesTemplate = `kind: Cluster
+name: rollout-test
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+---
+kind: ControlPlane
+machines:
+  - 4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a
+patches:
+  - name: cp-sysctls
+    file: patches/cp-sysctls.yaml
+---
+kind: Workers
+machines:
+  - 7e0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c
+patches:
+  - name: workers-sysctls
+    inline:
+      machine:
+        sysctls:
+          net.core.somaxconn:
+            secretRef:
+              file: secrets/somaxconn
+`
+
+func TestReconcilerReferencedFiles(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+	dir := t.TempDir()
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "patches"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0o755))
+
+	writePatch := func(somaxconn string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "patches", "cp-sysctls.yaml"), []byte("machine:\n  sysctls:\n    net.core.somaxconn: \""+somaxconn+"\"\n"), 0o644))
+	}
+
+	writeSecret := func(somaxconn string) {
+		// replace the file, as the editors do
+		tmp := filepath.Join(dir, "secrets", ".somaxconn.tmp")
+
+		require.NoError(t, os.WriteFile(tmp, []byte(somaxconn+"\n"), 0o644))
+		require.NoError(t, os.Rename(tmp, filepath.Join(dir, "secrets", "somaxconn")))
+	}
+
+	writePatch("128")
+	writeSecret("128")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster.yaml"), []byte(reconcileReferencesTemplate), 0o644))
+
+	reconciler := operations.NewReconciler(dir, st, zaptest.NewLogger(t), operations.ReconcileOptions{
+		MinSyncInterval: 10 * time.Millisecond,
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- reconciler.Run(ctx)
+	}()
+
+	// the relative paths are resolved against the template directory
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "128")
+	assertPatchEventually(ctx, t, st, rolloutWorkers, "128")
+	assertSyncedEventually(t, reconciler)
+
+	// the changes of the referenced files trigger a sync
+	writePatch("256")
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "256")
+
+	writeSecret("512")
+
+	assertPatchEventually(ctx, t, st, rolloutWorkers, "512")
+
+	assert.True(t, reconciler.Health().Healthy())
+
+	cancel()
+
+	require.NoError(t, <-errCh)
+}
+
+func TestReconcilerJsonnet(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+	dir := t.TempDir()
+
+	writeSomaxconn := func(somaxconn string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "somaxconn.libsonnet"), []byte("'"+somaxconn+"'\n"), 0o644))
+	}
+
+	writeSomaxconn("128")
+
+	// the template file is not a fleet file by itself, it's imported by the Jsonnet template
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster.tmpl"), []byte(rolloutClusterTemplate), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cluster.jsonnet"), []byte(`local somaxconn = import 'somaxconn.libsonnet';
+
+std.parseYaml(std.strReplace(std.strReplace(importstr 'cluster.tmpl', 'SOMAXCONN', somaxconn), 'KEEPALIVE', std.extVar('keepalive')))
+`), 0o644))
+
+	reconciler := operations.NewReconciler(dir, st, zaptest.NewLogger(t), operations.ReconcileOptions{
+		MinSyncInterval: 10 * time.Millisecond,
+		Jsonnet: template.JsonnetOptions{
+			ExtVars: map[string]string{"keepalive": "600"},
+		},
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- reconciler.Run(ctx)
+	}()
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "128")
+	assertSyncedEventually(t, reconciler)
+
+	// the changes of the imported files trigger a sync
+	writeSomaxconn("256")
+
+	assertPatchEventually(ctx, t, st, rolloutControlPlanes, "256")
+
+	assert.True(t, reconciler.Health().Healthy())
+
+	cancel()
+
+	require.NoError(t, <-errCh)
+}
+
+// assertSyncedEventually waits for the sync which created the resources to finish.
+func assertSyncedEventually(t *testing.T, reconciler *operations.Reconciler) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return reconciler.Health().Syncs > 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func assertPatchEventually(ctx context.Context, t *testing.T, st state.State, machineSetID, expected string) {
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		patches, err := safe.StateListAll[*omni.ConfigPatch](ctx, st, state.WithLabelQuery(resource.LabelEqual(omni.LabelMachineSet, machineSetID)))
+		if !assert.NoError(collect, err) || !assert.Equal(collect, 1, patches.Len()) {
+			return
+		}
+
+		assert.Contains(collect, patches.Get(0).TypedSpec().Value.GetData(), "net.core.somaxconn: \""+expected+"\"")
+	}, 10*time.Second, 10*time.Millisecond)
+}
@@ -5,16 +5,32 @@
 package operations
 
 import (
+	"cmp"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 
 	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/siderolabs/gen/xslices"
+	"github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configpatcher"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
 	"gopkg.in/yaml.v3"
 
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 	"github.com/siderolabs/omni-client/pkg/template"
 )
 
+// redactedSecret replaces the secrets in the rendered machine configuration.
+const redactedSecret = "******"
+
 // RenderTemplate outputs the rendered template to the given output.
+//
+// The template is rendered offline, so the resources which depend on the Omni state are skipped: the schematic configurations,
+// and the install disk and network patches of the machines with the disk and link selectors.
 func RenderTemplate(templateReader io.Reader, output io.Writer) error {
 	tmpl, err := template.Load(templateReader)
 	if err != nil {
@@ -25,7 +41,7 @@ func RenderTemplate(templateReader io.Reader, output io.Writer) error {
 		return err
 	}
 
-	resources, err := tmpl.Translate()
+	resources, err := tmpl.TranslateOffline()
 	if err != nil {
 		return fmt.Errorf("error rendering template: %w", err)
 	}
@@ -46,3 +62,148 @@ func RenderTemplate(templateReader io.Reader, output io.Writer) error {
 
 	return nil
 }
+
+// RenderMachineConfig outputs the effective Talos machine configuration of the machine in the template.
+//
+// The template patches which apply to the machine are applied in the weight order to a generated base configuration
+// for the Talos and Kubernetes versions of the template. The secrets in the output are redacted.
+//
+// The template is rendered offline, so the install disk and network patches of the machines with the disk and link selectors are skipped.
+//
+//nolint:gocognit,gocyclo,cyclop
+func RenderMachineConfig(templateReader io.Reader, output io.Writer, machineID string) error {
+	tmpl, err := template.Load(templateReader)
+	if err != nil {
+		return fmt.Errorf("error loading template: %w", err)
+	}
+
+	if err = tmpl.Validate(); err != nil {
+		return err
+	}
+
+	resources, err := tmpl.TranslateOffline()
+	if err != nil {
+		return fmt.Errorf("error rendering template: %w", err)
+	}
+
+	var (
+		cluster        *omni.Cluster
+		machineSetNode *omni.MachineSetNode
+		machineSets    = map[resource.ID]*omni.MachineSet{}
+		configPatches  []*omni.ConfigPatch
+	)
+
+	for _, r := range resources {
+		switch res := r.(type) {
+		case *omni.Cluster:
+			cluster = res
+		case *omni.MachineSet:
+			machineSets[res.Metadata().ID()] = res
+		case *omni.MachineSetNode:
+			if res.Metadata().ID() == machineID {
+				machineSetNode = res
+			}
+		case *omni.ConfigPatch:
+			configPatches = append(configPatches, res)
+		}
+	}
+
+	if machineSetNode == nil {
+		return fmt.Errorf("machine %q is not used in the template machine sets", machineID)
+	}
+
+	machineSetID, _ := machineSetNode.Metadata().Labels().Get(omni.LabelMachineSet)
+
+	machineSet, ok := machineSets[machineSetID]
+	if !ok {
+		return fmt.Errorf("machine set %q of the machine %q not found", machineSetID, machineID)
+	}
+
+	machineType := machine.TypeWorker
+	if _, isControlPlane := machineSet.Metadata().Labels().Get(omni.LabelControlPlaneRole); isControlPlane {
+		machineType = machine.TypeControlPlane
+	}
+
+	configPatches = xslices.Filter(configPatches, func(patch *omni.ConfigPatch) bool {
+		if clusterMachine, ok := patch.Metadata().Labels().Get(omni.LabelClusterMachine); ok {
+			return clusterMachine == machineID
+		}
+
+		if patchMachineSet, ok := patch.Metadata().Labels().Get(omni.LabelMachineSet); ok {
+			return patchMachineSet == machineSetID
+		}
+
+		return true
+	})
+
+	// patches are applied as cluster, machine set, cluster machine patches, and in the weight order within each group,
+	// patch IDs are prefixed with the zero-padded weight
+	slices.SortFunc(configPatches, func(a, b *omni.ConfigPatch) int {
+		return cmp.Or(
+			cmp.Compare(patchPrecedence(a), patchPrecedence(b)),
+			strings.Compare(a.Metadata().ID(), b.Metadata().ID()),
+		)
+	})
+
+	versionContract, err := config.ParseContractFromVersion("v" + cluster.TypedSpec().Value.TalosVersion)
+	if err != nil {
+		return fmt.Errorf("error parsing Talos version: %w", err)
+	}
+
+	input, err := generate.NewInput(
+		cluster.Metadata().ID(),
+		fmt.Sprintf("https://%s.omni.invalid:6443", cluster.Metadata().ID()),
+		cluster.TypedSpec().Value.KubernetesVersion,
+		generate.WithVersionContract(versionContract),
+	)
+	if err != nil {
+		return fmt.Errorf("error generating base config: %w", err)
+	}
+
+	baseConfig, err := input.Config(machineType)
+	if err != nil {
+		return fmt.Errorf("error generating base config: %w", err)
+	}
+
+	patches := make([]configpatcher.Patch, 0, len(configPatches))
+
+	for _, configPatch := range configPatches {
+		patch, err := configpatcher.LoadPatch([]byte(configPatch.TypedSpec().Value.GetData()))
+		if err != nil {
+			return fmt.Errorf("error loading config patch %q: %w", configPatch.Metadata().ID(), err)
+		}
+
+		patches = append(patches, patch)
+	}
+
+	patched, err := configpatcher.Apply(configpatcher.WithConfig(baseConfig), patches)
+	if err != nil {
+		return fmt.Errorf("error applying config patches: %w", err)
+	}
+
+	patchedConfig, err := patched.Config()
+	if err != nil {
+		return fmt.Errorf("error loading patched config: %w", err)
+	}
+
+	raw, err := patchedConfig.RedactSecrets(redactedSecret).EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+
+	_, err = output.Write(raw)
+
+	return err
+}
+
+func patchPrecedence(patch *omni.ConfigPatch) int {
+	if _, ok := patch.Metadata().Labels().Get(omni.LabelClusterMachine); ok {
+		return 2
+	}
+
+	if _, ok := patch.Metadata().Labels().Get(omni.LabelMachineSet); ok {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,119 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	_ "embed"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+//go:embed testdata/render/cluster-template.yaml
+var renderClusterTemplate string
+
+func TestRenderTemplate(t *testing.T) {
+	var sb strings.Builder
+
+	// the workers use the disk and link selectors and the system extensions, which can't be resolved offline
+	require.NoError(t, operations.RenderTemplate(strings.NewReader(renderClusterTemplate), &sb))
+
+	decoder := yaml.NewDecoder(strings.NewReader(sb.String()))
+
+	var rendered []string
+
+	for {
+		var doc struct {
+			Metadata struct {
+				Type string `yaml:"type"`
+				ID   string `yaml:"id"`
+			} `yaml:"metadata"`
+		}
+
+		if err := decoder.Decode(&doc); err != nil {
+			require.ErrorIs(t, err, io.EOF)
+
+			break
+		}
+
+		rendered = append(rendered, doc.Metadata.Type+"/"+doc.Metadata.ID)
+	}
+
+	assert.Equal(t, []string{
+		"Clusters.omni.sidero.dev/render-test",
+		"ConfigPatches.omni.sidero.dev/200-cluster-render-test-cluster-hostname",
+		"MachineSets.omni.sidero.dev/render-test-control-planes",
+		"MachineSetNodes.omni.sidero.dev/4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a",
+		"ConfigPatches.omni.sidero.dev/400-render-test-control-planes-cp-hostname",
+		"MachineSets.omni.sidero.dev/render-test-workers",
+		"MachineSetNodes.omni.sidero.dev/7e0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c",
+		"ConfigPatches.omni.sidero.dev/000-cm-4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a-install-disk",
+		"ConfigPatches.omni.sidero.dev/400-cm-4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a-machine-hostname",
+	}, rendered)
+}
+
+func TestRenderMachineConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		machineID        string
+		expectedType     string
+		expectedHostname string
+		expectedDisk     string
+	}{
+		{
+			name:             "control plane",
+			machineID:        "4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a",
+			expectedType:     "controlplane",
+			expectedHostname: "machine",
+			expectedDisk:     "/dev/vda",
+		},
+		{
+			name:             "worker",
+			machineID:        "7e0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c",
+			expectedType:     "worker",
+			expectedHostname: "cluster",
+			expectedDisk:     "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+
+			require.NoError(t, operations.RenderMachineConfig(strings.NewReader(renderClusterTemplate), &sb, tt.machineID))
+
+			var cfg struct {
+				Machine struct {
+					Type    string `yaml:"type"`
+					Token   string `yaml:"token"`
+					Install struct {
+						Disk string `yaml:"disk"`
+					} `yaml:"install"`
+					Network struct {
+						Hostname string `yaml:"hostname"`
+						KubeSpan struct {
+							Enabled bool `yaml:"enabled"`
+						} `yaml:"kubespan"`
+					} `yaml:"network"`
+				} `yaml:"machine"`
+			}
+
+			require.NoError(t, yaml.Unmarshal([]byte(sb.String()), &cfg))
+
+			assert.Equal(t, tt.expectedType, cfg.Machine.Type)
+			assert.Equal(t, tt.expectedHostname, cfg.Machine.Network.Hostname)
+			assert.Equal(t, tt.expectedDisk, cfg.Machine.Install.Disk)
+			assert.True(t, cfg.Machine.Network.KubeSpan.Enabled)
+			assert.Equal(t, "******", cfg.Machine.Token)
+		})
+	}
+
+	err := operations.RenderMachineConfig(strings.NewReader(renderClusterTemplate), &strings.Builder{}, "8f0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c")
+	require.EqualError(t, err, `machine "8f0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c" is not used in the template machine sets`)
+}
@@ -0,0 +1,149 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/fatih/color"
+
+	"github.com/siderolabs/omni-client/pkg/template"
+	"github.com/siderolabs/omni-client/pkg/template/operations/internal/utils"
+)
+
+// rollbackTimeout limits the time spent on the rollback.
+//
+// Rollback runs even if the sync context is canceled, so that an interrupted sync doesn't leave the cluster half-updated.
+const rollbackTimeout = 5 * time.Minute
+
+// syncJournal records the changes applied by the sync, so that they can be rolled back.
+//
+// Deletions are not rolled back: once the teardown of a resource starts, Omni resets the machines it owns,
+// so recreating the resource from the snapshot doesn't restore the cluster. They are listed in the rollback report instead.
+type syncJournal struct {
+	entries  []journalEntry
+	tornDown []resource.Resource
+}
+
+// journalEntry is either a created resource, or an update with the snapshot of the resource before the sync.
+type journalEntry struct {
+	created resource.Resource
+	updated template.UpdateChange
+}
+
+func (journal *syncJournal) recordCreate(r resource.Resource) {
+	journal.entries = append(journal.entries, journalEntry{created: r})
+}
+
+func (journal *syncJournal) recordUpdate(p template.UpdateChange) {
+	journal.entries = append(journal.entries, journalEntry{updated: p})
+}
+
+// recordDelete records the resource being torn down, nil journal is used when nothing is rolled back.
+func (journal *syncJournal) recordDelete(r resource.Resource) {
+	if journal == nil {
+		return
+	}
+
+	journal.tornDown = append(journal.tornDown, r)
+}
+
+func (journal *syncJournal) empty() bool {
+	return len(journal.entries) == 0 && len(journal.tornDown) == 0
+}
+
+// rollback reverts the applied changes in the reverse order and prints the rollback report.
+//
+// Created resources are destroyed, and updated resources are restored to the pre-sync state.
+// The torn down resources are reported as not restorable, and the rollback is incomplete if there are any.
+func (journal *syncJournal) rollback(ctx context.Context, syncErr error, out io.Writer, st state.State) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	red := color.New(color.FgRed)
+	green := color.New(color.FgGreen)
+	boldFunc := color.New(color.Bold).SprintfFunc()
+
+	red.Fprintf(out, "! sync failed: %s\n", syncErr)                                //nolint:errcheck
+	red.Fprintf(out, "! rolling back %d applied change(s)\n", len(journal.entries)) //nolint:errcheck
+
+	var (
+		rollbackErrs []error
+		notRestored  []string
+	)
+
+	// deletions run last, so they are reported first
+	for i := len(journal.tornDown) - 1; i >= 0; i-- {
+		r := journal.tornDown[i]
+
+		red.Fprintf(out, "  ! %s is not restorable, it was torn down\n", boldFunc(utils.Describe(r))) //nolint:errcheck
+
+		notRestored = append(notRestored, utils.Describe(r))
+	}
+
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+
+		var (
+			action string
+			r      resource.Resource
+			err    error
+		)
+
+		if entry.created != nil {
+			action, r = "destroyed", entry.created
+			err = syncDeleteResources(ctx, []resource.Resource{entry.created}, nil, io.Discard, st, SyncOptions{})
+		} else {
+			action, r = "restored", entry.updated.Old
+			err = restoreResource(ctx, st, entry.updated.Old)
+		}
+
+		if err != nil {
+			red.Fprintf(out, "  ! failed to roll back %s: %s\n", boldFunc(utils.Describe(r)), err) //nolint:errcheck
+
+			rollbackErrs = append(rollbackErrs, fmt.Errorf("error rolling back %s: %w", utils.Describe(r), err))
+
+			continue
+		}
+
+		green.Fprintf(out, "  * %s %s\n", action, boldFunc(utils.Describe(r))) //nolint:errcheck
+	}
+
+	if len(rollbackErrs) > 0 || len(notRestored) > 0 {
+		red.Fprintf(out, "! rollback incomplete, %d change(s) failed to roll back, %d torn down resource(s) are not restorable\n", //nolint:errcheck
+			len(rollbackErrs), len(notRestored))
+
+		if len(notRestored) > 0 {
+			rollbackErrs = append(rollbackErrs, fmt.Errorf("torn down resources are not restorable: %s", strings.Join(notRestored, ", ")))
+		}
+
+		return errors.Join(fmt.Errorf("sync failed: %w", syncErr), fmt.Errorf("rollback failed: %w", errors.Join(rollbackErrs...)))
+	}
+
+	green.Fprintf(out, "* rollback complete\n") //nolint:errcheck
+
+	return fmt.Errorf("sync failed, applied changes were rolled back: %w", syncErr)
+}
+
+// restoreResource updates the resource back to the snapshot.
+func restoreResource(ctx context.Context, st state.State, snapshot resource.Resource) error {
+	current, err := st.Get(ctx, snapshot.Metadata())
+	if err != nil {
+		return err
+	}
+
+	restored := snapshot.DeepCopy()
+	restored.Metadata().SetVersion(current.Metadata().Version())
+	restored.Metadata().Finalizers().Set(*current.Metadata().Finalizers())
+
+	return st.Update(ctx, restored)
+}
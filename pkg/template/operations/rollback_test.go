@@ -0,0 +1,178 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	omniresources "github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+const rollbackMachinePatch = `---
+kind: Machine
+name: 4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a
+patches:
+  - name: machine-hostname
+    inline:
+      machine:
+        network:
+          hostname: machine
+`
+
+const rollbackGPUWorkers = `---
+kind: Workers
+name: gpu
+machines:
+  - 9c1d2e3f-4a5b-4c6d-8e7f-0a1b2c3d4e5f
+patches:
+  - name: gpu-sysctls
+    inline:
+      machine:
+        sysctls:
+          vm.nr_hugepages: "1024"
+`
+
+// failingState fails updates of the resources of the machine set, or the teardown of the resource.
+type failingState struct {
+	state.State
+
+	failMachineSet string
+	failTeardown   resource.ID
+}
+
+func (st *failingState) Update(ctx context.Context, r resource.Resource, opts ...state.UpdateOption) error {
+	if machineSet, _ := r.Metadata().Labels().Get(omni.LabelMachineSet); st.failMachineSet != "" && machineSet == st.failMachineSet {
+		return errors.New("update rejected")
+	}
+
+	return st.State.Update(ctx, r, opts...)
+}
+
+func (st *failingState) Teardown(ctx context.Context, ptr resource.Pointer, opts ...state.TeardownOption) (bool, error) {
+	if ptr.ID() == st.failTeardown {
+		return false, errors.New("teardown rejected")
+	}
+
+	return st.State.Teardown(ctx, ptr, opts...)
+}
+
+func TestSyncRollback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	for _, tt := range []struct {
+		name       string
+		noRollback bool
+	}{
+		{
+			name: "rollback",
+		},
+		{
+			name:       "no rollback",
+			noRollback: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+			require.NoError(t, operations.SyncTemplate(ctx, rolloutTemplate("128", "600"), &strings.Builder{}, st, operations.SyncOptions{}))
+
+			// patches are updated in the order of IDs, so the control plane patch is updated before the workers patch fails
+			failing := &failingState{State: st, failMachineSet: rolloutWorkers}
+
+			template := strings.NewReplacer("SOMAXCONN", "256", "KEEPALIVE", "600").Replace(rolloutClusterTemplate) + rollbackMachinePatch
+
+			var sb strings.Builder
+
+			syncErr := operations.SyncTemplate(ctx, strings.NewReader(template), &sb, failing, operations.SyncOptions{NoRollback: tt.noRollback})
+			require.Error(t, syncErr)
+			assert.ErrorContains(t, syncErr, "update rejected")
+
+			machinePatches, err := safe.StateListAll[*omni.ConfigPatch](ctx, st, state.WithLabelQuery(resource.LabelExists(omni.LabelClusterMachine)))
+			require.NoError(t, err)
+
+			if tt.noRollback {
+				assert.NotContains(t, sb.String(), "rolling back")
+
+				assert.Equal(t, 1, machinePatches.Len())
+				assertSomaxconn(ctx, t, st, rolloutControlPlanes, "256")
+				assertSomaxconn(ctx, t, st, rolloutWorkers, "128")
+
+				return
+			}
+
+			assert.ErrorContains(t, syncErr, "applied changes were rolled back")
+
+			output := sb.String()
+
+			assert.Contains(t, output, "rolling back 2 applied change(s)")
+			assert.Contains(t, output, "rollback complete")
+
+			// changes are rolled back in the reverse order
+			assert.Less(t, strings.Index(output, "restored ConfigPatch"), strings.Index(output, "destroyed ConfigPatch"))
+
+			assert.Equal(t, 0, machinePatches.Len())
+			assertSomaxconn(ctx, t, st, rolloutControlPlanes, "128")
+			assertSomaxconn(ctx, t, st, rolloutWorkers, "128")
+		})
+	}
+}
+
+func TestSyncRollbackTeardown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	template := strings.NewReplacer("SOMAXCONN", "128", "KEEPALIVE", "600").Replace(rolloutClusterTemplate)
+
+	require.NoError(t, operations.SyncTemplate(ctx, strings.NewReader(template+rollbackGPUWorkers), &strings.Builder{}, st, operations.SyncOptions{}))
+
+	// the machine set is destroyed in the first deletion phase, and the teardown of its patch fails in the second one
+	failing := &failingState{State: st, failTeardown: "400-rollout-test-gpu-gpu-sysctls"}
+
+	var sb strings.Builder
+
+	syncErr := operations.SyncTemplate(ctx, strings.NewReader(strings.ReplaceAll(template, `"128"`, `"256"`)), &sb, failing, operations.SyncOptions{})
+	require.Error(t, syncErr)
+	assert.ErrorContains(t, syncErr, "teardown rejected")
+	assert.ErrorContains(t, syncErr, "torn down resources are not restorable: MachineSets.omni.sidero.dev(rollout-test-gpu)")
+
+	output := sb.String()
+
+	assert.Contains(t, output, "destroyed MachineSets.omni.sidero.dev(rollout-test-gpu)")
+	assert.Contains(t, output, "tearing down ConfigPatches.omni.sidero.dev(400-rollout-test-gpu-gpu-sysctls)")
+	assert.Contains(t, output, "rolling back 2 applied change(s)")
+	assert.Contains(t, output, "MachineSets.omni.sidero.dev(rollout-test-gpu) is not restorable, it was torn down")
+	assert.Contains(t, output, "rollback incomplete, 0 change(s) failed to roll back, 1 torn down resource(s) are not restorable")
+	assert.NotContains(t, output, "recreated")
+
+	// the destroyed machine set is not recreated, and the patch which failed to tear down is left as is
+	_, err := safe.StateGet[*omni.MachineSet](ctx, st, omni.NewMachineSet(omniresources.DefaultNamespace, "rollout-test-gpu").Metadata())
+	require.True(t, state.IsNotFoundError(err))
+
+	patch, err := safe.StateGet[*omni.ConfigPatch](ctx, st, omni.NewConfigPatch(omniresources.DefaultNamespace, "400-rollout-test-gpu-gpu-sysctls").Metadata())
+	require.NoError(t, err)
+
+	assert.Equal(t, resource.PhaseRunning, patch.Metadata().Phase())
+
+	// the updates are restored
+	assertSomaxconn(ctx, t, st, rolloutControlPlanes, "128")
+	assertSomaxconn(ctx, t, st, rolloutWorkers, "128")
+}
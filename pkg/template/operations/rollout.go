@@ -0,0 +1,449 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/fatih/color"
+	"github.com/siderolabs/gen/maps"
+	"github.com/siderolabs/gen/xslices"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// DefaultStageTimeout is the default deadline for the health gate of each rollout stage.
+const DefaultStageTimeout = 15 * time.Minute
+
+// RolloutOptions configures the staged rollout of the template changes.
+type RolloutOptions struct {
+	// Staged enables the staged rollout: changes are applied one machine set at a time,
+	// and the next stage starts only after the machine sets of the previous one become healthy.
+	Staged bool
+
+	// ControlPlaneLast rolls out the control plane machine set after the workers, by default it goes first.
+	ControlPlaneLast bool
+
+	// StageTimeout is the deadline for the health gate of each stage, defaults to DefaultStageTimeout.
+	StageTimeout time.Duration
+}
+
+// rolloutStage is a set of changes applied together, followed by the health gate.
+type rolloutStage struct {
+	// machineSets gated after the stage is applied.
+	machineSets []resource.ID
+	create      []resource.Resource
+	update      []template.UpdateChange
+}
+
+func (stage *rolloutStage) empty() bool {
+	return len(stage.create) == 0 && len(stage.update) == 0
+}
+
+// planRollout splits the creates and updates of the sync result into stages, one per machine set.
+//
+// Cluster-wide changes (the cluster itself and the cluster patches) affect every machine set, so they can't be split:
+// they are applied in the last stage, after all machine set stages pass the health gate, and the health gate of that stage covers all machine sets.
+// If the cluster is being created, there is nothing to stage, so all changes are applied in a single stage.
+func planRollout(tmpl *template.Template, syncResult *template.SyncResult, options RolloutOptions) ([]*rolloutStage, error) {
+	expectedResources, err := tmpl.Translate()
+	if err != nil {
+		return nil, err
+	}
+
+	var controlPlaneSet resource.ID
+
+	machineSetStages := map[resource.ID]*rolloutStage{}
+	machineSets := map[resource.ID]resource.ID{}
+
+	for _, r := range expectedResources {
+		switch r.Metadata().Type() {
+		case omni.MachineSetType:
+			machineSetStages[r.Metadata().ID()] = &rolloutStage{machineSets: []resource.ID{r.Metadata().ID()}}
+
+			if _, ok := r.Metadata().Labels().Get(omni.LabelControlPlaneRole); ok {
+				controlPlaneSet = r.Metadata().ID()
+			}
+		case omni.MachineSetNodeType:
+			machineSets[r.Metadata().ID()], _ = r.Metadata().Labels().Get(omni.LabelMachineSet)
+		}
+	}
+
+	clusterStage := &rolloutStage{}
+
+	stageOf := func(r resource.Resource) *rolloutStage {
+		var machineSetID resource.ID
+
+		switch r.Metadata().Type() {
+		case omni.MachineSetType:
+			machineSetID = r.Metadata().ID()
+		case omni.MachineSetNodeType, omni.ConfigPatchType:
+			machineSetID, _ = r.Metadata().Labels().Get(omni.LabelMachineSet)
+
+			if clusterMachine, ok := r.Metadata().Labels().Get(omni.LabelClusterMachine); ok && machineSetID == "" {
+				machineSetID = machineSets[clusterMachine]
+			}
+		}
+
+		if stage, ok := machineSetStages[machineSetID]; ok {
+			return stage
+		}
+
+		return clusterStage
+	}
+
+	for _, r := range syncResult.Create {
+		stage := stageOf(r)
+		stage.create = append(stage.create, r)
+	}
+
+	for _, p := range syncResult.Update {
+		stage := stageOf(p.New)
+		stage.update = append(stage.update, p)
+	}
+
+	order := maps.Keys(machineSetStages)
+
+	slices.SortFunc(order, func(a, b resource.ID) int {
+		// control plane goes first or last depending on the options, the rest are sorted by ID
+		switch {
+		case a == b:
+			return 0
+		case a == controlPlaneSet:
+			return controlPlaneOrder(options)
+		case b == controlPlaneSet:
+			return -controlPlaneOrder(options)
+		default:
+			return strings.Compare(a, b)
+		}
+	})
+
+	if slices.ContainsFunc(syncResult.Create, func(r resource.Resource) bool { return r.Metadata().Type() == omni.ClusterType }) {
+		return []*rolloutStage{
+			{
+				machineSets: order,
+				create:      syncResult.Create,
+				update:      syncResult.Update,
+			},
+		}, nil
+	}
+
+	var stages []*rolloutStage
+
+	for _, machineSetID := range order {
+		if stage := machineSetStages[machineSetID]; !stage.empty() {
+			stages = append(stages, stage)
+		}
+	}
+
+	if !clusterStage.empty() {
+		clusterStage.machineSets = order
+
+		stages = append(stages, clusterStage)
+	}
+
+	return stages, nil
+}
+
+// patches returns the config patches of the stage which apply to the machine.
+//
+// Only the patches with the changed data are returned, as the other changes don't affect the machine config.
+func (stage *rolloutStage) patches(machineSetID, machineID resource.ID) []*omni.ConfigPatch {
+	changed := slices.Clone(stage.create)
+
+	for _, p := range stage.update {
+		oldPatch, oldOk := p.Old.(*omni.ConfigPatch)
+		newPatch, newOk := p.New.(*omni.ConfigPatch)
+
+		if oldOk && newOk && oldPatch.TypedSpec().Value.GetData() == newPatch.TypedSpec().Value.GetData() {
+			continue
+		}
+
+		changed = append(changed, p.New)
+	}
+
+	var patches []*omni.ConfigPatch
+
+	for _, r := range changed {
+		patch, ok := r.(*omni.ConfigPatch)
+		if !ok {
+			continue
+		}
+
+		if clusterMachine, ok := patch.Metadata().Labels().Get(omni.LabelClusterMachine); ok && clusterMachine != machineID {
+			continue
+		}
+
+		if machineSet, ok := patch.Metadata().Labels().Get(omni.LabelMachineSet); ok && machineSet != machineSetID {
+			continue
+		}
+
+		patches = append(patches, patch)
+	}
+
+	return patches
+}
+
+func controlPlaneOrder(options RolloutOptions) int {
+	if options.ControlPlaneLast {
+		return 1
+	}
+
+	return -1
+}
+
+// syncStaged applies the stages one by one, waiting for the health gate after each stage.
+func syncStaged(ctx context.Context, clusterName string, stages []*rolloutStage, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
+	cyan := color.New(color.FgCyan)
+	red := color.New(color.FgRed)
+
+	timeout := syncOptions.Rollout.StageTimeout
+	if timeout == 0 {
+		timeout = DefaultStageTimeout
+	}
+
+	for i, stage := range stages {
+		cyan.Fprintf(out, "* stage %d/%d: %s\n", i+1, len(stages), strings.Join(stage.machineSets, ", ")) //nolint:errcheck
+
+		if err := syncCreate(ctx, stage.create, journal, out, st, syncOptions); err != nil {
+			return err
+		}
+
+		if err := syncUpdate(ctx, stage.update, journal, out, st, syncOptions); err != nil {
+			return err
+		}
+
+		if syncOptions.DryRun || len(stage.machineSets) == 0 {
+			continue
+		}
+
+		cyan.Fprintf(out, "* waiting for %s to become healthy\n", strings.Join(stage.machineSets, ", ")) //nolint:errcheck
+
+		if err := waitHealthy(ctx, st, clusterName, stage, timeout); err != nil {
+			red.Fprintf(out, "! rollout stopped at stage %d/%d, %d stage(s) not applied\n", i+1, len(stages), len(stages)-i-1) //nolint:errcheck
+
+			return fmt.Errorf("stage %d/%d: %w", i+1, len(stages), err)
+		}
+	}
+
+	return nil
+}
+
+// waitHealthy waits for the machine sets of the stage to be ready, and for all of their machines to run the config generated with the stage changes.
+//
+// The machine config is up to date when the config patches of the machine were updated after the versions of the stage patches were written,
+// the machine config was generated after the last change of the config patches, and the applied config matches the version and the hash of the generated config.
+//
+//nolint:gocognit,gocyclo,cyclop
+func waitHealthy(ctx context.Context, st state.State, clusterName string, stage *rolloutStage, timeout time.Duration) error {
+	gated := xslices.ToSet(stage.machineSets)
+
+	// the stage patches are matched to the machine config patches by the time their versions were written
+	written, err := writtenPatches(ctx, st, stage)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watchCh := make(chan state.Event)
+
+	resourceTypes := []resource.Type{
+		omni.MachineSetStatusType,
+		omni.ClusterMachineStatusType,
+		omni.ClusterMachineConfigPatchesType,
+		omni.ClusterMachineConfigType,
+		omni.ClusterMachineConfigStatusType,
+	}
+
+	for _, resourceType := range resourceTypes {
+		if err = st.WatchKind(
+			ctx,
+			resource.NewMetadata(resources.DefaultNamespace, resourceType, "", resource.VersionUndefined),
+			watchCh,
+			state.WithBootstrapContents(true),
+			state.WatchWithLabelQuery(resource.LabelEqual(omni.LabelCluster, clusterName)),
+		); err != nil {
+			return err
+		}
+	}
+
+	// the statuses of the gated machine sets and of their machines, and the machine config resources of the cluster by type and ID
+	watched := map[resource.Type]map[resource.ID]resource.Resource{}
+
+	for _, resourceType := range resourceTypes {
+		watched[resourceType] = map[resource.ID]resource.Resource{}
+	}
+
+	// the machines of the gated machine sets are found by their statuses, the machine config resources are matched to them by ID
+	tracked := func(r resource.Resource) bool {
+		var machineSetID resource.ID
+
+		switch r.Metadata().Type() {
+		case omni.MachineSetStatusType:
+			machineSetID = r.Metadata().ID()
+		case omni.ClusterMachineStatusType:
+			machineSetID, _ = r.Metadata().Labels().Get(omni.LabelMachineSet)
+		default:
+			return true
+		}
+
+		_, ok := gated[machineSetID]
+
+		return ok
+	}
+
+	pendingBootstraps := len(resourceTypes)
+
+	get := func(resourceType resource.Type, id resource.ID) resource.Resource {
+		return watched[resourceType][id]
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	unhealthy := func() []string {
+		var reasons []string
+
+		for _, machineSetID := range stage.machineSets {
+			machineSetStatus, ok := get(omni.MachineSetStatusType, machineSetID).(*omni.MachineSetStatus)
+
+			switch {
+			case !ok:
+				reasons = append(reasons, fmt.Sprintf("machine set %s has no status", machineSetID))
+			case !machineSetStatus.TypedSpec().Value.Ready:
+				reasons = append(reasons, fmt.Sprintf("machine set %s is not ready", machineSetID))
+			}
+		}
+
+		machineIDs := maps.Keys(watched[omni.ClusterMachineStatusType])
+		slices.Sort(machineIDs)
+
+		for _, id := range machineIDs {
+			clusterMachineStatus, ok := get(omni.ClusterMachineStatusType, id).(*omni.ClusterMachineStatus)
+			if !ok {
+				continue
+			}
+
+			machineSetID, _ := clusterMachineStatus.Metadata().Labels().Get(omni.LabelMachineSet)
+
+			configPatches, _ := get(omni.ClusterMachineConfigPatchesType, id).(*omni.ClusterMachineConfigPatches)
+			config, _ := get(omni.ClusterMachineConfigType, id).(*omni.ClusterMachineConfig)
+			configStatus, _ := get(omni.ClusterMachineConfigStatusType, id).(*omni.ClusterMachineConfigStatus)
+
+			switch {
+			case !patchesObserved(configPatches, stage.patches(machineSetID, id), written):
+				reasons = append(reasons, fmt.Sprintf("machine %s config patches are not updated yet", id))
+			case config == nil || (configPatches != nil && config.Metadata().Updated().Before(configPatches.Metadata().Updated())):
+				reasons = append(reasons, fmt.Sprintf("machine %s config is not generated yet", id))
+			case !configApplied(config, configStatus):
+				reasons = append(reasons, fmt.Sprintf("machine %s config is not applied yet", id))
+			case !clusterMachineStatus.TypedSpec().Value.ConfigUpToDate:
+				reasons = append(reasons, fmt.Sprintf("machine %s config is not up to date", id))
+			}
+		}
+
+		return reasons
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("health gate didn't pass within %s: %s", timeout, strings.Join(unhealthy(), "; "))
+		case event := <-watchCh:
+			switch event.Type {
+			case state.Created, state.Updated:
+				if !tracked(event.Resource) {
+					delete(watched[event.Resource.Metadata().Type()], event.Resource.Metadata().ID())
+
+					continue
+				}
+
+				watched[event.Resource.Metadata().Type()][event.Resource.Metadata().ID()] = event.Resource
+			case state.Destroyed:
+				delete(watched[event.Resource.Metadata().Type()], event.Resource.Metadata().ID())
+			case state.Bootstrapped:
+				pendingBootstraps--
+			case state.Errored:
+				return event.Error
+			}
+		}
+
+		if pendingBootstraps > 0 {
+			continue
+		}
+
+		if len(unhealthy()) == 0 {
+			return nil
+		}
+	}
+}
+
+// writtenPatches returns the update times of the stage patches written by the sync, by ID.
+func writtenPatches(ctx context.Context, st state.State, stage *rolloutStage) (map[resource.ID]time.Time, error) {
+	written := map[resource.ID]time.Time{}
+
+	for _, r := range slices.Concat(stage.create, xslices.Map(stage.update, func(p template.UpdateChange) resource.Resource { return p.New })) {
+		if r.Metadata().Type() != omni.ConfigPatchType {
+			continue
+		}
+
+		patch, err := safe.StateGet[*omni.ConfigPatch](ctx, st, r.Metadata())
+		if err != nil {
+			if state.IsNotFoundError(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		written[patch.Metadata().ID()] = patch.Metadata().Updated()
+	}
+
+	return written, nil
+}
+
+// patchesObserved checks that the config patches of the machine were updated after the written versions of the patches.
+func patchesObserved(configPatches *omni.ClusterMachineConfigPatches, patches []*omni.ConfigPatch, written map[resource.ID]time.Time) bool {
+	for _, patch := range patches {
+		updated, ok := written[patch.Metadata().ID()]
+		if !ok {
+			continue
+		}
+
+		if configPatches == nil || configPatches.Metadata().Updated().Before(updated) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// configApplied checks that the applied config is the generated one, both by the version and by the hash.
+func configApplied(config *omni.ClusterMachineConfig, configStatus *omni.ClusterMachineConfigStatus) bool {
+	if configStatus == nil {
+		return false
+	}
+
+	hash := sha256.Sum256(config.TypedSpec().Value.GetData())
+
+	return configStatus.TypedSpec().Value.ClusterMachineConfigVersion == config.Metadata().Version().String() &&
+		configStatus.TypedSpec().Value.ClusterMachineConfigSha256 == hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,320 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	omniresources "github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+//go:embed testdata/rollout/cluster-template.yaml
+var rolloutClusterTemplate string
+
+const (
+	rolloutControlPlanes = "rollout-test-control-planes"
+	rolloutWorkers       = "rollout-test-workers"
+)
+
+func TestSyncStaged(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	require.NoError(t, operations.SyncTemplate(ctx, rolloutTemplate("128", "600"), &strings.Builder{}, st, operations.SyncOptions{}))
+
+	machines := map[string]string{
+		"4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a": rolloutControlPlanes,
+		"7e0a5b3d-8c5e-4f0a-9d7b-2a6c1e4f5b3c": rolloutWorkers,
+	}
+
+	for machineID, machineSetID := range machines {
+		machineSetStatus := omni.NewMachineSetStatus(omniresources.DefaultNamespace, machineSetID)
+		machineSetStatus.Metadata().Labels().Set(omni.LabelCluster, "rollout-test")
+		machineSetStatus.TypedSpec().Value.Ready = true
+
+		require.NoError(t, st.Create(ctx, machineSetStatus))
+
+		clusterMachineStatus := omni.NewClusterMachineStatus(omniresources.DefaultNamespace, machineID)
+		clusterMachineStatus.Metadata().Labels().Set(omni.LabelCluster, "rollout-test")
+		clusterMachineStatus.Metadata().Labels().Set(omni.LabelMachineSet, machineSetID)
+		clusterMachineStatus.TypedSpec().Value.ConfigUpToDate = true
+
+		require.NoError(t, st.Create(ctx, clusterMachineStatus))
+	}
+
+	var paused, staleHash atomic.Bool
+
+	go simulateConfigPipeline(ctx, st, machines, &paused, &staleHash)
+
+	t.Run("control plane last", func(t *testing.T) {
+		var sb strings.Builder
+
+		require.NoError(t, operations.SyncTemplate(ctx, rolloutTemplate("256", "600"), &sb, st, operations.SyncOptions{
+			Rollout: operations.RolloutOptions{
+				Staged:           true,
+				ControlPlaneLast: true,
+			},
+		}))
+
+		output := sb.String()
+
+		assert.Contains(t, output, "* stage 1/2: "+rolloutWorkers)
+		assert.Contains(t, output, "* stage 2/2: "+rolloutControlPlanes)
+		assert.Less(t, strings.Index(output, "400-"+rolloutWorkers), strings.Index(output, "400-"+rolloutControlPlanes))
+
+		assertSomaxconn(ctx, t, st, rolloutControlPlanes, "256")
+		assertSomaxconn(ctx, t, st, rolloutWorkers, "256")
+	})
+
+	t.Run("config gate", func(t *testing.T) {
+		// the machine sets are ready, but the config with the changes doesn't reach the machines
+		paused.Store(true)
+		defer paused.Store(false)
+
+		var sb strings.Builder
+
+		err := operations.SyncTemplate(ctx, rolloutTemplate("512", "600"), &sb, st, operations.SyncOptions{
+			Rollout: operations.RolloutOptions{
+				Staged:       true,
+				StageTimeout: 500 * time.Millisecond,
+			},
+			NoRollback: true,
+		})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "stage 1/2")
+		assert.ErrorContains(t, err, "machine 4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a config patches are not updated yet")
+
+		assertSomaxconn(ctx, t, st, rolloutControlPlanes, "512")
+		assertSomaxconn(ctx, t, st, rolloutWorkers, "256")
+	})
+
+	t.Run("applied config gate", func(t *testing.T) {
+		// the config version is reported as applied, but the applied config is not the generated one
+		staleHash.Store(true)
+		defer staleHash.Store(false)
+
+		var sb strings.Builder
+
+		err := operations.SyncTemplate(ctx, rolloutTemplate("768", "600"), &sb, st, operations.SyncOptions{
+			Rollout: operations.RolloutOptions{
+				Staged:       true,
+				StageTimeout: 500 * time.Millisecond,
+			},
+			NoRollback: true,
+		})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "stage 1/2")
+		assert.ErrorContains(t, err, "machine 4b3ab7c8-3c6b-4b8d-9a5e-3f1f4c6f1e2a config is not applied yet")
+
+		assertSomaxconn(ctx, t, st, rolloutControlPlanes, "768")
+		assertSomaxconn(ctx, t, st, rolloutWorkers, "256")
+	})
+
+	t.Run("cluster-wide changes last", func(t *testing.T) {
+		var sb strings.Builder
+
+		require.NoError(t, operations.SyncTemplate(ctx, rolloutTemplate("1024", "300"), &sb, st, operations.SyncOptions{
+			Rollout: operations.RolloutOptions{
+				Staged: true,
+			},
+		}))
+
+		output := sb.String()
+
+		assert.Contains(t, output, "* stage 1/3: "+rolloutControlPlanes+"\n")
+		assert.Contains(t, output, "* stage 2/3: "+rolloutWorkers+"\n")
+		assert.Contains(t, output, "* stage 3/3: "+rolloutControlPlanes+", "+rolloutWorkers+"\n")
+		assert.Less(t, strings.Index(output, "400-"+rolloutWorkers), strings.Index(output, "200-cluster-rollout-test-cluster-sysctls"))
+
+		assertSomaxconn(ctx, t, st, rolloutControlPlanes, "1024")
+		assertSomaxconn(ctx, t, st, rolloutWorkers, "1024")
+	})
+
+	t.Run("health gate", func(t *testing.T) {
+		_, err := safe.StateUpdateWithConflicts(ctx, st, omni.NewMachineSetStatus(omniresources.DefaultNamespace, rolloutControlPlanes).Metadata(),
+			func(res *omni.MachineSetStatus) error {
+				res.TypedSpec().Value.Ready = false
+
+				return nil
+			},
+		)
+		require.NoError(t, err)
+
+		for _, noRollback := range []bool{false, true} {
+			var sb strings.Builder
+
+			err = operations.SyncTemplate(ctx, rolloutTemplate("2048", "300"), &sb, st, operations.SyncOptions{
+				Rollout: operations.RolloutOptions{
+					Staged:       true,
+					StageTimeout: 500 * time.Millisecond,
+				},
+				NoRollback: noRollback,
+			})
+			require.Error(t, err)
+			assert.ErrorContains(t, err, "stage 1/2")
+			assert.ErrorContains(t, err, "machine set "+rolloutControlPlanes+" is not ready")
+
+			assert.Contains(t, sb.String(), "rollout stopped at stage 1/2, 1 stage(s) not applied")
+
+			// the rollout didn't proceed to the workers
+			assertSomaxconn(ctx, t, st, rolloutWorkers, "1024")
+
+			if noRollback {
+				assertSomaxconn(ctx, t, st, rolloutControlPlanes, "2048")
+			} else {
+				assertSomaxconn(ctx, t, st, rolloutControlPlanes, "1024")
+			}
+		}
+	})
+}
+
+func rolloutTemplate(somaxconn, keepalive string) *strings.Reader {
+	return strings.NewReader(strings.NewReplacer("SOMAXCONN", somaxconn, "KEEPALIVE", keepalive).Replace(rolloutClusterTemplate))
+}
+
+// simulateConfigPipeline generates and applies the machine configs from the config patches periodically, as the controllers would do.
+//
+// With staleHash set, the applied config hash doesn't match the generated config.
+func simulateConfigPipeline(ctx context.Context, st state.State, machines map[string]string, paused, staleHash *atomic.Bool) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if paused.Load() {
+			continue
+		}
+
+		patches, err := safe.StateListAll[*omni.ConfigPatch](ctx, st, state.WithLabelQuery(resource.LabelEqual(omni.LabelCluster, "rollout-test")))
+		if err != nil {
+			return
+		}
+
+		for machineID, machineSetID := range machines {
+			var machinePatches []string
+
+			for it := patches.Iterator(); it.Next(); {
+				if set, ok := it.Value().Metadata().Labels().Get(omni.LabelMachineSet); ok && set != machineSetID {
+					continue
+				}
+
+				machinePatches = append(machinePatches, it.Value().TypedSpec().Value.GetData())
+			}
+
+			configPatches := omni.NewClusterMachineConfigPatches(omniresources.DefaultNamespace, machineID)
+			config := omni.NewClusterMachineConfig(omniresources.DefaultNamespace, machineID)
+			configStatus := omni.NewClusterMachineConfigStatus(omniresources.DefaultNamespace, machineID)
+
+			// the machine config resources are labeled with the cluster only
+			for _, r := range []resource.Resource{configPatches, config, configStatus} {
+				r.Metadata().Labels().Set(omni.LabelCluster, "rollout-test")
+
+				st.Create(ctx, r) //nolint:errcheck
+			}
+
+			modify := func(r resource.Resource, update func(r resource.Resource) bool) resource.Resource {
+				current, err := st.Get(ctx, r.Metadata())
+				if err != nil {
+					return r
+				}
+
+				r = current.DeepCopy()
+				if !update(r) {
+					return current
+				}
+
+				if err = st.Update(ctx, r); err != nil {
+					return current
+				}
+
+				updated, err := st.Get(ctx, r.Metadata())
+				if err != nil {
+					return current
+				}
+
+				return updated
+			}
+
+			modify(configPatches, func(r resource.Resource) bool {
+				spec := r.(*omni.ClusterMachineConfigPatches).TypedSpec().Value //nolint:forcetypeassert,errcheck
+
+				if slices.Equal(spec.Patches, machinePatches) {
+					return false
+				}
+
+				spec.Patches = machinePatches
+
+				return true
+			})
+
+			generated := modify(config, func(r resource.Resource) bool {
+				spec := r.(*omni.ClusterMachineConfig).TypedSpec().Value //nolint:forcetypeassert,errcheck
+				data := []byte(strings.Join(machinePatches, "---\n"))
+
+				if bytes.Equal(spec.Data, data) {
+					return false
+				}
+
+				spec.Data = data
+
+				return true
+			})
+
+			modify(configStatus, func(r resource.Resource) bool {
+				spec := r.(*omni.ClusterMachineConfigStatus).TypedSpec().Value //nolint:forcetypeassert,errcheck
+
+				hash := sha256.Sum256(generated.(*omni.ClusterMachineConfig).TypedSpec().Value.GetData()) //nolint:forcetypeassert,errcheck
+				sha256sum := hex.EncodeToString(hash[:])
+
+				if staleHash.Load() {
+					sha256sum = "stale"
+				}
+
+				if spec.ClusterMachineConfigVersion == generated.Metadata().Version().String() && spec.ClusterMachineConfigSha256 == sha256sum {
+					return false
+				}
+
+				spec.ClusterMachineConfigVersion = generated.Metadata().Version().String()
+				spec.ClusterMachineConfigSha256 = sha256sum
+
+				return true
+			})
+		}
+	}
+}
+
+func assertSomaxconn(ctx context.Context, t *testing.T, st state.State, machineSetID, expected string) {
+	patches, err := safe.StateListAll[*omni.ConfigPatch](ctx, st, state.WithLabelQuery(resource.LabelEqual(omni.LabelMachineSet, machineSetID)))
+	require.NoError(t, err)
+	require.Equal(t, 1, patches.Len())
+
+	assert.Contains(t, patches.Get(0).TypedSpec().Value.GetData(), "net.core.somaxconn: \""+expected+"\"")
+}
@@ -19,7 +19,6 @@ import (
 	"github.com/xlab/treeprint"
 	"golang.org/x/term"
 
-	"github.com/siderolabs/omni-client/api/omni/specs"
 	"github.com/siderolabs/omni-client/pkg/omni/resources"
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 	"github.com/siderolabs/omni-client/pkg/template"
@@ -28,11 +27,58 @@ import (
 
 // StatusOptions configures the status operation.
 type StatusOptions struct {
+	// Format is the output format, defaults to StatusFormatTree.
+	Format StatusFormat
+
+	// Sections are the optional sections of the status tree.
+	Sections StatusSections
+
+	// For are the conditions to wait for instead of the cluster being ready, all of them should hold.
+	For []*StatusCondition
+
 	Wait  bool
 	Quiet bool
 }
 
+// StatusSections enables the optional sections of the status tree.
+//
+// The optional sections don't affect the cluster condition.
+type StatusSections struct {
+	// Kubernetes shows the node readiness, the static pod versions and the manifest sync status.
+	Kubernetes bool
+
+	// EtcdBackup shows the last etcd backup time and the backup errors.
+	EtcdBackup bool
+
+	// ImagePull shows the progress of the image pre-pulling.
+	ImagePull bool
+
+	// Tasks shows the ongoing tasks of the cluster, e.g. upgrades and teardown.
+	Tasks bool
+}
+
+// clusterTypes returns the types of the enabled sections which have the cluster name as the resource ID.
+func (sections StatusSections) clusterTypes() []resource.Type {
+	var types []resource.Type
+
+	if sections.Kubernetes {
+		types = append(types, omni.KubernetesStatusType, omni.KubernetesUpgradeManifestStatusType)
+	}
+
+	if sections.EtcdBackup {
+		types = append(types, omni.EtcdBackupStatusType)
+	}
+
+	if sections.ImagePull {
+		types = append(types, omni.ImagePullStatusType)
+	}
+
+	return types
+}
+
 // StatusTemplate queries, renders and (optionally) waits for the cluster status (health).
+//
+// If the cluster is not ready, or the StatusOptions.For conditions don't hold, *StatusError is returned with the condition of the cluster.
 func StatusTemplate(ctx context.Context, templateReader io.Reader, out io.Writer, st state.State, options StatusOptions) error {
 	tmpl, err := template.Load(templateReader)
 	if err != nil {
@@ -47,6 +93,8 @@ func StatusTemplate(ctx context.Context, templateReader io.Reader, out io.Writer
 }
 
 // StatusCluster queries, renders and (optionally) waits for the cluster status (health).
+//
+// If the cluster is not ready, or the StatusOptions.For conditions don't hold, *StatusError is returned with the condition of the cluster.
 func StatusCluster(ctx context.Context, clusterName string, out io.Writer, st state.State, options StatusOptions) error {
 	tmpl := template.WithCluster(clusterName)
 
@@ -60,14 +108,29 @@ func statusTemplate(ctx context.Context, tmpl *template.Template, out io.Writer,
 		return err
 	}
 
+	switch options.Format {
+	case "":
+		options.Format = StatusFormatTree
+	case StatusFormatTree, StatusFormatJSON, StatusFormatYAML:
+	default:
+		return fmt.Errorf("unknown status format %q", options.Format)
+	}
+
 	// initiate a watch on all resources which are part of the cluster status
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	watchCh := make(chan state.Event)
 
-	if err = st.Watch(ctx, omni.NewClusterStatus(resources.DefaultNamespace, clusterName).Metadata(), watchCh); err != nil {
-		return err
+	// resources with the cluster name as ID are watched directly, the first event is the current state (Destroyed if missing)
+	pendingWatches := map[resource.Type]struct{}{}
+
+	for _, resourceType := range append([]resource.Type{omni.ClusterStatusType}, options.Sections.clusterTypes()...) {
+		if err = st.Watch(ctx, resource.NewMetadata(resources.DefaultNamespace, resourceType, clusterName, resource.VersionUndefined), watchCh); err != nil {
+			return err
+		}
+
+		pendingWatches[resourceType] = struct{}{}
 	}
 
 	resourceTypes := []resource.Type{
@@ -77,6 +140,7 @@ func statusTemplate(ctx context.Context, tmpl *template.Template, out io.Writer,
 		omni.KubernetesUpgradeStatusType,
 		omni.TalosUpgradeStatusType,
 		omni.ClusterMachineStatusType,
+		omni.ClusterMachineConfigStatusType,
 	}
 
 	for _, resourceType := range resourceTypes {
@@ -91,87 +155,135 @@ func statusTemplate(ctx context.Context, tmpl *template.Template, out io.Writer,
 		}
 	}
 
-	resources := map[string]resource.Resource{}
 	pendingBootstraps := len(resourceTypes)
 
+	if options.Sections.Tasks {
+		// ongoing tasks are not labeled with the cluster, so they are filtered by ID
+		if err = st.WatchKind(
+			ctx,
+			resource.NewMetadata(resources.DefaultNamespace, omni.OngoingTaskType, "", resource.VersionUndefined),
+			watchCh,
+			state.WithBootstrapContents(true),
+		); err != nil {
+			return err
+		}
+
+		pendingBootstraps++
+	}
+
+	resources := map[string]resource.Resource{}
+
 	var (
-		clusterBootstrapped, startedRendering, hasUpdates bool
-		prevLines                                         []byte
+		startedRendering, hasUpdates bool
+		prevLines                    []byte
 	)
 
+	// update renders the current status, the structured document is only written once the status is final
+	update := func(final bool) (*StatusError, error) {
+		doc := BuildStatusDocument(clusterName, resources)
+
+		statusErr, err := checkConditions(doc, options.For)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case options.Quiet:
+		case options.Format == StatusFormatTree:
+			newLines := render(resources)
+
+			if err := printStatus(out, prevLines, newLines); err != nil {
+				return nil, err
+			}
+
+			prevLines = newLines
+		case final || statusErr == nil:
+			if err := doc.Encode(out, options.Format); err != nil {
+				return nil, err
+			}
+		}
+
+		return statusErr, nil
+	}
+
 	renderTicker := time.NewTicker(time.Second)
 	defer renderTicker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-renderTicker.C:
-			if !hasUpdates {
-				continue
+			if !startedRendering {
+				return ctx.Err()
 			}
 
-			hasUpdates = false
+			statusErr, updateErr := update(true)
+			if updateErr != nil {
+				return updateErr
+			}
+
+			if statusErr == nil {
+				return nil
+			}
 
-			if options.Quiet {
+			return fmt.Errorf("%w: %w", ctx.Err(), statusErr)
+		case <-renderTicker.C:
+			if !hasUpdates {
 				continue
 			}
 
-			newLines, healthy := render(resources)
+			hasUpdates = false
 
-			if err = printStatus(out, prevLines, newLines); err != nil {
-				return err
+			statusErr, updateErr := update(false)
+			if updateErr != nil {
+				return updateErr
 			}
 
-			prevLines = newLines
-
-			if healthy {
+			if statusErr == nil {
 				// done waiting
 				return nil
 			}
 		case event := <-watchCh:
 			hasUpdates = true
 
+			if event.Type != state.Errored && event.Type != state.Bootstrapped {
+				delete(pendingWatches, event.Resource.Metadata().Type())
+
+				if event.Resource.Metadata().Type() == omni.OngoingTaskType && !isClusterTask(event.Resource, clusterName) {
+					continue
+				}
+			}
+
 			switch event.Type {
 			case state.Errored:
 				return fmt.Errorf("watch failed: %w", event.Error)
 			case state.Bootstrapped:
 				pendingBootstraps--
 			case state.Created, state.Updated:
-				if event.Resource.Metadata().Type() == omni.ClusterStatusType {
-					clusterBootstrapped = true
-				}
-
 				resources[resource.String(event.Resource)] = event.Resource
 			case state.Destroyed:
 				delete(resources, resource.String(event.Resource))
 			}
 
 			// render the initial state once fully bootstrapped
-			if !startedRendering && clusterBootstrapped && pendingBootstraps == 0 {
+			if !startedRendering && len(pendingWatches) == 0 && pendingBootstraps == 0 {
 				startedRendering = true
 			} else {
 				continue
 			}
 
-			newLines, healthy := render(resources)
-
-			if !options.Quiet {
-				if err = printStatus(out, prevLines, newLines); err != nil {
-					return err
-				}
+			hasUpdates = false
 
-				prevLines = newLines
+			statusErr, updateErr := update(!options.Wait)
+			if updateErr != nil {
+				return updateErr
 			}
 
-			hasUpdates = false
-
-			if healthy {
+			if statusErr == nil {
 				return nil
 			}
 
 			if !options.Wait {
-				return fmt.Errorf("cluster is not healthy")
+				return statusErr
 			}
 		}
 	}
@@ -190,33 +302,36 @@ func expandTree(tree treeprint.Tree, item statustree.NodeWrapper, resources map[
 
 	for _, item := range nextLevel {
 		subtree := tree.AddBranch(item)
+		item.AddDetails(subtree)
 		expandTree(subtree, item, resources)
 	}
 }
 
+// isClusterTask returns true if the ongoing task belongs to the cluster.
+//
+// The tasks are matched by the cluster label, or by the ID which is the cluster name, optionally prefixed with the task kind.
+func isClusterTask(task resource.Resource, clusterName string) bool {
+	if cluster, ok := task.Metadata().Labels().Get(omni.LabelCluster); ok {
+		return cluster == clusterName
+	}
+
+	id := task.Metadata().ID()
+
+	return id == clusterName || strings.HasSuffix(id, "-"+clusterName)
+}
+
 // render builds a tree of resources and renders it to the buffer.
-func render(resources map[string]resource.Resource) ([]byte, bool) {
+func render(resources map[string]resource.Resource) []byte {
 	var clusterStatus *omni.ClusterStatus
 
-	healthy := true
-
 	for _, r := range resources {
-		switch item := r.(type) {
-		case *omni.ClusterStatus:
+		if item, ok := r.(*omni.ClusterStatus); ok {
 			clusterStatus = item
-
-			healthy = healthy && item.TypedSpec().Value.Phase == specs.ClusterStatusSpec_RUNNING && item.TypedSpec().Value.Ready
-		case *omni.MachineSetStatus:
-			healthy = healthy && item.TypedSpec().Value.Phase == specs.MachineSetPhase_Running && item.TypedSpec().Value.Ready
-		case *omni.KubernetesUpgradeStatus:
-			healthy = healthy && item.TypedSpec().Value.Phase == specs.KubernetesUpgradeStatusSpec_Done
-		case *omni.TalosUpgradeStatus:
-			healthy = healthy && item.TypedSpec().Value.Phase == specs.TalosUpgradeStatusSpec_Done
 		}
 	}
 
 	if clusterStatus == nil {
-		return nil, false
+		return nil
 	}
 
 	root := statustree.NodeWrapper{Resource: clusterStatus}
@@ -224,7 +339,7 @@ func render(resources map[string]resource.Resource) ([]byte, bool) {
 
 	expandTree(tree, root, resources)
 
-	return tree.Bytes(), healthy
+	return tree.Bytes()
 }
 
 // printStatus prints the tree to the terminal.
@@ -0,0 +1,377 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+)
+
+// StatusFormat is the format of the cluster status output.
+type StatusFormat string
+
+// Cluster status output formats.
+const (
+	// StatusFormatTree is the colored tree of the cluster resources, updated in place if the output is a terminal.
+	StatusFormatTree StatusFormat = "tree"
+
+	// StatusFormatJSON is the StatusDocument encoded as JSON, written once the status is final.
+	StatusFormatJSON StatusFormat = "json"
+
+	// StatusFormatYAML is the StatusDocument encoded as YAML, written once the status is final.
+	StatusFormatYAML StatusFormat = "yaml"
+)
+
+// ClusterCondition is the overall condition of the cluster.
+type ClusterCondition string
+
+// Cluster conditions.
+const (
+	// ClusterConditionReady means the cluster and all its machine sets are running and ready, and no upgrades are in progress.
+	ClusterConditionReady ClusterCondition = "ready"
+
+	// ClusterConditionNotReady means the cluster is still progressing, e.g. scaling or upgrading.
+	ClusterConditionNotReady ClusterCondition = "notReady"
+
+	// ClusterConditionDegraded means something is failing: a machine set or an upgrade failed, a machine is unreachable
+	// or failed to apply the config, or the control plane checks fail on a running cluster.
+	ClusterConditionDegraded ClusterCondition = "degraded"
+
+	// ClusterConditionNotFound means the cluster doesn't exist.
+	ClusterConditionNotFound ClusterCondition = "notFound"
+)
+
+// Exit codes of the cluster status commands, 1 is left for the other errors.
+const (
+	StatusExitCodeReady    = 0
+	StatusExitCodeNotReady = 2
+	StatusExitCodeDegraded = 3
+	StatusExitCodeNotFound = 4
+)
+
+// ExitCode returns the exit code of the status commands for the condition.
+func (condition ClusterCondition) ExitCode() int {
+	switch condition {
+	case ClusterConditionReady:
+		return StatusExitCodeReady
+	case ClusterConditionDegraded:
+		return StatusExitCodeDegraded
+	case ClusterConditionNotFound:
+		return StatusExitCodeNotFound
+	case ClusterConditionNotReady:
+		return StatusExitCodeNotReady
+	default:
+		return StatusExitCodeNotReady
+	}
+}
+
+// StatusError is returned by the status operations if the cluster is not ready, or the wait conditions don't hold.
+type StatusError struct {
+	Cluster   string
+	Condition ClusterCondition
+
+	// Unmet are the wait conditions which don't hold.
+	Unmet []string
+}
+
+// Error implements error.
+func (err *StatusError) Error() string {
+	if len(err.Unmet) > 0 {
+		return fmt.Sprintf("cluster %q is %s, conditions not met: %s", err.Cluster, err.Condition, strings.Join(err.Unmet, ", "))
+	}
+
+	switch err.Condition {
+	case ClusterConditionNotFound:
+		return fmt.Sprintf("cluster %q not found", err.Cluster)
+	case ClusterConditionDegraded:
+		return fmt.Sprintf("cluster %q is degraded", err.Cluster)
+	case ClusterConditionReady, ClusterConditionNotReady:
+		return "cluster is not healthy"
+	default:
+		return "cluster is not healthy"
+	}
+}
+
+// ExitCode returns the exit code of the status commands for the error.
+//
+// If the wait conditions don't hold on a ready cluster, the cluster is reported as not ready.
+func (err *StatusError) ExitCode() int {
+	if err.Condition == ClusterConditionReady {
+		return StatusExitCodeNotReady
+	}
+
+	return err.Condition.ExitCode()
+}
+
+// StatusDocument is the machine-readable cluster status.
+type StatusDocument struct {
+	Cluster   string           `json:"cluster" yaml:"cluster"`
+	Condition ClusterCondition `json:"condition" yaml:"condition"`
+	Phase     string           `json:"phase,omitempty" yaml:"phase,omitempty"`
+
+	Ready                     bool `json:"ready" yaml:"ready"`
+	KubernetesAPIReady        bool `json:"kubernetesAPIReady" yaml:"kubernetesAPIReady"`
+	ControlPlaneReady         bool `json:"controlPlaneReady" yaml:"controlPlaneReady"`
+	HasConnectedControlPlanes bool `json:"hasConnectedControlPlanes" yaml:"hasConnectedControlPlanes"`
+	LoadBalancerHealthy       bool `json:"loadBalancerHealthy" yaml:"loadBalancerHealthy"`
+
+	// FailingChecks are the failing control plane status checks.
+	FailingChecks []string `json:"failingChecks,omitempty" yaml:"failingChecks,omitempty"`
+
+	Machines    MachineCounts              `json:"machines" yaml:"machines"`
+	MachineSets []MachineSetStatusDocument `json:"machineSets,omitempty" yaml:"machineSets,omitempty"`
+
+	KubernetesUpgrade *UpgradeStatusDocument `json:"kubernetesUpgrade,omitempty" yaml:"kubernetesUpgrade,omitempty"`
+	TalosUpgrade      *UpgradeStatusDocument `json:"talosUpgrade,omitempty" yaml:"talosUpgrade,omitempty"`
+}
+
+// MachineCounts are the machine counters of the cluster or of the machine set.
+type MachineCounts struct {
+	Total     uint32 `json:"total" yaml:"total"`
+	Healthy   uint32 `json:"healthy" yaml:"healthy"`
+	Connected uint32 `json:"connected" yaml:"connected"`
+	Requested uint32 `json:"requested" yaml:"requested"`
+}
+
+// MachineSetStatusDocument is the machine-readable machine set status.
+type MachineSetStatusDocument struct {
+	ID    string `json:"id" yaml:"id"`
+	Role  string `json:"role" yaml:"role"`
+	Phase string `json:"phase" yaml:"phase"`
+	Ready bool   `json:"ready" yaml:"ready"`
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	Counts   MachineCounts           `json:"counts" yaml:"counts"`
+	Machines []MachineStatusDocument `json:"machines,omitempty" yaml:"machines,omitempty"`
+}
+
+// MachineStatusDocument is the machine-readable status of the cluster machine.
+type MachineStatusDocument struct {
+	ID                string `json:"id" yaml:"id"`
+	Stage             string `json:"stage" yaml:"stage"`
+	Ready             bool   `json:"ready" yaml:"ready"`
+	Connected         bool   `json:"connected" yaml:"connected"`
+	ConfigUpToDate    bool   `json:"configUpToDate" yaml:"configUpToDate"`
+	ConfigApplyStatus string `json:"configApplyStatus" yaml:"configApplyStatus"`
+	LastError         string `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	TalosVersion      string `json:"talosVersion,omitempty" yaml:"talosVersion,omitempty"`
+}
+
+// UpgradeStatusDocument is the machine-readable status of the Talos or Kubernetes upgrade.
+type UpgradeStatusDocument struct {
+	Phase          string `json:"phase" yaml:"phase"`
+	Step           string `json:"step,omitempty" yaml:"step,omitempty"`
+	Status         string `json:"status,omitempty" yaml:"status,omitempty"`
+	Error          string `json:"error,omitempty" yaml:"error,omitempty"`
+	CurrentVersion string `json:"currentVersion,omitempty" yaml:"currentVersion,omitempty"`
+	LastVersion    string `json:"lastVersion,omitempty" yaml:"lastVersion,omitempty"`
+}
+
+// Encode writes the document in the format.
+func (doc *StatusDocument) Encode(w io.Writer, format StatusFormat) error {
+	switch format {
+	case StatusFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(doc)
+	case StatusFormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+
+		return enc.Close()
+	case StatusFormatTree:
+		return fmt.Errorf("status document can't be encoded as %q", format)
+	default:
+		return fmt.Errorf("unknown status format %q", format)
+	}
+}
+
+// BuildStatusDocument builds the status document of the cluster from its resources, keyed by resource.String.
+//
+// All resources should belong to the cluster, the resources of other types are ignored.
+//
+//nolint:gocognit,gocyclo,cyclop
+func BuildStatusDocument(clusterName string, resources map[string]resource.Resource) *StatusDocument {
+	doc := &StatusDocument{
+		Cluster:   clusterName,
+		Condition: ClusterConditionNotFound,
+	}
+
+	var (
+		clusterStatus *omni.ClusterStatus
+		ready         = true
+		degraded      bool
+
+		loadBalancerFailing bool
+		machineSets         = map[string]*MachineSetStatusDocument{}
+		machines            []*omni.ClusterMachineStatus
+		talosVersions       = map[string]string{}
+	)
+
+	for _, r := range resources {
+		switch item := r.(type) {
+		case *omni.ClusterStatus:
+			clusterStatus = item
+		case *omni.MachineSetStatus:
+			spec := item.TypedSpec().Value
+
+			role := "worker"
+			if _, ok := item.Metadata().Labels().Get(omni.LabelControlPlaneRole); ok {
+				role = "controlplane"
+			}
+
+			machineSets[item.Metadata().ID()] = &MachineSetStatusDocument{
+				ID:     item.Metadata().ID(),
+				Role:   role,
+				Phase:  spec.Phase.String(),
+				Ready:  spec.Ready,
+				Error:  spec.Error,
+				Counts: machineCounts(spec.GetMachines()),
+			}
+
+			ready = ready && spec.Phase == specs.MachineSetPhase_Running && spec.Ready
+			degraded = degraded || spec.Phase == specs.MachineSetPhase_Failed || spec.Error != ""
+		case *omni.ClusterMachineStatus:
+			machines = append(machines, item)
+		case *omni.ClusterMachineConfigStatus:
+			talosVersions[item.Metadata().ID()] = item.TypedSpec().Value.TalosVersion
+		case *omni.KubernetesUpgradeStatus:
+			spec := item.TypedSpec().Value
+
+			doc.KubernetesUpgrade = &UpgradeStatusDocument{
+				Phase:          spec.Phase.String(),
+				Step:           spec.Step,
+				Status:         spec.Status,
+				Error:          spec.Error,
+				CurrentVersion: spec.CurrentUpgradeVersion,
+				LastVersion:    spec.LastUpgradeVersion,
+			}
+
+			ready = ready && spec.Phase == specs.KubernetesUpgradeStatusSpec_Done
+			degraded = degraded || spec.Phase == specs.KubernetesUpgradeStatusSpec_Failed
+		case *omni.TalosUpgradeStatus:
+			spec := item.TypedSpec().Value
+
+			doc.TalosUpgrade = &UpgradeStatusDocument{
+				Phase:          spec.Phase.String(),
+				Step:           spec.Step,
+				Status:         spec.Status,
+				Error:          spec.Error,
+				CurrentVersion: spec.CurrentUpgradeVersion,
+				LastVersion:    spec.LastUpgradeVersion,
+			}
+
+			ready = ready && spec.Phase == specs.TalosUpgradeStatusSpec_Done
+			degraded = degraded || spec.Phase == specs.TalosUpgradeStatusSpec_Failed
+		case *omni.ControlPlaneStatus:
+			for _, condition := range item.TypedSpec().Value.GetConditions() {
+				if condition.GetStatus() == specs.ControlPlaneStatusSpec_Condition_NotReady {
+					doc.FailingChecks = append(doc.FailingChecks, condition.GetType().String())
+				}
+			}
+		case *omni.LoadBalancerStatus:
+			doc.LoadBalancerHealthy = item.TypedSpec().Value.Healthy
+			loadBalancerFailing = !item.TypedSpec().Value.Healthy && !item.TypedSpec().Value.Stopped
+		}
+	}
+
+	if clusterStatus == nil {
+		return doc
+	}
+
+	spec := clusterStatus.TypedSpec().Value
+
+	doc.Phase = spec.Phase.String()
+	doc.Ready = spec.Ready
+	doc.KubernetesAPIReady = spec.KubernetesAPIReady
+	doc.ControlPlaneReady = spec.ControlplaneReady
+	doc.HasConnectedControlPlanes = spec.HasConnectedControlPlanes
+	doc.Machines = machineCounts(spec.GetMachines())
+
+	ready = ready && spec.Phase == specs.ClusterStatusSpec_RUNNING && spec.Ready
+
+	// the control plane checks and the load balancer are expected to fail while the cluster is being created
+	if spec.Phase == specs.ClusterStatusSpec_RUNNING {
+		degraded = degraded || len(doc.FailingChecks) > 0 || loadBalancerFailing
+	}
+
+	for _, machine := range machines {
+		machineSpec := machine.TypedSpec().Value
+		_, connected := machine.Metadata().Labels().Get(omni.MachineStatusLabelConnected)
+
+		machineDoc := MachineStatusDocument{
+			ID:                machine.Metadata().ID(),
+			Stage:             machineSpec.Stage.String(),
+			Ready:             machineSpec.Ready,
+			Connected:         connected,
+			ConfigUpToDate:    machineSpec.ConfigUpToDate,
+			ConfigApplyStatus: machineSpec.ConfigApplyStatus.String(),
+			LastError:         machineSpec.LastConfigError,
+			TalosVersion:      talosVersions[machine.Metadata().ID()],
+		}
+
+		degraded = degraded || !connected || machineSpec.ConfigApplyStatus == specs.ConfigApplyStatus_FAILED
+
+		machineSetID, _ := machine.Metadata().Labels().Get(omni.LabelMachineSet)
+
+		if machineSet, ok := machineSets[machineSetID]; ok {
+			machineSet.Machines = append(machineSet.Machines, machineDoc)
+		}
+	}
+
+	for _, machineSet := range machineSets {
+		slices.SortFunc(machineSet.Machines, func(a, b MachineStatusDocument) int { return cmp.Compare(a.ID, b.ID) })
+
+		doc.MachineSets = append(doc.MachineSets, *machineSet)
+	}
+
+	// control plane first, then by ID as in the tree
+	slices.SortFunc(doc.MachineSets, func(a, b MachineSetStatusDocument) int {
+		return cmp.Or(cmp.Compare(roleOrder(a.Role), roleOrder(b.Role)), cmp.Compare(a.ID, b.ID))
+	})
+
+	switch {
+	case ready:
+		doc.Condition = ClusterConditionReady
+	case degraded:
+		doc.Condition = ClusterConditionDegraded
+	default:
+		doc.Condition = ClusterConditionNotReady
+	}
+
+	return doc
+}
+
+func machineCounts(machines *specs.Machines) MachineCounts {
+	return MachineCounts{
+		Total:     machines.GetTotal(),
+		Healthy:   machines.GetHealthy(),
+		Connected: machines.GetConnected(),
+		Requested: machines.GetRequested(),
+	}
+}
+
+func roleOrder(role string) int {
+	if role == "controlplane" {
+		return 0
+	}
+
+	return 1
+}
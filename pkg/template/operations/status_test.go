@@ -0,0 +1,327 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	omniresources "github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/operations"
+)
+
+const statusCluster = "status"
+
+// statusState creates a running cluster with one control plane and one worker machine.
+func statusState(ctx context.Context, t *testing.T) state.State {
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	clusterStatus := omni.NewClusterStatus(omniresources.DefaultNamespace, statusCluster)
+	clusterStatus.TypedSpec().Value.Phase = specs.ClusterStatusSpec_RUNNING
+	clusterStatus.TypedSpec().Value.Ready = true
+	clusterStatus.TypedSpec().Value.KubernetesAPIReady = true
+	clusterStatus.TypedSpec().Value.ControlplaneReady = true
+	clusterStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 2, Healthy: 2, Connected: 2, Requested: 2}
+
+	require.NoError(t, st.Create(ctx, clusterStatus))
+
+	for _, machineSetID := range []string{omni.ControlPlanesResourceID(statusCluster), omni.WorkersResourceID(statusCluster)} {
+		machineSetStatus := omni.NewMachineSetStatus(omniresources.DefaultNamespace, machineSetID)
+		machineSetStatus.Metadata().Labels().Set(omni.LabelCluster, statusCluster)
+		machineSetStatus.TypedSpec().Value.Phase = specs.MachineSetPhase_Running
+		machineSetStatus.TypedSpec().Value.Ready = true
+		machineSetStatus.TypedSpec().Value.Machines = &specs.Machines{Total: 1, Healthy: 1, Connected: 1, Requested: 1}
+
+		if machineSetID == omni.ControlPlanesResourceID(statusCluster) {
+			machineSetStatus.Metadata().Labels().Set(omni.LabelControlPlaneRole, "")
+		}
+
+		require.NoError(t, st.Create(ctx, machineSetStatus))
+
+		clusterMachineStatus := omni.NewClusterMachineStatus(omniresources.DefaultNamespace, machineSetID+"-machine")
+		clusterMachineStatus.Metadata().Labels().Set(omni.LabelCluster, statusCluster)
+		clusterMachineStatus.Metadata().Labels().Set(omni.LabelMachineSet, machineSetID)
+		clusterMachineStatus.Metadata().Labels().Set(omni.MachineStatusLabelConnected, "")
+		clusterMachineStatus.TypedSpec().Value.Stage = specs.ClusterMachineStatusSpec_RUNNING
+		clusterMachineStatus.TypedSpec().Value.Ready = true
+		clusterMachineStatus.TypedSpec().Value.ConfigUpToDate = true
+		clusterMachineStatus.TypedSpec().Value.ConfigApplyStatus = specs.ConfigApplyStatus_APPLIED
+
+		require.NoError(t, st.Create(ctx, clusterMachineStatus))
+	}
+
+	return st
+}
+
+func TestStatusClusterDocument(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	var out strings.Builder
+
+	require.NoError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{Format: operations.StatusFormatJSON}))
+
+	var doc operations.StatusDocument
+
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &doc))
+
+	assert.Equal(t, operations.ClusterConditionReady, doc.Condition)
+	assert.Equal(t, "RUNNING", doc.Phase)
+	assert.True(t, doc.KubernetesAPIReady)
+	assert.Equal(t, operations.MachineCounts{Total: 2, Healthy: 2, Connected: 2, Requested: 2}, doc.Machines)
+	require.Len(t, doc.MachineSets, 2)
+	assert.Equal(t, "controlplane", doc.MachineSets[0].Role)
+	assert.Equal(t, "worker", doc.MachineSets[1].Role)
+	require.Len(t, doc.MachineSets[1].Machines, 1)
+	assert.Equal(t, operations.MachineStatusDocument{
+		ID:                omni.WorkersResourceID(statusCluster) + "-machine",
+		Stage:             "RUNNING",
+		Ready:             true,
+		Connected:         true,
+		ConfigUpToDate:    true,
+		ConfigApplyStatus: "APPLIED",
+	}, doc.MachineSets[1].Machines[0])
+
+	// the worker fails to apply the config and becomes unreachable
+	clusterMachineStatus, err := st.Get(ctx, omni.NewClusterMachineStatus(omniresources.DefaultNamespace, omni.WorkersResourceID(statusCluster)+"-machine").Metadata())
+	require.NoError(t, err)
+
+	clusterMachineStatus.Metadata().Labels().Delete(omni.MachineStatusLabelConnected)
+	clusterMachineStatus.(*omni.ClusterMachineStatus).TypedSpec().Value.ConfigApplyStatus = specs.ConfigApplyStatus_FAILED //nolint:forcetypeassert
+	clusterMachineStatus.(*omni.ClusterMachineStatus).TypedSpec().Value.LastConfigError = "invalid config"                 //nolint:forcetypeassert
+	require.NoError(t, st.Update(ctx, clusterMachineStatus))
+
+	machineSetStatus, err := st.Get(ctx, omni.NewMachineSetStatus(omniresources.DefaultNamespace, omni.WorkersResourceID(statusCluster)).Metadata())
+	require.NoError(t, err)
+
+	machineSetStatus.(*omni.MachineSetStatus).TypedSpec().Value.Ready = false //nolint:forcetypeassert
+	require.NoError(t, st.Update(ctx, machineSetStatus))
+
+	out.Reset()
+
+	err = operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{Format: operations.StatusFormatYAML})
+
+	var statusErr *operations.StatusError
+
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, operations.StatusExitCodeDegraded, statusErr.ExitCode())
+	assert.EqualError(t, err, `cluster "status" is degraded`)
+
+	doc = operations.StatusDocument{}
+
+	require.NoError(t, yaml.Unmarshal([]byte(out.String()), &doc))
+
+	assert.Equal(t, operations.ClusterConditionDegraded, doc.Condition)
+	assert.False(t, doc.MachineSets[1].Ready)
+	assert.False(t, doc.MachineSets[1].Machines[0].Connected)
+	assert.Equal(t, "invalid config", doc.MachineSets[1].Machines[0].LastError)
+}
+
+func TestStatusClusterConditions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	var out strings.Builder
+
+	// scaling up is not ready
+	clusterStatus, err := st.Get(ctx, omni.NewClusterStatus(omniresources.DefaultNamespace, statusCluster).Metadata())
+	require.NoError(t, err)
+
+	clusterStatus.(*omni.ClusterStatus).TypedSpec().Value.Phase = specs.ClusterStatusSpec_SCALING_UP //nolint:forcetypeassert
+	require.NoError(t, st.Update(ctx, clusterStatus))
+
+	err = operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{Quiet: true})
+
+	var statusErr *operations.StatusError
+
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, operations.ClusterConditionNotReady, statusErr.Condition)
+	assert.Equal(t, operations.StatusExitCodeNotReady, statusErr.ExitCode())
+	assert.Empty(t, out.String())
+
+	// missing cluster is reported without waiting for the timeout
+	err = operations.StatusCluster(ctx, "missing", &out, st, operations.StatusOptions{Format: operations.StatusFormatJSON})
+
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, operations.StatusExitCodeNotFound, statusErr.ExitCode())
+	assert.EqualError(t, err, `cluster "missing" not found`)
+	assert.Contains(t, out.String(), `"condition": "notFound"`)
+
+	// waiting for the missing cluster times out with the not found condition
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	t.Cleanup(waitCancel)
+
+	err = operations.StatusCluster(waitCtx, "missing", &out, st, operations.StatusOptions{Wait: true, Quiet: true})
+
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, operations.ClusterConditionNotFound, statusErr.Condition)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.EqualError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{Format: "xml"}), `unknown status format "xml"`)
+}
+
+func TestStatusClusterSections(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	kubernetesStatus := omni.NewKubernetesStatus(omniresources.DefaultNamespace, statusCluster)
+	kubernetesStatus.TypedSpec().Value.Nodes = []*specs.KubernetesStatusSpec_NodeStatus{
+		{Nodename: "cp-1", KubeletVersion: "v1.29.1", Ready: true},
+		{Nodename: "worker-1", KubeletVersion: "v1.29.0", Ready: false},
+	}
+	kubernetesStatus.TypedSpec().Value.StaticPods = []*specs.KubernetesStatusSpec_NodeStaticPods{
+		{
+			Nodename: "cp-1",
+			StaticPods: []*specs.KubernetesStatusSpec_StaticPodStatus{
+				{App: "kube-apiserver", Version: "v1.29.1", Ready: true},
+			},
+		},
+	}
+
+	manifestStatus := omni.NewKubernetesUpgradeManifestStatus(omniresources.DefaultNamespace, statusCluster)
+	manifestStatus.TypedSpec().Value.OutOfSync = 2
+
+	backupStatus := omni.NewEtcdBackupStatus(statusCluster)
+	backupStatus.TypedSpec().Value.Status = specs.EtcdBackupStatusSpec_Error
+	backupStatus.TypedSpec().Value.Error = "bucket not found"
+
+	imagePullStatus := omni.NewImagePullStatus(omniresources.DefaultNamespace, statusCluster)
+	imagePullStatus.TypedSpec().Value.ProcessedCount = 3
+	imagePullStatus.TypedSpec().Value.TotalCount = 10
+
+	task := omni.NewOngoingTask(omniresources.DefaultNamespace, "talos-upgrade-"+statusCluster)
+	task.TypedSpec().Value.Title = "Talos Upgrade"
+	task.TypedSpec().Value.Details = &specs.OngoingTaskSpec_TalosUpgrade{
+		TalosUpgrade: &specs.TalosUpgradeStatusSpec{Phase: specs.TalosUpgradeStatusSpec_Upgrading, Step: "upgrading machine"},
+	}
+
+	otherTask := omni.NewOngoingTask(omniresources.DefaultNamespace, "talos-upgrade-other")
+	otherTask.TypedSpec().Value.Title = "Other Upgrade"
+
+	for _, r := range []resource.Resource{kubernetesStatus, manifestStatus, backupStatus, imagePullStatus, task, otherTask} {
+		require.NoError(t, st.Create(ctx, r))
+	}
+
+	var out strings.Builder
+
+	require.NoError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{}))
+
+	assert.NotContains(t, out.String(), "Kubernetes (")
+	assert.NotContains(t, out.String(), "Task")
+
+	out.Reset()
+
+	require.NoError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{
+		Sections: operations.StatusSections{Kubernetes: true, EtcdBackup: true, ImagePull: true, Tasks: true},
+	}))
+
+	assert.Equal(t, `Cluster "status" RUNNING Ready (2/2) (healthy/total)
+├── Task "Talos Upgrade" Upgrading upgrading machine
+├── Kubernetes Not Ready (1/2) (ready/total nodes)
+│   ├── Node "cp-1" v1.29.1 Ready
+│   │   └── kube-apiserver v1.29.1 Ready
+│   ├── Node "worker-1" v1.29.0 Not Ready
+│   └── Manifests 2 Out of Sync
+├── Etcd Backup Error Error: bucket not found
+├── Image Pull Pulling (3/10) (pulled/total images)
+├── Control Plane "status-control-planes" Running Ready (1/1)
+│   └── Machine "status-control-planes-machine" RUNNING Ready
+└── Workers "status-workers" Running Ready (1/1)
+    └── Machine "status-workers-machine" RUNNING Ready
+`, out.String())
+}
+
+func TestStatusClusterFor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	st := statusState(ctx, t)
+
+	for _, machineSetID := range []string{omni.ControlPlanesResourceID(statusCluster), omni.WorkersResourceID(statusCluster)} {
+		configStatus := omni.NewClusterMachineConfigStatus(omniresources.DefaultNamespace, machineSetID+"-machine")
+		configStatus.Metadata().Labels().Set(omni.LabelCluster, statusCluster)
+		configStatus.TypedSpec().Value.TalosVersion = "1.6.4"
+
+		require.NoError(t, st.Create(ctx, configStatus))
+	}
+
+	parse := func(exprs ...string) []*operations.StatusCondition {
+		conditions := make([]*operations.StatusCondition, 0, len(exprs))
+
+		for _, expr := range exprs {
+			condition, err := operations.ParseStatusCondition(expr)
+			require.NoError(t, err)
+
+			conditions = append(conditions, condition)
+		}
+
+		return conditions
+	}
+
+	var out strings.Builder
+
+	require.NoError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{
+		Quiet: true,
+		For: parse(
+			"condition=ready",
+			"jsonpath={.machineSets[*].machines[*].talosVersion}=1.6.4",
+			`jsonpath={.machineSets[?(@.id=="status-workers")].counts.healthy}>=1`,
+		),
+	}))
+
+	err := operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{
+		Quiet: true,
+		For:   parse("jsonpath={.machineSets[*].machines[*].talosVersion}=1.7.0", "delete"),
+	})
+
+	var statusErr *operations.StatusError
+
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, operations.StatusExitCodeNotReady, statusErr.ExitCode())
+	assert.EqualError(t, err, `cluster "status" is ready, conditions not met: jsonpath={.machineSets[*].machines[*].talosVersion}=1.7.0, delete`)
+
+	// the cluster is destroyed while waiting
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+
+		assert.NoError(t, st.Destroy(ctx, omni.NewClusterStatus(omniresources.DefaultNamespace, statusCluster).Metadata()))
+	}()
+
+	require.NoError(t, operations.StatusCluster(ctx, statusCluster, &out, st, operations.StatusOptions{
+		Quiet: true,
+		Wait:  true,
+		For:   parse("delete"),
+	}))
+
+	for expr, expectedErr := range map[string]string{
+		"condition=healthy": `unknown cluster condition "healthy"`,
+		"delete=now":        `unexpected value in wait condition "delete=now"`,
+		"jsonpath={.phase":  "unbalanced braces",
+		"phase=Running":     `unknown wait condition "phase=Running"`,
+	} {
+		_, err = operations.ParseStatusCondition(expr)
+		assert.ErrorContains(t, err, expectedErr)
+	}
+}
@@ -0,0 +1,98 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package operations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/jsonpath"
+)
+
+// StatusCondition is a condition to wait for in the status operations, see ParseStatusCondition.
+type StatusCondition struct {
+	jsonPath  *jsonpath.Condition
+	condition ClusterCondition
+	raw       string
+}
+
+// ParseStatusCondition parses the wait condition over the cluster status:
+//
+//   - condition=<ready|notReady|degraded|notFound> holds when the cluster has the condition,
+//   - delete holds when the cluster doesn't exist, the same as condition=notFound,
+//   - jsonpath=<expr>[<op><value>] evaluates the JSONPath expression over the StatusDocument,
+//     e.g. jsonpath={.kubernetesUpgrade.phase}=Done, see jsonpath.ParseCondition for the operators.
+func ParseStatusCondition(s string) (*StatusCondition, error) {
+	kind, value, _ := strings.Cut(s, "=")
+
+	switch kind {
+	case "condition":
+		switch condition := ClusterCondition(value); condition {
+		case ClusterConditionReady, ClusterConditionNotReady, ClusterConditionDegraded, ClusterConditionNotFound:
+			return &StatusCondition{condition: condition, raw: s}, nil
+		default:
+			return nil, fmt.Errorf("unknown cluster condition %q, expected one of: %s, %s, %s, %s", value,
+				ClusterConditionReady, ClusterConditionNotReady, ClusterConditionDegraded, ClusterConditionNotFound)
+		}
+	case "delete":
+		if value != "" {
+			return nil, fmt.Errorf("unexpected value in wait condition %q", s)
+		}
+
+		return &StatusCondition{condition: ClusterConditionNotFound, raw: s}, nil
+	case "jsonpath":
+		condition, err := jsonpath.ParseCondition(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &StatusCondition{jsonPath: condition, raw: s}, nil
+	default:
+		return nil, fmt.Errorf("unknown wait condition %q, expected condition=<condition>, delete or jsonpath=<expr>[<op><value>]", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (condition *StatusCondition) String() string {
+	return condition.raw
+}
+
+// checkConditions returns *StatusError if any condition doesn't hold, the default condition is the cluster being ready.
+func checkConditions(doc *StatusDocument, conditions []*StatusCondition) (*StatusError, error) {
+	if len(conditions) == 0 {
+		if doc.Condition == ClusterConditionReady {
+			return nil, nil //nolint:nilnil
+		}
+
+		return &StatusError{Cluster: doc.Cluster, Condition: doc.Condition}, nil
+	}
+
+	data, err := jsonpath.Normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var unmet []string
+
+	for _, condition := range conditions {
+		matches := doc.Condition == condition.condition
+
+		if condition.jsonPath != nil {
+			if matches, err = condition.jsonPath.Matches(data); err != nil {
+				return nil, err
+			}
+		}
+
+		if !matches {
+			unmet = append(unmet, condition.String())
+		}
+	}
+
+	if len(unmet) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &StatusError{Cluster: doc.Cluster, Condition: doc.Condition, Unmet: unmet}, nil
+}
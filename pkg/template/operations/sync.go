@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/state"
@@ -27,8 +26,22 @@ type SyncOptions struct {
 	// Verbose indicates that diff for each resource should be printed.
 	Verbose bool
 
+	// DiffFormat is the format of the diff printed in the verbose mode, defaults to DiffFormatText.
+	DiffFormat DiffFormat
+
 	// DestroyMachines forcefully remove the disconnected nodes from Omni.
 	DestroyMachines bool
+
+	// Rollout configures the staged rollout of the changes.
+	Rollout RolloutOptions
+
+	// NoRollback disables the rollback of the applied changes (created and updated resources) if the sync fails.
+	//
+	// Torn down resources are never restored, they are listed in the rollback report.
+	NoRollback bool
+
+	// SchematicResolver creates the schematics for the schematic customizations in the template.
+	SchematicResolver template.SchematicResolver
 }
 
 // SyncTemplate performs resource sync to Omni.
@@ -42,6 +55,20 @@ func SyncTemplate(ctx context.Context, templateReader io.Reader, out io.Writer,
 		return err
 	}
 
+	return syncTemplate(ctx, tmpl, out, st, syncOptions)
+}
+
+func syncTemplate(ctx context.Context, tmpl *template.Template, out io.Writer, st state.State, syncOptions SyncOptions) error {
+	resolver := syncOptions.SchematicResolver
+	if syncOptions.DryRun {
+		// dry run doesn't create the schematics
+		resolver = template.SchematicLookup{State: st}
+	}
+
+	if err := resolveTemplate(ctx, tmpl, st, resolver); err != nil {
+		return err
+	}
+
 	syncResult, err := tmpl.Sync(ctx, st)
 	if err != nil {
 		return fmt.Errorf("error syncing template: %w", err)
@@ -53,7 +80,53 @@ func SyncTemplate(ctx context.Context, templateReader io.Reader, out io.Writer,
 	//  3. delete resources last
 	//
 	// this follows the idea of a scaling up first
+	//
+	// with the staged rollout, steps 1 and 2 are done one machine set at a time
+	//
+	// if any step fails, the applied changes are rolled back using the journal,
+	// the deletions are not rolled back, as the teardown resets the machines, so they are only reported
+
+	journal := &syncJournal{}
+
+	if err = syncApply(ctx, tmpl, syncResult, journal, out, st, syncOptions); err == nil {
+		err = syncDelete(ctx, syncResult, journal, out, st, syncOptions)
+	}
+
+	if err != nil {
+		if syncOptions.NoRollback || syncOptions.DryRun || journal.empty() {
+			return err
+		}
+
+		return journal.rollback(ctx, err, out, st)
+	}
+
+	return nil
+}
+
+// syncApply creates and updates the resources, recording the applied changes in the journal.
+func syncApply(ctx context.Context, tmpl *template.Template, syncResult *template.SyncResult, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
+	if !syncOptions.Rollout.Staged {
+		if err := syncCreate(ctx, syncResult.Create, journal, out, st, syncOptions); err != nil {
+			return err
+		}
+
+		return syncUpdate(ctx, syncResult.Update, journal, out, st, syncOptions)
+	}
+
+	clusterName, err := tmpl.ClusterName()
+	if err != nil {
+		return err
+	}
+
+	stages, err := planRollout(tmpl, syncResult, syncOptions.Rollout)
+	if err != nil {
+		return err
+	}
+
+	return syncStaged(ctx, clusterName, stages, journal, out, st, syncOptions)
+}
 
+func syncCreate(ctx context.Context, toCreate []resource.Resource, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
 	yellow := color.New(color.FgYellow)
 	boldFunc := color.New(color.Bold).SprintfFunc()
 
@@ -62,11 +135,11 @@ func SyncTemplate(ctx context.Context, templateReader io.Reader, out io.Writer,
 		dryRun = " (dry run)"
 	}
 
-	for _, r := range syncResult.Create {
+	for _, r := range toCreate {
 		yellow.Fprintf(out, "* creating%s %s\n", dryRun, boldFunc(utils.Describe(r))) //nolint:errcheck
 
 		if syncOptions.Verbose {
-			if err = utils.RenderDiff(out, nil, r); err != nil {
+			if err := renderDiff(out, nil, r, syncOptions.DiffFormat); err != nil {
 				return err
 			}
 		}
@@ -75,16 +148,40 @@ func SyncTemplate(ctx context.Context, templateReader io.Reader, out io.Writer,
 			continue
 		}
 
-		if err = st.Create(ctx, r); err != nil {
+		if err := st.Create(ctx, r); err != nil {
 			return err
 		}
+
+		journal.recordCreate(r)
 	}
 
-	for _, p := range syncResult.Update {
+	return nil
+}
+
+func syncUpdate(ctx context.Context, toUpdate []template.UpdateChange, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
+	yellow := color.New(color.FgYellow)
+	red := color.New(color.FgRed)
+	boldFunc := color.New(color.Bold).SprintfFunc()
+
+	dryRun := ""
+	if syncOptions.DryRun {
+		dryRun = " (dry run)"
+	}
+
+	for _, p := range toUpdate {
+		drift, err := p.Drift()
+		if err != nil {
+			return err
+		}
+
+		if drift.LiveModified {
+			red.Fprintf(out, "! %s was modified outside of the template, the changes will be overwritten\n", boldFunc(utils.Describe(p.Old))) //nolint:errcheck
+		}
+
 		yellow.Fprintf(out, "* updating%s %s\n", dryRun, boldFunc(utils.Describe(p.New))) //nolint:errcheck
 
 		if syncOptions.Verbose {
-			if err = utils.RenderDiff(os.Stdout, p.Old, p.New); err != nil {
+			if err = renderDiff(out, p.Old, p.New, syncOptions.DiffFormat); err != nil {
 				return err
 			}
 		}
@@ -96,14 +193,17 @@ func SyncTemplate(ctx context.Context, templateReader io.Reader, out io.Writer,
 		if err = st.Update(ctx, p.New); err != nil {
 			return err
 		}
+
+		journal.recordUpdate(p)
 	}
 
-	return syncDelete(ctx, syncResult, out, st, syncOptions)
+	return nil
 }
 
-func syncDelete(ctx context.Context, syncResult *template.SyncResult, out io.Writer, st state.State, syncOptions SyncOptions) error {
+// syncDelete tears down the resources phase by phase, recording the torn down resources in the journal, if it is not nil.
+func syncDelete(ctx context.Context, syncResult *template.SyncResult, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
 	for _, phase := range syncResult.Destroy {
-		if err := syncDeleteResources(ctx, phase, out, st, syncOptions); err != nil {
+		if err := syncDeleteResources(ctx, phase, journal, out, st, syncOptions); err != nil {
 			return err
 		}
 	}
@@ -112,7 +212,7 @@ func syncDelete(ctx context.Context, syncResult *template.SyncResult, out io.Wri
 }
 
 //nolint:gocognit,gocyclo,cyclop
-func syncDeleteResources(ctx context.Context, toDelete []resource.Resource, out io.Writer, st state.State, syncOptions SyncOptions) error {
+func syncDeleteResources(ctx context.Context, toDelete []resource.Resource, journal *syncJournal, out io.Writer, st state.State, syncOptions SyncOptions) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -143,7 +243,7 @@ func syncDeleteResources(ctx context.Context, toDelete []resource.Resource, out
 		yellow.Fprintf(out, "* tearing down%s %s\n", dryRun, boldFunc(utils.Describe(r))) //nolint:errcheck
 
 		if syncOptions.Verbose {
-			if err := utils.RenderDiff(os.Stdout, r, nil); err != nil {
+			if err := renderDiff(out, r, nil, syncOptions.DiffFormat); err != nil {
 				return err
 			}
 		}
@@ -156,6 +256,8 @@ func syncDeleteResources(ctx context.Context, toDelete []resource.Resource, out
 			return err
 		}
 
+		journal.recordDelete(r)
+
 		tearingDownResources[utils.Describe(r)] = struct{}{}
 	}
 
@@ -196,3 +298,26 @@ func syncDeleteResources(ctx context.Context, toDelete []resource.Resource, out
 
 	return nil
 }
+
+// resolveTemplate resolves the schematic customizations, the install disk selectors and the network link selectors of the template, if there are any.
+func resolveTemplate(ctx context.Context, tmpl *template.Template, st state.State, resolver template.SchematicResolver) error {
+	if tmpl.NeedsSchematics() {
+		if resolver == nil {
+			return fmt.Errorf("template has schematic customizations, but no schematic resolver is configured")
+		}
+
+		if err := tmpl.ResolveSchematics(ctx, st, resolver); err != nil {
+			return fmt.Errorf("error resolving schematics: %w", err)
+		}
+	}
+
+	if err := tmpl.ResolveInstallDisks(ctx, st); err != nil {
+		return fmt.Errorf("error resolving install disks: %w", err)
+	}
+
+	if err := tmpl.ResolveNetworkLinks(ctx, st); err != nil {
+		return fmt.Errorf("error resolving network links: %w", err)
+	}
+
+	return nil
+}
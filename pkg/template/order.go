@@ -7,6 +7,7 @@ package template
 import (
 	"cmp"
 	"fmt"
+	"math"
 	"slices"
 
 	"github.com/cosi-project/runtime/pkg/resource"
@@ -14,27 +15,91 @@ import (
 	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 )
 
-// Canonical order of resources in the generated list.
-var canonicalResourceOrder = map[resource.Type]int{
-	omni.ClusterType:        1,
-	omni.ConfigPatchType:    2,
-	omni.MachineSetType:     3,
-	omni.MachineSetNodeType: 4,
+// ResourceType declares how the resources of the type generated by the template are synced.
+type ResourceType struct {
+	// Type of the resource.
+	Type resource.Type
+
+	// Order of the resources in the generated list, resources are created and updated in the ascending order.
+	//
+	// Built-in resource types use orders 10 (Cluster), 15 (SchematicConfiguration), 20 (ConfigPatch), 30 (MachineSet), 40 (MachineSetNode).
+	Order int
+
+	// DeletionPhase of the resources, phases are destroyed in the ascending order, and each phase
+	// is fully destroyed before the next one starts.
+	//
+	// Built-in resource types use phases 0 (MachineSet, MachineSetNode) and 1 (Cluster, SchematicConfiguration, ConfigPatch).
+	DeletionPhase int
 }
 
-func sortResources[T any](s []T, mapper func(T) resource.Metadata) {
-	slices.SortStableFunc(s, func(a, b T) int {
-		orderI := canonicalResourceOrder[mapper(a).Type()]
-		orderJ := canonicalResourceOrder[mapper(b).Type()]
+// Canonical order and deletion phases of resources in the generated list.
+var resourceTypes = map[resource.Type]ResourceType{
+	omni.ClusterType:                {Type: omni.ClusterType, Order: 10, DeletionPhase: 1},
+	omni.SchematicConfigurationType: {Type: omni.SchematicConfigurationType, Order: 15, DeletionPhase: 1},
+	omni.ConfigPatchType:            {Type: omni.ConfigPatchType, Order: 20, DeletionPhase: 1},
+	omni.MachineSetType:             {Type: omni.MachineSetType, Order: 30, DeletionPhase: 0},
+	omni.MachineSetNodeType:         {Type: omni.MachineSetNodeType, Order: 40, DeletionPhase: 0},
+}
+
+// RegisterResourceType registers a resource type generated by the custom template kinds.
+//
+// Resources of the type should have the cluster label set, as they are looked up by the cluster label when syncing or deleting the template.
+// RegisterResourceType is not safe for concurrent use, it should be called during the initialization.
+func RegisterResourceType(resourceType ResourceType) error {
+	if _, ok := resourceTypes[resourceType.Type]; ok {
+		return fmt.Errorf("resource type %q already registered", resourceType.Type)
+	}
+
+	if resourceType.Order <= 0 {
+		return fmt.Errorf("resource type %q order should be positive", resourceType.Type)
+	}
+
+	if resourceType.DeletionPhase < 0 {
+		return fmt.Errorf("resource type %q deletion phase should not be negative", resourceType.Type)
+	}
+
+	resourceTypes[resourceType.Type] = resourceType
+
+	return nil
+}
+
+// ResourceTypes returns the types of the resources generated by the templates in the canonical order.
+func ResourceTypes() []resource.Type {
+	types := make([]resource.Type, 0, len(resourceTypes))
 
-		if orderI == 0 {
-			panic(fmt.Sprintf("unknown resource type %q", mapper(a).Type()))
-		}
+	for resourceType := range resourceTypes {
+		types = append(types, resourceType)
+	}
 
-		if orderJ == 0 {
-			panic(fmt.Sprintf("unknown resource type %q", mapper(b).Type()))
-		}
+	slices.SortFunc(types, func(a, b resource.Type) int {
+		return cmp.Compare(resourceOrder(a), resourceOrder(b))
+	})
+
+	return types
+}
+
+// resourceOrder returns the order of the resource type, unknown types go last.
+func resourceOrder(resourceType resource.Type) int {
+	if rt, ok := resourceTypes[resourceType]; ok {
+		return rt.Order
+	}
+
+	return math.MaxInt
+}
 
-		return cmp.Compare(orderI, orderJ)
+// deletionPhases returns the number of the deletion phases.
+func deletionPhases() int {
+	var phases int
+
+	for _, rt := range resourceTypes {
+		phases = max(phases, rt.DeletionPhase+1)
+	}
+
+	return phases
+}
+
+func sortResources[T any](s []T, mapper func(T) resource.Metadata) {
+	slices.SortStableFunc(s, func(a, b T) int {
+		return cmp.Compare(resourceOrder(mapper(a).Type()), resourceOrder(mapper(b).Type()))
 	})
 }
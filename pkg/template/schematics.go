@@ -0,0 +1,225 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/gen/xslices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/api/omni/management"
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template/internal/models"
+)
+
+// SchematicResolver creates Image Factory schematics, it is implemented by the Omni management client.
+type SchematicResolver interface {
+	CreateSchematic(ctx context.Context, req *management.CreateSchematicRequest) (*management.CreateSchematicResponse, error)
+}
+
+// SchematicLookup resolves the schematic customizations to the existing schematics without creating them,
+// it is used by the read-only operations.
+//
+// The schematic ID is computed from the customizations in the same way as the Image Factory does it.
+// If there is no existing schematic with that ID, the schematics without the extra kernel arguments and meta values are looked up
+// by the system extensions, as the Omni state keeps only the extensions of the schematics.
+type SchematicLookup struct {
+	State state.State
+}
+
+// CreateSchematic implements SchematicResolver.
+func (l SchematicLookup) CreateSchematic(ctx context.Context, req *management.CreateSchematicRequest) (*management.CreateSchematicResponse, error) {
+	schematicID, err := imageFactorySchematicID(req)
+	if err != nil {
+		return nil, err
+	}
+
+	schematics, err := safe.StateListAll[*omni.Schematic](ctx, l.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schematics: %w", err)
+	}
+
+	if _, found := schematics.Find(func(schematic *omni.Schematic) bool { return schematic.Metadata().ID() == schematicID }); found {
+		return &management.CreateSchematicResponse{SchematicId: schematicID}, nil
+	}
+
+	if len(req.ExtraKernelArgs) == 0 && len(req.MetaValues) == 0 {
+		extensions := sortedStrings(req.Extensions)
+
+		if schematic, found := schematics.Find(func(schematic *omni.Schematic) bool {
+			return slices.Equal(sortedStrings(schematic.TypedSpec().Value.Extensions), extensions)
+		}); found {
+			return &management.CreateSchematicResponse{SchematicId: schematic.Metadata().ID()}, nil
+		}
+	}
+
+	// the schematic will be created by the sync
+	return &management.CreateSchematicResponse{SchematicId: schematicID}, nil
+}
+
+// imageFactorySchematicID returns the ID of the schematic, which is the hash of the schematic in the Image Factory format.
+func imageFactorySchematicID(req *management.CreateSchematicRequest) (string, error) {
+	type metaValue struct {
+		Key   uint8  `yaml:"key"`
+		Value string `yaml:"value"`
+	}
+
+	var schematic struct {
+		Customization struct {
+			ExtraKernelArgs  []string    `yaml:"extraKernelArgs,omitempty"`
+			Meta             []metaValue `yaml:"meta,omitempty"`
+			SystemExtensions struct {
+				OfficialExtensions []string `yaml:"officialExtensions,omitempty"`
+			} `yaml:"systemExtensions,omitempty"`
+		} `yaml:"customization"`
+	}
+
+	schematic.Customization.ExtraKernelArgs = req.ExtraKernelArgs
+	schematic.Customization.SystemExtensions.OfficialExtensions = req.Extensions
+
+	for key, value := range req.MetaValues {
+		schematic.Customization.Meta = append(schematic.Customization.Meta, metaValue{Key: uint8(key), Value: value})
+	}
+
+	slices.SortFunc(schematic.Customization.Meta, func(a, b metaValue) int { return cmp.Compare(a.Key, b.Key) })
+
+	raw, err := yaml.Marshal(schematic)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func sortedStrings(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+
+	return s
+}
+
+// NeedsSchematics returns true if the template has schematic customizations which should be resolved before the translation.
+func (t *Template) NeedsSchematics() bool {
+	return len(t.models.Schematics()) > 0
+}
+
+// ResolveSchematics resolves the schematic customizations of the template into the schematic IDs.
+//
+// The system extensions are validated against the extensions available for the Talos version of the cluster.
+func (t *Template) ResolveSchematics(ctx context.Context, st state.State, resolver SchematicResolver) error {
+	schematics := t.models.Schematics()
+	if len(schematics) == 0 {
+		return nil
+	}
+
+	talosVersion, err := t.models.TalosVersion()
+	if err != nil {
+		return err
+	}
+
+	if err = validateExtensions(ctx, st, talosVersion, schematics); err != nil {
+		return err
+	}
+
+	schematicIDs := make(map[string]string, len(schematics))
+
+	for _, schematic := range schematics {
+		key := schematic.Key()
+
+		if _, ok := schematicIDs[key]; ok {
+			continue
+		}
+
+		resp, err := resolver.CreateSchematic(ctx, &management.CreateSchematicRequest{
+			Extensions:      schematic.SystemExtensions,
+			ExtraKernelArgs: schematic.ExtraKernelArgs,
+			MetaValues:      schematic.Meta,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating schematic: %w", err)
+		}
+
+		schematicIDs[key] = resp.SchematicId
+	}
+
+	t.schematicIDs = schematicIDs
+
+	return nil
+}
+
+func validateExtensions(ctx context.Context, st state.State, talosVersion string, schematics []models.Schematic) error {
+	if !slices.ContainsFunc(schematics, func(s models.Schematic) bool { return len(s.SystemExtensions) > 0 }) {
+		return nil
+	}
+
+	extensions, err := safe.StateGet[*omni.TalosExtensions](ctx, st, omni.NewTalosExtensions(resources.DefaultNamespace, strings.TrimLeft(talosVersion, "v")).Metadata())
+	if err != nil {
+		return fmt.Errorf("failed to get extensions for Talos version %q: %w", talosVersion, err)
+	}
+
+	available := xslices.ToSet(xslices.Map(extensions.TypedSpec().Value.Items, func(info *specs.TalosExtensionsSpec_Info) string {
+		return info.Name
+	}))
+
+	var (
+		multiErr error
+		reported = map[string]struct{}{}
+	)
+
+	for _, schematic := range schematics {
+		for _, extension := range schematic.SystemExtensions {
+			if _, ok := available[extension]; ok {
+				continue
+			}
+
+			if _, ok := reported[extension]; ok {
+				continue
+			}
+
+			reported[extension] = struct{}{}
+
+			err := fmt.Errorf("system extension %q is not available for Talos version %q", extension, talosVersion)
+
+			if suggestion := suggestExtension(available, extension); suggestion != "" {
+				err = fmt.Errorf("%w, did you mean %q?", err, suggestion)
+			}
+
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+
+	return multiErr
+}
+
+// suggestExtension returns the full name of the extension if it is the only one matching the name without the prefix.
+func suggestExtension(available map[string]struct{}, extension string) string {
+	var matches []string
+
+	for name := range available {
+		if strings.HasSuffix(name, "/"+extension) {
+			matches = append(matches, name)
+		}
+	}
+
+	if len(matches) != 1 {
+		return ""
+	}
+
+	return matches[0]
+}
@@ -0,0 +1,201 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/api/omni/management"
+	"github.com/siderolabs/omni-client/api/omni/specs"
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/cluster-schematics.yaml
+var clusterSchematics []byte
+
+type fakeSchematicResolver struct {
+	requests []*management.CreateSchematicRequest
+}
+
+func (r *fakeSchematicResolver) CreateSchematic(_ context.Context, req *management.CreateSchematicRequest) (*management.CreateSchematicResponse, error) {
+	r.requests = append(r.requests, req)
+
+	return &management.CreateSchematicResponse{SchematicId: fmt.Sprintf("schematic-%d", len(r.requests))}, nil
+}
+
+func TestSchematics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	tmpl, err := template.Load(bytes.NewReader(clusterSchematics))
+	require.NoError(t, err)
+
+	require.NoError(t, tmpl.Validate())
+	require.True(t, tmpl.NeedsSchematics())
+
+	_, err = tmpl.Translate()
+	require.ErrorContains(t, err, `schematic for "schematics" is not resolved`)
+
+	// the offline translation skips the schematic configurations
+	offlineResources, err := tmpl.TranslateOffline()
+	require.NoError(t, err)
+
+	for _, r := range offlineResources {
+		assert.NotEqual(t, omni.SchematicConfigurationType, r.Metadata().Type())
+	}
+
+	resolver := &fakeSchematicResolver{}
+
+	require.ErrorContains(t, tmpl.ResolveSchematics(ctx, st, resolver), `failed to get extensions for Talos version "v1.6.4"`)
+
+	extensions := omni.NewTalosExtensions(resources.DefaultNamespace, "1.6.4")
+	extensions.TypedSpec().Value.Items = []*specs.TalosExtensionsSpec_Info{
+		{Name: "siderolabs/iscsi-tools"},
+	}
+
+	require.NoError(t, st.Create(ctx, extensions))
+
+	err = tmpl.ResolveSchematics(ctx, st, resolver)
+	require.ErrorContains(t, err, `system extension "siderolabs/util-linux-tools" is not available for Talos version "v1.6.4"`)
+
+	extensions.TypedSpec().Value.Items = append(extensions.TypedSpec().Value.Items, &specs.TalosExtensionsSpec_Info{Name: "siderolabs/util-linux-tools"})
+
+	require.NoError(t, st.Update(ctx, extensions))
+	require.NoError(t, tmpl.ResolveSchematics(ctx, st, resolver))
+
+	// equal customizations are resolved once
+	require.Len(t, resolver.requests, 3)
+	assert.Equal(t, []string{"siderolabs/util-linux-tools", "siderolabs/iscsi-tools"}, resolver.requests[1].Extensions)
+	assert.Equal(t, []string{"console=ttyS0"}, resolver.requests[1].ExtraKernelArgs)
+	assert.Equal(t, map[uint32]string{0xa: `{"externalIPs":["10.5.0.2"]}`}, resolver.requests[2].MetaValues)
+
+	resourceList, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	var schematicConfigurations []string
+
+	for _, r := range resourceList {
+		if schematicConfiguration, ok := r.(*omni.SchematicConfiguration); ok {
+			cluster, _ := r.Metadata().Labels().Get(omni.LabelCluster)
+
+			assert.Equal(t, "schematics", cluster)
+
+			schematicConfigurations = append(schematicConfigurations, strings.Join([]string{
+				r.Metadata().ID(),
+				schematicConfiguration.TypedSpec().Value.Target.String(),
+				schematicConfiguration.TypedSpec().Value.SchematicId,
+			}, " "))
+		}
+	}
+
+	assert.Equal(t, []string{
+		"schematics Cluster schematic-1",
+		"schematics-workers MachineSet schematic-2",
+		"5f3b8f8c-7d0e-4a4c-9b5f-2c6d8e9f0a1b ClusterMachine schematic-1",
+		"b1ed45d8-4e79-4a07-a29a-b1b075843d41 ClusterMachine schematic-3",
+	}, schematicConfigurations)
+}
+
+func TestSchematicLookup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	existing := omni.NewSchematic(resources.DefaultNamespace, "existing")
+	existing.TypedSpec().Value.Extensions = []string{"siderolabs/util-linux-tools", "siderolabs/iscsi-tools"}
+
+	require.NoError(t, st.Create(ctx, existing))
+
+	lookup := template.SchematicLookup{State: st}
+
+	for _, tt := range []struct {
+		req      *management.CreateSchematicRequest
+		name     string
+		expected string
+	}{
+		{
+			name:     "vanilla",
+			req:      &management.CreateSchematicRequest{},
+			expected: "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba",
+		},
+		{
+			name:     "same extensions",
+			req:      &management.CreateSchematicRequest{Extensions: []string{"siderolabs/iscsi-tools", "siderolabs/util-linux-tools"}},
+			expected: "existing",
+		},
+		{
+			name: "kernel args",
+			req: &management.CreateSchematicRequest{
+				Extensions:      []string{"siderolabs/iscsi-tools", "siderolabs/util-linux-tools"},
+				ExtraKernelArgs: []string{"console=ttyS0"},
+			},
+			expected: "1bea4c94a8bc9ae01726ff1b2a178382bca5b4a69e1abab8b72f082f68cb976f",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := lookup.CreateSchematic(ctx, tt.req)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, resp.SchematicId)
+		})
+	}
+
+	// the lookup doesn't create the schematics
+	schematics, err := safe.StateListAll[*omni.Schematic](ctx, st)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, schematics.Len())
+}
+
+func TestSchematicsSuggestion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	extensions := omni.NewTalosExtensions(resources.DefaultNamespace, "1.6.4")
+	extensions.TypedSpec().Value.Items = []*specs.TalosExtensionsSpec_Info{
+		{Name: "siderolabs/iscsi-tools"},
+		{Name: "siderolabs/util-linux-tools"},
+	}
+
+	require.NoError(t, st.Create(ctx, extensions))
+
+	tmpl, err := template.Load(strings.NewReader(`kind: Cluster
+name: suggestion
+kubernetes:
+  version: v1.29.1
+talos:
+  version: v1.6.4
+systemExtensions:
+  - iscsi-tools
+meta:
+  0x0: invalid
+`))
+	require.NoError(t, err)
+
+	require.ErrorContains(t, tmpl.Validate(), "meta key 0x0 is not allowed")
+
+	err = tmpl.ResolveSchematics(ctx, st, &fakeSchematicResolver{})
+	require.ErrorContains(t, err, `system extension "iscsi-tools" is not available for Talos version "v1.6.4", did you mean "siderolabs/iscsi-tools"?`)
+}
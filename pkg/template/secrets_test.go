@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package template_test
+
+import (
+	"bytes"
+	_ "embed"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+//go:embed testdata/cluster-secrets.yaml
+var clusterSecrets []byte
+
+func TestSecrets(t *testing.T) {
+	keyFile, err := filepath.Abs("testdata/age-key.txt")
+	require.NoError(t, err)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir("testdata"))
+
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	tmpl, err := template.Load(bytes.NewReader(clusterSecrets))
+	require.NoError(t, err)
+
+	t.Run("missing secrets", func(t *testing.T) {
+		t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+
+		err := tmpl.Validate()
+		require.Error(t, err)
+
+		assert.ErrorContains(t, err, `failed to access "patches/registry-auth.sops.yaml": failed to decrypt: Failed to get the data key required to decrypt the SOPS file`)
+		assert.ErrorContains(t, err, `failed to access "patches/hostname.yaml.age": failed to decrypt: error reading age keys file`)
+		assert.ErrorContains(t, err, `error resolving secret at "machine.registries.config.gcr.io.auth.identityToken": environment variable "TEST_REGISTRY_TOKEN" is not set`)
+	})
+
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+	t.Setenv("TEST_REGISTRY_TOKEN", "gcr-token")
+
+	require.NoError(t, tmpl.Validate())
+
+	resources, err := tmpl.Translate()
+	require.NoError(t, err)
+
+	patches := map[string]string{}
+
+	for _, r := range resources {
+		if patch, ok := r.(*omni.ConfigPatch); ok {
+			patches[patch.Metadata().ID()] = patch.TypedSpec().Value.GetData()
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"200-cluster-secrets-patches/registry-auth.sops.yaml": `machine:
+  registries:
+    config:
+      ghcr.io:
+        auth:
+          username: robot
+          password: s3cr3t
+  sysctls:
+    net.core.somaxconn: "1024"
+`,
+		"201-cluster-secrets-registry-auth": `machine:
+    registries:
+        config:
+            gcr.io:
+                auth:
+                    identityToken: gcr-token
+            quay.io:
+                auth:
+                    password: quay-password
+                    username: robot
+`,
+		"400-cm-9e0c7a1d-3b4f-4c2e-8d6a-5f1b2c3d4e5f-patches/hostname.yaml.age": `machine:
+  network:
+    hostname: secret-host
+`,
+	}, patches)
+}
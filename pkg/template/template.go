@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/cosi-project/runtime/pkg/resource"
 	"github.com/cosi-project/runtime/pkg/state"
@@ -25,20 +26,45 @@ import (
 // Template is a cluster template.
 type Template struct {
 	models models.List
+
+	// schematicIDs maps schematic customization keys to the schematic IDs, see ResolveSchematics.
+	schematicIDs map[string]string
+
+	// installDisks are the install disks of the machines with disk selectors, see ResolveInstallDisks.
+	installDisks map[models.MachineID]string
+
+	// networkLinks are the hardware addresses of the network links of the machines with link selectors, see ResolveNetworkLinks.
+	networkLinks map[models.MachineID]string
+
+	// imports are the files imported by the Jsonnet template file, see LoadFleetFile.
+	imports []string
 }
 
 // Load the template from input.
 func Load(input io.Reader) (*Template, error) {
+	modelList, err := decodeModels(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{models: modelList}, nil
+}
+
+// decodeModels decodes all documents from the input.
+//
+// The input is a multi-document YAML, or a JSON (YAML) array of documents, e.g. the output of Jsonnet.
+// Errors in the array elements are reported by the document index.
+func decodeModels(input io.Reader) (models.List, error) {
 	dec := yaml.NewDecoder(input)
 
-	var template Template
+	var modelList models.List
 
 	for {
 		var docNode yaml.Node
 
 		if err := dec.Decode(&docNode); err != nil {
 			if errors.Is(err, io.EOF) {
-				return &template, nil
+				return modelList, nil
 			}
 
 			return nil, fmt.Errorf("error decoding template: %w", err)
@@ -52,32 +78,61 @@ func Load(input io.Reader) (*Template, error) {
 			return nil, fmt.Errorf("unexpected number of nodes %d", len(docNode.Content))
 		}
 
-		kind, err := findKind(docNode.Content[0])
-		if err != nil {
-			return nil, fmt.Errorf("error in document at line %d:%d: %w", docNode.Line, docNode.Column, err)
-		}
+		if docNode.Content[0].Kind != yaml.SequenceNode {
+			model, err := decodeModel(docNode.Content[0], fmt.Sprintf("document at line %d:%d", docNode.Line, docNode.Column))
+			if err != nil {
+				return nil, err
+			}
 
-		model, err := models.New(kind)
-		if err != nil {
-			return nil, fmt.Errorf("error in document at line %d:%d: %w", docNode.Line, docNode.Column, err)
-		}
+			modelList = append(modelList, model)
 
-		// YAML decoder doesn't allow to decode with KnownFields: true from a Node
-		// so we do a roundtrip to bytes and back :sigh:
-		raw, err := yaml.Marshal(docNode.Content[0])
-		if err != nil {
-			return nil, fmt.Errorf("error marshaling document at line %d:%d: %w", docNode.Line, docNode.Column, err)
+			continue
 		}
 
-		documentDecoder := yaml.NewDecoder(bytes.NewReader(raw))
-		documentDecoder.KnownFields(true)
+		for _, node := range docNode.Content[0].Content {
+			model, err := decodeModel(node, fmt.Sprintf("document %d", len(modelList)))
+			if err != nil {
+				return nil, err
+			}
 
-		if err = documentDecoder.Decode(model); err != nil {
-			return nil, fmt.Errorf("error decoding document at line %d:%d: %w", docNode.Line, docNode.Column, err)
+			modelList = append(modelList, model)
 		}
+	}
+}
+
+// decodeModel decodes a single document with the known fields check, location describes the document in the errors.
+func decodeModel(node *yaml.Node, location string) (models.Model, error) {
+	kind, err := findKind(node)
+	if err != nil {
+		return nil, fmt.Errorf("error in %s: %w", location, err)
+	}
+
+	model, err := models.New(kind)
+	if err != nil {
+		return nil, fmt.Errorf("error in %s: %w", location, err)
+	}
 
-		template.models = append(template.models, model)
+	// YAML decoder doesn't allow to decode with KnownFields: true from a Node
+	// so we do a roundtrip to bytes and back :sigh:
+	raw, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s: %w", location, err)
+	}
+
+	documentDecoder := yaml.NewDecoder(bytes.NewReader(raw))
+	documentDecoder.KnownFields(true)
+
+	var target any = model
+
+	if custom, ok := model.(*customModel); ok {
+		target = custom.Model
 	}
+
+	if err = documentDecoder.Decode(target); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", location, err)
+	}
+
+	return model, nil
 }
 
 func findKind(node *yaml.Node) (string, error) {
@@ -123,14 +178,62 @@ func WithCluster(clusterName string) *Template {
 	}
 }
 
+// SetDir sets the directory the relative file paths in the template are resolved against, e.g. the directory of the template file.
+//
+// By default, the relative paths are resolved against the working directory.
+func (t *Template) SetDir(dir string) {
+	t.models.SetDir(dir)
+}
+
+// Files returns the local files and directories referenced by the template: the patch and manifest files,
+// the Helm charts, the files of the secret placeholders, and the files imported by the Jsonnet template.
+func (t *Template) Files() []string {
+	files := t.models.Files()
+	files = append(files, t.imports...)
+
+	slices.Sort(files)
+
+	return slices.Compact(files)
+}
+
 // Validate the template.
 func (t *Template) Validate() error {
 	return t.models.Validate()
 }
 
 // Translate the template into resources.
+//
+// The schematic customizations, the install disk selectors and the network link selectors should be resolved before the translation.
 func (t *Template) Translate() ([]resource.Resource, error) {
-	return t.models.Translate()
+	return t.translate(false)
+}
+
+// TranslateOffline translates the template into resources without the Omni state.
+//
+// The resources generated from the unresolved settings are skipped: the schematic configurations,
+// the install disk patches of the machines with the disk selectors, and the network patches of the machines with the link selectors.
+func (t *Template) TranslateOffline() ([]resource.Resource, error) {
+	return t.translate(true)
+}
+
+func (t *Template) translate(skipUnresolved bool) ([]resource.Resource, error) {
+	resourceList, err := t.models.Translate(models.Resolved{
+		SchematicIDs:   t.schematicIDs,
+		InstallDisks:   t.installDisks,
+		NetworkLinks:   t.networkLinks,
+		SkipUnresolved: skipUnresolved,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range resourceList {
+		if _, ok := resourceTypes[r.Metadata().Type()]; !ok {
+			return nil, fmt.Errorf("resource %s has unregistered type, use RegisterResourceType to register it", resource.String(r))
+		}
+	}
+
+	return resourceList, nil
 }
 
 // ClusterName returns the name of the cluster associated with the template.
@@ -156,11 +259,11 @@ func (t *Template) actualResources(ctx context.Context, st state.State) ([]resou
 		actualResources = append(actualResources, clusterResource)
 	}
 
-	for _, resourceType := range []resource.Type{
-		omni.MachineSetType,
-		omni.MachineSetNodeType,
-		omni.ConfigPatchType,
-	} {
+	for resourceType := range resourceTypes {
+		if resourceType == omni.ClusterType {
+			continue
+		}
+
 		items, err := st.List(
 			ctx,
 			resource.NewMetadata(resources.DefaultNamespace, resourceType, "", resource.VersionUndefined),
@@ -182,15 +285,16 @@ func (t *Template) actualResources(ctx context.Context, st state.State) ([]resou
 }
 
 func splitResourcesToDelete(toDelete []resource.Resource) [][]resource.Resource {
-	phases := make([][]resource.Resource, 2)
+	phases := make([][]resource.Resource, deletionPhases())
 
 	for _, r := range deduplicateDeletion(toDelete) {
-		switch r.Metadata().Type() {
-		case omni.MachineSetNodeType, omni.MachineSetType:
-			phases[0] = append(phases[0], r)
-		default:
-			phases[1] = append(phases[1], r)
+		phase := len(phases) - 1
+
+		if rt, ok := resourceTypes[r.Metadata().Type()]; ok {
+			phase = rt.DeletionPhase
 		}
+
+		phases[phase] = append(phases[phase], r)
 	}
 
 	for i := range phases {
@@ -252,7 +356,15 @@ func (t *Template) Sync(ctx context.Context, st state.State) (*SyncResult, error
 			expectedResource.Metadata().SetCreated(actualResource.Metadata().Created())
 			expectedResource.Metadata().Finalizers().Set(*actualResource.Metadata().Finalizers())
 
+			if lastApplied, ok := actualResource.Metadata().Annotations().Get(omni.LastAppliedTemplateHash); ok {
+				expectedResource.Metadata().Annotations().Set(omni.LastAppliedTemplateHash, lastApplied)
+			}
+
 			if !resource.Equal(actualResource, expectedResource) {
+				if err = setLastApplied(expectedResource); err != nil {
+					return nil, err
+				}
+
 				syncResult.Update = append(syncResult.Update, UpdateChange{Old: actualResource, New: expectedResource})
 			}
 		} else {
@@ -278,6 +390,10 @@ func (t *Template) Sync(ctx context.Context, st state.State) (*SyncResult, error
 				return nil, fmt.Errorf("resource %s already exists from cluster %q, but template is for cluster %q", resource.String(actualResource), clusterLabel, clusterName)
 			}
 
+			if err = setLastApplied(expectedResource); err != nil {
+				return nil, err
+			}
+
 			syncResult.Create = append(syncResult.Create, expectedResource)
 		}
 	}
@@ -307,7 +423,7 @@ func deduplicateDeletion(toDelete []resource.Resource) []resource.Resource {
 			if _, ok := toDeleteMap[metadataKey(resource.NewMetadata(resources.DefaultNamespace, omni.MachineSetType, machineSetName, resource.VersionUndefined))]; ok {
 				return false
 			}
-		default:
+		case omni.MachineSetType, omni.ConfigPatchType:
 			clusterName, ok := r.Metadata().Labels().Get(omni.LabelCluster)
 			if !ok {
 				return true
@@ -316,6 +432,9 @@ func deduplicateDeletion(toDelete []resource.Resource) []resource.Resource {
 			if _, ok := toDeleteMap[metadataKey(resource.NewMetadata(resources.DefaultNamespace, omni.ClusterType, clusterName, resource.VersionUndefined))]; ok {
 				return false
 			}
+		default:
+			// resources of the custom types are not torn down with the cluster, so they are always destroyed explicitly
+			return true
 		}
 
 		return true
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/safe"
 	"github.com/cosi-project/runtime/pkg/state"
 	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
 	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
@@ -23,6 +24,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 
+	"github.com/siderolabs/omni-client/pkg/omni/resources"
+	"github.com/siderolabs/omni-client/pkg/omni/resources/omni"
 	"github.com/siderolabs/omni-client/pkg/template"
 )
 
@@ -439,3 +442,77 @@ func TestDelete(t *testing.T) {
 	assert.Len(t, syncDelete.Destroy[0], 0)
 	assert.Len(t, syncDelete.Destroy[1], 1)
 }
+
+func TestDrift(t *testing.T) {
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir("testdata"))
+	t.Cleanup(func() {
+		os.Chdir(cwd) //nolint:errcheck
+	})
+
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	ctx := context.Background()
+
+	templ1, err := template.Load(bytes.NewReader(cluster1))
+	require.NoError(t, err)
+
+	sync1, err := templ1.Sync(ctx, st)
+	require.NoError(t, err)
+
+	for _, r := range sync1.Create {
+		require.NoError(t, st.Create(ctx, r))
+	}
+
+	// modify the cluster outside of the template
+	_, err = safe.StateUpdateWithConflicts(ctx, st, omni.NewCluster(resources.DefaultNamespace, "my-first-cluster").Metadata(), func(res *omni.Cluster) error {
+		res.TypedSpec().Value.KubernetesVersion = "1.18.3"
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	// same template: the out-of-band change is detected
+	sync1, err = templ1.Sync(ctx, st)
+	require.NoError(t, err)
+
+	require.Len(t, sync1.Update, 1)
+
+	drift, err := sync1.Update[0].Drift()
+	require.NoError(t, err)
+
+	assert.Equal(t, template.Drift{LiveModified: true}, drift)
+
+	// updated template: the cluster is changed on both sides, the install disk only in the template
+	templ2, err := template.Load(bytes.NewReader(cluster2))
+	require.NoError(t, err)
+
+	sync2, err := templ2.Sync(ctx, st)
+	require.NoError(t, err)
+
+	drifts := map[string]template.Drift{}
+
+	for _, u := range sync2.Update {
+		drifts[resource.String(u.New)], err = u.Drift()
+		require.NoError(t, err)
+	}
+
+	assert.True(t, drifts["Clusters.omni.sidero.dev(default/my-first-cluster)"].Conflict())
+	assert.Equal(t, template.Drift{TemplateModified: true}, drifts["ConfigPatches.omni.sidero.dev(default/000-cm-430d882a-51a8-48b3-ae00-90c5b0b5b0b0-install-disk)"])
+
+	// resources removed from the template
+	for _, r := range sync2.Destroy[1] {
+		drift, err = template.ResourceDrift(r, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, template.Drift{TemplateModified: true}, drift)
+	}
+
+	// resources without last applied state
+	drift, err = template.ResourceDrift(omni.NewCluster(resources.DefaultNamespace, "my-first-cluster"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, template.Drift{Untracked: true}, drift)
+}
@@ -0,0 +1,286 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package templatetest provides golden file tests of cluster templates which don't need an Omni instance.
+//
+// The template is translated and synced against an in-memory state seeded with the existing resources,
+// and the resulting resources and the sync plan are compared with the golden file:
+//
+//	func TestTemplates(t *testing.T) {
+//		templatetest.Run(t, templatetest.Case{
+//			Template: "testdata/prod.yaml",
+//			State:    "testdata/prod-resources.yaml",
+//		})
+//	}
+//
+// Golden files are updated with `go test ./... -update-golden`.
+package templatetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosi-project/runtime/pkg/resource"
+	"github.com/cosi-project/runtime/pkg/resource/protobuf"
+	"github.com/cosi-project/runtime/pkg/state"
+	"github.com/cosi-project/runtime/pkg/state/impl/inmem"
+	"github.com/cosi-project/runtime/pkg/state/impl/namespaced"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"github.com/siderolabs/gen/xslices"
+	"gopkg.in/yaml.v3"
+
+	"github.com/siderolabs/omni-client/pkg/cosi/diff"
+	"github.com/siderolabs/omni-client/pkg/template"
+)
+
+// UpdateGolden makes Run rewrite the golden files instead of comparing with them.
+var UpdateGolden = flag.Bool("update-golden", false, "update the golden files of the cluster template tests")
+
+// Case is a golden file test of a cluster template.
+type Case struct {
+	// SchematicResolver resolves the schematic customizations, defaults to the lookup of the existing schematics in the state.
+	SchematicResolver template.SchematicResolver
+
+	// Template is the path to the cluster template.
+	Template string
+
+	// State is the path to the YAML file with the existing resources, e.g. machine statuses or the resources of the cluster
+	// created by the previous version of the template. The state is empty if not set.
+	State string
+
+	// Golden is the path to the golden file, defaults to the template path with the .golden.yaml extension.
+	Golden string
+
+	// Jsonnet are the variables of the Jsonnet template.
+	Jsonnet template.JsonnetOptions
+}
+
+// golden is the contents of the golden file.
+type golden struct {
+	// Resources are the resources translated from the template.
+	Resources []any `yaml:"resources"`
+
+	// Sync is the plan of the sync against the existing resources.
+	Sync goldenSync `yaml:"sync"`
+}
+
+type goldenSync struct {
+	// Update lists the structural diff of each updated resource.
+	Update map[string][]string `yaml:"update,omitempty"`
+
+	// Create lists the resources to create.
+	Create []string `yaml:"create,omitempty"`
+
+	// Destroy lists the resources to destroy by phases.
+	Destroy [][]string `yaml:"destroy,omitempty"`
+}
+
+// Run the golden file test cases, each case is a subtest named after the template.
+//
+// Relative patch and manifest paths in the templates are resolved against the working directory of the test.
+func Run(t *testing.T, cases ...Case) {
+	t.Helper()
+
+	for _, c := range cases {
+		t.Run(c.Template, func(t *testing.T) {
+			goldenPath := c.GoldenPath()
+
+			actual, err := Render(context.Background(), c)
+			if err != nil {
+				t.Fatalf("error rendering template %q: %s", c.Template, err)
+			}
+
+			if *UpdateGolden {
+				if err = os.WriteFile(goldenPath, actual, 0o644); err != nil {
+					t.Fatalf("error updating golden file: %s", err)
+				}
+
+				return
+			}
+
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("error reading golden file, run with -update-golden to create it: %s", err)
+			}
+
+			if !bytes.Equal(expected, actual) {
+				t.Errorf("template %q doesn't match golden file %q, run with -update-golden to update it:\n%s", c.Template, goldenPath, lineDiff(string(expected), string(actual)))
+			}
+		})
+	}
+}
+
+// GoldenPath returns the path to the golden file of the case.
+func (c Case) GoldenPath() string {
+	if c.Golden != "" {
+		return c.Golden
+	}
+
+	return strings.TrimSuffix(c.Template, filepath.Ext(c.Template)) + ".golden.yaml"
+}
+
+// Render loads, translates and syncs the template, and returns the contents of the golden file.
+func Render(ctx context.Context, c Case) ([]byte, error) {
+	st, err := buildState(ctx, c.State)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := c.loadTemplate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tmpl.Validate(); err != nil {
+		return nil, err
+	}
+
+	if tmpl.NeedsSchematics() {
+		var resolver template.SchematicResolver = template.SchematicLookup{State: st}
+		if c.SchematicResolver != nil {
+			resolver = c.SchematicResolver
+		}
+
+		if err = tmpl.ResolveSchematics(ctx, st, resolver); err != nil {
+			return nil, fmt.Errorf("error resolving schematics: %w", err)
+		}
+	}
+
+	if err = tmpl.ResolveInstallDisks(ctx, st); err != nil {
+		return nil, fmt.Errorf("error resolving install disks: %w", err)
+	}
+
+	if err = tmpl.ResolveNetworkLinks(ctx, st); err != nil {
+		return nil, fmt.Errorf("error resolving network links: %w", err)
+	}
+
+	resources, err := tmpl.Translate()
+	if err != nil {
+		return nil, fmt.Errorf("error translating template: %w", err)
+	}
+
+	var result golden
+
+	for _, r := range resources {
+		// zero timestamps for reproducibility
+		r.Metadata().SetCreated(time.Time{})
+		r.Metadata().SetUpdated(time.Time{})
+
+		m, err := resource.MarshalYAML(r)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Resources = append(result.Resources, m)
+	}
+
+	syncResult, err := tmpl.Sync(ctx, st)
+	if err != nil {
+		return nil, fmt.Errorf("error syncing template: %w", err)
+	}
+
+	result.Sync.Create = xslices.Map(syncResult.Create, resource.String)
+
+	for _, phase := range syncResult.Destroy {
+		result.Sync.Destroy = append(result.Sync.Destroy, xslices.Map(phase, resource.String))
+	}
+
+	if len(syncResult.Update) > 0 {
+		result.Sync.Update = make(map[string][]string, len(syncResult.Update))
+	}
+
+	for _, update := range syncResult.Update {
+		changes, err := diff.Compute(update.Old, update.New)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Sync.Update[resource.String(update.New)] = xslices.Map(changes, diff.Change.String)
+	}
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err = enc.Encode(result); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c Case) loadTemplate(ctx context.Context) (*template.Template, error) {
+	if template.IsJsonnet(c.Template) {
+		evaluated, err := template.EvaluateJsonnet(ctx, c.Template, c.Jsonnet)
+		if err != nil {
+			return nil, err
+		}
+
+		return template.Load(evaluated)
+	}
+
+	f, err := os.Open(c.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return template.Load(f)
+}
+
+// buildState creates an in-memory state with the resources from the YAML file.
+func buildState(ctx context.Context, path string) (state.State, error) {
+	st := state.WrapCore(namespaced.NewState(inmem.Build))
+
+	if path == "" {
+		return st, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	dec := yaml.NewDecoder(f)
+
+	for {
+		var res protobuf.YAMLResource
+
+		if err = dec.Decode(&res); err != nil {
+			if errors.Is(err, io.EOF) {
+				return st, nil
+			}
+
+			return nil, fmt.Errorf("error decoding state %q: %w", path, err)
+		}
+
+		r := res.Resource()
+
+		if err = st.Create(ctx, r, state.WithCreateOwner(r.Metadata().Owner())); err != nil {
+			return nil, fmt.Errorf("error creating %s: %w", resource.String(r), err)
+		}
+	}
+}
+
+// lineDiff returns the unified diff between the expected and actual output.
+func lineDiff(expected, actual string) string {
+	edits := myers.ComputeEdits(span.URIFromPath("golden"), expected, actual)
+
+	return fmt.Sprint(gotextdiff.ToUnified("golden", "actual", expected, edits))
+}
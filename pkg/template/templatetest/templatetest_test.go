@@ -0,0 +1,18 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package templatetest_test
+
+import (
+	"testing"
+
+	"github.com/siderolabs/omni-client/pkg/template/templatetest"
+)
+
+func TestRun(t *testing.T) {
+	templatetest.Run(t, templatetest.Case{
+		Template: "testdata/cluster.yaml",
+		State:    "testdata/cluster-resources.yaml",
+	})
+}